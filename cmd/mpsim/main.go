@@ -0,0 +1,39 @@
+// Comando mpsim sobe o simulador do Mercado Pago para desenvolvimento local.
+// Aponte o serviço para ele com MERCADO_PAGO_BASE_URL=http://localhost:8081.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/integration/mercadopago/mpsim"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"go.uber.org/zap"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "endereço HTTP do simulador")
+	webhookURL := flag.String("webhook-url", "http://localhost:8080/v1/webhooks/mercadopago", "URL que recebe os webhooks; vazio desativa")
+	outcome := flag.String("outcome", string(mpsim.OutcomeApprove), "resultado padrão das cobranças: approve, reject, pending ou error")
+	settleAfter := flag.Duration("settle-after", 3*time.Second, "tempo até liquidar cada cobrança; 0 exige POST /_sim/orders/{id}/settle")
+	flag.Parse()
+
+	sim := mpsim.NewServer(mpsim.Config{
+		AccessToken:    os.Getenv("MERCADO_PAGO_ACCESS_TOKEN"),
+		WebhookURL:     *webhookURL,
+		WebhookSecret:  os.Getenv("MERCADO_PAGO_WEBHOOK_SECRET"),
+		DefaultOutcome: mpsim.Outcome(*outcome),
+		SettleAfter:    *settleAfter,
+	})
+
+	logger.Info("mercadopago simulator listening",
+		zap.String("addr", *addr),
+		zap.String("webhook_url", *webhookURL),
+		zap.String("default_outcome", *outcome),
+	)
+	if err := http.ListenAndServe(*addr, sim); err != nil {
+		logger.Fatal("failed to run simulator", zap.Error(err))
+	}
+}
@@ -0,0 +1,154 @@
+// Comando pagamento-admin reúne as tarefas de operação do serviço.
+//
+//	pagamento-admin migrate   cria ou atualiza as tabelas do DynamoDB (índices
+//	                          e TTL incluídos) e aplica as migrações de dados;
+//	                          com PAYMENT_STORE=postgres aplica também as
+//	                          migrações do PostgreSQL
+//	pagamento-admin verify    confere as tabelas sem alterá-las
+//
+// Usa a mesma configuração do servidor (pacote internal/config), validando só
+// as seções aws, dynamodb e store.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	repo "github.com/alexssanderFonseca/pagamento/internal/repository/dynamodb"
+	"github.com/alexssanderFonseca/pagamento/internal/repository/postgres"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		logger.Info("No .env file found, relying on environment variables")
+	}
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load("aws", "dynamodb", "store")
+	if err != nil {
+		logger.Fatal("invalid configuration", zap.Error(err))
+	}
+
+	ctx := context.Background()
+	switch os.Args[1] {
+	case "migrate":
+		err = runMigrate(ctx, cfg, os.Args[2:])
+	case "verify":
+		err = runVerify(ctx, cfg, os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		logger.Error("command failed", zap.String("command", os.Args[1]), zap.Error(err))
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "uso: pagamento-admin <migrate|verify> [flags]")
+}
+
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	schemaOnly := flags.Bool("schema-only", false, "só cria e atualiza as tabelas, sem as migrações de dados")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newDynamoDBClient(ctx, cfg.AWS)
+	if err != nil {
+		return err
+	}
+	migrations := repo.Migrations()
+	if *schemaOnly {
+		migrations = nil
+	}
+	report, err := repo.NewSchemaManager(client, cfg.DynamoDB).Migrate(ctx, repo.Tables(cfg.DynamoDB), migrations)
+	for _, change := range report.Changes {
+		logger.Info("dynamodb schema updated", zap.String("change", change))
+	}
+	if len(report.Applied) > 0 {
+		logger.Info("dynamodb migrations applied", zap.Strings("versions", report.Applied))
+	}
+	if err != nil {
+		return err
+	}
+
+	if cfg.Store.PaymentStore == "postgres" {
+		pool, err := pgxpool.New(ctx, cfg.Store.DatabaseURL)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		applied, err := postgres.Migrate(ctx, pool)
+		if len(applied) > 0 {
+			logger.Info("postgres migrations applied", zap.Strings("versions", applied))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("migration finished")
+	return nil
+}
+
+func runVerify(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newDynamoDBClient(ctx, cfg.AWS)
+	if err != nil {
+		return err
+	}
+	schema := repo.NewSchemaManager(client, cfg.DynamoDB)
+	err = schema.Verify(ctx, repo.Tables(cfg.DynamoDB))
+	var schemaErr *repo.SchemaError
+	if errors.As(err, &schemaErr) {
+		for _, problem := range schemaErr.Problems {
+			logger.Warn("dynamodb schema problem", zap.String("problem", problem))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	pending, err := schema.PendingMigrations(ctx, repo.Migrations())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pending dynamodb migrations: %v", pending)
+	}
+	logger.Info("dynamodb schema is up to date")
+	return nil
+}
+
+func newDynamoDBClient(ctx context.Context, cfg config.AWS) (*dynamodb.Client, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, err
+	}
+	return dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	}), nil
+}
@@ -2,20 +2,33 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/alexssanderFonseca/pagamento/internal/api"
 	"github.com/alexssanderFonseca/pagamento/internal/api/handler"
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/health"
+	"github.com/alexssanderFonseca/pagamento/internal/lifecycle"
 	"github.com/alexssanderFonseca/pagamento/internal/telemetry"
 	"github.com/alexssanderFonseca/pagamento/internal/integration/mercadopago"
 	"github.com/alexssanderFonseca/pagamento/internal/integration/sns"
 	"github.com/alexssanderFonseca/pagamento/internal/logger"
 	repo "github.com/alexssanderFonseca/pagamento/internal/repository/dynamodb"
+	"github.com/alexssanderFonseca/pagamento/internal/repository/memory"
+	"github.com/alexssanderFonseca/pagamento/internal/repository/postgres"
 	"github.com/alexssanderFonseca/pagamento/internal/service"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 )
 
@@ -36,60 +49,299 @@ import (
 
 // @securityDefinitions.basic  BasicAuth
 
+// @securityDefinitions.apikey  AdminToken
+// @in                          header
+// @name                        Authorization
+// @description                 Token de administração no formato "Bearer <ADMIN_TOKEN>".
+
 func main() {
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		logger.Info("No .env file found, relying on environment variables")
 	}
 
-	ctx := context.Background()
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatal("invalid configuration", zap.Error(err))
+	}
+	logger.Info("configuration loaded", zap.Any("config", cfg.Redacted()))
+
+	// SIGTERM (Kubernetes) ou SIGINT encerram o serviço de forma ordenada.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// O runner para os componentes na ordem inversa do registro: primeiro o
+	// servidor HTTP, depois os workers e por último a telemetria.
+	runner := lifecycle.NewRunner(cfg.Server.ShutdownTimeout)
 
 	// Initialize Telemetry
-	shutdown, err := telemetry.InitProvider()
+	shutdown, err := telemetry.InitProvider(cfg.Telemetry)
 	if err != nil {
 		logger.Fatal("failed to initialize telemetry", zap.Error(err))
 	}
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			logger.Error("failed to shutdown telemetry", zap.Error(err))
-		}
-	}()
+	runner.OnStop("telemetry", shutdown)
 
 	// AWS Config
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(os.Getenv("AWS_REGION")),
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(cfg.AWS.Region),
 	)
 	if err != nil {
 		logger.Fatal("unable to load SDK config", zap.Error(err))
 	}
+	// Um span por chamada ao DynamoDB e ao SNS.
+	awsCfg.APIOptions = append(awsCfg.APIOptions, telemetry.AWSTracing(otel.GetTracerProvider()))
 
 	// DynamoDB Client
-	awsEndpoint := os.Getenv("AWS_ENDPOINT")
-	dbClient := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+	awsEndpoint := cfg.AWS.Endpoint
+	dbClient := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
 		if awsEndpoint != "" {
 			o.BaseEndpoint = aws.String(awsEndpoint)
 		}
-	})
+	}, repo.WithMetrics(otel.GetMeterProvider()))
 	
 	// SNS Client
-	snsClient := sns.NewClient(cfg)
+	snsClient := sns.NewClient(awsCfg, cfg.AWS.SNSTopicARN)
 
 	// Dependency Injection
-	paymentRepo := repo.NewPaymentRepository(dbClient)
-	mpClient := mercadopago.NewClient()
-	paymentService := service.NewPaymentService(paymentRepo, mpClient, snsClient)
+	prepareSchema(ctx, cfg, dbClient)
+	paymentRepo, outboxRepo, storeCheck, closeStore := newPaymentStore(ctx, cfg, dbClient)
+	runner.OnStop("payment store", func(context.Context) error {
+		closeStore()
+		return nil
+	})
+	idempotencyRepo := repo.NewIdempotencyRepository(dbClient, cfg.DynamoDB)
+	var notificationStore domain.NotificationStore = repo.NewNotificationRepository(dbClient, cfg.DynamoDB)
+	if cfg.Webhooks.DedupStore == "memory" {
+		notificationStore = memory.NewNotificationStore()
+	}
+	inboxRepo := repo.NewInboxRepository(dbClient, cfg.DynamoDB)
+	mpClient := mercadopago.NewClient(cfg.MercadoPago)
+	providers := service.NewProviders(mpClient)
+	if err := providers.SetDefault(cfg.Payments.Provider); err != nil {
+		logger.Fatal("invalid PAYMENT_PROVIDER", zap.Error(err))
+	}
+	referencePolicy, err := domain.ParseReferencePolicy(cfg.Payments.ReferencePolicy)
+	if err != nil {
+		logger.Fatal("invalid EXTERNAL_REFERENCE_POLICY", zap.Error(err))
+	}
+	serviceOpts := []service.Option{
+		service.WithIdempotencyStore(idempotencyRepo),
+		service.WithReferencePolicy(referencePolicy),
+		service.WithPaymentTTL(cfg.Payments.TTL),
+		service.WithNotificationStore(notificationStore, cfg.Webhooks.DedupTTL),
+	}
+	webhookAsync := cfg.Webhooks.Async
+	if webhookAsync {
+		serviceOpts = append(serviceOpts, service.WithWebhookInbox(inboxRepo))
+	}
+	paymentService := service.NewPaymentService(paymentRepo, providers, serviceOpts...)
+	reconciler := service.NewReconciler(paymentService, cfg.Reconciliation.Window)
+
+	// Subcomando de execução única: pagamento reconcile [-format json|csv] [-output arquivo]
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		err := runReconcile(ctx, reconciler, os.Args[2:])
+		if shutdownErr := runner.Shutdown(context.WithoutCancel(ctx)); shutdownErr != nil {
+			logger.Error("shutdown failed", zap.Error(shutdownErr))
+		}
+		if err != nil {
+			logger.Error("reconciliation failed", zap.Error(err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	outboxRelay := service.NewOutboxRelay(outboxRepo, snsClient)
+	expirationSweeper := service.NewExpirationSweeper(paymentRepo, providers, cfg.Expiration.Interval)
+	webhookWorker := service.NewWebhookWorker(inboxRepo, paymentService, cfg.Webhooks.Workers)
 	paymentHandler := handler.NewPaymentHandler(paymentService)
+	adminHandler := handler.NewAdminHandler(outboxRelay, webhookWorker)
+	readiness := health.NewReadiness(
+		readinessDependencies(cfg, dbClient, storeCheck, snsClient, mpClient),
+		health.WithCheckTimeout(cfg.Health.CheckTimeout),
+		health.WithCacheTTL(cfg.Health.CacheTTL),
+	)
+	healthHandler := handler.NewHealthHandler(readiness, mpClient.CircuitBreaker())
+
+	// Background workers: o relay é registrado primeiro para parar por
+	// último e publicar os eventos gravados pelos demais.
+	runner.Go("outbox relay", outboxRelay.Run)
+	if cfg.Expiration.Interval > 0 {
+		runner.Go("expiration sweeper", expirationSweeper.Run)
+	}
+	if webhookAsync {
+		runner.Go("webhook worker", webhookWorker.Run)
+	}
+	if interval := cfg.Reconciliation.Interval; interval > 0 {
+		runner.Go("reconciler", func(ctx context.Context) {
+			reconciler.Run(ctx, interval)
+		})
+	}
 
 	// Router initialization
-	r := api.SetupRouter(paymentHandler)
+	r := api.SetupRouter(paymentHandler, adminHandler, healthHandler, cfg.Admin.Token)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	port := cfg.Server.Port
+	runner.AddServer("http server", &http.Server{
+		Addr:         ":" + port,
+		Handler:      r,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	})
 
 	logger.Info("Server starting", zap.String("port", port))
-	if err := r.Run(":" + port); err != nil {
-		logger.Fatal("failed to run server", zap.Error(err))
+	if err := runner.Run(ctx); err != nil {
+		logger.Error("server stopped with errors", zap.Error(err))
+		os.Exit(1)
+	}
+	logger.Info("Server stopped")
+}
+
+func dynamoDBPaymentStore(cfg *config.Config) bool {
+	return cfg.Store.PaymentStore == "dynamodb"
+}
+
+// requiredTables lista as tabelas do DynamoDB usadas com a configuração atual.
+// Com o armazenamento de pagamentos no DynamoDB, as migrações de dados também
+// rodam, então entram a tabela de migrações e todas as que elas alteram (a
+// inbox inclusive, mesmo com WEBHOOK_ASYNC=false).
+func requiredTables(cfg *config.Config) []repo.TableSpec {
+	tables := []repo.TableSpec{repo.IdempotencyTable(cfg.DynamoDB)}
+	if dynamoDBPaymentStore(cfg) {
+		tables = append(tables, repo.PaymentTables(cfg.DynamoDB)...)
+	}
+	if cfg.Webhooks.DedupStore != "memory" {
+		tables = append(tables, repo.NotificationTable(cfg.DynamoDB))
+	}
+	if cfg.Webhooks.Async || dynamoDBPaymentStore(cfg) {
+		tables = append(tables, repo.InboxTable(cfg.DynamoDB))
+	}
+	if dynamoDBPaymentStore(cfg) {
+		tables = append(tables, repo.MigrationsTable(cfg.DynamoDB))
+	}
+	return tables
+}
+
+// prepareSchema aplica as migrações do DynamoDB (as mesmas do
+// pagamento-admin migrate) se MIGRATE_ON_START=true e interrompe a
+// inicialização se faltar alguma tabela ou índice.
+func prepareSchema(ctx context.Context, cfg *config.Config, dbClient *dynamodb.Client) {
+	schema := repo.NewSchemaManager(dbClient, cfg.DynamoDB)
+	tables := requiredTables(cfg)
+	var migrations []repo.Migration
+	if dynamoDBPaymentStore(cfg) {
+		migrations = repo.Migrations()
+	}
+
+	if cfg.Store.MigrateOnStart {
+		report, err := schema.Migrate(ctx, tables, migrations)
+		for _, change := range report.Changes {
+			logger.Info("dynamodb schema updated", zap.String("change", change))
+		}
+		if len(report.Applied) > 0 {
+			logger.Info("dynamodb migrations applied", zap.Strings("versions", report.Applied))
+		}
+		if err != nil {
+			logger.Fatal("failed to migrate dynamodb", zap.Error(err))
+		}
+	}
+
+	if err := schema.Verify(ctx, tables); err != nil {
+		logger.Fatal("dynamodb schema check failed, run pagamento-admin migrate", zap.Error(err))
+	}
+	if len(migrations) > 0 {
+		pending, err := schema.PendingMigrations(ctx, migrations)
+		if err != nil {
+			logger.Fatal("failed to read dynamodb migrations", zap.Error(err))
+		}
+		if len(pending) > 0 {
+			logger.Warn("dynamodb data migrations pending", zap.Strings("versions", pending))
+		}
+	}
+}
+
+// readinessDependencies lista o que a readiness probe confere. Só o
+// armazenamento é crítico: sem SNS o outbox acumula os eventos, e sem o
+// Mercado Pago as consultas e os webhooks continuam funcionando.
+func readinessDependencies(cfg *config.Config, dbClient *dynamodb.Client, storeCheck health.Checker, snsClient *sns.Client, mpClient *mercadopago.Client) []health.Dependency {
+	schema := repo.NewSchemaManager(dbClient, cfg.DynamoDB)
+	tables := requiredTables(cfg)
+	dependencies := []health.Dependency{
+		{Name: "dynamodb", Critical: true, Checker: health.CheckerFunc(func(ctx context.Context) error {
+			return schema.Ping(ctx, tables)
+		})},
+		{Name: "sns", Checker: health.CheckerFunc(snsClient.Ping)},
+		{Name: "mercadopago", Checker: health.CheckerFunc(mpClient.Ping)},
+		{Name: "mercadopago_circuit_breaker", Checker: health.BreakerChecker(mpClient.CircuitBreaker())},
+	}
+	if storeCheck != nil {
+		dependencies = append(dependencies, health.Dependency{Name: cfg.Store.PaymentStore, Critical: true, Checker: storeCheck})
+	}
+	return dependencies
+}
+
+// newPaymentStore escolhe onde ficam os pagamentos e o outbox, gravados
+// sempre juntos: PAYMENT_STORE=dynamodb (padrão), memory ou postgres, este com
+// a conexão de DATABASE_URL. O Checker confere o banco fora do DynamoDB na
+// readiness; é nil quando não há o que conferir.
+func newPaymentStore(ctx context.Context, cfg *config.Config, dbClient *dynamodb.Client) (domain.PaymentRepository, domain.OutboxRepository, health.Checker, func()) {
+	switch store := cfg.Store.PaymentStore; store {
+	case "dynamodb":
+		return repo.NewPaymentRepository(dbClient, cfg.DynamoDB), repo.NewOutboxRepository(dbClient, cfg.DynamoDB), nil, func() {}
+	case "memory":
+		paymentRepo := memory.NewPaymentRepository()
+		return paymentRepo, paymentRepo.Outbox(), nil, func() {}
+	case "postgres":
+		pool, err := pgxpool.New(ctx, cfg.Store.DatabaseURL)
+		if err != nil {
+			logger.Fatal("invalid DATABASE_URL", zap.Error(err))
+		}
+		if cfg.Store.MigrateOnStart {
+			applied, err := postgres.Migrate(ctx, pool)
+			if err != nil {
+				logger.Fatal("failed to apply postgres migrations", zap.Error(err))
+			}
+			if len(applied) > 0 {
+				logger.Info("postgres migrations applied", zap.Strings("versions", applied))
+			}
+		}
+		pending, err := postgres.PendingMigrations(ctx, pool)
+		if err != nil {
+			logger.Fatal("failed to read postgres migrations", zap.Error(err))
+		}
+		if len(pending) > 0 {
+			logger.Fatal("postgres migrations pending, run pagamento-admin migrate", zap.Strings("versions", pending))
+		}
+		return postgres.NewPaymentRepository(pool), postgres.NewOutboxRepository(pool), health.CheckerFunc(pool.Ping), pool.Close
+	default:
+		logger.Fatal("invalid PAYMENT_STORE", zap.String("store", store))
+		return nil, nil, nil, nil
+	}
+}
+
+func runReconcile(ctx context.Context, reconciler *service.Reconciler, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	format := flags.String("format", service.ReportFormatJSON, "formato do relatório: json ou csv")
+	output := flags.String("output", "", "arquivo do relatório (padrão: stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != service.ReportFormatJSON && *format != service.ReportFormatCSV {
+		return fmt.Errorf("unsupported report format %q", *format)
+	}
+
+	report, err := reconciler.Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
 	}
+	return service.WriteReconciliationReport(out, report, *format)
 }
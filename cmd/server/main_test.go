@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	repo "github.com/alexssanderFonseca/pagamento/internal/repository/dynamodb"
+)
+
+func tableNames(tables []repo.TableSpec) []string {
+	names := make([]string, 0, len(tables))
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	return names
+}
+
+func TestRequiredTables_MigrationsWithoutAsyncWebhooks(t *testing.T) {
+	cfg := config.Default()
+	cfg.Store.PaymentStore = "dynamodb"
+	cfg.Store.MigrateOnStart = true
+	cfg.Webhooks.Async = false
+
+	names := tableNames(requiredTables(&cfg))
+	for _, want := range []string{cfg.DynamoDB.Inbox, cfg.DynamoDB.Migrations} {
+		if !slices.Contains(names, want) {
+			t.Errorf("requiredTables() = %v, missing %q", names, want)
+		}
+	}
+}
+
+func TestRequiredTables_MemoryStoreSkipsMigrations(t *testing.T) {
+	cfg := config.Default()
+	cfg.Store.PaymentStore = "memory"
+	cfg.Webhooks.Async = false
+
+	names := tableNames(requiredTables(&cfg))
+	for _, unwanted := range []string{cfg.DynamoDB.Inbox, cfg.DynamoDB.Migrations} {
+		if slices.Contains(names, unwanted) {
+			t.Errorf("requiredTables() = %v, should not include %q", names, unwanted)
+		}
+	}
+}
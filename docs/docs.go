@@ -24,9 +24,707 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/log/nivel": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Nível mínimo dos logs em uso",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Consultar o nível de log",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.LogLevel"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Altera em execução o nível mínimo dos logs (debug, info, warn ou error). Vale só para a réplica que recebeu a requisição e até ela reiniciar",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Alterar o nível de log",
+                "parameters": [
+                    {
+                        "description": "Novo nível",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.LogLevel"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.LogLevel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/outbox/travados": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Eventos que falharam definitivamente ou estão pendentes há mais de older_than",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Listar eventos travados no outbox",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Idade mínima dos pendentes (ex.: 5m, 1h)",
+                        "name": "older_than",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Quantidade máxima de eventos (máx. 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.OutboxEvent"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/mortos": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Notificações de webhook que falharam em todas as tentativas de processamento",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Listar webhooks que esgotaram as tentativas",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Quantidade máxima de notificações (máx. 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.InboxNotification"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/{id}/reprocessar": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Devolve à fila uma notificação que esgotou as tentativas, com as tentativas zeradas",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reprocessar um webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID da notificação no inbox",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/domain.InboxNotification"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Retorna degraded, ainda com 200, quando algum disjuntor de dependência externa não está fechado",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Verificar a saúde do serviço",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/health/live": {
+            "get": {
+                "description": "Responde 200 enquanto o processo atende requisições, sem consultar as dependências",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/health/ready": {
+            "get": {
+                "description": "Confere as dependências (DynamoDB, SNS, Mercado Pago e disjuntores) e retorna o estado de cada uma. Responde 503 quando uma dependência crítica está fora do ar; as demais só deixam o status degraded",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    }
+                }
+            }
+        },
         "/pagamentos": {
+            "get": {
+                "description": "Lista pagamentos com filtros e paginação por cursor",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pagamentos"
+                ],
+                "summary": "Listar pagamentos",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Referência externa (ordem de serviço)",
+                        "name": "external_reference",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Status do pagamento",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Criado a partir de (RFC3339)",
+                        "name": "created_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Criado até (RFC3339)",
+                        "name": "created_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Atualizado a partir de (RFC3339)",
+                        "name": "updated_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Itens por página (máx. 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor da próxima página",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.PaymentPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Gera a cobrança (QR Code) no gateway para uma ordem de serviço. Uma ordem que já tem pagamento segue EXTERNAL_REFERENCE_POLICY: 409, o pagamento pendente existente ou uma nova tentativa após falha ou expiração",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pagamentos"
+                ],
+                "summary": "Criar um novo pagamento",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chave de idempotência da requisição",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Autor declarado pelo cliente, não autenticado; registrado em declared_actor no histórico de status",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Dados do Pagamento",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.CreatePaymentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Payment"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/pagamentos/{id}": {
+            "get": {
+                "description": "Retorna o pagamento e seu status atual",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pagamentos"
+                ],
+                "summary": "Consultar um pagamento",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do Pagamento",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Payment"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/pagamentos/{id}/cancelar": {
+            "post": {
+                "description": "Cancela no gateway a cobrança de um pagamento ainda não pago",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pagamentos"
+                ],
+                "summary": "Cancelar um pagamento",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do Pagamento",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Autor declarado pelo cliente, não autenticado; registrado em declared_actor no histórico de status",
+                        "name": "X-Actor",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Payment"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/pagamentos/{id}/historico": {
+            "get": {
+                "description": "Lista as mudanças de status do pagamento em ordem cronológica, com a origem (api, webhook, reconciliation, sweeper) e o status bruto do gateway",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pagamentos"
+                ],
+                "summary": "Consultar o histórico de status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do Pagamento",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.StatusHistoryEntry"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/pagamentos/{id}/reembolsos": {
             "post": {
-                "description": "Gera um QR Code no Mercado Pago para uma ordem de serviço",
+                "description": "Estorna total ou parcialmente um pagamento aprovado. Sem amount, estorna o saldo restante. O Idempotency-Key é obrigatório, e repetir a requisição com a mesma chave não estorna de novo; 503 indica um estorno feito no gateway que ainda não foi registrado e deve ser repetido com a mesma chave.",
                 "consumes": [
                     "application/json"
                 ],
@@ -36,15 +734,35 @@ const docTemplate = `{
                 "tags": [
                     "pagamentos"
                 ],
-                "summary": "Criar um novo pagamento",
+                "summary": "Estornar um pagamento",
                 "parameters": [
                     {
-                        "description": "Dados do Pagamento",
+                        "type": "string",
+                        "description": "ID do Pagamento",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chave de idempotência do estorno",
+                        "name": "Idempotency-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Autor declarado pelo cliente, não autenticado; registrado em declared_actor no histórico de status",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Dados do Estorno",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/domain.CreatePaymentRequest"
+                            "$ref": "#/definitions/domain.RefundRequest"
                         }
                     }
                 ],
@@ -64,6 +782,33 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -72,13 +817,22 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
-        "/webhooks/mercadopago": {
+        "/webhooks/{provider}": {
             "post": {
-                "description": "Processa o status do pagamento via webhook assinado",
+                "description": "Valida a notificação com o gateway indicado e a grava para processamento assíncrono (ou atualiza o status do pagamento na hora, sem inbox)",
                 "consumes": [
                     "application/json"
                 ],
@@ -88,22 +842,28 @@ const docTemplate = `{
                 "tags": [
                     "webhooks"
                 ],
-                "summary": "Receber notificação do Mercado Pago",
+                "summary": "Receber notificação de um gateway de pagamento",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Assinura HMAC-SHA256",
-                        "name": "X-Signature",
-                        "in": "header",
+                        "description": "Gateway de pagamento (ex.: mercadopago)",
+                        "name": "provider",
+                        "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Notificação MP",
+                        "type": "string",
+                        "description": "Assinatura HMAC-SHA256",
+                        "name": "X-Signature",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Notificação no formato do gateway",
                         "name": "notification",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/domain.MPWebhookNotification"
+                            "type": "object"
                         }
                     }
                 ],
@@ -117,6 +877,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
@@ -143,77 +912,266 @@ const docTemplate = `{
         "domain.CreatePaymentRequest": {
             "type": "object",
             "required": [
-                "amount",
                 "description",
                 "external_reference"
             ],
             "properties": {
                 "amount": {
-                    "type": "number"
+                    "description": "Amount aceita {\"units\": 1050, \"currency\": \"BRL\"} ou, como antes, um\nnúmero em reais.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/domain.Money"
+                        }
+                    ]
                 },
                 "description": {
                     "type": "string"
                 },
+                "expires_in": {
+                    "description": "ExpiresIn é o prazo de pagamento em segundos; sem ele vale o padrão do\nserviço.",
+                    "type": "integer",
+                    "maximum": 86400,
+                    "minimum": 60
+                },
                 "external_reference": {
                     "type": "string"
+                },
+                "provider": {
+                    "description": "Provider escolhe o gateway; vazio usa o padrão configurado.",
+                    "type": "string"
                 }
             }
         },
-        "domain.MPWebhookNotification": {
+        "domain.InboxNotification": {
             "type": "object",
             "properties": {
-                "action": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "body": {
+                    "description": "Body é o corpo recebido, guardado para inspeção.",
+                    "type": "object"
+                },
+                "charge_id": {
+                    "type": "string"
+                },
+                "claim_expires_at": {
+                    "type": "string"
+                },
+                "claimed_by": {
+                    "description": "ClaimedBy e ClaimExpiresAt identificam o worker que reservou a\nnotificação para processá-la e até quando a reserva vale.",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "notification_id": {
+                    "type": "string"
+                },
+                "payment_id": {
+                    "type": "string"
+                },
+                "processed_at": {
                     "type": "string"
                 },
-                "api_version": {
+                "provider": {
                     "type": "string"
                 },
-                "data": {
+                "status": {
+                    "$ref": "#/definitions/domain.InboxStatus"
+                },
+                "trace_context": {
+                    "description": "TraceContext guarda o contexto do trace da requisição do webhook; o\nWebhookWorker continua o mesmo trace.",
                     "type": "object",
-                    "properties": {
-                        "id": {
-                            "type": "string"
-                        }
+                    "additionalProperties": {
+                        "type": "string"
                     }
                 },
-                "date_created": {
+                "type": {
                     "type": "string"
                 },
-                "id": {},
-                "live_mode": {
-                    "type": "boolean"
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.InboxStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "processed",
+                "dead"
+            ],
+            "x-enum-varnames": [
+                "InboxPending",
+                "InboxProcessed",
+                "InboxDead"
+            ]
+        },
+        "domain.Money": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string",
+                    "example": "BRL"
                 },
-                "type": {
+                "units": {
+                    "type": "integer",
+                    "example": 1050
+                }
+            }
+        },
+        "domain.OutboxEvent": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "claim_expires_at": {
+                    "type": "string"
+                },
+                "claimed_by": {
+                    "description": "ClaimedBy e ClaimExpiresAt identificam o relay que reservou o evento\npara publicá-lo e até quando a reserva vale.",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "Payload é o JSON publicado no SNS, com o formato definido por EventType.",
+                    "type": "object"
+                },
+                "payment_id": {
                     "type": "string"
                 },
-                "user_id": {
+                "sent_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/domain.OutboxStatus"
+                },
+                "trace_context": {
+                    "description": "TraceContext guarda o contexto do trace (traceparent) em que o evento\nfoi gerado; a publicação continua o mesmo trace.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "updated_at": {
                     "type": "string"
                 }
             }
         },
+        "domain.OutboxStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "sent",
+                "failed"
+            ],
+            "x-enum-varnames": [
+                "OutboxPending",
+                "OutboxSent",
+                "OutboxFailed"
+            ]
+        },
         "domain.Payment": {
             "type": "object",
             "properties": {
                 "amount": {
-                    "type": "number"
+                    "description": "Amount e RefundedAmount saem no JSON como decimais na unidade maior,\ncom a moeda em currency (ver MarshalJSON).",
+                    "type": "number",
+                    "example": 10.5
                 },
                 "created_at": {
                     "type": "string"
                 },
+                "currency": {
+                    "type": "string",
+                    "example": "BRL"
+                },
+                "expires_at": {
+                    "description": "ExpiresAt é o prazo para pagamento do QR; depois dele o pagamento\npendente é expirado e a cobrança cancelada no gateway.",
+                    "type": "string"
+                },
                 "external_reference": {
                     "type": "string"
                 },
                 "id": {
                     "type": "string"
                 },
+                "previous_attempt_id": {
+                    "description": "PreviousAttemptID é o pagamento da mesma referência externa que esta\ntentativa substituiu (ver ReferencePolicyRetryAfterFailure).",
+                    "type": "string"
+                },
+                "provider": {
+                    "description": "Provider é o gateway da cobrança; vazio nos itens antigos, que são do\nMercado Pago (ver ProviderName).",
+                    "type": "string"
+                },
+                "provider_charge_id": {
+                    "description": "ProviderChargeID e ProviderPaymentID mantêm os nomes de atributo da\népoca em que só havia o Mercado Pago.",
+                    "type": "string"
+                },
+                "provider_payment_id": {
+                    "type": "string"
+                },
                 "qr_code": {
                     "type": "string"
                 },
+                "refunded_amount": {
+                    "type": "number",
+                    "example": 0
+                },
+                "refunds": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.Refund"
+                    }
+                },
                 "status": {
                     "$ref": "#/definitions/domain.PaymentStatus"
                 },
                 "updated_at": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "Version é incrementada a cada escrita e usada como condição nas\natualizações; itens antigos, sem o atributo, estão na versão 0.",
+                    "type": "integer"
+                }
+            }
+        },
+        "domain.PaymentPage": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.Payment"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
                 }
             }
         },
@@ -221,17 +1179,170 @@ const docTemplate = `{
             "type": "string",
             "enum": [
                 "pending",
+                "authorized",
                 "approved",
-                "rejected"
+                "rejected",
+                "cancelled",
+                "expired",
+                "refunded",
+                "partially_refunded",
+                "charged_back"
             ],
             "x-enum-varnames": [
                 "StatusPending",
+                "StatusAuthorized",
                 "StatusApproved",
-                "StatusRejected"
+                "StatusRejected",
+                "StatusCancelled",
+                "StatusExpired",
+                "StatusRefunded",
+                "StatusPartiallyRefunded",
+                "StatusChargedBack"
+            ]
+        },
+        "domain.Refund": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/domain.Money"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "provider_refund_id": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.RefundRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount vazio estorna todo o saldo restante.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/domain.Money"
+                        }
+                    ]
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.StatusHistoryEntry": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "changed_at": {
+                    "type": "string"
+                },
+                "declared_actor": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "new_status": {
+                    "$ref": "#/definitions/domain.PaymentStatus"
+                },
+                "notification_id": {
+                    "type": "string"
+                },
+                "payment_id": {
+                    "type": "string"
+                },
+                "previous_status": {
+                    "$ref": "#/definitions/domain.PaymentStatus"
+                },
+                "provider_status": {
+                    "type": "string"
+                },
+                "source": {
+                    "$ref": "#/definitions/domain.StatusSource"
+                }
+            }
+        },
+        "domain.StatusSource": {
+            "type": "string",
+            "enum": [
+                "api",
+                "webhook",
+                "reconciliation",
+                "sweeper"
+            ],
+            "x-enum-varnames": [
+                "SourceAPI",
+                "SourceWebhook",
+                "SourceReconciliation",
+                "SourceSweeper"
             ]
+        },
+        "handler.LogLevel": {
+            "type": "object",
+            "required": [
+                "level"
+            ],
+            "properties": {
+                "level": {
+                    "type": "string",
+                    "example": "debug"
+                }
+            }
+        },
+        "health.DependencyStatus": {
+            "type": "object",
+            "properties": {
+                "critical": {
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "health.Report": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "dependencies": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/health.DependencyStatus"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
+        "AdminToken": {
+            "description": "Token de administração no formato \"Bearer \u003cADMIN_TOKEN\u003e\".",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        },
         "BasicAuth": {
             "type": "basic"
         }
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type OutboxService interface {
+	ListStuck(ctx context.Context, olderThan time.Duration, limit int) ([]domain.OutboxEvent, error)
+}
+
+type WebhookInboxService interface {
+	ListDead(ctx context.Context, limit int) ([]domain.InboxNotification, error)
+	Replay(ctx context.Context, id string) (*domain.InboxNotification, error)
+}
+
+type AdminHandler struct {
+	outbox OutboxService
+	inbox  WebhookInboxService
+}
+
+func NewAdminHandler(outbox OutboxService, inbox WebhookInboxService) *AdminHandler {
+	return &AdminHandler{
+		outbox: outbox,
+		inbox:  inbox,
+	}
+}
+
+type stuckEventsQuery struct {
+	OlderThan string `form:"older_than"`
+	Limit     int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ListStuckEvents godoc
+// @Summary      Listar eventos travados no outbox
+// @Description  Eventos que falharam definitivamente ou estão pendentes há mais de older_than
+// @Tags         admin
+// @Security     AdminToken
+// @Produce      json
+// @Param        older_than  query     string  false  "Idade mínima dos pendentes (ex.: 5m, 1h)"
+// @Param        limit       query     int     false  "Quantidade máxima de eventos (máx. 100)"
+// @Success      200  {array}   domain.OutboxEvent
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /admin/outbox/travados [get]
+func (h *AdminHandler) ListStuckEvents(c *gin.Context) {
+	var query stuckEventsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	olderThan := 5 * time.Minute
+	if query.OlderThan != "" {
+		parsed, err := time.ParseDuration(query.OlderThan)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid older_than: " + query.OlderThan})
+			return
+		}
+		olderThan = parsed
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = domain.DefaultPageLimit
+	}
+
+	events, err := h.outbox.ListStuck(c.Request.Context(), olderThan, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+type deadNotificationsQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ListDeadNotifications godoc
+// @Summary      Listar webhooks que esgotaram as tentativas
+// @Description  Notificações de webhook que falharam em todas as tentativas de processamento
+// @Tags         admin
+// @Security     AdminToken
+// @Produce      json
+// @Param        limit  query     int  false  "Quantidade máxima de notificações (máx. 100)"
+// @Success      200  {array}   domain.InboxNotification
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /admin/webhooks/mortos [get]
+func (h *AdminHandler) ListDeadNotifications(c *gin.Context) {
+	var query deadNotificationsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = domain.DefaultPageLimit
+	}
+
+	notifications, err := h.inbox.ListDead(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// ReplayNotification godoc
+// @Summary      Reprocessar um webhook
+// @Description  Devolve à fila uma notificação que esgotou as tentativas, com as tentativas zeradas
+// @Tags         admin
+// @Security     AdminToken
+// @Produce      json
+// @Param        id   path      string  true  "ID da notificação no inbox"
+// @Success      202  {object}  domain.InboxNotification
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /admin/webhooks/{id}/reprocessar [post]
+func (h *AdminHandler) ReplayNotification(c *gin.Context) {
+	notification, err := h.inbox.Replay(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, notification)
+}
+
+// LogLevel é o nível mínimo dos logs.
+type LogLevel struct {
+	Level string `json:"level" binding:"required" example:"debug"`
+}
+
+// GetLogLevel godoc
+// @Summary      Consultar o nível de log
+// @Description  Nível mínimo dos logs em uso
+// @Tags         admin
+// @Security     AdminToken
+// @Produce      json
+// @Success      200  {object}  LogLevel
+// @Failure      401  {object}  map[string]string
+// @Router       /admin/log/nivel [get]
+func (h *AdminHandler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, LogLevel{Level: logger.Level().String()})
+}
+
+// SetLogLevel godoc
+// @Summary      Alterar o nível de log
+// @Description  Altera em execução o nível mínimo dos logs (debug, info, warn ou error). Vale só para a réplica que recebeu a requisição e até ela reiniciar
+// @Tags         admin
+// @Security     AdminToken
+// @Accept       json
+// @Produce      json
+// @Param        request  body      LogLevel  true  "Novo nível"
+// @Success      200      {object}  LogLevel
+// @Failure      400      {object}  map[string]string
+// @Failure      401      {object}  map[string]string
+// @Router       /admin/log/nivel [put]
+func (h *AdminHandler) SetLogLevel(c *gin.Context) {
+	var req LogLevel
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous := logger.Level()
+	if err := logger.SetLevel(req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logger.FromContext(c.Request.Context()).Warn("log level changed",
+		zap.Stringer("previous_level", previous),
+		zap.Stringer("level", logger.Level()),
+	)
+
+	c.JSON(http.StatusOK, LogLevel{Level: logger.Level().String()})
+}
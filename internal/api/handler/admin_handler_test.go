@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type mockOutboxService struct {
+	listStuckFunc func(ctx context.Context, olderThan time.Duration, limit int) ([]domain.OutboxEvent, error)
+}
+
+func (m *mockOutboxService) ListStuck(ctx context.Context, olderThan time.Duration, limit int) ([]domain.OutboxEvent, error) {
+	return m.listStuckFunc(ctx, olderThan, limit)
+}
+
+type mockWebhookInboxService struct {
+	listDeadFunc func(ctx context.Context, limit int) ([]domain.InboxNotification, error)
+	replayFunc   func(ctx context.Context, id string) (*domain.InboxNotification, error)
+}
+
+func (m *mockWebhookInboxService) ListDead(ctx context.Context, limit int) ([]domain.InboxNotification, error) {
+	return m.listDeadFunc(ctx, limit)
+}
+func (m *mockWebhookInboxService) Replay(ctx context.Context, id string) (*domain.InboxNotification, error) {
+	return m.replayFunc(ctx, id)
+}
+
+func TestAdminHandler_ListStuckEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var receivedAge time.Duration
+	svc := &mockOutboxService{
+		listStuckFunc: func(ctx context.Context, olderThan time.Duration, limit int) ([]domain.OutboxEvent, error) {
+			receivedAge = olderThan
+			if limit == 99 {
+				return nil, errors.New("db error")
+			}
+			return []domain.OutboxEvent{{ID: "evt-1", Status: domain.OutboxFailed}}, nil
+		},
+	}
+
+	h := NewAdminHandler(svc, &mockWebhookInboxService{})
+	r := gin.New()
+	r.GET("/admin/outbox/travados", h.ListStuckEvents)
+
+	t.Run("Success", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin/outbox/travados?older_than=15m", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if receivedAge != 15*time.Minute {
+			t.Errorf("expected older_than 15m, got %v", receivedAge)
+		}
+	})
+
+	t.Run("Invalid Duration", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin/outbox/travados?older_than=ontem", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Service Error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin/outbox/travados?limit=99", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("expected 500, got %d", w.Code)
+		}
+	})
+}
+
+func TestAdminHandler_DeadNotifications(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	inbox := &mockWebhookInboxService{
+		listDeadFunc: func(ctx context.Context, limit int) ([]domain.InboxNotification, error) {
+			return []domain.InboxNotification{{ID: "in-1", Status: domain.InboxDead}}, nil
+		},
+		replayFunc: func(ctx context.Context, id string) (*domain.InboxNotification, error) {
+			switch id {
+			case "in-1":
+				return &domain.InboxNotification{ID: id, Status: domain.InboxPending}, nil
+			case "in-2":
+				return nil, domain.ErrInboxNotificationNotDead
+			}
+			return nil, domain.ErrInboxNotificationNotFound
+		},
+	}
+
+	h := NewAdminHandler(&mockOutboxService{}, inbox)
+	r := gin.New()
+	r.GET("/admin/webhooks/mortos", h.ListDeadNotifications)
+	r.POST("/admin/webhooks/:id/reprocessar", h.ReplayNotification)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"List", "GET", "/admin/webhooks/mortos", http.StatusOK},
+		{"Invalid Limit", "GET", "/admin/webhooks/mortos?limit=500", http.StatusBadRequest},
+		{"Replay", "POST", "/admin/webhooks/in-1/reprocessar", http.StatusAccepted},
+		{"Replay Not Dead", "POST", "/admin/webhooks/in-2/reprocessar", http.StatusConflict},
+		{"Replay Not Found", "POST", "/admin/webhooks/in-9/reprocessar", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d. Body: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminHandler_LogLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := logger.Level().String()
+	t.Cleanup(func() { _ = logger.SetLevel(previous) })
+
+	h := NewAdminHandler(&mockOutboxService{}, &mockWebhookInboxService{})
+	r := gin.New()
+	r.GET("/admin/log/nivel", h.GetLogLevel)
+	r.PUT("/admin/log/nivel", h.SetLogLevel)
+
+	t.Run("Change", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/admin/log/nivel", strings.NewReader(`{"level":"debug"}`))
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/admin/log/nivel", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != `{"level":"debug"}` {
+			t.Errorf("expected debug level, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("InvalidLevel", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/admin/log/nivel", strings.NewReader(`{"level":"verbose"}`))
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+		if logger.Level().String() != "debug" {
+			t.Errorf("expected the level to be kept, got %s", logger.Level())
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/alexssanderFonseca/pagamento/internal/health"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"github.com/gin-gonic/gin"
+)
+
+// CircuitBreaker é o disjuntor de uma dependência externa.
+type CircuitBreaker interface {
+	Name() string
+	State() resilience.State
+}
+
+// ReadinessChecker confere as dependências usadas pela readiness probe.
+type ReadinessChecker interface {
+	Check(ctx context.Context) health.Report
+}
+
+type HealthHandler struct {
+	readiness ReadinessChecker
+	breakers  []CircuitBreaker
+}
+
+func NewHealthHandler(readiness ReadinessChecker, breakers ...CircuitBreaker) *HealthHandler {
+	return &HealthHandler{
+		readiness: readiness,
+		breakers:  breakers,
+	}
+}
+
+// Health godoc
+// @Summary      Verificar a saúde do serviço
+// @Description  Retorna degraded, ainda com 200, quando algum disjuntor de dependência externa não está fechado
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /health [get]
+func (h *HealthHandler) Health(c *gin.Context) {
+	status := "up"
+	breakers := gin.H{}
+	for _, breaker := range h.breakers {
+		state := breaker.State()
+		breakers[breaker.Name()] = state
+		if state != resilience.StateClosed {
+			status = "degraded"
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":           status,
+		"circuit_breakers": breakers,
+	})
+}
+
+// Live godoc
+// @Summary      Liveness probe
+// @Description  Responde 200 enquanto o processo atende requisições, sem consultar as dependências
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /health/live [get]
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+}
+
+// Ready godoc
+// @Summary      Readiness probe
+// @Description  Confere as dependências (DynamoDB, SNS, Mercado Pago e disjuntores) e retorna o estado de cada uma. Responde 503 quando uma dependência crítica está fora do ar; as demais só deixam o status degraded
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  health.Report
+// @Failure      503  {object}  health.Report
+// @Router       /health/ready [get]
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.readiness.Check(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
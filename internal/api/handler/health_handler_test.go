@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/health"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"github.com/gin-gonic/gin"
+)
+
+type mockReadiness struct {
+	checkFunc func(ctx context.Context) health.Report
+}
+
+func (m *mockReadiness) Check(ctx context.Context) health.Report {
+	return m.checkFunc(ctx)
+}
+
+func TestHealthHandler_Health(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	breaker := resilience.NewCircuitBreaker("mercadopago", resilience.BreakerConfig{FailureThreshold: 1})
+	h := NewHealthHandler(&mockReadiness{}, breaker)
+
+	check := func(expectedStatus string, expectedState resilience.State) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/health", nil)
+		h.Health(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		var body struct {
+			Status          string                      `json:"status"`
+			CircuitBreakers map[string]resilience.State `json:"circuit_breakers"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if body.Status != expectedStatus || body.CircuitBreakers["mercadopago"] != expectedState {
+			t.Errorf("expected %s/%s, got %+v", expectedStatus, expectedState, body)
+		}
+	}
+
+	check("up", resilience.StateClosed)
+
+	_ = breaker.Allow()
+	breaker.Failure()
+	check("degraded", resilience.StateOpen)
+}
+
+func TestHealthHandler_Live(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := NewHealthHandler(&mockReadiness{})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/health/live", nil)
+	h.Live(c)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestHealthHandler_Ready(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		status         string
+		expectedStatus int
+	}{
+		{name: "up", status: health.StatusUp, expectedStatus: http.StatusOK},
+		{name: "degraded", status: health.StatusDegraded, expectedStatus: http.StatusOK},
+		{name: "critical dependency down", status: health.StatusDown, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readiness := &mockReadiness{
+				checkFunc: func(ctx context.Context) health.Report {
+					return health.Report{
+						Status: tt.status,
+						Dependencies: map[string]health.DependencyStatus{
+							"dynamodb": {Status: tt.status, Critical: true},
+						},
+					}
+				},
+			}
+			h := NewHealthHandler(readiness)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/health/ready", nil)
+			h.Ready(c)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected %d, got %d", tt.expectedStatus, w.Code)
+			}
+			var body health.Report
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if body.Status != tt.status || body.Dependencies["dynamodb"].Status != tt.status {
+				t.Errorf("expected the per-dependency breakdown, got %+v", body)
+			}
+		})
+	}
+}
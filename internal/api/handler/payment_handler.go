@@ -2,13 +2,8 @@ package handler
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
+	"errors"
 	"net/http"
-	"os"
-	"strings"
 
 	"github.com/alexssanderFonseca/pagamento/internal/domain"
 	"github.com/alexssanderFonseca/pagamento/internal/logger"
@@ -16,9 +11,21 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxIdempotencyKeyLength limita o tamanho do header Idempotency-Key.
+const maxIdempotencyKeyLength = 255
+
+// actorHeader traz o autor declarado pelo cliente, registrado no histórico de
+// status como declared_actor.
+const actorHeader = "X-Actor"
+
 type PaymentService interface {
 	CreatePayment(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error)
-	ProcessWebhook(ctx context.Context, notification domain.MPWebhookNotification) error
+	GetPayment(ctx context.Context, id string) (*domain.Payment, error)
+	GetPaymentHistory(ctx context.Context, id string) ([]domain.StatusHistoryEntry, error)
+	ListPayments(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error)
+	RefundPayment(ctx context.Context, id string, req domain.RefundRequest) (*domain.Payment, error)
+	CancelPayment(ctx context.Context, id string) (*domain.Payment, error)
+	ProcessWebhook(ctx context.Context, provider string, req domain.WebhookRequest) error
 }
 
 type PaymentHandler struct {
@@ -33,14 +40,18 @@ func NewPaymentHandler(service PaymentService) *PaymentHandler {
 
 // CreatePayment godoc
 // @Summary      Criar um novo pagamento
-// @Description  Gera um QR Code no Mercado Pago para uma ordem de serviço
+// @Description  Gera a cobrança (QR Code) no gateway para uma ordem de serviço. Uma ordem que já tem pagamento segue EXTERNAL_REFERENCE_POLICY: 409, o pagamento pendente existente ou uma nova tentativa após falha ou expiração
 // @Tags         pagamentos
 // @Accept       json
 // @Produce      json
-// @Param        request  body      domain.CreatePaymentRequest  true  "Dados do Pagamento"
+// @Param        Idempotency-Key  header    string                       false  "Chave de idempotência da requisição"
+// @Param        X-Actor          header    string                       false  "Autor declarado pelo cliente, não autenticado; registrado em declared_actor no histórico de status"
+// @Param        request          body      domain.CreatePaymentRequest  true   "Dados do Pagamento"
 // @Success      201      {object}  domain.Payment
 // @Failure      400      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
 // @Failure      500      {object}  map[string]string
+// @Failure      503      {object}  map[string]string
 // @Router       /pagamentos [post]
 func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 	var req domain.CreatePaymentRequest
@@ -49,86 +60,247 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 		return
 	}
 
-	payment, err := h.service.CreatePayment(c.Request.Context(), req)
+	req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key header too long"})
+		return
+	}
+
+	payment, err := h.service.CreatePayment(requestContext(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, payment)
 }
 
-// HandleWebhook godoc
-// @Summary      Receber notificação do Mercado Pago
-// @Description  Processa o status do pagamento via webhook assinado
-// @Tags         webhooks
+// GetPayment godoc
+// @Summary      Consultar um pagamento
+// @Description  Retorna o pagamento e seu status atual
+// @Tags         pagamentos
+// @Produce      json
+// @Param        id   path      string  true  "ID do Pagamento"
+// @Success      200  {object}  domain.Payment
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /pagamentos/{id} [get]
+func (h *PaymentHandler) GetPayment(c *gin.Context) {
+	payment, err := h.service.GetPayment(requestContext(c), c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// GetPaymentHistory godoc
+// @Summary      Consultar o histórico de status
+// @Description  Lista as mudanças de status do pagamento em ordem cronológica, com a origem (api, webhook, reconciliation, sweeper) e o status bruto do gateway
+// @Tags         pagamentos
+// @Produce      json
+// @Param        id   path      string  true  "ID do Pagamento"
+// @Success      200  {array}   domain.StatusHistoryEntry
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /pagamentos/{id}/historico [get]
+func (h *PaymentHandler) GetPaymentHistory(c *gin.Context) {
+	history, err := h.service.GetPaymentHistory(requestContext(c), c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// RefundPayment godoc
+// @Summary      Estornar um pagamento
+// @Description  Estorna total ou parcialmente um pagamento aprovado. Sem amount, estorna o saldo restante. O Idempotency-Key é obrigatório, e repetir a requisição com a mesma chave não estorna de novo; 503 indica um estorno feito no gateway que ainda não foi registrado e deve ser repetido com a mesma chave.
+// @Tags         pagamentos
 // @Accept       json
 // @Produce      json
-// @Param        X-Signature  header    string  true  "Assinura HMAC-SHA256"
-// @Param        notification body      domain.MPWebhookNotification  true  "Notificação MP"
-// @Success      200      {object}  map[string]string
-// @Failure      401      {object}  map[string]string
+// @Param        id               path      string                true   "ID do Pagamento"
+// @Param        Idempotency-Key  header    string                true   "Chave de idempotência do estorno"
+// @Param        X-Actor          header    string                false  "Autor declarado pelo cliente, não autenticado; registrado em declared_actor no histórico de status"
+// @Param        request          body      domain.RefundRequest  true   "Dados do Estorno"
+// @Success      201      {object}  domain.Payment
+// @Failure      400      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Failure      422      {object}  map[string]string
 // @Failure      500      {object}  map[string]string
-// @Router       /webhooks/mercadopago [post]
-func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
-	var notification domain.MPWebhookNotification
-	if err := c.ShouldBindJSON(&notification); err != nil {
+// @Failure      503      {object}  map[string]string
+// @Router       /pagamentos/{id}/reembolsos [post]
+func (h *PaymentHandler) RefundPayment(c *gin.Context) {
+	var req domain.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validação de Segurança do Webhook
-	if !h.validateSignature(c, notification) {
-		logger.Warn("invalid webhook signature detected",
-			zap.String("id", notification.Data.ID),
-			zap.String("signature", c.GetHeader("x-signature")),
-		)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+	req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key header too long"})
 		return
 	}
 
-	if err := h.service.ProcessWebhook(c.Request.Context(), notification); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	payment, err := h.service.RefundPayment(requestContext(c), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "received"})
+	c.JSON(http.StatusCreated, payment)
 }
 
-func (h *PaymentHandler) validateSignature(c *gin.Context, notification domain.MPWebhookNotification) bool {
-	secret := os.Getenv("MERCADO_PAGO_WEBHOOK_SECRET")
-	if secret == "" {
-		return true
+// CancelPayment godoc
+// @Summary      Cancelar um pagamento
+// @Description  Cancela no gateway a cobrança de um pagamento ainda não pago
+// @Tags         pagamentos
+// @Produce      json
+// @Param        id       path      string  true   "ID do Pagamento"
+// @Param        X-Actor  header    string  false  "Autor declarado pelo cliente, não autenticado; registrado em declared_actor no histórico de status"
+// @Success      200  {object}  domain.Payment
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /pagamentos/{id}/cancelar [post]
+func (h *PaymentHandler) CancelPayment(c *gin.Context) {
+	payment, err := h.service.CancelPayment(requestContext(c), c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// ListPayments godoc
+// @Summary      Listar pagamentos
+// @Description  Lista pagamentos com filtros e paginação por cursor
+// @Tags         pagamentos
+// @Produce      json
+// @Param        external_reference  query     string  false  "Referência externa (ordem de serviço)"
+// @Param        status              query     string  false  "Status do pagamento"
+// @Param        created_from        query     string  false  "Criado a partir de (RFC3339)"
+// @Param        created_to          query     string  false  "Criado até (RFC3339)"
+// @Param        updated_from        query     string  false  "Atualizado a partir de (RFC3339)"
+// @Param        limit               query     int     false  "Itens por página (máx. 100)"
+// @Param        cursor              query     string  false  "Cursor da próxima página"
+// @Success      200  {object}  domain.PaymentPage
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /pagamentos [get]
+func (h *PaymentHandler) ListPayments(c *gin.Context) {
+	var filter domain.PaymentFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Status != "" && !filter.Status.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + string(filter.Status)})
+		return
 	}
 
-	signatureHeader := c.GetHeader("x-signature")
-	if signatureHeader == "" {
-		return false
+	page, err := h.service.ListPayments(requestContext(c), filter)
+	if err != nil {
+		writeError(c, err)
+		return
 	}
 
-	parts := strings.Split(signatureHeader, ",")
-	var ts, hash string
-	for _, part := range parts {
-		kv := strings.Split(part, "=")
-		if len(kv) != 2 {
-			continue
-		}
-		if kv[0] == "ts" {
-			ts = kv[1]
-		} else if kv[0] == "v1" {
-			hash = kv[1]
-		}
+	c.JSON(http.StatusOK, page)
+}
+
+// HandleWebhook godoc
+// @Summary      Receber notificação de um gateway de pagamento
+// @Description  Valida a notificação com o gateway indicado e a grava para processamento assíncrono (ou atualiza o status do pagamento na hora, sem inbox)
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        provider      path      string  true   "Gateway de pagamento (ex.: mercadopago)"
+// @Param        X-Signature   header    string  false  "Assinatura HMAC-SHA256"
+// @Param        notification  body      object  true   "Notificação no formato do gateway"
+// @Success      200      {object}  map[string]string
+// @Failure      400      {object}  map[string]string
+// @Failure      401      {object}  map[string]string
+// @Failure      500      {object}  map[string]string
+// @Router       /webhooks/{provider} [post]
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if ts == "" || hash == "" {
-		return false
+	req := domain.WebhookRequest{
+		Headers: c.Request.Header,
+		Query:   c.Request.URL.Query(),
+		Body:    body,
+	}
+	if err := h.service.ProcessWebhook(requestContext(c), c.Param("provider"), req); err != nil {
+		writeError(c, err)
+		return
 	}
 
-	manifest := fmt.Sprintf("id:%s;ts:%s;", notification.Data.ID, ts)
+	c.JSON(http.StatusOK, gin.H{"status": "received"})
+}
 
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write([]byte(manifest))
-	expectedHash := hex.EncodeToString(mac.Sum(nil))
+// requestContext associa ao contexto o autor declarado no header X-Actor e,
+// nas rotas /pagamentos/:id, o ID do pagamento incluído nos logs. O header não
+// é autenticado: vai para o histórico como DeclaredActor, não como Actor.
+func requestContext(c *gin.Context) context.Context {
+	ctx := domain.ContextWithDeclaredActor(c.Request.Context(), c.GetHeader(actorHeader))
+	if id := c.Param("id"); id != "" {
+		ctx = logger.WithPaymentID(ctx, id)
+	}
+	return ctx
+}
 
-	return hmac.Equal([]byte(hash), []byte(expectedHash))
+// writeError traduz os erros de domínio para o status HTTP correspondente.
+func writeError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, domain.ErrPaymentNotFound),
+		errors.Is(err, domain.ErrInboxNotificationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidCursor),
+		errors.Is(err, domain.ErrInvalidAmount),
+		errors.Is(err, domain.ErrUnsupportedCurrency),
+		errors.Is(err, domain.ErrAmountTooLarge),
+		errors.Is(err, domain.ErrUnknownProvider),
+		errors.Is(err, domain.ErrInvalidWebhookPayload),
+		errors.Is(err, domain.ErrRefundKeyRequired):
+		status = http.StatusBadRequest
+	case errors.Is(err, domain.ErrInvalidWebhookSignature):
+		status = http.StatusUnauthorized
+	case errors.Is(err, domain.ErrProviderUnavailable),
+		errors.Is(err, domain.ErrRefundNotRecorded):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, domain.ErrInvalidTransition),
+		errors.Is(err, domain.ErrConcurrentModification),
+		errors.Is(err, domain.ErrPaymentAlreadyExists),
+		errors.Is(err, domain.ErrDuplicateExternalReference),
+		errors.Is(err, domain.ErrIdempotencyConflict),
+		errors.Is(err, domain.ErrIdempotencyInProgress),
+		errors.Is(err, domain.ErrInboxNotificationNotDead):
+		status = http.StatusConflict
+	case errors.Is(err, domain.ErrInvalidRefundAmount),
+		errors.Is(err, domain.ErrRefundExceedsAmount),
+		errors.Is(err, domain.ErrCurrencyMismatch),
+		errors.Is(err, domain.ErrMissingProviderReference),
+		errors.Is(err, domain.ErrOperationNotSupported):
+		status = http.StatusUnprocessableEntity
+	}
+	if status >= http.StatusInternalServerError {
+		logger.FromContext(c.Request.Context()).Error("request failed",
+			zap.Error(err),
+			zap.String("route", c.FullPath()),
+			zap.Int("status", status),
+		)
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
 }
@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/alexssanderFonseca/pagamento/internal/domain"
@@ -15,15 +17,40 @@ import (
 
 type mockPaymentService struct {
 	createPaymentFunc  func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error)
-	processWebhookFunc func(ctx context.Context, notification domain.MPWebhookNotification) error
+	getPaymentFunc     func(ctx context.Context, id string) (*domain.Payment, error)
+	getHistoryFunc     func(ctx context.Context, id string) ([]domain.StatusHistoryEntry, error)
+	listPaymentsFunc   func(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error)
+	refundPaymentFunc  func(ctx context.Context, id string, req domain.RefundRequest) (*domain.Payment, error)
+	cancelPaymentFunc  func(ctx context.Context, id string) (*domain.Payment, error)
+	processWebhookFunc func(ctx context.Context, provider string, req domain.WebhookRequest) error
 }
 
 func (m *mockPaymentService) CreatePayment(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error) {
 	return m.createPaymentFunc(ctx, req)
 }
 
-func (m *mockPaymentService) ProcessWebhook(ctx context.Context, notification domain.MPWebhookNotification) error {
-	return m.processWebhookFunc(ctx, notification)
+func (m *mockPaymentService) GetPayment(ctx context.Context, id string) (*domain.Payment, error) {
+	return m.getPaymentFunc(ctx, id)
+}
+
+func (m *mockPaymentService) GetPaymentHistory(ctx context.Context, id string) ([]domain.StatusHistoryEntry, error) {
+	return m.getHistoryFunc(ctx, id)
+}
+
+func (m *mockPaymentService) ListPayments(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+	return m.listPaymentsFunc(ctx, filter)
+}
+
+func (m *mockPaymentService) RefundPayment(ctx context.Context, id string, req domain.RefundRequest) (*domain.Payment, error) {
+	return m.refundPaymentFunc(ctx, id, req)
+}
+
+func (m *mockPaymentService) CancelPayment(ctx context.Context, id string) (*domain.Payment, error) {
+	return m.cancelPaymentFunc(ctx, id)
+}
+
+func (m *mockPaymentService) ProcessWebhook(ctx context.Context, provider string, req domain.WebhookRequest) error {
+	return m.processWebhookFunc(ctx, provider, req)
 }
 
 func TestPaymentHandler_CreatePayment(t *testing.T) {
@@ -44,7 +71,7 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
-		body := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: 10.0, Description: "Test"}
+		body := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1000, "BRL"), Description: "Test"}
 		jsonBody, _ := json.Marshal(body)
 		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
 		c.Request.Header.Set("Content-Type", "application/json")
@@ -54,6 +81,20 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 		}
 	})
 
+	t.Run("Numeric Amount", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBufferString(`{"external_reference":"ORDER-1","amount":10.5,"description":"Test"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.CreatePayment(c)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `"amount":10.50,"currency":"BRL"`) {
+			t.Errorf("expected the amount in reais to be read as BRL 10.50, got %s", w.Body.String())
+		}
+	})
+
 	t.Run("Invalid JSON", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
@@ -64,13 +105,52 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 		}
 	})
 
+	t.Run("Idempotency Key Header", func(t *testing.T) {
+		var received string
+		svc.createPaymentFunc = func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error) {
+			received = req.IdempotencyKey
+			return &domain.Payment{ID: "test-id"}, nil
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1000, "BRL"), Description: "Test"}
+		jsonBody, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("Idempotency-Key", "key-1")
+		h.CreatePayment(c)
+		if w.Code != http.StatusCreated {
+			t.Errorf("expected 201, got %d", w.Code)
+		}
+		if received != "key-1" {
+			t.Errorf("expected idempotency key key-1, got %q", received)
+		}
+	})
+
+	t.Run("Idempotency Conflict", func(t *testing.T) {
+		svc.createPaymentFunc = func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error) {
+			return nil, domain.ErrIdempotencyConflict
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1000, "BRL"), Description: "Test"}
+		jsonBody, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("Idempotency-Key", "key-1")
+		h.CreatePayment(c)
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %d", w.Code)
+		}
+	})
+
 	t.Run("Service Error", func(t *testing.T) {
 		svc.createPaymentFunc = func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error) {
 			return nil, errors.New("service failed")
 		}
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
-		body := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: 10.0, Description: "Test"}
+		body := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1000, "BRL"), Description: "Test"}
 		jsonBody, _ := json.Marshal(body)
 		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
 		c.Request.Header.Set("Content-Type", "application/json")
@@ -81,54 +161,354 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 	})
 }
 
-func TestPaymentHandler_HandleWebhook(t *testing.T) {
+func TestPaymentHandler_GetPayment(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	svc := &mockPaymentService{
-		processWebhookFunc: func(ctx context.Context, notification domain.MPWebhookNotification) error {
-			return nil
+		getPaymentFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			if id == "missing" {
+				return nil, domain.ErrPaymentNotFound
+			}
+			if id == "broken" {
+				return nil, errors.New("db error")
+			}
+			return &domain.Payment{ID: id, Status: domain.StatusPending}, nil
 		},
 	}
 
 	h := NewPaymentHandler(svc)
+	r := gin.New()
+	r.GET("/pagamentos/:id", h.GetPayment)
+
+	cases := map[string]int{
+		"pay-1":   http.StatusOK,
+		"missing": http.StatusNotFound,
+		"broken":  http.StatusInternalServerError,
+	}
+	for id, expected := range cases {
+		t.Run(id, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/pagamentos/"+id, nil)
+			r.ServeHTTP(w, req)
+			if w.Code != expected {
+				t.Errorf("expected %d, got %d. Body: %s", expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPaymentHandler_GetPayment_ResponseShape(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &mockPaymentService{
+		getPaymentFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return &domain.Payment{
+				ID:             id,
+				Amount:         domain.NewMoney(1050, "BRL"),
+				RefundedAmount: domain.NewMoney(250, "BRL"),
+				Status:         domain.StatusPartiallyRefunded,
+			}, nil
+		},
+	}
+
+	h := NewPaymentHandler(svc)
+	r := gin.New()
+	r.GET("/pagamentos/:id", h.GetPayment)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/pagamentos/pay-1", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	// O serviço de ordens de serviço lê amount como número em reais.
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	expected := map[string]string{
+		"amount":          `10.50`,
+		"refunded_amount": `2.50`,
+		"currency":        `"BRL"`,
+	}
+	for field, value := range expected {
+		if string(body[field]) != value {
+			t.Errorf("expected %s to be %s, got %s", field, value, body[field])
+		}
+	}
+
+	var payment domain.Payment
+	if err := json.Unmarshal(w.Body.Bytes(), &payment); err != nil {
+		t.Fatalf("failed to decode payment: %v", err)
+	}
+	if payment.Amount != domain.NewMoney(1050, "BRL") || payment.RefundedAmount != domain.NewMoney(250, "BRL") {
+		t.Errorf("expected the amounts to round trip, got %+v", payment)
+	}
+}
+
+func TestPaymentHandler_ListPayments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var received domain.PaymentFilter
+	svc := &mockPaymentService{
+		listPaymentsFunc: func(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+			received = filter
+			if filter.Cursor == "bad" {
+				return nil, domain.ErrInvalidCursor
+			}
+			return &domain.PaymentPage{Items: []domain.Payment{{ID: "pay-1"}}, NextCursor: "next"}, nil
+		},
+	}
+
+	h := NewPaymentHandler(svc)
+	r := gin.New()
+	r.GET("/pagamentos", h.ListPayments)
 
 	t.Run("Success", func(t *testing.T) {
 		w := httptest.NewRecorder()
-		c, _ := gin.CreateTestContext(w)
-		notification := domain.MPWebhookNotification{Type: "payment"}
-		notification.Data.ID = "123"
-		jsonBody, _ := json.Marshal(notification)
-		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
-		c.Request.Header.Set("Content-Type", "application/json")
-		h.HandleWebhook(c)
+		req, _ := http.NewRequest("GET", "/pagamentos?status=pending&external_reference=ORDER-1&created_from=2024-01-01T00:00:00Z&limit=5", nil)
+		r.ServeHTTP(w, req)
 		if w.Code != http.StatusOK {
-			t.Errorf("expected 200, got %d", w.Code)
+			t.Fatalf("expected 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if received.Status != domain.StatusPending || received.ExternalReference != "ORDER-1" || received.Limit != 5 {
+			t.Errorf("unexpected filter: %+v", received)
+		}
+		if received.CreatedFrom == nil || received.CreatedFrom.Year() != 2024 {
+			t.Errorf("expected created_from to be parsed, got %v", received.CreatedFrom)
+		}
+		var page domain.PaymentPage
+		_ = json.Unmarshal(w.Body.Bytes(), &page)
+		if page.NextCursor != "next" || len(page.Items) != 1 {
+			t.Errorf("unexpected page: %+v", page)
 		}
 	})
 
-	t.Run("Invalid JSON", func(t *testing.T) {
+	t.Run("Invalid Limit", func(t *testing.T) {
 		w := httptest.NewRecorder()
-		c, _ := gin.CreateTestContext(w)
-		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBufferString("{invalid}"))
-		h.HandleWebhook(c)
+		req, _ := http.NewRequest("GET", "/pagamentos?limit=500", nil)
+		r.ServeHTTP(w, req)
 		if w.Code != http.StatusBadRequest {
 			t.Errorf("expected 400, got %d", w.Code)
 		}
 	})
 
-	t.Run("Service Error", func(t *testing.T) {
-		svc.processWebhookFunc = func(ctx context.Context, notification domain.MPWebhookNotification) error {
-			return errors.New("webhook failed")
+	t.Run("Invalid Status", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/pagamentos?status=paid", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Invalid Cursor", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/pagamentos?cursor=bad", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
 		}
+	})
+}
+
+func TestPaymentHandler_RefundPayment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &mockPaymentService{
+		refundPaymentFunc: func(ctx context.Context, id string, req domain.RefundRequest) (*domain.Payment, error) {
+			if req.Amount != nil && req.Amount.Units > 10000 {
+				return nil, domain.ErrRefundExceedsAmount
+			}
+			if id == "pending" {
+				return nil, &domain.TransitionError{From: domain.StatusPending, To: domain.StatusRefunded}
+			}
+			if id == "unrecorded" {
+				return nil, fmt.Errorf("%w: %w", domain.ErrRefundNotRecorded, domain.ErrConcurrentModification)
+			}
+			if req.IdempotencyKey == "" {
+				return nil, domain.ErrRefundKeyRequired
+			}
+			if req.IdempotencyKey != "key-1" {
+				t.Errorf("unexpected idempotency key %q", req.IdempotencyKey)
+			}
+			return &domain.Payment{ID: id, Status: domain.StatusPartiallyRefunded}, nil
+		},
+	}
+
+	h := NewPaymentHandler(svc)
+	r := gin.New()
+	r.POST("/pagamentos/:id/reembolsos", h.RefundPayment)
+
+	cases := []struct {
+		name     string
+		id       string
+		body     string
+		key      string
+		expected int
+	}{
+		{"Success", "pay-1", `{"amount": 10.5, "reason": "devolução"}`, "key-1", http.StatusCreated},
+		{"Full Refund", "pay-1", `{}`, "key-1", http.StatusCreated},
+		{"Exceeds Amount", "pay-1", `{"amount": 500}`, "key-1", http.StatusUnprocessableEntity},
+		{"Invalid Transition", "pending", `{}`, "key-1", http.StatusConflict},
+		{"Not Recorded", "unrecorded", `{}`, "key-1", http.StatusServiceUnavailable},
+		{"Missing Idempotency Key", "pay-1", `{}`, "", http.StatusBadRequest},
+		{"Invalid JSON", "pay-1", `{invalid}`, "key-1", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/pagamentos/"+tc.id+"/reembolsos", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.key != "" {
+				req.Header.Set("Idempotency-Key", tc.key)
+			}
+			r.ServeHTTP(w, req)
+			if w.Code != tc.expected {
+				t.Errorf("expected %d, got %d. Body: %s", tc.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPaymentHandler_GetPaymentHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &mockPaymentService{
+		getHistoryFunc: func(ctx context.Context, id string) ([]domain.StatusHistoryEntry, error) {
+			if id == "missing" {
+				return nil, domain.ErrPaymentNotFound
+			}
+			return []domain.StatusHistoryEntry{
+				{PaymentID: id, NewStatus: domain.StatusPending, Source: domain.SourceAPI},
+				{PaymentID: id, PreviousStatus: domain.StatusPending, NewStatus: domain.StatusApproved, Source: domain.SourceWebhook, ProviderStatus: "approved", NotificationID: "n-1"},
+			}, nil
+		},
+	}
+
+	h := NewPaymentHandler(svc)
+	r := gin.New()
+	r.GET("/pagamentos/:id/historico", h.GetPaymentHistory)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/pagamentos/pay-1/historico", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var history []domain.StatusHistoryEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(history) != 2 || history[1].Source != domain.SourceWebhook || history[1].NotificationID != "n-1" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/pagamentos/missing/historico", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestPaymentHandler_CancelPayment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &mockPaymentService{
+		cancelPaymentFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			if domain.DeclaredActorFromContext(ctx) != "atendente-1" {
+				t.Errorf("expected declared actor from the X-Actor header, got %q", domain.DeclaredActorFromContext(ctx))
+			}
+			switch id {
+			case "missing":
+				return nil, domain.ErrPaymentNotFound
+			case "approved":
+				return nil, &domain.TransitionError{From: domain.StatusApproved, To: domain.StatusCancelled}
+			}
+			return &domain.Payment{ID: id, Status: domain.StatusCancelled}, nil
+		},
+	}
+
+	h := NewPaymentHandler(svc)
+	r := gin.New()
+	r.POST("/pagamentos/:id/cancelar", h.CancelPayment)
+
+	cases := map[string]int{
+		"pay-1":    http.StatusOK,
+		"missing":  http.StatusNotFound,
+		"approved": http.StatusConflict,
+	}
+	for id, expected := range cases {
+		t.Run(id, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/pagamentos/"+id+"/cancelar", nil)
+			req.Header.Set("X-Actor", "atendente-1")
+			r.ServeHTTP(w, req)
+			if w.Code != expected {
+				t.Errorf("expected %d, got %d. Body: %s", expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPaymentHandler_HandleWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var received domain.WebhookRequest
+	var receivedProvider string
+	svc := &mockPaymentService{
+		processWebhookFunc: func(ctx context.Context, provider string, req domain.WebhookRequest) error {
+			receivedProvider = provider
+			received = req
+			return nil
+		},
+	}
+
+	h := NewPaymentHandler(svc)
+
+	t.Run("Success", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
-		notification := domain.MPWebhookNotification{Type: "payment"}
-		jsonBody, _ := json.Marshal(notification)
-		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
+		body := `{"type":"payment","data":{"id":"123"}}`
+		c.Request, _ = http.NewRequest("POST", "/?data.id=123", bytes.NewBufferString(body))
 		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("x-signature", "ts=1,v1=abc")
+		c.Params = gin.Params{{Key: "provider", Value: "mercadopago"}}
 		h.HandleWebhook(c)
-		if w.Code != http.StatusInternalServerError {
-			t.Errorf("expected 500, got %d", w.Code)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", w.Code)
+		}
+		if receivedProvider != "mercadopago" || string(received.Body) != body {
+			t.Errorf("unexpected request forwarded: %s %s", receivedProvider, received.Body)
+		}
+		if received.Headers.Get("x-signature") != "ts=1,v1=abc" || received.Query.Get("data.id") != "123" {
+			t.Errorf("expected headers and query to be forwarded, got %+v", received)
 		}
 	})
+
+	cases := map[string]struct {
+		err    error
+		status int
+	}{
+		"Invalid Payload":   {domain.ErrInvalidWebhookPayload, http.StatusBadRequest},
+		"Unknown Provider":  {domain.ErrUnknownProvider, http.StatusBadRequest},
+		"Invalid Signature": {domain.ErrInvalidWebhookSignature, http.StatusUnauthorized},
+		"Service Error":     {errors.New("webhook failed"), http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			svc.processWebhookFunc = func(ctx context.Context, provider string, req domain.WebhookRequest) error {
+				return tc.err
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/", bytes.NewBufferString("{}"))
+			h.HandleWebhook(c)
+			if w.Code != tc.status {
+				t.Errorf("expected %d, got %d", tc.status, w.Code)
+			}
+		})
+	}
 }
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader identifica a requisição nos logs deste serviço e de quem o
+// chamou.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength descarta IDs recebidos grandes demais para os logs.
+const maxRequestIDLength = 128
+
+// RequestID usa o X-Request-ID recebido, ou gera um, e o devolve na resposta.
+// O ID vai para o contexto da requisição, lido por logger.FromContext, e para
+// o span corrente; por isso o middleware roda depois do otelgin.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, id)
+
+		ctx := logger.WithRequestID(c.Request.Context(), id)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// AdminAuth exige o token de administração no header Authorization, como
+// "Bearer <token>". Sem token configurado todas as requisições são recusadas.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		received, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(received), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
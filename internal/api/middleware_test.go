@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "propagates received id", header: "req-1", expected: "req-1"},
+		{name: "generates missing id"},
+		{name: "replaces oversized id", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			r := gin.New()
+			r.Use(RequestID())
+			r.GET("/", func(c *gin.Context) {
+				fromContext = logger.RequestID(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if got == "" || got != fromContext {
+				t.Errorf("expected the response header to match the context, got %q and %q", got, fromContext)
+			}
+			if tt.expected != "" && got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+			if tt.expected == "" && got == tt.header {
+				t.Errorf("expected a generated id, got %s", got)
+			}
+		})
+	}
+}
+
+func TestAdminAuth_RejectsWhenTokenIsNotConfigured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", AdminAuth(""), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
@@ -9,31 +9,48 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func SetupRouter(paymentHandler *handler.PaymentHandler) *gin.Engine {
+// SetupRouter monta as rotas; adminToken protege as rotas de /v1/admin.
+func SetupRouter(paymentHandler *handler.PaymentHandler, adminHandler *handler.AdminHandler, healthHandler *handler.HealthHandler, adminToken string) *gin.Engine {
 	r := gin.Default()
 
 	// OpenTelemetry Middleware
 	r.Use(otelgin.Middleware("pagamento"))
+	r.Use(RequestID())
 
 	// Swagger route
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "up"})
-	})
+	r.GET("/health", healthHandler.Health)
+	r.GET("/health/live", healthHandler.Live)
+	r.GET("/health/ready", healthHandler.Ready)
 
 	v1 := r.Group("/v1")
 	{
 		payments := v1.Group("/pagamentos")
 		{
 			payments.POST("", paymentHandler.CreatePayment)
+			payments.GET("", paymentHandler.ListPayments)
+			payments.GET("/:id", paymentHandler.GetPayment)
+			payments.GET("/:id/historico", paymentHandler.GetPaymentHistory)
+			payments.POST("/:id/reembolsos", paymentHandler.RefundPayment)
+			payments.POST("/:id/cancelar", paymentHandler.CancelPayment)
 		}
 
-		// Rota para Webhooks do Mercado Pago
+		// Webhooks dos gateways de pagamento, ex.: /v1/webhooks/mercadopago
 		webhooks := v1.Group("/webhooks")
 		{
-			webhooks.POST("/mercadopago", paymentHandler.HandleWebhook)
+			webhooks.POST("/:provider", paymentHandler.HandleWebhook)
+		}
+
+		// Rotas operacionais
+		admin := v1.Group("/admin", AdminAuth(adminToken))
+		{
+			admin.GET("/outbox/travados", adminHandler.ListStuckEvents)
+			admin.GET("/webhooks/mortos", adminHandler.ListDeadNotifications)
+			admin.POST("/webhooks/:id/reprocessar", adminHandler.ReplayNotification)
+			admin.GET("/log/nivel", adminHandler.GetLogLevel)
+			admin.PUT("/log/nivel", adminHandler.SetLogLevel)
 		}
 	}
 
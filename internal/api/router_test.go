@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/api/handler"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetupRouter_AdminRoutesRequireToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := SetupRouter(handler.NewPaymentHandler(nil), handler.NewAdminHandler(nil, nil), handler.NewHealthHandler(nil), "admin-token")
+
+	routes := []struct{ method, path string }{
+		{http.MethodGet, "/v1/admin/outbox/travados"},
+		{http.MethodGet, "/v1/admin/webhooks/mortos"},
+		{http.MethodPost, "/v1/admin/webhooks/in-1/reprocessar"},
+		{http.MethodGet, "/v1/admin/log/nivel"},
+		{http.MethodPut, "/v1/admin/log/nivel"},
+	}
+	for _, route := range routes {
+		for _, authorization := range []string{"", "admin-token", "Bearer wrong", "Basic admin-token"} {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with %q: expected 401, got %d", route.method, route.path, authorization, w.Code)
+			}
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/log/nivel", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 with the admin token, got %d", w.Code)
+	}
+}
@@ -0,0 +1,129 @@
+// Package config reúne a configuração do serviço em structs tipadas.
+//
+// Cada valor vem, da menor para a maior precedência, do padrão declarado na
+// tag default, do arquivo de CONFIG_FILE (YAML ou TOML), de um arquivo com o
+// nome da variável em CONFIG_SECRETS_DIR (secrets montados pelo Kubernetes) e
+// da variável de ambiente. Load valida tudo de uma vez e devolve um
+// ValidationError listando cada problema.
+//
+// Tags dos campos:
+//
+//	key       caminho no arquivo, relativo à seção (ex.: access_token)
+//	env       variável de ambiente e nome do arquivo em CONFIG_SECRETS_DIR
+//	default   valor usado quando nenhuma fonte define o campo
+//	required  o valor final não pode ser vazio
+//	secret    o valor é mascarado em Redacted
+//	oneof     valores aceitos, separados por vírgula
+//	min       menor valor aceito para inteiros
+package config
+
+import "time"
+
+type Config struct {
+	Server         Server         `key:"server"`
+	AWS            AWS            `key:"aws"`
+	DynamoDB       DynamoDB       `key:"dynamodb"`
+	Store          Store          `key:"store"`
+	MercadoPago    MercadoPago    `key:"mercadopago"`
+	Payments       Payments       `key:"payments"`
+	Webhooks       Webhooks       `key:"webhooks"`
+	Reconciliation Reconciliation `key:"reconciliation"`
+	Expiration     Expiration     `key:"expiration"`
+	Telemetry      Telemetry      `key:"telemetry"`
+	Health         Health         `key:"health"`
+	Admin          Admin          `key:"admin"`
+}
+
+type Server struct {
+	Port         string        `key:"port" env:"PORT" default:"8080" required:"true"`
+	ReadTimeout  time.Duration `key:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"15s"`
+	WriteTimeout time.Duration `key:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout  time.Duration `key:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"60s"`
+	// ShutdownTimeout limita a drenagem das conexões e a parada dos workers
+	// após o SIGTERM; deve caber no terminationGracePeriodSeconds do pod.
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"25s"`
+}
+
+type AWS struct {
+	// Region vazia deixa o SDK resolver a região pelo perfil local.
+	Region string `key:"region" env:"AWS_REGION"`
+	// Endpoint aponta o SDK para outro endereço, como o LocalStack.
+	Endpoint    string `key:"endpoint" env:"AWS_ENDPOINT"`
+	SNSTopicARN string `key:"sns_topic_arn" env:"AWS_SNS_TOPIC_ARN" required:"true"`
+}
+
+// DynamoDB são os nomes das tabelas.
+type DynamoDB struct {
+	Payments     string `key:"payments_table" env:"DYNAMODB_TABLE_NAME" default:"Payments" required:"true"`
+	Outbox       string `key:"outbox_table" env:"DYNAMODB_OUTBOX_TABLE_NAME" default:"PaymentOutbox" required:"true"`
+	History      string `key:"history_table" env:"DYNAMODB_HISTORY_TABLE_NAME" default:"PaymentStatusHistory" required:"true"`
+	Reference    string `key:"reference_table" env:"DYNAMODB_REFERENCE_TABLE_NAME" default:"PaymentExternalReferences" required:"true"`
+	Idempotency  string `key:"idempotency_table" env:"DYNAMODB_IDEMPOTENCY_TABLE_NAME" default:"PaymentIdempotency" required:"true"`
+	Notification string `key:"notification_table" env:"DYNAMODB_NOTIFICATION_TABLE_NAME" default:"PaymentWebhookNotifications" required:"true"`
+	Inbox        string `key:"inbox_table" env:"DYNAMODB_INBOX_TABLE_NAME" default:"PaymentWebhookInbox" required:"true"`
+	Migrations   string `key:"migrations_table" env:"DYNAMODB_MIGRATIONS_TABLE_NAME" default:"PaymentSchemaMigrations" required:"true"`
+}
+
+// Store escolhe onde ficam os pagamentos e o outbox.
+type Store struct {
+	PaymentStore   string `key:"payment_store" env:"PAYMENT_STORE" default:"dynamodb" oneof:"dynamodb,memory,postgres"`
+	DatabaseURL    string `key:"database_url" env:"DATABASE_URL" secret:"true"`
+	MigrateOnStart bool   `key:"migrate_on_start" env:"MIGRATE_ON_START" default:"false"`
+}
+
+type MercadoPago struct {
+	BaseURL            string        `key:"base_url" env:"MERCADO_PAGO_BASE_URL" default:"https://api.mercadopago.com" required:"true"`
+	AccessToken        string        `key:"access_token" env:"MERCADO_PAGO_ACCESS_TOKEN" required:"true" secret:"true"`
+	POSID              string        `key:"pos_id" env:"MERCADO_PAGO_POS_ID" required:"true"`
+	WebhookSecret      string        `key:"webhook_secret" env:"MERCADO_PAGO_WEBHOOK_SECRET" required:"true" secret:"true"`
+	WebhookTolerance   time.Duration `key:"webhook_tolerance" env:"MERCADO_PAGO_WEBHOOK_TOLERANCE" default:"5m"`
+	Timeout            time.Duration `key:"timeout" env:"MERCADO_PAGO_TIMEOUT" default:"10s"`
+	MaxRetries         int           `key:"max_retries" env:"MERCADO_PAGO_MAX_RETRIES" default:"3"`
+	BreakerThreshold   int           `key:"breaker_threshold" env:"MERCADO_PAGO_BREAKER_THRESHOLD" default:"5" min:"1"`
+	BreakerOpenTimeout time.Duration `key:"breaker_open_timeout" env:"MERCADO_PAGO_BREAKER_OPEN_TIMEOUT" default:"30s"`
+}
+
+type Payments struct {
+	// Provider é o gateway usado quando a requisição não escolhe um.
+	Provider        string        `key:"provider" env:"PAYMENT_PROVIDER" default:"mercadopago" required:"true"`
+	ReferencePolicy string        `key:"reference_policy" env:"EXTERNAL_REFERENCE_POLICY" default:"retry_after_failure" oneof:"reject,return_pending,retry_after_failure"`
+	TTL             time.Duration `key:"ttl" env:"PAYMENT_TTL" default:"30m"`
+}
+
+type Webhooks struct {
+	DedupStore string        `key:"dedup_store" env:"WEBHOOK_DEDUP_STORE" default:"dynamodb" oneof:"dynamodb,memory"`
+	DedupTTL   time.Duration `key:"dedup_ttl" env:"WEBHOOK_DEDUP_TTL" default:"72h"`
+	// Async=false processa os webhooks na própria requisição.
+	Async   bool `key:"async" env:"WEBHOOK_ASYNC" default:"true"`
+	Workers int  `key:"workers" env:"WEBHOOK_WORKERS" default:"4" min:"1"`
+}
+
+type Reconciliation struct {
+	// Interval zero desliga a reconciliação periódica.
+	Interval time.Duration `key:"interval" env:"RECONCILIATION_INTERVAL" default:"10m"`
+	Window   time.Duration `key:"window" env:"RECONCILIATION_WINDOW" default:"24h"`
+}
+
+// Expiration configura a varredura dos pagamentos vencidos.
+type Expiration struct {
+	// Interval zero desliga a varredura.
+	Interval time.Duration `key:"interval" env:"EXPIRATION_INTERVAL" default:"30s"`
+}
+
+type Telemetry struct {
+	ServiceName  string `key:"service_name" env:"OTEL_SERVICE_NAME" default:"pagamento"`
+	Version      string `key:"version" env:"OTEL_VERSION" default:"1.0.0"`
+	Environment  string `key:"environment" env:"OTEL_ENVIRONMENT" default:"local"`
+	OTLPEndpoint string `key:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"localhost:4318"`
+}
+
+// Admin protege as rotas operacionais de /v1/admin.
+type Admin struct {
+	Token string `key:"token" env:"ADMIN_TOKEN" required:"true" secret:"true"`
+}
+
+// Health configura a readiness probe.
+type Health struct {
+	CheckTimeout time.Duration `key:"check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2s"`
+	CacheTTL     time.Duration `key:"cache_ttl" env:"HEALTH_CACHE_TTL" default:"5s"`
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequired define as variáveis obrigatórias, isolando o teste do ambiente.
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv(FileEnv, "")
+	t.Setenv(SecretsDirEnv, "")
+	t.Setenv("AWS_SNS_TOPIC_ARN", "arn:aws:sns:us-east-1:000000000000:pagamento")
+	t.Setenv("MERCADO_PAGO_ACCESS_TOKEN", "token")
+	t.Setenv("MERCADO_PAGO_POS_ID", "POS1")
+	t.Setenv("MERCADO_PAGO_WEBHOOK_SECRET", "secret")
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func validationProblems(t *testing.T, err error) []string {
+	t.Helper()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	return validationErr.Problems
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	setRequired(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Port != "8080" || cfg.DynamoDB.Payments != "Payments" || cfg.Store.PaymentStore != "dynamodb" {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+	if cfg.MercadoPago.Timeout != 10*time.Second || cfg.Webhooks.Workers != 4 || !cfg.Webhooks.Async {
+		t.Errorf("expected typed defaults, got %+v", cfg)
+	}
+}
+
+func TestLoad_ReportsEveryMissingValue(t *testing.T) {
+	setRequired(t)
+	t.Setenv("MERCADO_PAGO_ACCESS_TOKEN", "")
+	t.Setenv("MERCADO_PAGO_WEBHOOK_SECRET", "")
+
+	_, err := Load()
+	problems := validationProblems(t, err)
+	expected := []string{
+		"MERCADO_PAGO_ACCESS_TOKEN (mercadopago.access_token) is required",
+		"MERCADO_PAGO_WEBHOOK_SECRET (mercadopago.webhook_secret) is required",
+	}
+	if strings.Join(problems, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+}
+
+func TestLoad_InvalidValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{
+			name:     "duration",
+			env:      map[string]string{"PAYMENT_TTL": "30"},
+			expected: `PAYMENT_TTL (payments.ttl): invalid duration "30"`,
+		},
+		{
+			name:     "negative duration",
+			env:      map[string]string{"RECONCILIATION_WINDOW": "-1h"},
+			expected: "RECONCILIATION_WINDOW (reconciliation.window) must not be negative",
+		},
+		{
+			name:     "boolean",
+			env:      map[string]string{"WEBHOOK_ASYNC": "sim"},
+			expected: `WEBHOOK_ASYNC (webhooks.async): invalid boolean "sim"`,
+		},
+		{
+			name:     "below minimum",
+			env:      map[string]string{"WEBHOOK_WORKERS": "0"},
+			expected: "WEBHOOK_WORKERS (webhooks.workers) must be at least 1, got 0",
+		},
+		{
+			name:     "unknown option",
+			env:      map[string]string{"PAYMENT_STORE": "mysql"},
+			expected: `PAYMENT_STORE (store.payment_store) must be one of dynamodb,memory,postgres, got "mysql"`,
+		},
+		{
+			name:     "postgres without url",
+			env:      map[string]string{"PAYMENT_STORE": "postgres"},
+			expected: "DATABASE_URL (store.database_url) is required when PAYMENT_STORE=postgres",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			problems := validationProblems(t, func() error { _, err := Load(); return err }())
+			if len(problems) != 1 || problems[0] != tt.expected {
+				t.Errorf("expected [%s], got %v", tt.expected, problems)
+			}
+		})
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	setRequired(t)
+	dir := t.TempDir()
+	t.Setenv(FileEnv, writeFile(t, dir, "config.yaml", `
+server:
+  port: 9090
+mercadopago:
+  timeout: 3s
+  max_retries: 1
+  access_token: from-file
+webhooks:
+  async: false
+`))
+	secrets := t.TempDir()
+	t.Setenv(SecretsDirEnv, secrets)
+	writeFile(t, secrets, "MERCADO_PAGO_MAX_RETRIES", "2\n")
+	writeFile(t, secrets, "DATABASE_URL", "postgres://secret\n")
+	t.Setenv("MERCADO_PAGO_ACCESS_TOKEN", "from-env")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Port != "9090" || cfg.MercadoPago.Timeout != 3*time.Second || cfg.Webhooks.Async {
+		t.Errorf("expected values from the file, got %+v", cfg)
+	}
+	if cfg.MercadoPago.MaxRetries != 2 || cfg.Store.DatabaseURL != "postgres://secret" {
+		t.Errorf("expected secrets to override the file, got %+v", cfg)
+	}
+	if cfg.MercadoPago.AccessToken != "from-env" {
+		t.Errorf("expected env to override the file, got %q", cfg.MercadoPago.AccessToken)
+	}
+}
+
+func TestLoad_TOMLFile(t *testing.T) {
+	setRequired(t)
+	t.Setenv(FileEnv, writeFile(t, t.TempDir(), "config.toml", `
+[dynamodb]
+payments_table = "PaymentsStaging"
+
+[reconciliation]
+interval = "0s"
+`))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DynamoDB.Payments != "PaymentsStaging" || cfg.Reconciliation.Interval != 0 {
+		t.Errorf("expected values from the toml file, got %+v", cfg)
+	}
+}
+
+func TestLoad_UnknownFileKey(t *testing.T) {
+	setRequired(t)
+	path := writeFile(t, t.TempDir(), "config.yml", "mercadopago:\n  timout: 3s\n")
+	t.Setenv(FileEnv, path)
+
+	_, err := Load()
+	problems := validationProblems(t, err)
+	if len(problems) != 1 || problems[0] != "unknown key mercadopago.timout in "+path {
+		t.Errorf("expected the typo to be reported, got %v", problems)
+	}
+}
+
+func TestLoad_OnlyValidatesRequestedSections(t *testing.T) {
+	setRequired(t)
+	t.Setenv("MERCADO_PAGO_ACCESS_TOKEN", "")
+	t.Setenv("AWS_SNS_TOPIC_ARN", "")
+
+	if _, err := Load("dynamodb", "store"); err != nil {
+		t.Errorf("expected other sections to be ignored, got %v", err)
+	}
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	cfg := Default()
+	cfg.MercadoPago.AccessToken = "token"
+	cfg.MercadoPago.POSID = "POS1"
+
+	redacted := cfg.Redacted()
+	if redacted["mercadopago.access_token"] != redactedValue {
+		t.Errorf("expected the access token to be masked, got %q", redacted["mercadopago.access_token"])
+	}
+	if redacted["mercadopago.webhook_secret"] != "" {
+		t.Errorf("expected an empty secret to stay empty, got %q", redacted["mercadopago.webhook_secret"])
+	}
+	if redacted["mercadopago.pos_id"] != "POS1" || redacted["mercadopago.timeout"] != "10s" {
+		t.Errorf("expected plain values, got %v", redacted)
+	}
+}
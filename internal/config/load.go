@@ -0,0 +1,273 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FileEnv aponta o arquivo de configuração opcional (.yaml, .yml ou .toml).
+	FileEnv = "CONFIG_FILE"
+	// SecretsDirEnv aponta o diretório com um arquivo por variável, como os
+	// secrets montados como volume no Kubernetes.
+	SecretsDirEnv = "CONFIG_SECRETS_DIR"
+)
+
+// redactedValue substitui os valores secretos em Redacted.
+const redactedValue = "***"
+
+// ValidationError lista todos os valores ausentes ou inválidos encontrados
+// em Load.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// field é um valor folha da configuração, com o caminho no arquivo
+// (ex.: mercadopago.access_token) e as tags do campo.
+type field struct {
+	path  string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+func (f field) section() string {
+	section, _, _ := strings.Cut(f.path, ".")
+	return section
+}
+
+func (f field) name() string {
+	return fmt.Sprintf("%s (%s)", f.tag.Get("env"), f.path)
+}
+
+func fields(cfg *Config) []field {
+	var leaves []field
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			structField := v.Type().Field(i)
+			path := structField.Tag.Get("key")
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			if _, ok := structField.Tag.Lookup("env"); ok {
+				leaves = append(leaves, field{path: path, tag: structField.Tag, value: v.Field(i)})
+				continue
+			}
+			walk(path, v.Field(i))
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+	return leaves
+}
+
+// Default retorna a configuração só com os valores padrão, sem ler nenhuma
+// fonte nem validar. Útil em testes.
+func Default() Config {
+	var cfg Config
+	for _, f := range fields(&cfg) {
+		if value, ok := f.tag.Lookup("default"); ok {
+			if err := set(f.value, value); err != nil {
+				panic(fmt.Sprintf("config: invalid default for %s: %v", f.path, err))
+			}
+		}
+	}
+	return cfg
+}
+
+// Load monta a configuração a partir das fontes descritas no pacote e valida
+// as seções informadas (ex.: "aws", "dynamodb"); sem seções, valida todas.
+func Load(sections ...string) (*Config, error) {
+	values := map[string]string{}
+	if path := os.Getenv(FileEnv); path != "" {
+		fileValues, err := readFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s %s: %w", FileEnv, path, err)
+		}
+		values = fileValues
+	}
+
+	cfg := Default()
+	leaves := fields(&cfg)
+	var problems []string
+	known := make(map[string]bool, len(leaves))
+	for _, f := range leaves {
+		known[f.path] = true
+	}
+	for _, path := range slices.Sorted(maps.Keys(values)) {
+		if !known[path] {
+			problems = append(problems, fmt.Sprintf("unknown key %s in %s", path, os.Getenv(FileEnv)))
+		}
+	}
+
+	secretsDir := os.Getenv(SecretsDirEnv)
+	for _, f := range leaves {
+		env := f.tag.Get("env")
+		if secretsDir != "" {
+			content, err := os.ReadFile(filepath.Join(secretsDir, env))
+			switch {
+			case err == nil:
+				values[f.path] = strings.TrimSpace(string(content))
+			case !errors.Is(err, os.ErrNotExist):
+				return nil, fmt.Errorf("read secret %s: %w", env, err)
+			}
+		}
+		// Variável vazia conta como ausente, como no .env de exemplo.
+		if value := os.Getenv(env); value != "" {
+			values[f.path] = value
+		}
+	}
+
+	for _, f := range leaves {
+		value, ok := values[f.path]
+		if !ok {
+			continue
+		}
+		if err := set(f.value, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.name(), err))
+		}
+	}
+
+	for _, f := range leaves {
+		if len(sections) > 0 && !slices.Contains(sections, f.section()) {
+			continue
+		}
+		problems = append(problems, validateField(f)...)
+	}
+	if len(sections) == 0 || slices.Contains(sections, "store") {
+		if cfg.Store.PaymentStore == "postgres" && cfg.Store.DatabaseURL == "" {
+			problems = append(problems, "DATABASE_URL (store.database_url) is required when PAYMENT_STORE=postgres")
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return &cfg, nil
+}
+
+func validateField(f field) []string {
+	var problems []string
+	if f.tag.Get("required") == "true" && f.value.IsZero() {
+		problems = append(problems, f.name()+" is required")
+	}
+	if oneof, ok := f.tag.Lookup("oneof"); ok {
+		if allowed := strings.Split(oneof, ","); !slices.Contains(allowed, f.value.String()) {
+			problems = append(problems, fmt.Sprintf("%s must be one of %s, got %q", f.name(), oneof, f.value.String()))
+		}
+	}
+	switch f.value.Kind() {
+	case reflect.Int:
+		minimum := 0
+		if value, ok := f.tag.Lookup("min"); ok {
+			minimum, _ = strconv.Atoi(value)
+		}
+		if f.value.Int() < int64(minimum) {
+			problems = append(problems, fmt.Sprintf("%s must be at least %d, got %d", f.name(), minimum, f.value.Int()))
+		}
+	case reflect.Int64:
+		if f.value.Int() < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative", f.name()))
+		}
+	}
+	return problems
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set converte o texto de uma fonte para o tipo do campo.
+func set(v reflect.Value, value string) error {
+	switch {
+	case v.Type() == durationType:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		v.SetInt(int64(duration))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(parsed)
+	case v.Kind() == reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(int64(parsed))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// readFile lê o arquivo de configuração e achata as seções em caminhos
+// (ex.: mercadopago.timeout).
+func readFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	case ".toml":
+		err = toml.Unmarshal(content, &tree)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	flatten("", tree, values)
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]any, values map[string]string) {
+	for key, value := range tree {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		switch value := value.(type) {
+		case map[string]any:
+			flatten(path, value, values)
+		case nil:
+		default:
+			values[path] = fmt.Sprint(value)
+		}
+	}
+}
+
+// Redacted retorna a configuração efetiva por caminho, com os valores
+// secretos mascarados, para o log de inicialização.
+func (c Config) Redacted() map[string]string {
+	redacted := map[string]string{}
+	for _, f := range fields(&c) {
+		value := fmt.Sprint(f.value.Interface())
+		if f.tag.Get("secret") == "true" && value != "" {
+			value = redactedValue
+		}
+		redacted[f.path] = value
+	}
+	return redacted
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// StatusSource identifica o componente que provocou uma mudança de status.
+type StatusSource string
+
+const (
+	SourceAPI            StatusSource = "api"
+	SourceWebhook        StatusSource = "webhook"
+	SourceReconciliation StatusSource = "reconciliation"
+	SourceSweeper        StatusSource = "sweeper"
+)
+
+// StatusAudit acompanha cada mudança de status e é gravado no histórico do
+// pagamento.
+type StatusAudit struct {
+	// PreviousStatus é o status do pagamento antes da mudança, garantido pela
+	// condição de versão; vazio na criação do pagamento.
+	PreviousStatus PaymentStatus
+	Source         StatusSource
+	// ProviderStatus é o status bruto informado pelo gateway, quando houver.
+	ProviderStatus string
+	// NotificationID é o ID da notificação de webhook que motivou a mudança.
+	NotificationID string
+	// Actor é quem pediu a mudança: o gateway ou o componente interno. Fica
+	// vazio nas mudanças pedidas pela API, que não autentica o usuário.
+	Actor string
+	// DeclaredActor é o autor que o cliente da API informou no header
+	// X-Actor. Não é autenticado, então serve só como referência do cliente,
+	// nunca como autor da auditoria.
+	DeclaredActor string
+}
+
+// StatusHistoryEntry é um registro imutável de uma mudança de status. EntryID
+// ordena os registros do pagamento por data.
+type StatusHistoryEntry struct {
+	PaymentID      string        `json:"payment_id" dynamodbav:"payment_id"`
+	EntryID        string        `json:"id" dynamodbav:"entry_id"`
+	PreviousStatus PaymentStatus `json:"previous_status,omitempty" dynamodbav:"previous_status,omitempty"`
+	NewStatus      PaymentStatus `json:"new_status" dynamodbav:"new_status"`
+	Source         StatusSource  `json:"source" dynamodbav:"source"`
+	ProviderStatus string        `json:"provider_status,omitempty" dynamodbav:"provider_status,omitempty"`
+	NotificationID string        `json:"notification_id,omitempty" dynamodbav:"notification_id,omitempty"`
+	Actor          string        `json:"actor,omitempty" dynamodbav:"actor,omitempty"`
+	DeclaredActor  string        `json:"declared_actor,omitempty" dynamodbav:"declared_actor,omitempty"`
+	ChangedAt      time.Time     `json:"changed_at" dynamodbav:"changed_at"`
+}
+
+// NewStatusHistoryEntry monta o registro de histórico de uma mudança de
+// status. O EntryID fica a cargo do repositório.
+func NewStatusHistoryEntry(paymentID string, status PaymentStatus, audit StatusAudit, changedAt time.Time) StatusHistoryEntry {
+	return StatusHistoryEntry{
+		PaymentID:      paymentID,
+		PreviousStatus: audit.PreviousStatus,
+		NewStatus:      status,
+		Source:         audit.Source,
+		ProviderStatus: audit.ProviderStatus,
+		NotificationID: audit.NotificationID,
+		Actor:          audit.Actor,
+		DeclaredActor:  audit.DeclaredActor,
+		ChangedAt:      changedAt,
+	}
+}
+
+type declaredActorKey struct{}
+
+// ContextWithDeclaredActor associa ao contexto o autor que o cliente da API
+// informou, registrado como DeclaredActor no histórico das mudanças de status
+// feitas pela API.
+func ContextWithDeclaredActor(ctx context.Context, actor string) context.Context {
+	if actor == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, declaredActorKey{}, actor)
+}
+
+// DeclaredActorFromContext retorna o autor declarado associado ao contexto ou
+// vazio.
+func DeclaredActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(declaredActorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyExists  = errors.New("idempotency key already exists")
+	ErrIdempotencyConflict   = errors.New("idempotency key reused with a different request")
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")
+	// ErrIdempotencyReservationLost indica que a reserva venceu e foi assumida
+	// por uma repetição antes de a requisição original concluir.
+	ErrIdempotencyReservationLost = errors.New("idempotency reservation was taken over by another request")
+)
+
+// IdempotencyRecord guarda a chave enviada pelo cliente, o fingerprint da
+// requisição original e, depois de concluída, o pagamento devolvido.
+type IdempotencyRecord struct {
+	Key         string   `json:"key" dynamodbav:"idempotency_key"`
+	Fingerprint string   `json:"fingerprint" dynamodbav:"fingerprint"`
+	Payment     *Payment `json:"payment,omitempty" dynamodbav:"payment,omitempty"`
+	// Token identifica a requisição dona da reserva; só ela conclui ou libera
+	// a chave.
+	Token string `json:"token" dynamodbav:"token"`
+	// LockedUntil limita a reserva de uma requisição em andamento: se ela
+	// morrer antes de concluir, uma repetição assume a chave depois disso.
+	LockedUntil time.Time `json:"locked_until" dynamodbav:"locked_until,unixtime"`
+	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" dynamodbav:"expires_at,unixtime"`
+}
+
+// InProgress indica uma requisição ainda em andamento: sem pagamento e com a
+// reserva vigente.
+func (r IdempotencyRecord) InProgress(now time.Time) bool {
+	return r.Payment == nil && now.Before(r.LockedUntil)
+}
+
+type IdempotencyStore interface {
+	// Reserve grava o registro e retorna ErrIdempotencyKeyExists se a chave
+	// já estiver em uso. Uma reserva vencida, sem pagamento e com o mesmo
+	// fingerprint, é assumida pelo novo registro.
+	Reserve(ctx context.Context, record IdempotencyRecord) error
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+	// Complete grava o pagamento se a reserva ainda for de token; senão
+	// retorna ErrIdempotencyReservationLost.
+	Complete(ctx context.Context, key, token string, payment Payment) error
+	// Release apaga a reserva se ela ainda for de token e não tiver sido
+	// concluída.
+	Release(ctx context.Context, key, token string) error
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInboxNotificationNotFound = errors.New("webhook notification not found")
+	// ErrInboxNotificationNotDead é retornado ao reprocessar uma notificação
+	// que ainda não esgotou as tentativas.
+	ErrInboxNotificationNotDead = errors.New("webhook notification is not in the dead-letter store")
+	// ErrInboxNotificationClaimed é retornado quando a notificação está
+	// reservada por outro worker ou não está mais pendente.
+	ErrInboxNotificationClaimed = errors.New("webhook notification is claimed by another worker")
+)
+
+type InboxStatus string
+
+const (
+	InboxPending   InboxStatus = "pending"
+	InboxProcessed InboxStatus = "processed"
+	// InboxDead indica que a notificação esgotou as tentativas e aguarda
+	// inspeção ou reprocessamento manual.
+	InboxDead InboxStatus = "dead"
+)
+
+// InboxNotification é uma notificação de webhook já validada, gravada pelo
+// handler e processada depois pelo WebhookWorker.
+type InboxNotification struct {
+	ID             string `json:"id" dynamodbav:"id"`
+	Provider       string `json:"provider" dynamodbav:"provider"`
+	NotificationID string `json:"notification_id,omitempty" dynamodbav:"notification_id,omitempty"`
+	Type           string `json:"type" dynamodbav:"type"`
+	PaymentID      string `json:"payment_id,omitempty" dynamodbav:"payment_id,omitempty"`
+	ChargeID       string `json:"charge_id,omitempty" dynamodbav:"charge_id,omitempty"`
+	// Body é o corpo recebido, guardado para inspeção.
+	Body          json.RawMessage `json:"body" dynamodbav:"body" swaggertype:"object"`
+	Status        InboxStatus     `json:"status" dynamodbav:"status"`
+	Attempts      int             `json:"attempts" dynamodbav:"attempts"`
+	LastError     string          `json:"last_error,omitempty" dynamodbav:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" dynamodbav:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" dynamodbav:"updated_at"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty" dynamodbav:"processed_at,omitempty"`
+	// ClaimedBy e ClaimExpiresAt identificam o worker que reservou a
+	// notificação para processá-la e até quando a reserva vale.
+	ClaimedBy      string     `json:"claimed_by,omitempty" dynamodbav:"claimed_by,omitempty"`
+	ClaimExpiresAt *time.Time `json:"claim_expires_at,omitempty" dynamodbav:"claim_expires_at,omitempty"`
+	// TraceContext guarda o contexto do trace da requisição do webhook; o
+	// WebhookWorker continua o mesmo trace.
+	TraceContext map[string]string `json:"trace_context,omitempty" dynamodbav:"trace_context,omitempty"`
+}
+
+// Event reconstrói a notificação validada a partir do registro gravado.
+func (n InboxNotification) Event() WebhookEvent {
+	return WebhookEvent{ID: n.NotificationID, Type: n.Type, PaymentID: n.PaymentID, ChargeID: n.ChargeID}
+}
+
+// OrderingKey agrupa as notificações que devem ser processadas em ordem: as
+// do mesmo pagamento, ou da mesma cobrança, no mesmo gateway.
+func (n InboxNotification) OrderingKey() string {
+	switch {
+	case n.PaymentID != "":
+		return n.Provider + ":" + n.PaymentID
+	case n.ChargeID != "":
+		return n.Provider + ":" + n.ChargeID
+	default:
+		return n.ID
+	}
+}
+
+type InboxRepository interface {
+	Save(ctx context.Context, notification InboxNotification) error
+	Get(ctx context.Context, id string) (*InboxNotification, error)
+	// ListPending retorna, em ordem de chegada, notificações pendentes cuja
+	// próxima tentativa já venceu, inclusive as reservadas por outro worker:
+	// elas seguram as seguintes do mesmo pagamento.
+	ListPending(ctx context.Context, now time.Time, limit int) ([]InboxNotification, error)
+	// OldestPending retorna a notificação pendente mais antiga com a chave de
+	// ordenação informada (ver OrderingKey), vencida ou não, ou nil se não
+	// houver nenhuma.
+	OldestPending(ctx context.Context, orderingKey string) (*InboxNotification, error)
+	ListDead(ctx context.Context, limit int) ([]InboxNotification, error)
+	// Claim reserva a notificação para owner até expiresAt e retorna a
+	// notificação reservada. Só reserva notificações pendentes, com a próxima
+	// tentativa vencida e sem reserva vigente em now; as demais retornam
+	// ErrInboxNotificationClaimed.
+	Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (InboxNotification, error)
+	// Update grava o resultado de uma tentativa de processamento e libera a
+	// reserva. Uma notificação com ClaimedBy só é gravada se a reserva ainda
+	// for desse worker; senão retorna ErrInboxNotificationClaimed.
+	Update(ctx context.Context, notification InboxNotification) error
+}
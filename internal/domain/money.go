@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency é assumida para valores legados, gravados apenas como
+// número, e para requisições que não informam a moeda.
+const DefaultCurrency = "BRL"
+
+var (
+	ErrInvalidAmount       = errors.New("amount must be a positive value with at most the currency's decimal places")
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrAmountTooLarge      = errors.New("amount exceeds the currency limit")
+	ErrCurrencyMismatch    = errors.New("currencies do not match")
+)
+
+type currencyInfo struct {
+	// exponent é o número de casas decimais da unidade menor.
+	exponent int
+	// maxUnits é o maior valor aceito em uma cobrança, em unidades menores.
+	maxUnits int64
+}
+
+// currencies lista as moedas ISO-4217 dos países atendidos pelo Mercado Pago.
+var currencies = map[string]currencyInfo{
+	"BRL": {exponent: 2, maxUnits: 1_000_000_00},
+	"ARS": {exponent: 2, maxUnits: 500_000_000_00},
+	"CLP": {exponent: 0, maxUnits: 1_000_000_000},
+	"COP": {exponent: 2, maxUnits: 4_000_000_000_00},
+	"MXN": {exponent: 2, maxUnits: 20_000_000_00},
+	"PEN": {exponent: 2, maxUnits: 4_000_000_00},
+	"UYU": {exponent: 2, maxUnits: 40_000_000_00},
+	"USD": {exponent: 2, maxUnits: 1_000_000_00},
+}
+
+// Money é um valor monetário exato: Units está na unidade menor da moeda
+// (centavos para BRL) e Currency é o código ISO-4217.
+type Money struct {
+	Units    int64  `json:"units" dynamodbav:"units" example:"1050"`
+	Currency string `json:"currency" dynamodbav:"currency" example:"BRL"`
+}
+
+func NewMoney(units int64, currency string) Money {
+	return Money{Units: units, Currency: currency}
+}
+
+// ParseMoney interpreta um decimal na unidade maior ("10.50") e rejeita
+// valores com mais casas do que a moeda permite.
+func ParseMoney(value, currency string) (Money, error) {
+	info, ok := currencies[currency]
+	if !ok {
+		return Money{}, ErrUnsupportedCurrency
+	}
+	units, exact, err := decimalToUnits(value, info.exponent)
+	if err != nil {
+		return Money{}, err
+	}
+	if !exact {
+		return Money{}, ErrInvalidAmount
+	}
+	return Money{Units: units, Currency: currency}, nil
+}
+
+// RoundMoney interpreta um decimal na unidade maior arredondando para a
+// unidade menor, para valores que vieram de float64.
+func RoundMoney(value, currency string) (Money, error) {
+	info, ok := currencies[currency]
+	if !ok {
+		return Money{}, ErrUnsupportedCurrency
+	}
+	units, _, err := decimalToUnits(value, info.exponent)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Units: units, Currency: currency}, nil
+}
+
+func decimalToUnits(value string, exponent int) (int64, bool, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return 0, false, ErrInvalidAmount
+	}
+	rat.Mul(rat, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)))
+
+	// Arredonda para a unidade menor mais próxima, afastando do zero no meio.
+	num, den := rat.Num(), rat.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, false, ErrAmountTooLarge
+	}
+	return quo.Int64(), rem.Sign() == 0, nil
+}
+
+// Validate verifica se o valor é positivo e está dentro do limite da moeda.
+func (m Money) Validate() error {
+	info, ok := currencies[m.Currency]
+	if !ok {
+		return ErrUnsupportedCurrency
+	}
+	if m.Units <= 0 {
+		return ErrInvalidAmount
+	}
+	if m.Units > info.maxUnits {
+		return ErrAmountTooLarge
+	}
+	return nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Units == 0
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Units: m.Units + other.Units, Currency: m.currencyOr(other)}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Units: m.Units - other.Units, Currency: m.currencyOr(other)}
+}
+
+func (m Money) currencyOr(other Money) string {
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+// Decimal formata o valor na unidade maior com as casas da moeda, no formato
+// esperado pelo Mercado Pago ("10.50").
+func (m Money) Decimal() string {
+	exponent := 2
+	if info, ok := currencies[m.Currency]; ok {
+		exponent = info.exponent
+	}
+
+	sign := ""
+	units := m.Units
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	digits := strconv.FormatInt(units, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+func (m Money) String() string {
+	return m.Currency + " " + m.Decimal()
+}
+
+type moneyFields Money
+
+// UnmarshalJSON aceita o formato {"units": 1050, "currency": "BRL"} e, por
+// compatibilidade, um número decimal em reais (10.50).
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var fields moneyFields
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		*m = Money(fields)
+		return nil
+	}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid amount: %w", err)
+	}
+	money, err := ParseMoney(number.String(), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		value    string
+		currency string
+		units    int64
+		err      error
+	}{
+		{"10.50", "BRL", 1050, nil},
+		{"10.5", "BRL", 1050, nil},
+		{"0.1", "BRL", 10, nil},
+		{"1500", "CLP", 1500, nil},
+		{"10.555", "BRL", 0, ErrInvalidAmount},
+		{"10.5", "CLP", 0, ErrInvalidAmount},
+		{"abc", "BRL", 0, ErrInvalidAmount},
+		{"10", "XYZ", 0, ErrUnsupportedCurrency},
+	}
+
+	for _, tc := range cases {
+		money, err := ParseMoney(tc.value, tc.currency)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("ParseMoney(%q, %s): expected error %v, got %v", tc.value, tc.currency, tc.err, err)
+			continue
+		}
+		if err == nil && money.Units != tc.units {
+			t.Errorf("ParseMoney(%q, %s): expected %d units, got %d", tc.value, tc.currency, tc.units, money.Units)
+		}
+	}
+}
+
+func TestRoundMoney(t *testing.T) {
+	money, err := RoundMoney("10.499999999", "BRL")
+	if err != nil || money != NewMoney(1050, "BRL") {
+		t.Errorf("expected BRL 10.50, got %v (%v)", money, err)
+	}
+	if _, err := RoundMoney("10", "XYZ"); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("expected ErrUnsupportedCurrency, got %v", err)
+	}
+}
+
+func TestMoney_Validate(t *testing.T) {
+	cases := map[string]struct {
+		money Money
+		err   error
+	}{
+		"valid":          {NewMoney(1050, "BRL"), nil},
+		"zero":           {NewMoney(0, "BRL"), ErrInvalidAmount},
+		"negative":       {NewMoney(-1, "BRL"), ErrInvalidAmount},
+		"over the limit": {NewMoney(1_000_000_01, "BRL"), ErrAmountTooLarge},
+		"unknown":        {NewMoney(100, "XYZ"), ErrUnsupportedCurrency},
+		"no currency":    {NewMoney(100, ""), ErrUnsupportedCurrency},
+	}
+
+	for name, tc := range cases {
+		if err := tc.money.Validate(); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestMoney_Decimal(t *testing.T) {
+	cases := map[Money]string{
+		NewMoney(1050, "BRL"): "10.50",
+		NewMoney(5, "BRL"):    "0.05",
+		NewMoney(0, "BRL"):    "0.00",
+		NewMoney(-150, "BRL"): "-1.50",
+		NewMoney(1500, "CLP"): "1500",
+	}
+
+	for money, expected := range cases {
+		if got := money.Decimal(); got != expected {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var legacy CreatePaymentRequest
+	if err := json.Unmarshal([]byte(`{"amount": 10.5}`), &legacy); err != nil {
+		t.Fatalf("expected legacy number to be accepted, got %v", err)
+	}
+	if legacy.Amount != NewMoney(1050, "BRL") {
+		t.Errorf("unexpected legacy amount: %+v", legacy.Amount)
+	}
+
+	var current CreatePaymentRequest
+	if err := json.Unmarshal([]byte(`{"amount": {"units": 1500, "currency": "CLP"}}`), &current); err != nil {
+		t.Fatalf("expected object to be accepted, got %v", err)
+	}
+	if current.Amount != NewMoney(1500, "CLP") {
+		t.Errorf("unexpected amount: %+v", current.Amount)
+	}
+
+	var invalid CreatePaymentRequest
+	if err := json.Unmarshal([]byte(`{"amount": 10.555}`), &invalid); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected ErrInvalidAmount for three decimals, got %v", err)
+	}
+
+	data, _ := json.Marshal(NewMoney(1050, "BRL"))
+	if string(data) != `{"units":1050,"currency":"BRL"}` {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+}
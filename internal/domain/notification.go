@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotificationProcessed = errors.New("webhook notification already processed")
+
+// ProcessedNotification marca uma notificação de webhook já recebida. Key
+// combina o gateway e o ID da notificação.
+type ProcessedNotification struct {
+	Key       string    `json:"key" dynamodbav:"notification_key"`
+	Provider  string    `json:"provider" dynamodbav:"provider"`
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" dynamodbav:"expires_at,unixtime"`
+}
+
+// NotificationStore deduplica as notificações de webhook que o gateway
+// reentrega.
+type NotificationStore interface {
+	// Reserve grava a notificação e retorna ErrNotificationProcessed se ela já
+	// foi recebida e ainda não expirou.
+	Reserve(ctx context.Context, notification ProcessedNotification) error
+	// Release apaga a reserva de uma notificação cujo processamento falhou,
+	// para que a reentrega seja processada.
+	Release(ctx context.Context, key string) error
+}
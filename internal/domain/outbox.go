@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrOutboxEventNotFound = errors.New("outbox event not found")
+	// ErrOutboxEventClaimed é retornado quando o evento está reservado por
+	// outro relay ou não está mais pendente.
+	ErrOutboxEventClaimed = errors.New("outbox event is claimed by another relay")
+)
+
+const (
+	EventTypePaymentProcessed = "payment_processed"
+	EventTypePaymentRefunded  = "payment_refunded"
+	EventTypePaymentExpired   = "payment_expired"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	// OutboxFailed indica que o evento esgotou as tentativas de publicação.
+	OutboxFailed OutboxStatus = "failed"
+)
+
+// OutboxEvent é gravado na mesma transação da mudança de status e publicado
+// depois pelo relay.
+type OutboxEvent struct {
+	ID        string `json:"id" dynamodbav:"id"`
+	EventType string `json:"event_type" dynamodbav:"event_type"`
+	PaymentID string `json:"payment_id" dynamodbav:"payment_id"`
+	// Payload é o JSON publicado no SNS, com o formato definido por EventType.
+	Payload       json.RawMessage `json:"payload" dynamodbav:"payload" swaggertype:"object"`
+	Status        OutboxStatus    `json:"status" dynamodbav:"status"`
+	Attempts      int             `json:"attempts" dynamodbav:"attempts"`
+	LastError     string          `json:"last_error,omitempty" dynamodbav:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" dynamodbav:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" dynamodbav:"updated_at"`
+	SentAt        *time.Time      `json:"sent_at,omitempty" dynamodbav:"sent_at,omitempty"`
+	// ClaimedBy e ClaimExpiresAt identificam o relay que reservou o evento
+	// para publicá-lo e até quando a reserva vale.
+	ClaimedBy      string     `json:"claimed_by,omitempty" dynamodbav:"claimed_by,omitempty"`
+	ClaimExpiresAt *time.Time `json:"claim_expires_at,omitempty" dynamodbav:"claim_expires_at,omitempty"`
+	// TraceContext guarda o contexto do trace (traceparent) em que o evento
+	// foi gerado; a publicação continua o mesmo trace.
+	TraceContext map[string]string `json:"trace_context,omitempty" dynamodbav:"trace_context,omitempty"`
+}
+
+// NewOutboxEvent serializa o payload e monta um evento pendente.
+func NewOutboxEvent(id, eventType, paymentID string, payload interface{}, now time.Time) (OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+	return OutboxEvent{
+		ID:            id,
+		EventType:     eventType,
+		PaymentID:     paymentID,
+		Payload:       data,
+		Status:        OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+type OutboxRepository interface {
+	// ListPending retorna eventos pendentes cuja próxima tentativa já venceu e
+	// que não estão reservados por outro relay.
+	ListPending(ctx context.Context, now time.Time, limit int) ([]OutboxEvent, error)
+	// Claim reserva o evento para owner até expiresAt e retorna o evento
+	// reservado. Só reserva eventos pendentes, com a próxima tentativa vencida e
+	// sem reserva vigente em now; os demais retornam ErrOutboxEventClaimed.
+	Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (OutboxEvent, error)
+	// ListStuck retorna eventos que falharam definitivamente ou que estão
+	// pendentes desde antes de olderThan.
+	ListStuck(ctx context.Context, olderThan time.Time, limit int) ([]OutboxEvent, error)
+	// UpdateDelivery grava o resultado de uma tentativa de publicação de um
+	// evento existente e libera a reserva. Um evento com ClaimedBy só é gravado
+	// se a reserva ainda for desse relay; senão retorna ErrOutboxEventClaimed.
+	UpdateDelivery(ctx context.Context, event OutboxEvent) error
+}
@@ -2,72 +2,259 @@ package domain
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 )
 
 type PaymentStatus string
 
 const (
-	StatusPending  PaymentStatus = "pending"
-	StatusApproved PaymentStatus = "approved"
-	StatusRejected PaymentStatus = "rejected"
+	StatusPending           PaymentStatus = "pending"
+	StatusAuthorized        PaymentStatus = "authorized"
+	StatusApproved          PaymentStatus = "approved"
+	StatusRejected          PaymentStatus = "rejected"
+	StatusCancelled         PaymentStatus = "cancelled"
+	StatusExpired           PaymentStatus = "expired"
+	StatusRefunded          PaymentStatus = "refunded"
+	StatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	StatusChargedBack       PaymentStatus = "charged_back"
 )
 
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	ErrInvalidCursor   = errors.New("invalid pagination cursor")
+	// ErrMissingProviderReference indica que o pagamento não tem os IDs do
+	// gateway necessários para a operação.
+	ErrMissingProviderReference = errors.New("payment has no provider reference")
+	// ErrPaymentAlreadyExists impede que Save sobrescreva um pagamento.
+	ErrPaymentAlreadyExists = errors.New("payment already exists")
+	// ErrConcurrentModification indica que o pagamento foi alterado por outra
+	// escrita depois de lido.
+	ErrConcurrentModification = errors.New("payment was modified concurrently")
+)
+
+// ConcurrentModificationError descreve uma escrita recusada porque a versão
+// gravada não é mais a versão lida.
+type ConcurrentModificationError struct {
+	PaymentID string
+	Expected  int64
+	Current   int64
+}
+
+func (e *ConcurrentModificationError) Error() string {
+	return fmt.Sprintf("%s: payment %s at version %d, expected %d", ErrConcurrentModification, e.PaymentID, e.Current, e.Expected)
+}
+
+func (e *ConcurrentModificationError) Is(target error) bool {
+	return target == ErrConcurrentModification
+}
+
 type Payment struct {
-	ID                string        `json:"id" dynamodbav:"id"`
-	ExternalReference string        `json:"external_reference" dynamodbav:"external_reference"`
-	Amount            float64       `json:"amount" dynamodbav:"amount"`
-	Status            PaymentStatus `json:"status" dynamodbav:"status"`
-	QRCode            string        `json:"qr_code" dynamodbav:"qr_code"`
-	CreatedAt         time.Time     `json:"created_at" dynamodbav:"created_at"`
-	UpdatedAt         time.Time     `json:"updated_at" dynamodbav:"updated_at"`
+	ID                string `json:"id" dynamodbav:"id"`
+	ExternalReference string `json:"external_reference" dynamodbav:"external_reference"`
+	// Amount e RefundedAmount saem no JSON como decimais na unidade maior,
+	// com a moeda em currency (ver MarshalJSON).
+	Amount Money         `json:"amount" dynamodbav:"amount" swaggertype:"number" example:"10.5"`
+	Status PaymentStatus `json:"status" dynamodbav:"status"`
+	QRCode string        `json:"qr_code" dynamodbav:"qr_code"`
+	// Provider é o gateway da cobrança; vazio nos itens antigos, que são do
+	// Mercado Pago (ver ProviderName).
+	Provider string `json:"provider" dynamodbav:"provider,omitempty"`
+	// ProviderChargeID e ProviderPaymentID mantêm os nomes de atributo da
+	// época em que só havia o Mercado Pago.
+	ProviderChargeID  string   `json:"provider_charge_id,omitempty" dynamodbav:"mp_order_id,omitempty"`
+	ProviderPaymentID string   `json:"provider_payment_id,omitempty" dynamodbav:"mp_payment_id,omitempty"`
+	RefundedAmount    Money    `json:"refunded_amount" dynamodbav:"refunded_amount" swaggertype:"number" example:"0"`
+	Refunds           []Refund `json:"refunds,omitempty" dynamodbav:"refunds,omitempty"`
+	// ExpiresAt é o prazo para pagamento do QR; depois dele o pagamento
+	// pendente é expirado e a cobrança cancelada no gateway.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" dynamodbav:"updated_at"`
+	// PreviousAttemptID é o pagamento da mesma referência externa que esta
+	// tentativa substituiu (ver ReferencePolicyRetryAfterFailure).
+	PreviousAttemptID string `json:"previous_attempt_id,omitempty" dynamodbav:"previous_attempt_id,omitempty"`
+	// Version é incrementada a cada escrita e usada como condição nas
+	// atualizações; itens antigos, sem o atributo, estão na versão 0.
+	Version int64 `json:"version" dynamodbav:"version"`
 }
 
-type CreatePaymentRequest struct {
-	ExternalReference string  `json:"external_reference" binding:"required"`
-	Amount            float64 `json:"amount" binding:"required"`
-	Description       string  `json:"description" binding:"required"`
-}
-
-type MPWebhookNotification struct {
-	ID          interface{} `json:"id"`
-	LiveMode    bool        `json:"live_mode"`
-	Type        string      `json:"type"`
-	DateCreated string      `json:"date_created"`
-	UserID      string      `json:"user_id"`
-	APIVersion  string      `json:"api_version"`
-	Action      string      `json:"action"`
-		Data     struct {
-			ID string `json:"id"`
-		} `json:"data"`
+// ProviderName retorna o gateway do pagamento, considerando os itens antigos.
+func (p Payment) ProviderName() string {
+	if p.Provider == "" {
+		return LegacyProvider
+	}
+	return p.Provider
+}
+
+type paymentFields Payment
+
+// paymentJSON é o formato da resposta da API: amount e refunded_amount
+// continuam números em reais, como antes do tipo Money, e currency traz a
+// moeda dos dois.
+type paymentJSON struct {
+	paymentFields
+	Amount         json.Number `json:"amount"`
+	Currency       string      `json:"currency"`
+	RefundedAmount json.Number `json:"refunded_amount"`
+}
+
+func (p Payment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(paymentJSON{
+		paymentFields:  paymentFields(p),
+		Amount:         json.Number(p.Amount.Decimal()),
+		Currency:       p.Amount.Currency,
+		RefundedAmount: json.Number(p.RefundedAmount.Decimal()),
+	})
+}
+
+// UnmarshalJSON lê o formato de MarshalJSON; sem currency vale
+// DefaultCurrency.
+func (p *Payment) UnmarshalJSON(data []byte) error {
+	var v paymentJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
 	}
-	
-	// Interfaces para Mocking e Desacoplamento
-	type PaymentRepository interface {
-		Save(ctx context.Context, payment Payment) error
-		GetByID(ctx context.Context, id string) (*Payment, error)
-		GetByExternalReference(ctx context.Context, ref string) (*Payment, error)
-		UpdateStatus(ctx context.Context, id string, status PaymentStatus) error
+	currency := v.Currency
+	if currency == "" {
+		currency = DefaultCurrency
 	}
-	
-	type MPPaymentResponse struct {
-		ID                int64  `json:"id"`
-		Status            string `json:"status"`
-		ExternalReference string `json:"external_reference"`
+	amount, err := parseDecimalField("amount", v.Amount, currency)
+	if err != nil {
+		return err
 	}
-	
-	type MercadoPagoClient interface {
-		CreateQRCodeOrder(ctx context.Context, req CreatePaymentRequest) (string, error)
-		GetPaymentDetails(ctx context.Context, paymentID string) (*MPPaymentResponse, error)
+	refunded, err := parseDecimalField("refunded_amount", v.RefundedAmount, currency)
+	if err != nil {
+		return err
 	}
+	*p = Payment(v.paymentFields)
+	p.Amount = amount
+	p.RefundedAmount = refunded
+	return nil
+}
 
-	type PaymentProcessedEvent struct {
-		PaymentID         string        `json:"payment_id"`
-		ExternalReference string        `json:"external_reference"`
-		Status            PaymentStatus `json:"status"`
-		ProcessedAt       time.Time     `json:"processed_at"`
+func parseDecimalField(name string, value json.Number, currency string) (Money, error) {
+	if value == "" {
+		return Money{Currency: currency}, nil
+	}
+	money, err := ParseMoney(string(value), currency)
+	if err != nil {
+		return Money{}, fmt.Errorf("%s: %w", name, err)
 	}
+	return money, nil
+}
+
+// StatusChange descreve uma transição de status e os dados gravados junto
+// com ela.
+type StatusChange struct {
+	Status PaymentStatus
+	// ProviderPaymentID, quando informado, associa o pagamento do gateway.
+	ProviderPaymentID string
+	// Refund, quando informado, é anexado a Payment.Refunds e
+	// Payment.RefundedAmount passa a ser RefundedAmount, o novo total estornado.
+	Refund         *Refund
+	RefundedAmount Money
+	// Version é a versão lida do pagamento; a gravação falha com
+	// ErrConcurrentModification se outra escrita a alterou.
+	Version int64
+	// Audit descreve a origem da mudança e é gravado no histórico.
+	Audit StatusAudit
+}
 
-	type PaymentEventPublisher interface {
-		PublishPaymentProcessed(ctx context.Context, event PaymentProcessedEvent) error
+type CreatePaymentRequest struct {
+	ExternalReference string `json:"external_reference" binding:"required"`
+	// Amount aceita {"units": 1050, "currency": "BRL"} ou, como antes, um
+	// número em reais.
+	Amount      Money  `json:"amount"`
+	Description string `json:"description" binding:"required"`
+	// Provider escolhe o gateway; vazio usa o padrão configurado.
+	Provider string `json:"provider,omitempty"`
+	// ExpiresIn é o prazo de pagamento em segundos; sem ele vale o padrão do
+	// serviço.
+	ExpiresIn int `json:"expires_in,omitempty" binding:"omitempty,min=60,max=86400"`
+	// IdempotencyKey vem do header Idempotency-Key e não faz parte do corpo.
+	IdempotencyKey string `json:"-"`
+}
+
+// Validate verifica o valor da cobrança; a moeda padrão é BRL.
+func (r *CreatePaymentRequest) Validate() error {
+	if r.Amount.Currency == "" {
+		r.Amount.Currency = DefaultCurrency
 	}
+	return r.Amount.Validate()
+}
+
+// Fingerprint identifica o conteúdo da requisição para detectar reuso de uma
+// mesma chave de idempotência com corpos diferentes.
+func (r CreatePaymentRequest) Fingerprint() string {
+	payload, _ := json.Marshal(r)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// PaymentFilter define os critérios de listagem. Cursor é o token opaco
+// devolvido em PaymentPage.NextCursor pela página anterior.
+type PaymentFilter struct {
+	ExternalReference string        `form:"external_reference"`
+	Status            PaymentStatus `form:"status"`
+	CreatedFrom       *time.Time    `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo         *time.Time    `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedFrom       *time.Time    `form:"updated_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit             int           `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor            string        `form:"cursor"`
+}
+
+type PaymentPage struct {
+	Items      []Payment `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// Interfaces para Mocking e Desacoplamento
+type PaymentRepository interface {
+	// Save grava um pagamento novo e o primeiro registro do histórico, com o
+	// autor declarado de DeclaredActorFromContext. Retorna
+	// ErrPaymentAlreadyExists se o ID já existe e
+	// ErrDuplicateExternalReference se a referência externa já tem outro
+	// pagamento que não seja PreviousAttemptID.
+	Save(ctx context.Context, payment Payment) error
+	GetByID(ctx context.Context, id string) (*Payment, error)
+	// GetByExternalReference retorna a tentativa mais recente da referência.
+	GetByExternalReference(ctx context.Context, ref string) (*Payment, error)
+	List(ctx context.Context, filter PaymentFilter) (*PaymentPage, error)
+	// UpdateStatus grava a mudança de status e, na mesma transação, o registro
+	// de histórico e os eventos de outbox informados. A versão do pagamento é
+	// incrementada.
+	UpdateStatus(ctx context.Context, id string, change StatusChange, events ...OutboxEvent) error
+	// ListExpired retorna pagamentos pendentes com expires_at anterior a now.
+	ListExpired(ctx context.Context, now time.Time, limit int) ([]Payment, error)
+	// History retorna o histórico de status do pagamento, do mais antigo ao
+	// mais recente.
+	History(ctx context.Context, paymentID string) ([]StatusHistoryEntry, error)
+}
+
+type PaymentProcessedEvent struct {
+	PaymentID         string        `json:"payment_id"`
+	ExternalReference string        `json:"external_reference"`
+	Status            PaymentStatus `json:"status"`
+	ProcessedAt       time.Time     `json:"processed_at"`
+}
+
+type PaymentExpiredEvent struct {
+	PaymentID         string    `json:"payment_id"`
+	ExternalReference string    `json:"external_reference"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	ExpiredAt         time.Time `json:"expired_at"`
+}
+
+type PaymentEventPublisher interface {
+	Publish(ctx context.Context, eventType string, payload []byte) error
+}
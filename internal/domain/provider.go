@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// LegacyProvider é o gateway dos pagamentos gravados antes de Payment.Provider
+// existir.
+const LegacyProvider = "mercadopago"
+
+var (
+	ErrUnknownProvider         = errors.New("unknown payment provider")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrInvalidWebhookPayload   = errors.New("invalid webhook payload")
+	ErrOperationNotSupported   = errors.New("operation not supported by the payment provider")
+	// ErrProviderUnavailable indica que o gateway está fora do ar ou
+	// limitando requisições, inclusive com o disjuntor aberto.
+	ErrProviderUnavailable = errors.New("payment provider unavailable")
+)
+
+// ProviderCharge é a cobrança criada no gateway, como a ordem QR do Mercado
+// Pago. Nas consultas (GetCharge) vem com o status atual traduzido: pending
+// enquanto aberta, approved quando paga, cancelled ou expired quando fechada
+// sem pagamento.
+type ProviderCharge struct {
+	ID                string
+	QRData            string
+	ExternalReference string
+	Status            PaymentStatus
+	RawStatus         string
+	// PaymentIDs são os pagamentos do gateway feitos na cobrança.
+	PaymentIDs []string
+	// Linked indica uma cobrança vinculada à criada por CreateCharge, como a
+	// merchant order do Mercado Pago. O ID dela não é o de
+	// Payment.ProviderChargeID; a tentativa é identificada pelos pagamentos.
+	Linked bool
+}
+
+// ProviderPayment é um pagamento do gateway com o status já traduzido para a
+// máquina de estados local. RawStatus guarda o status original para logs.
+type ProviderPayment struct {
+	ID                string
+	ExternalReference string
+	Status            PaymentStatus
+	RawStatus         string
+	// StatusDetail é o motivo informado pelo gateway, como o de uma recusa
+	// (ex.: cc_rejected_insufficient_amount).
+	StatusDetail string
+	// Refunds são os estornos feitos no gateway, quando ele os informa.
+	Refunds []ProviderRefund
+}
+
+type ProviderRefund struct {
+	ID     string
+	Status string
+	Amount Money
+}
+
+// WebhookRequest é a requisição HTTP recebida do gateway, sem interpretação.
+type WebhookRequest struct {
+	Headers http.Header
+	Query   url.Values
+	Body    []byte
+}
+
+// WebhookEvent é uma notificação já validada. Notificações de pagamento
+// trazem PaymentID e as de cobrança (ordens), ChargeID; sem nenhum dos dois, o
+// tópico não altera pagamentos. ID identifica a notificação, e se repete
+// quando o gateway reenvia a mesma notificação.
+type WebhookEvent struct {
+	ID        string
+	Type      string
+	PaymentID string
+	ChargeID  string
+}
+
+// PaymentProvider abstrai um gateway de pagamento (Mercado Pago, Pix direto,
+// adquirentes de cartão). Operações que o gateway não oferece retornam
+// ErrOperationNotSupported.
+type PaymentProvider interface {
+	Name() string
+	CreateCharge(ctx context.Context, req CreatePaymentRequest) (*ProviderCharge, error)
+	GetPayment(ctx context.Context, providerPaymentID string) (*ProviderPayment, error)
+	// SearchPayments lista os pagamentos de uma external_reference, do mais
+	// recente para o mais antigo.
+	SearchPayments(ctx context.Context, externalReference string) ([]ProviderPayment, error)
+	// RefundPayment estorna o pagamento; amount nil estorna o valor total.
+	RefundPayment(ctx context.Context, providerPaymentID string, amount *Money, idempotencyKey string) (*ProviderRefund, error)
+	// GetCharge consulta uma cobrança e o seu status atual.
+	GetCharge(ctx context.Context, chargeID string) (*ProviderCharge, error)
+	// CancelCharge cancela uma cobrança que ainda não foi paga.
+	CancelCharge(ctx context.Context, chargeID string, idempotencyKey string) error
+	// ParseWebhook valida a assinatura e interpreta a notificação.
+	ParseWebhook(ctx context.Context, req WebhookRequest) (*WebhookEvent, error)
+}
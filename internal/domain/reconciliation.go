@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// ReconciliationAction descreve o que a reconciliação fez com uma divergência.
+type ReconciliationAction string
+
+const (
+	// ReconciliationCorrected indica que o status local foi corrigido.
+	ReconciliationCorrected ReconciliationAction = "corrected"
+	// ReconciliationManualReview indica uma divergência que a máquina de
+	// estados não permite corrigir automaticamente.
+	ReconciliationManualReview ReconciliationAction = "manual_review"
+	// ReconciliationNotFound indica que o gateway não tem pagamento para
+	// um status local que exigiria um.
+	ReconciliationNotFound ReconciliationAction = "not_found_in_provider"
+	ReconciliationError    ReconciliationAction = "error"
+)
+
+// Discrepancy é uma linha do relatório de reconciliação.
+type Discrepancy struct {
+	PaymentID         string               `json:"payment_id"`
+	ExternalReference string               `json:"external_reference"`
+	Provider          string               `json:"provider"`
+	LocalStatus       PaymentStatus        `json:"local_status"`
+	ProviderStatus    PaymentStatus        `json:"provider_status,omitempty"`
+	ProviderPaymentID string               `json:"provider_payment_id,omitempty"`
+	Action            ReconciliationAction `json:"action"`
+	Error             string               `json:"error,omitempty"`
+}
+
+type ReconciliationReport struct {
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Checked       int           `json:"checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDuplicateExternalReference indica que a referência externa já tem um
+// pagamento que a política não permite substituir.
+var ErrDuplicateExternalReference = errors.New("external reference already has an active payment")
+
+// ReferencePolicy define o que acontece ao criar um pagamento para uma
+// referência externa (ordem de serviço) que já tem um.
+type ReferencePolicy string
+
+const (
+	// ReferencePolicyReject recusa qualquer novo pagamento para a referência.
+	ReferencePolicyReject ReferencePolicy = "reject"
+	// ReferencePolicyReturnPending devolve o pagamento existente enquanto ele
+	// estiver pendente e recusa nos demais casos.
+	ReferencePolicyReturnPending ReferencePolicy = "return_pending"
+	// ReferencePolicyRetryAfterFailure permite uma nova tentativa depois que a
+	// anterior foi recusada, cancelada ou expirou.
+	ReferencePolicyRetryAfterFailure ReferencePolicy = "retry_after_failure"
+)
+
+// ParseReferencePolicy valida o nome da política; vazio usa
+// ReferencePolicyRetryAfterFailure.
+func ParseReferencePolicy(value string) (ReferencePolicy, error) {
+	switch policy := ReferencePolicy(value); policy {
+	case "":
+		return ReferencePolicyRetryAfterFailure, nil
+	case ReferencePolicyReject, ReferencePolicyReturnPending, ReferencePolicyRetryAfterFailure:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown external reference policy: %q", value)
+	}
+}
+
+// IsFailed informa se o pagamento terminou sem ser pago e a referência pode
+// receber uma nova tentativa.
+func (s PaymentStatus) IsFailed() bool {
+	switch s {
+	case StatusRejected, StatusCancelled, StatusExpired:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefundAmount = errors.New("refund amount must be positive")
+	ErrRefundExceedsAmount = errors.New("refund amount exceeds the remaining balance")
+	// ErrRefundKeyRequired é retornado para estornos sem chave de
+	// idempotência: sem ela, repetir a requisição estornaria de novo.
+	ErrRefundKeyRequired = errors.New("refunds require an Idempotency-Key")
+	// ErrRefundNotRecorded indica um estorno feito no gateway que não pôde ser
+	// gravado. Repetir a requisição com a mesma chave de idempotência, ou a
+	// notificação do gateway, registra o estorno sem estornar de novo.
+	ErrRefundNotRecorded = errors.New("refund executed in the payment provider but not recorded locally")
+)
+
+// Refund é o registro filho de um estorno total ou parcial do pagamento.
+type Refund struct {
+	ID               string    `json:"id" dynamodbav:"id"`
+	ProviderRefundID string    `json:"provider_refund_id" dynamodbav:"mp_refund_id"`
+	Amount           Money     `json:"amount" dynamodbav:"amount"`
+	Reason           string    `json:"reason,omitempty" dynamodbav:"reason,omitempty"`
+	Status           string    `json:"status" dynamodbav:"status"`
+	CreatedAt        time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+type RefundRequest struct {
+	// Amount vazio estorna todo o saldo restante.
+	Amount *Money `json:"amount,omitempty"`
+	Reason string `json:"reason"`
+	// IdempotencyKey vem do header Idempotency-Key e não faz parte do corpo.
+	IdempotencyKey string `json:"-"`
+}
+
+type PaymentRefundedEvent struct {
+	PaymentID         string        `json:"payment_id"`
+	ExternalReference string        `json:"external_reference"`
+	RefundID          string        `json:"refund_id"`
+	Amount            Money         `json:"amount"`
+	TotalRefunded     Money         `json:"total_refunded"`
+	Status            PaymentStatus `json:"status"`
+	RefundedAt        time.Time     `json:"refunded_at"`
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidTransition = errors.New("invalid payment status transition")
+
+// TransitionError descreve uma transição recusada pela máquina de estados.
+type TransitionError struct {
+	From PaymentStatus
+	To   PaymentStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s: %s -> %s", ErrInvalidTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// transitions é a tabela de transições permitidas. Estados sem entrada são
+// terminais.
+var transitions = map[PaymentStatus][]PaymentStatus{
+	StatusPending: {
+		StatusAuthorized, StatusApproved, StatusRejected, StatusCancelled, StatusExpired,
+	},
+	StatusAuthorized: {
+		StatusApproved, StatusRejected, StatusCancelled, StatusExpired,
+	},
+	// Um QR recusado pode ser pago novamente pelo cliente na mesma ordem.
+	StatusRejected: {
+		StatusAuthorized, StatusApproved,
+	},
+	StatusApproved: {
+		StatusPartiallyRefunded, StatusRefunded, StatusChargedBack,
+	},
+	StatusPartiallyRefunded: {
+		StatusPartiallyRefunded, StatusRefunded, StatusChargedBack,
+	},
+}
+
+var allStatuses = []PaymentStatus{
+	StatusPending,
+	StatusAuthorized,
+	StatusApproved,
+	StatusRejected,
+	StatusCancelled,
+	StatusExpired,
+	StatusRefunded,
+	StatusPartiallyRefunded,
+	StatusChargedBack,
+}
+
+func (s PaymentStatus) IsValid() bool {
+	for _, status := range allStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (s PaymentStatus) IsTerminal() bool {
+	return s.IsValid() && len(transitions[s]) == 0
+}
+
+func (s PaymentStatus) CanTransitionTo(to PaymentStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition retorna um *TransitionError quando from -> to não é
+// permitido.
+func ValidateTransition(from, to PaymentStatus) error {
+	if !from.CanTransitionTo(to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// SourceStatuses lista os estados a partir dos quais é possível chegar em to.
+// Usado pelos repositórios para condicionar a escrita.
+func SourceStatuses(to PaymentStatus) []PaymentStatus {
+	var sources []PaymentStatus
+	for _, from := range allStatuses {
+		if from.CanTransitionTo(to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	cases := []struct {
+		from, to PaymentStatus
+		allowed  bool
+	}{
+		{StatusPending, StatusApproved, true},
+		{StatusPending, StatusAuthorized, true},
+		{StatusPending, StatusExpired, true},
+		{StatusAuthorized, StatusApproved, true},
+		{StatusApproved, StatusRefunded, true},
+		{StatusApproved, StatusPartiallyRefunded, true},
+		{StatusPartiallyRefunded, StatusPartiallyRefunded, true},
+		{StatusPartiallyRefunded, StatusRefunded, true},
+		{StatusRejected, StatusApproved, true},
+		{StatusApproved, StatusPending, false},
+		{StatusApproved, StatusRejected, false},
+		{StatusRefunded, StatusApproved, false},
+		{StatusCancelled, StatusApproved, false},
+		{StatusExpired, StatusPending, false},
+		{StatusPending, StatusRefunded, false},
+	}
+
+	for _, tc := range cases {
+		err := ValidateTransition(tc.from, tc.to)
+		if tc.allowed && err != nil {
+			t.Errorf("%s -> %s: expected allowed, got %v", tc.from, tc.to, err)
+		}
+		if !tc.allowed {
+			var transitionErr *TransitionError
+			if !errors.As(err, &transitionErr) || !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("%s -> %s: expected TransitionError, got %v", tc.from, tc.to, err)
+			}
+		}
+	}
+}
+
+func TestPaymentStatus_IsTerminal(t *testing.T) {
+	for _, status := range []PaymentStatus{StatusCancelled, StatusExpired, StatusRefunded, StatusChargedBack} {
+		if !status.IsTerminal() {
+			t.Errorf("expected %s to be terminal", status)
+		}
+	}
+	for _, status := range []PaymentStatus{StatusPending, StatusApproved, StatusPartiallyRefunded} {
+		if status.IsTerminal() {
+			t.Errorf("expected %s not to be terminal", status)
+		}
+	}
+	if PaymentStatus("unknown").IsValid() {
+		t.Error("expected unknown status to be invalid")
+	}
+}
+
+func TestSourceStatuses(t *testing.T) {
+	if sources := SourceStatuses(StatusPending); len(sources) != 0 {
+		t.Errorf("expected no way back to pending, got %v", sources)
+	}
+
+	sources := SourceStatuses(StatusApproved)
+	expected := map[PaymentStatus]bool{StatusPending: true, StatusAuthorized: true, StatusRejected: true}
+	if len(sources) != len(expected) {
+		t.Fatalf("expected %d sources, got %v", len(expected), sources)
+	}
+	for _, s := range sources {
+		if !expected[s] {
+			t.Errorf("unexpected source %s", s)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package health confere as dependências do serviço para a readiness probe.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultCheckTimeout = 2 * time.Second
+	DefaultCacheTTL     = 5 * time.Second
+)
+
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Checker confere uma dependência; nil significa disponível.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapta uma função a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Dependency é uma dependência conferida pela Readiness. Uma dependência
+// crítica fora do ar deixa o serviço indisponível; as demais só o degradam.
+type Dependency struct {
+	Name     string
+	Critical bool
+	Checker  Checker
+}
+
+// DependencyStatus é o resultado da última conferência de uma dependência.
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// Report é o resultado da readiness: down se alguma dependência crítica
+// falhou, degraded se só as demais falharam.
+type Report struct {
+	Status       string                      `json:"status"`
+	CheckedAt    time.Time                   `json:"checked_at"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Ready informa se o serviço pode receber tráfego.
+func (r Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+type Option func(*Readiness)
+
+// WithCheckTimeout limita cada conferência; a que estoura conta como falha.
+func WithCheckTimeout(timeout time.Duration) Option {
+	return func(r *Readiness) {
+		r.timeout = timeout
+	}
+}
+
+// WithCacheTTL define por quanto tempo um resultado é reaproveitado, para
+// que as probes não consultem as dependências a cada requisição.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(r *Readiness) {
+		r.cacheTTL = ttl
+	}
+}
+
+// Readiness confere as dependências em paralelo e guarda o resultado por
+// cacheTTL. Requisições simultâneas esperam a mesma conferência.
+type Readiness struct {
+	dependencies []Dependency
+	timeout      time.Duration
+	cacheTTL     time.Duration
+	now          func() time.Time
+
+	group  singleflight.Group
+	mu     sync.Mutex
+	report *Report
+}
+
+func NewReadiness(dependencies []Dependency, opts ...Option) *Readiness {
+	r := &Readiness{
+		dependencies: dependencies,
+		timeout:      DefaultCheckTimeout,
+		cacheTTL:     DefaultCacheTTL,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Check retorna o resultado em cache ou confere as dependências de novo. As
+// conferências não usam o cancelamento de ctx, só r.timeout: uma probe que
+// desiste não pode marcar as dependências como fora do ar para as próximas.
+// Se ctx acaba antes, Check retorna o último resultado, ou down se não há
+// nenhum.
+func (r *Readiness) Check(ctx context.Context) Report {
+	if report, ok := r.cached(); ok {
+		return report
+	}
+
+	result := r.group.DoChan("readiness", func() (any, error) {
+		if report, ok := r.cached(); ok {
+			return report, nil
+		}
+		report := r.run(context.WithoutCancel(ctx))
+		r.mu.Lock()
+		r.report = &report
+		r.mu.Unlock()
+		return report, nil
+	})
+	select {
+	case res := <-result:
+		return res.Val.(Report)
+	case <-ctx.Done():
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.report != nil {
+			return *r.report
+		}
+		return Report{Status: StatusDown, CheckedAt: r.now(), Dependencies: map[string]DependencyStatus{}}
+	}
+}
+
+func (r *Readiness) cached() (Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.report != nil && r.now().Sub(r.report.CheckedAt) < r.cacheTTL {
+		return *r.report, true
+	}
+	return Report{}, false
+}
+
+func (r *Readiness) run(ctx context.Context) Report {
+	statuses := make([]DependencyStatus, len(r.dependencies))
+	var wg sync.WaitGroup
+	for i, dependency := range r.dependencies {
+		wg.Add(1)
+		go func(i int, dependency Dependency) {
+			defer wg.Done()
+			statuses[i] = r.check(ctx, dependency)
+		}(i, dependency)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, CheckedAt: r.now(), Dependencies: make(map[string]DependencyStatus, len(statuses))}
+	for i, status := range statuses {
+		report.Dependencies[r.dependencies[i].Name] = status
+		switch {
+		case status.Status == StatusUp:
+		case status.Critical:
+			report.Status = StatusDown
+		case report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (r *Readiness) check(ctx context.Context, dependency Dependency) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := dependency.Checker.Check(ctx)
+	status := DependencyStatus{
+		Status:    StatusUp,
+		Critical:  dependency.Critical,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// BreakerState é o disjuntor de uma dependência externa.
+type BreakerState interface {
+	State() resilience.State
+}
+
+// BreakerChecker falha enquanto o disjuntor está aberto; meio aberto conta
+// como disponível, pois a chamada de teste já está liberada.
+func BreakerChecker(breaker BreakerState) Checker {
+	return CheckerFunc(func(context.Context) error {
+		if state := breaker.State(); state == resilience.StateOpen {
+			return fmt.Errorf("circuit breaker is %s", state)
+		}
+		return nil
+	})
+}
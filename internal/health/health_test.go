@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+)
+
+func up(context.Context) error { return nil }
+
+func down(context.Context) error { return errors.New("connection refused") }
+
+func TestReadiness_Status(t *testing.T) {
+	tests := []struct {
+		name         string
+		dependencies []Dependency
+		expected     string
+	}{
+		{
+			name: "all up",
+			dependencies: []Dependency{
+				{Name: "dynamodb", Critical: true, Checker: CheckerFunc(up)},
+				{Name: "sns", Checker: CheckerFunc(up)},
+			},
+			expected: StatusUp,
+		},
+		{
+			name: "non critical down",
+			dependencies: []Dependency{
+				{Name: "dynamodb", Critical: true, Checker: CheckerFunc(up)},
+				{Name: "sns", Checker: CheckerFunc(down)},
+			},
+			expected: StatusDegraded,
+		},
+		{
+			name: "critical down",
+			dependencies: []Dependency{
+				{Name: "dynamodb", Critical: true, Checker: CheckerFunc(down)},
+				{Name: "sns", Checker: CheckerFunc(down)},
+			},
+			expected: StatusDown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewReadiness(tt.dependencies).Check(context.Background())
+			if report.Status != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, report.Status)
+			}
+			if report.Ready() != (tt.expected != StatusDown) {
+				t.Errorf("unexpected Ready() for %s", report.Status)
+			}
+			if len(report.Dependencies) != len(tt.dependencies) {
+				t.Errorf("expected every dependency in the report, got %+v", report.Dependencies)
+			}
+		})
+	}
+}
+
+func TestReadiness_ReportsErrorPerDependency(t *testing.T) {
+	report := NewReadiness([]Dependency{
+		{Name: "sns", Checker: CheckerFunc(down)},
+	}).Check(context.Background())
+
+	status := report.Dependencies["sns"]
+	if status.Status != StatusDown || status.Critical || status.Error != "connection refused" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestReadiness_Timeout(t *testing.T) {
+	slow := CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	readiness := NewReadiness([]Dependency{{Name: "mercadopago", Critical: true, Checker: slow}}, WithCheckTimeout(10*time.Millisecond))
+
+	start := time.Now()
+	report := readiness.Check(context.Background())
+	if time.Since(start) > time.Second {
+		t.Fatal("expected the check to be bounded by the timeout")
+	}
+	if report.Status != StatusDown || report.Dependencies["mercadopago"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("expected the slow dependency to be down, got %+v", report)
+	}
+}
+
+func TestReadiness_CachesResult(t *testing.T) {
+	var calls atomic.Int32
+	checker := CheckerFunc(func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+	now := time.Now()
+	readiness := NewReadiness([]Dependency{{Name: "dynamodb", Checker: checker}}, WithCacheTTL(time.Minute))
+	readiness.now = func() time.Time { return now }
+
+	readiness.Check(context.Background())
+	readiness.Check(context.Background())
+	if calls.Load() != 1 {
+		t.Errorf("expected the second check to be cached, got %d calls", calls.Load())
+	}
+
+	now = now.Add(time.Minute)
+	readiness.Check(context.Background())
+	if calls.Load() != 2 {
+		t.Errorf("expected the cache to expire, got %d calls", calls.Load())
+	}
+}
+
+func TestReadiness_IgnoresCallerCancellation(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	checker := CheckerFunc(func(ctx context.Context) error {
+		calls.Add(1)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	readiness := NewReadiness([]Dependency{{Name: "dynamodb", Critical: true, Checker: checker}}, WithCacheTTL(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := readiness.Check(ctx); report.Ready() {
+		t.Errorf("expected a cancelled probe without a previous result to be down, got %+v", report)
+	}
+
+	close(release)
+	report := readiness.Check(context.Background())
+	if report.Status != StatusUp {
+		t.Errorf("expected the cancelled probe not to mark the dependency down, got %+v", report)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected both probes to share one check, got %d", calls.Load())
+	}
+}
+
+func TestBreakerChecker(t *testing.T) {
+	breaker := resilience.NewCircuitBreaker("mercadopago", resilience.BreakerConfig{FailureThreshold: 1})
+	checker := BreakerChecker(breaker)
+
+	if err := checker.Check(context.Background()); err != nil {
+		t.Errorf("expected a closed breaker to pass, got %v", err)
+	}
+	_ = breaker.Allow()
+	breaker.Failure()
+	if err := checker.Check(context.Background()); err == nil {
+		t.Error("expected an open breaker to fail")
+	}
+}
@@ -2,26 +2,206 @@ package mercadopago
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/alexssanderFonseca/pagamento/internal/config"
 	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
+// ProviderName é o nome do Mercado Pago entre os gateways de pagamento.
+const ProviderName = "mercadopago"
+
+// DefaultBaseURL é a API de produção, usada quando config.MercadoPago.BaseURL
+// está vazia.
+const DefaultBaseURL = "https://api.mercadopago.com"
+
+// Client implementa domain.PaymentProvider com cobranças por QR dinâmico.
 type Client struct {
-	httpClient  *resty.Client
-	baseURL     string
-	accessToken string
+	httpClient       *resty.Client
+	baseURL          string
+	accessToken      string
+	posID            string
+	webhookSecret    string
+	webhookTolerance time.Duration
+
+	timeout           time.Duration
+	operationTimeouts map[string]time.Duration
+	maxRetries        int
+	backoff           resilience.Backoff
+	breakerConfig     resilience.BreakerConfig
+	breaker           *resilience.CircuitBreaker
+	meterProvider     metric.MeterProvider
+	metrics           *clientMetrics
+	tracerProvider    trace.TracerProvider
+	tracer            trace.Tracer
+}
+
+// Option altera a configuração lida do ambiente, por exemplo para apontar o
+// cliente para o simulador (cmd/mpsim) nos testes.
+type Option func(*Client)
+
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+func WithAccessToken(token string) Option {
+	return func(c *Client) {
+		c.accessToken = token
+	}
+}
+
+func WithPOSID(posID string) Option {
+	return func(c *Client) {
+		c.posID = posID
+	}
+}
+
+func WithWebhookSecret(secret string) Option {
+	return func(c *Client) {
+		c.webhookSecret = secret
+	}
+}
+
+// WithWebhookTolerance define a idade máxima do ts assinado de um webhook;
+// zero desliga a verificação.
+func WithWebhookTolerance(tolerance time.Duration) Option {
+	return func(c *Client) {
+		c.webhookTolerance = tolerance
+	}
+}
+
+// WithTimeout define o tempo máximo de cada tentativa de chamada à API.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithOperationTimeout sobrescreve o timeout de uma operação, como
+// OperationCreateCharge.
+func WithOperationTimeout(operation string, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.operationTimeouts[operation] = timeout
+	}
+}
+
+// WithRetry define quantas novas tentativas são feitas após 429/5xx e a
+// espera entre elas.
+func WithRetry(maxRetries int, backoff resilience.Backoff) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+func WithCircuitBreaker(cfg resilience.BreakerConfig) Option {
+	return func(c *Client) {
+		c.breakerConfig = cfg
+	}
+}
+
+// WithMeterProvider troca o MeterProvider global das métricas do cliente.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *Client) {
+		c.meterProvider = provider
+	}
+}
+
+// WithTracerProvider troca o TracerProvider global dos spans do cliente.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracerProvider = provider
+	}
+}
+
+// NewClient cria o cliente com a seção mercadopago da configuração; as
+// opções sobrescrevem os valores dela.
+func NewClient(cfg config.MercadoPago, opts ...Option) *Client {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	c := &Client{
+		httpClient:        resty.New(),
+		accessToken:       cfg.AccessToken,
+		posID:             cfg.POSID,
+		webhookSecret:     cfg.WebhookSecret,
+		webhookTolerance:  cfg.WebhookTolerance,
+		timeout:           positiveDuration(cfg.Timeout, DefaultTimeout),
+		operationTimeouts: map[string]time.Duration{},
+		meterProvider:     otel.GetMeterProvider(),
+		tracerProvider:    otel.GetTracerProvider(),
+		maxRetries:        cfg.MaxRetries,
+		backoff:           resilience.Backoff{Base: DefaultBackoffBase, Max: DefaultBackoffMax},
+		breakerConfig: resilience.BreakerConfig{
+			FailureThreshold: cfg.BreakerThreshold,
+			OpenTimeout:      cfg.BreakerOpenTimeout,
+		},
+	}
+	WithBaseURL(baseURL)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.metrics = newClientMetrics(c.meterProvider)
+	c.tracer = c.tracerProvider.Tracer(instrumentationName)
+	// Cada tentativa vira um span HTTP filho do span da operação e leva o
+	// contexto do trace nos headers (traceparent).
+	c.httpClient.SetTransport(otelhttp.NewTransport(c.httpClient.GetClient().Transport,
+		otelhttp.WithTracerProvider(c.tracerProvider),
+		otelhttp.WithMeterProvider(c.meterProvider),
+	))
+	onStateChange := c.breakerConfig.OnStateChange
+	c.breakerConfig.OnStateChange = func(from, to resilience.State) {
+		logger.Warn("mercadopago circuit breaker state changed",
+			zap.String("from", string(from)),
+			zap.String("to", string(to)),
+		)
+		c.metrics.recordTransition(to)
+		if onStateChange != nil {
+			onStateChange(from, to)
+		}
+	}
+	c.breaker = resilience.NewCircuitBreaker(ProviderName, c.breakerConfig)
+	c.metrics.observeBreaker(c.breaker)
+	return c
 }
 
-func NewClient() *Client {
-	return &Client{
-		httpClient:  resty.New(),
-		baseURL:     "https://api.mercadopago.com",
-		accessToken: os.Getenv("MERCADO_PAGO_ACCESS_TOKEN"),
+func (c *Client) Name() string {
+	return ProviderName
+}
+
+// CircuitBreaker expõe o disjuntor das chamadas à API, para o health check.
+func (c *Client) CircuitBreaker() *resilience.CircuitBreaker {
+	return c.breaker
+}
+
+// Ping confere se a API responde, sem passar pelo disjuntor nem pelas novas
+// tentativas. Qualquer resposta abaixo de 500 conta como alcançável.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.httpClient.R().SetContext(ctx).Get(c.baseURL + "/")
+	if err != nil {
+		return fmt.Errorf("mercadopago unreachable: %w", err)
 	}
+	if resp.StatusCode() >= 500 {
+		return fmt.Errorf("mercadopago api returned %d", resp.StatusCode())
+	}
+	return nil
 }
 
 type OrderRequest struct {
@@ -59,19 +239,73 @@ type Item struct {
 }
 
 type OrderResponse struct {
-	ID           string       `json:"id"`
-	TypeResponse TypeResponse `json:"type_response"`
+	ID                string            `json:"id"`
+	ExternalReference string            `json:"external_reference"`
+	Status            string            `json:"status"`
+	StatusDetail      string            `json:"status_detail"`
+	TypeResponse      TypeResponse      `json:"type_response"`
+	Transactions      OrderTransactions `json:"transactions"`
+}
+
+type OrderTransactions struct {
+	Payments []OrderPayment `json:"payments"`
+}
+
+// OrderPayment é um pagamento feito na ordem. ReferenceID é o ID do pagamento
+// na API v1/payments, o mesmo das notificações do tópico payment.
+type OrderPayment struct {
+	ID          string `json:"id"`
+	ReferenceID string `json:"reference_id"`
+	Status      string `json:"status"`
+}
+
+// MerchantOrderResponse é a merchant order do fluxo QR legado, notificada no
+// tópico merchant_order.
+type MerchantOrderResponse struct {
+	ID                int64                  `json:"id"`
+	ExternalReference string                 `json:"external_reference"`
+	Status            string                 `json:"status"`
+	OrderStatus       string                 `json:"order_status"`
+	Payments          []MerchantOrderPayment `json:"payments"`
+}
+
+type MerchantOrderPayment struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
 }
 
 type TypeResponse struct {
 	QRCodeData string `json:"qr_data"`
 }
 
-func (c *Client) CreateQRCodeOrder(ctx context.Context, req domain.CreatePaymentRequest) (string, error) {
-	posID := os.Getenv("MERCADO_PAGO_POS_ID")
+type PaymentResponse struct {
+	ID                int64            `json:"id"`
+	Status            string           `json:"status"`
+	StatusDetail      string           `json:"status_detail"`
+	ExternalReference string           `json:"external_reference"`
+	CurrencyID        string           `json:"currency_id,omitempty"`
+	Refunds           []RefundResponse `json:"refunds,omitempty"`
+}
+
+type PaymentSearchResponse struct {
+	Results []PaymentResponse `json:"results"`
+}
+
+type RefundResponse struct {
+	ID        int64   `json:"id"`
+	PaymentID int64   `json:"payment_id"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+}
+
+type RefundRequest struct {
+	Amount *json.Number `json:"amount,omitempty"`
+}
+
+func (c *Client) CreateCharge(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
 	url := fmt.Sprintf("%s/v1/orders", c.baseURL)
 
-	amountStr := fmt.Sprintf("%.2f", req.Amount)
+	amountStr := req.Amount.Decimal()
 
 	orderReq := OrderRequest{
 		Type:              "qr",
@@ -80,7 +314,7 @@ func (c *Client) CreateQRCodeOrder(ctx context.Context, req domain.CreatePayment
 		Description:       req.Description,
 		Config: OrderConfig{
 			QR: QRConfig{
-				ExternalPOSID: posID,
+				ExternalPOSID: c.posID,
 				Mode:          "dynamic",
 			},
 		},
@@ -100,44 +334,336 @@ func (c *Client) CreateQRCodeOrder(ctx context.Context, req domain.CreatePayment
 	}
 
 	var orderResp OrderResponse
-	idempotencyKey := uuid.New().String()
+	// Reutilizar a chave do cliente faz o Mercado Pago devolver a mesma ordem
+	// em repetições da mesma requisição.
+	idempotencyKey := req.IdempotencyKey
+	if idempotencyKey == "" {
+		idempotencyKey = uuid.New().String()
+	}
 
-	resp, err := c.httpClient.R().
-		SetContext(ctx).
-		SetHeader("Authorization", "Bearer "+c.accessToken).
-		SetHeader("X-Idempotency-Key", idempotencyKey).
-		SetBody(orderReq).
-		SetResult(&orderResp).
-		Post(url)
+	resp, err := c.do(ctx, OperationCreateCharge, func(req *resty.Request) (*resty.Response, error) {
+		return req.
+			SetHeader("X-Idempotency-Key", idempotencyKey).
+			SetBody(orderReq).
+			SetResult(&orderResp).
+			Post(url)
+	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if resp.IsError() {
-		return "", fmt.Errorf("mercadopago api error: %s", resp.String())
+		return nil, apiError(ctx, OperationCreateCharge, resp)
 	}
 
-	return orderResp.TypeResponse.QRCodeData, nil
+	return &domain.ProviderCharge{
+		ID:     orderResp.ID,
+		QRData: orderResp.TypeResponse.QRCodeData,
+	}, nil
 }
 
-func (c *Client) GetPaymentDetails(ctx context.Context, paymentID string) (*domain.MPPaymentResponse, error) {
+func (c *Client) GetPayment(ctx context.Context, paymentID string) (*domain.ProviderPayment, error) {
 	url := fmt.Sprintf("%s/v1/payments/%s", c.baseURL, paymentID)
 
-	var paymentResp domain.MPPaymentResponse
-	resp, err := c.httpClient.R().
-		SetContext(ctx).
-		SetHeader("Authorization", "Bearer "+c.accessToken).
-		SetResult(&paymentResp).
-		Get(url)
+	var paymentResp PaymentResponse
+	resp, err := c.do(ctx, OperationGetPayment, func(req *resty.Request) (*resty.Response, error) {
+		return req.
+			SetResult(&paymentResp).
+			Get(url)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.IsError() {
+		return nil, apiError(ctx, OperationGetPayment, resp)
+	}
+
+	payment := toProviderPayment(ctx, paymentResp)
+	return &payment, nil
+}
+
+func (c *Client) SearchPayments(ctx context.Context, externalReference string) ([]domain.ProviderPayment, error) {
+	url := fmt.Sprintf("%s/v1/payments/search", c.baseURL)
+
+	var searchResp PaymentSearchResponse
+	resp, err := c.do(ctx, OperationSearchPayments, func(req *resty.Request) (*resty.Response, error) {
+		return req.
+			SetQueryParams(map[string]string{
+				"external_reference": externalReference,
+				"sort":               "date_created",
+				"criteria":           "desc",
+			}).
+			SetResult(&searchResp).
+			Get(url)
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.IsError() {
-		return nil, fmt.Errorf("mercadopago api error: %s", resp.String())
+		return nil, apiError(ctx, OperationSearchPayments, resp)
 	}
 
-	return &paymentResp, nil
+	payments := make([]domain.ProviderPayment, len(searchResp.Results))
+	for i, result := range searchResp.Results {
+		payments[i] = toProviderPayment(ctx, result)
+	}
+	return payments, nil
+}
+
+func (c *Client) RefundPayment(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+	url := fmt.Sprintf("%s/v1/payments/%s/refunds", c.baseURL, paymentID)
+
+	var refundReq RefundRequest
+	if amount != nil {
+		value := json.Number(amount.Decimal())
+		refundReq.Amount = &value
+	}
+
+	var refundResp RefundResponse
+	resp, err := c.do(ctx, OperationRefundPayment, func(req *resty.Request) (*resty.Response, error) {
+		return req.
+			SetHeader("X-Idempotency-Key", idempotencyKey).
+			SetBody(refundReq).
+			SetResult(&refundResp).
+			Post(url)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.IsError() {
+		return nil, apiError(ctx, OperationRefundPayment, resp)
+	}
+
+	refund, err := toProviderRefund(refundResp, currencyOf(amount))
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// GetOrder consulta uma ordem da API v1/orders.
+func (c *Client) GetOrder(ctx context.Context, orderID string) (*OrderResponse, error) {
+	url := fmt.Sprintf("%s/v1/orders/%s", c.baseURL, orderID)
+
+	var orderResp OrderResponse
+	resp, err := c.do(ctx, OperationGetCharge, func(req *resty.Request) (*resty.Response, error) {
+		return req.
+			SetResult(&orderResp).
+			Get(url)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.IsError() {
+		return nil, apiError(ctx, OperationGetCharge, resp)
+	}
+
+	return &orderResp, nil
+}
+
+// GetMerchantOrder consulta uma merchant order.
+func (c *Client) GetMerchantOrder(ctx context.Context, merchantOrderID string) (*MerchantOrderResponse, error) {
+	url := fmt.Sprintf("%s/merchant_orders/%s", c.baseURL, merchantOrderID)
+
+	var orderResp MerchantOrderResponse
+	resp, err := c.do(ctx, OperationGetCharge, func(req *resty.Request) (*resty.Response, error) {
+		return req.
+			SetResult(&orderResp).
+			Get(url)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.IsError() {
+		return nil, apiError(ctx, OperationGetCharge, resp)
+	}
+
+	return &orderResp, nil
+}
+
+// GetCharge consulta a cobrança notificada nos tópicos order e
+// merchant_order. IDs numéricos são de merchant orders; os da API v1/orders
+// são alfanuméricos (ORD...). A merchant order não traz o ID da ordem v1, por
+// isso volta como cobrança vinculada, com os pagamentos feitos nela.
+func (c *Client) GetCharge(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+	if _, err := strconv.ParseInt(chargeID, 10, 64); err == nil {
+		merchantOrder, err := c.GetMerchantOrder(ctx, chargeID)
+		if err != nil {
+			return nil, err
+		}
+		paymentIDs := make([]string, 0, len(merchantOrder.Payments))
+		for _, payment := range merchantOrder.Payments {
+			paymentIDs = append(paymentIDs, strconv.FormatInt(payment.ID, 10))
+		}
+		return &domain.ProviderCharge{
+			ID:                strconv.FormatInt(merchantOrder.ID, 10),
+			ExternalReference: merchantOrder.ExternalReference,
+			Status:            mapMerchantOrderStatus(merchantOrder.Status, merchantOrder.OrderStatus),
+			RawStatus:         merchantOrder.OrderStatus,
+			PaymentIDs:        paymentIDs,
+			Linked:            true,
+		}, nil
+	}
+
+	order, err := c.GetOrder(ctx, chargeID)
+	if err != nil {
+		return nil, err
+	}
+	paymentIDs := make([]string, 0, len(order.Transactions.Payments))
+	for _, payment := range order.Transactions.Payments {
+		if payment.ReferenceID != "" {
+			paymentIDs = append(paymentIDs, payment.ReferenceID)
+		}
+	}
+	return &domain.ProviderCharge{
+		ID:                order.ID,
+		QRData:            order.TypeResponse.QRCodeData,
+		ExternalReference: order.ExternalReference,
+		Status:            mapOrderStatus(order.Status),
+		RawStatus:         order.Status,
+		PaymentIDs:        paymentIDs,
+	}, nil
+}
+
+// CancelCharge cancela a ordem QR, identificada pelo ID da cobrança.
+func (c *Client) CancelCharge(ctx context.Context, orderID string, idempotencyKey string) error {
+	url := fmt.Sprintf("%s/v1/orders/%s/cancel", c.baseURL, orderID)
+
+	resp, err := c.do(ctx, OperationCancelCharge, func(req *resty.Request) (*resty.Response, error) {
+		return req.
+			SetHeader("X-Idempotency-Key", idempotencyKey).
+			Post(url)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if resp.IsError() {
+		return apiError(ctx, OperationCancelCharge, resp)
+	}
+
+	return nil
+}
+
+// toProviderPayment converte o pagamento do Mercado Pago. Um estorno com valor
+// inválido é descartado: registrá-lo como zero corromperia o total estornado.
+func toProviderPayment(ctx context.Context, resp PaymentResponse) domain.ProviderPayment {
+	currency := resp.CurrencyID
+	if currency == "" {
+		currency = domain.DefaultCurrency
+	}
+	var refunds []domain.ProviderRefund
+	for _, refund := range resp.Refunds {
+		providerRefund, err := toProviderRefund(refund, currency)
+		if err != nil {
+			logger.FromContext(ctx).Error("mercadopago refund with invalid amount ignored",
+				zap.Error(err),
+				zap.Int64("provider_payment_id", resp.ID),
+				zap.Int64("provider_refund_id", refund.ID),
+			)
+			continue
+		}
+		refunds = append(refunds, providerRefund)
+	}
+	return domain.ProviderPayment{
+		ID:                strconv.FormatInt(resp.ID, 10),
+		ExternalReference: resp.ExternalReference,
+		Status:            mapStatus(resp.Status),
+		RawStatus:         resp.Status,
+		StatusDetail:      resp.StatusDetail,
+		Refunds:           refunds,
+	}
+}
+
+// toProviderRefund converte o valor decimal do estorno e falha se ele não
+// cabe na moeda.
+func toProviderRefund(resp RefundResponse, currency string) (domain.ProviderRefund, error) {
+	value := strconv.FormatFloat(resp.Amount, 'f', -1, 64)
+	amount, err := domain.ParseMoney(value, currency)
+	if err != nil {
+		return domain.ProviderRefund{}, fmt.Errorf("mercadopago refund %d amount %s %s: %w", resp.ID, value, currency, err)
+	}
+	return domain.ProviderRefund{
+		ID:     strconv.FormatInt(resp.ID, 10),
+		Status: resp.Status,
+		Amount: amount,
+	}, nil
+}
+
+func currencyOf(amount *domain.Money) string {
+	if amount == nil || amount.Currency == "" {
+		return domain.DefaultCurrency
+	}
+	return amount.Currency
+}
+
+// mapStatus traduz o status de pagamento do Mercado Pago para o domínio.
+func mapStatus(status string) domain.PaymentStatus {
+	switch status {
+	case "approved":
+		return domain.StatusApproved
+	case "authorized":
+		return domain.StatusAuthorized
+	case "rejected":
+		return domain.StatusRejected
+	case "cancelled":
+		return domain.StatusCancelled
+	case "refunded":
+		return domain.StatusRefunded
+	case "charged_back":
+		return domain.StatusChargedBack
+	default:
+		// pending, in_process, in_mediation
+		return domain.StatusPending
+	}
+}
+
+// mapOrderStatus traduz o status de uma ordem da API v1/orders. Ordens
+// abertas ou parcialmente pagas (created, action_required) continuam
+// pendentes.
+func mapOrderStatus(status string) domain.PaymentStatus {
+	switch status {
+	case "processed":
+		return domain.StatusApproved
+	case "failed":
+		return domain.StatusRejected
+	case "canceled", "cancelled":
+		return domain.StatusCancelled
+	case "expired":
+		return domain.StatusExpired
+	case "refunded":
+		return domain.StatusRefunded
+	default:
+		return domain.StatusPending
+	}
+}
+
+// mapMerchantOrderStatus traduz uma merchant order pelo status da ordem
+// (opened, closed, expired) e pelo status de pagamento (payment_required,
+// partially_paid, paid, reverted...).
+func mapMerchantOrderStatus(status, orderStatus string) domain.PaymentStatus {
+	switch {
+	case orderStatus == "paid":
+		return domain.StatusApproved
+	case orderStatus == "reverted":
+		return domain.StatusRefunded
+	case status == "expired" || orderStatus == "expired":
+		return domain.StatusExpired
+	case status == "closed" && orderStatus == "payment_required":
+		return domain.StatusCancelled
+	default:
+		return domain.StatusPending
+	}
 }
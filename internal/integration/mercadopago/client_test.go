@@ -0,0 +1,360 @@
+package mercadopago
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"github.com/alexssanderFonseca/pagamento/internal/telemetry/metrictest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeAPI responde com os status de responses em sequência e repete o último.
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses []int
+	delay     time.Duration
+	calls     int
+	keys      []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	status := f.responses[min(f.calls, len(f.responses)-1)]
+	f.calls++
+	f.keys = append(f.keys, r.Header.Get("X-Idempotency-Key"))
+	f.mu.Unlock()
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(`{"id":"ORD1","type_response":{"qr_data":"qr"},"status":"approved","external_reference":"OS-1"}`))
+}
+
+func newTestClient(t *testing.T, api *fakeAPI, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	opts = append([]Option{
+		WithBaseURL(server.URL),
+		WithRetry(2, resilience.Backoff{Base: time.Millisecond, Max: 5 * time.Millisecond}),
+	}, opts...)
+	return NewClient(config.Default().MercadoPago, opts...)
+}
+
+func chargeRequest() domain.CreatePaymentRequest {
+	return domain.CreatePaymentRequest{ExternalReference: "OS-1", Amount: domain.NewMoney(1050, "BRL"), IdempotencyKey: "key-1"}
+}
+
+func TestClient_RetriesServerErrorsWithSameIdempotencyKey(t *testing.T) {
+	api := &fakeAPI{responses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusCreated}}
+	client := newTestClient(t, api)
+
+	charge, err := client.CreateCharge(context.Background(), chargeRequest())
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if charge.ID != "ORD1" || api.calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d (%+v)", api.calls, charge)
+	}
+	for _, key := range api.keys {
+		if key != "key-1" {
+			t.Errorf("expected every attempt to reuse the idempotency key, got %v", api.keys)
+		}
+	}
+}
+
+func TestClient_DoesNotRetryClientErrors(t *testing.T) {
+	api := &fakeAPI{responses: []int{http.StatusBadRequest}}
+	client := newTestClient(t, api)
+
+	_, err := client.CreateCharge(context.Background(), chargeRequest())
+	if err == nil || errors.Is(err, domain.ErrProviderUnavailable) {
+		t.Fatalf("expected plain API error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "ORD1") || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected only the status in the error, without the response body, got %v", err)
+	}
+	if api.calls != 1 {
+		t.Errorf("expected a single attempt, got %d", api.calls)
+	}
+}
+
+func TestClient_ExhaustedRetriesReportUnavailable(t *testing.T) {
+	api := &fakeAPI{responses: []int{http.StatusBadGateway}}
+	client := newTestClient(t, api)
+
+	_, err := client.GetPayment(context.Background(), "1")
+	if !errors.Is(err, domain.ErrProviderUnavailable) {
+		t.Fatalf("expected ErrProviderUnavailable, got %v", err)
+	}
+	if api.calls != 3 {
+		t.Errorf("expected 1 attempt plus 2 retries, got %d", api.calls)
+	}
+}
+
+func TestClient_CircuitBreakerFailsFast(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	api := &fakeAPI{responses: []int{http.StatusInternalServerError}}
+	client := newTestClient(t, api,
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		WithRetry(0, resilience.Backoff{}),
+		WithCircuitBreaker(resilience.BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}),
+	)
+
+	for i := 0; i < 2; i++ {
+		_, _ = client.GetPayment(context.Background(), "1")
+	}
+	_, err := client.GetPayment(context.Background(), "1")
+	if !errors.Is(err, domain.ErrProviderUnavailable) || !errors.Is(err, resilience.ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if api.calls != 2 {
+		t.Errorf("expected the open breaker to skip the API, got %d calls", api.calls)
+	}
+	if client.CircuitBreaker().State() != resilience.StateOpen {
+		t.Errorf("expected open breaker, got %s", client.CircuitBreaker().State())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	found := false
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if gauge, ok := m.Data.(metricdata.Gauge[int64]); ok && m.Name == "mercadopago.circuit_breaker.state" {
+				found = len(gauge.DataPoints) == 1 && gauge.DataPoints[0].Value == 2
+			}
+		}
+	}
+	if !found {
+		t.Error("expected circuit breaker state gauge with value 2 (open)")
+	}
+}
+
+func TestClient_RateLimitDoesNotOpenCircuit(t *testing.T) {
+	api := &fakeAPI{responses: []int{http.StatusTooManyRequests}}
+	client := newTestClient(t, api,
+		WithRetry(0, resilience.Backoff{}),
+		WithCircuitBreaker(resilience.BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}),
+	)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.GetPayment(context.Background(), "1")
+		if errors.Is(err, resilience.ErrCircuitOpen) {
+			t.Fatalf("expected rate limiting not to open the circuit, got %v", err)
+		}
+	}
+	if api.calls != 3 || client.CircuitBreaker().State() != resilience.StateClosed {
+		t.Errorf("expected every call to reach the API with a closed breaker, got %d calls (%s)", api.calls, client.CircuitBreaker().State())
+	}
+}
+
+func TestClient_PerOperationTimeout(t *testing.T) {
+	api := &fakeAPI{responses: []int{http.StatusOK}, delay: 500 * time.Millisecond}
+	client := newTestClient(t, api, WithOperationTimeout(OperationGetPayment, 20*time.Millisecond))
+
+	start := time.Now()
+	_, err := client.GetPayment(context.Background(), "1")
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("expected the call to give up after the timeout, took %s", elapsed)
+	}
+	if api.calls != 1 {
+		t.Errorf("expected network errors not to be retried, got %d calls", api.calls)
+	}
+}
+
+func TestClient_RecordsLatencyAndErrorCodes(t *testing.T) {
+	reader := metrictest.NewReader()
+	api := &fakeAPI{responses: []int{http.StatusInternalServerError, http.StatusOK}}
+	client := newTestClient(t, api, WithMeterProvider(reader.Provider))
+
+	// O corpo do fakeAPI não é um pagamento; só as tentativas importam aqui.
+	_, _ = client.GetPayment(context.Background(), "1")
+
+	operation := attribute.String("operation", OperationGetPayment)
+	if got := reader.HistogramCount(t, "mercadopago.client.duration", operation); got != 2 {
+		t.Errorf("expected both attempts to be measured, got %d", got)
+	}
+	if got := reader.HistogramCount(t, "mercadopago.client.duration", operation, attribute.Int("status_code", http.StatusOK)); got != 1 {
+		t.Errorf("expected one successful attempt, got %d", got)
+	}
+	if got := reader.Int64Sum(t, "mercadopago.client.errors", operation, attribute.String("error_code", "500")); got != 1 {
+		t.Errorf("expected one 500 error, got %d", got)
+	}
+}
+
+func TestClient_RecordsTimeoutErrorCode(t *testing.T) {
+	reader := metrictest.NewReader()
+	api := &fakeAPI{responses: []int{http.StatusOK}, delay: 500 * time.Millisecond}
+	client := newTestClient(t, api,
+		WithMeterProvider(reader.Provider),
+		WithOperationTimeout(OperationGetPayment, 20*time.Millisecond),
+	)
+
+	if _, err := client.GetPayment(context.Background(), "1"); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if got := reader.Int64Sum(t, "mercadopago.client.errors", attribute.String("error_code", "timeout")); got != 1 {
+		t.Errorf("expected one timeout error, got %d", got)
+	}
+}
+
+func TestClient_PropagatesTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":123,"status":"approved","external_reference":"OS-1"}`))
+	}))
+	defer server.Close()
+	recorder := tracetest.NewSpanRecorder()
+	client := NewClient(config.Default().MercadoPago,
+		WithBaseURL(server.URL),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+	)
+
+	if _, err := client.GetPayment(context.Background(), "123"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	var operation sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "mercadopago."+OperationGetPayment {
+			operation = span
+		}
+	}
+	if operation == nil || len(spans) != 2 {
+		t.Fatalf("expected an operation span and an HTTP span, got %d spans", len(spans))
+	}
+	traceID := operation.SpanContext().TraceID().String()
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("expected traceparent with trace %s, got %q", traceID, traceparent)
+	}
+}
+
+func TestClient_GetChargeMerchantOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/merchant_orders/123" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":123,"external_reference":"OS-1","status":"closed","order_status":"paid","payments":[{"id":456,"status":"approved"}]}`))
+	}))
+	defer server.Close()
+	client := NewClient(config.Default().MercadoPago, WithBaseURL(server.URL))
+
+	charge, err := client.GetCharge(context.Background(), "123")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if charge.ID != "123" || charge.ExternalReference != "OS-1" || charge.Status != domain.StatusApproved || !charge.Linked {
+		t.Errorf("unexpected charge: %+v", charge)
+	}
+	if len(charge.PaymentIDs) != 1 || charge.PaymentIDs[0] != "456" {
+		t.Errorf("expected the merchant order payments, got %v", charge.PaymentIDs)
+	}
+}
+
+func TestClient_GetChargeOrderPayments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/orders/ORD1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"ORD1","external_reference":"OS-1","status":"processed","transactions":{"payments":[{"id":"PAY1","reference_id":"456","status":"processed"}]}}`))
+	}))
+	defer server.Close()
+	client := NewClient(config.Default().MercadoPago, WithBaseURL(server.URL))
+
+	charge, err := client.GetCharge(context.Background(), "ORD1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if charge.Linked || len(charge.PaymentIDs) != 1 || charge.PaymentIDs[0] != "456" {
+		t.Errorf("expected the order payment ids, got %+v", charge)
+	}
+}
+
+func TestClient_GetPaymentSkipsRefundsWithInvalidAmount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":456,"status":"refunded","currency_id":"BRL","refunds":[{"id":1,"amount":10.5,"status":"approved"},{"id":2,"amount":0.001,"status":"approved"}]}`))
+	}))
+	defer server.Close()
+	client := NewClient(config.Default().MercadoPago, WithBaseURL(server.URL))
+
+	payment, err := client.GetPayment(context.Background(), "456")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(payment.Refunds) != 1 || payment.Refunds[0].ID != "1" || payment.Refunds[0].Amount != domain.NewMoney(1050, "BRL") {
+		t.Errorf("expected only the valid refund, got %+v", payment.Refunds)
+	}
+}
+
+func TestClient_RefundPaymentRejectsInvalidAmount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":1,"payment_id":456,"amount":0.001,"status":"approved"}`))
+	}))
+	defer server.Close()
+	client := NewClient(config.Default().MercadoPago, WithBaseURL(server.URL))
+
+	refund, err := client.RefundPayment(context.Background(), "456", nil, "key-1")
+	if err == nil {
+		t.Errorf("expected an error instead of a zero refund, got %+v", refund)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := NewClient(config.Default().MercadoPago, WithBaseURL(server.URL))
+
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("expected any response below 500 to be reachable, got %v", err)
+	}
+	status = http.StatusBadGateway
+	if err := client.Ping(context.Background()); err == nil {
+		t.Error("expected 502 to be reported")
+	}
+	server.Close()
+	if err := client.Ping(context.Background()); err == nil {
+		t.Error("expected a closed server to be unreachable")
+	}
+}
@@ -0,0 +1,119 @@
+package mercadopago
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// instrumentationName identifica as métricas e os spans do cliente.
+const instrumentationName = "github.com/alexssanderFonseca/pagamento/internal/integration/mercadopago"
+
+// breakerStateValues é o valor do gauge de estado do disjuntor.
+var breakerStateValues = map[resilience.State]int64{
+	resilience.StateClosed:   0,
+	resilience.StateHalfOpen: 1,
+	resilience.StateOpen:     2,
+}
+
+type clientMetrics struct {
+	meter       metric.Meter
+	retries     metric.Int64Counter
+	rejected    metric.Int64Counter
+	transitions metric.Int64Counter
+	duration    metric.Float64Histogram
+	errors      metric.Int64Counter
+}
+
+// newClientMetrics registra os instrumentos no provider. Falhas de registro só
+// são logadas: os instrumentos retornados continuam utilizáveis.
+func newClientMetrics(provider metric.MeterProvider) *clientMetrics {
+	m := &clientMetrics{meter: provider.Meter(instrumentationName)}
+	var err error
+	if m.retries, err = m.meter.Int64Counter("mercadopago.client.retries",
+		metric.WithDescription("Novas tentativas de chamadas à API do Mercado Pago após 429/5xx")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.rejected, err = m.meter.Int64Counter("mercadopago.client.rejected",
+		metric.WithDescription("Chamadas recusadas sem acesso à rede com o disjuntor aberto")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.transitions, err = m.meter.Int64Counter("mercadopago.circuit_breaker.transitions",
+		metric.WithDescription("Mudanças de estado do disjuntor do Mercado Pago")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.duration, err = m.meter.Float64Histogram("mercadopago.client.duration",
+		metric.WithDescription("Duração de cada tentativa de chamada à API do Mercado Pago"),
+		metric.WithUnit("s")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.errors, err = m.meter.Int64Counter("mercadopago.client.errors",
+		metric.WithDescription("Tentativas de chamada à API do Mercado Pago que falharam, por código de erro")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	return m
+}
+
+// observeBreaker publica o estado do disjuntor como gauge: 0 fechado,
+// 1 meio-aberto e 2 aberto.
+func (m *clientMetrics) observeBreaker(breaker *resilience.CircuitBreaker) {
+	_, err := m.meter.Int64ObservableGauge("mercadopago.circuit_breaker.state",
+		metric.WithDescription("Estado do disjuntor do Mercado Pago (0 fechado, 1 meio-aberto, 2 aberto)"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			o.Observe(breakerStateValues[breaker.State()])
+			return nil
+		}),
+	)
+	if err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+}
+
+func (m *clientMetrics) recordRetry(ctx context.Context, operation string) {
+	m.retries.Add(ctx, 1, metric.WithAttributes(attribute.String("operation", operation)))
+}
+
+func (m *clientMetrics) recordRejected(ctx context.Context, operation string) {
+	m.rejected.Add(ctx, 1, metric.WithAttributes(attribute.String("operation", operation)))
+}
+
+func (m *clientMetrics) recordTransition(to resilience.State) {
+	m.transitions.Add(context.Background(), 1, metric.WithAttributes(attribute.String("state", string(to))))
+}
+
+// recordCall registra a duração de uma tentativa e, se ela falhou, o código
+// do erro: o status HTTP (>= 400), timeout, canceled, network (sem resposta)
+// ou decode (resposta que não pôde ser lida).
+func (m *clientMetrics) recordCall(ctx context.Context, operation string, elapsed time.Duration, statusCode int, err error) {
+	m.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.Int("status_code", statusCode),
+	))
+
+	var code string
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		code = "timeout"
+	case errors.Is(err, context.Canceled):
+		code = "canceled"
+	case statusCode >= 400:
+		code = strconv.Itoa(statusCode)
+	case err != nil && statusCode == 0:
+		code = "network"
+	case err != nil:
+		code = "decode"
+	default:
+		return
+	}
+	m.errors.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("error_code", code),
+	))
+}
@@ -0,0 +1,661 @@
+// Package mpsim é um Mercado Pago falso para testes de integração e
+// desenvolvimento sem rede. Implementa as rotas usadas pelo
+// mercadopago.Client, permite roteirizar o resultado de cada cobrança e envia
+// webhooks assinados de volta para o serviço.
+package mpsim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/integration/mercadopago"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Outcome é o resultado roteirizado de uma cobrança.
+type Outcome string
+
+const (
+	// OutcomeApprove liquida a cobrança com um pagamento aprovado.
+	OutcomeApprove Outcome = "approve"
+	// OutcomeReject liquida a cobrança com um pagamento rejeitado.
+	OutcomeReject Outcome = "reject"
+	// OutcomePending cria um pagamento em análise (in_process).
+	OutcomePending Outcome = "pending"
+	// OutcomeError faz a criação da ordem falhar com 500.
+	OutcomeError Outcome = "error"
+)
+
+var (
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrOrderNotOpen    = errors.New("order is not open")
+	ErrInvalidOutcome  = errors.New("invalid outcome")
+	ErrWebhookRejected = errors.New("webhook rejected by receiver")
+)
+
+// Script define como o simulador responde às cobranças de uma
+// external_reference.
+type Script struct {
+	Outcome Outcome `json:"outcome"`
+	// Latency atrasa as respostas da API para as cobranças da referência.
+	Latency time.Duration `json:"latency"`
+}
+
+// Config configura o simulador. WebhookURL vazio desativa os webhooks e
+// SettleAfter zero exige liquidar as cobranças com Settle.
+type Config struct {
+	AccessToken    string
+	WebhookURL     string
+	WebhookSecret  string
+	DefaultOutcome Outcome
+	SettleAfter    time.Duration
+}
+
+type order struct {
+	ID                string
+	ExternalReference string
+	TotalAmount       string
+	Status            string
+	PaymentID         int64
+	IdempotencyKey    string
+}
+
+type payment struct {
+	mercadopago.PaymentResponse
+	Amount   domain.Money
+	Refunded domain.Money
+}
+
+// Server guarda ordens, pagamentos e estornos em memória.
+type Server struct {
+	cfg        Config
+	router     *gin.Engine
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	orders        map[string]*order
+	payments      map[int64]*payment
+	byIdempotency map[string]string
+	refundsByKey  map[string]mercadopago.RefundResponse
+	scripts       map[string]Script
+	failures      int
+	failureStatus int
+	nextOrder     int64
+	nextPayment   int64
+	nextRefund    int64
+}
+
+func NewServer(cfg Config) *Server {
+	if cfg.DefaultOutcome == "" {
+		cfg.DefaultOutcome = OutcomeApprove
+	}
+	s := &Server{
+		cfg:           cfg,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		orders:        map[string]*order{},
+		payments:      map[int64]*payment{},
+		byIdempotency: map[string]string{},
+		refundsByKey:  map[string]mercadopago.RefundResponse{},
+		scripts:       map[string]Script{},
+		nextPayment:   100000000,
+		nextRefund:    500000000,
+	}
+	s.router = s.routes()
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *Server) routes() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	v1 := r.Group("/v1", s.authenticate, s.injectFailures)
+	{
+		v1.POST("/orders", s.createOrder)
+		v1.GET("/orders/:id", s.getOrder)
+		v1.POST("/orders/:id/cancel", s.cancelOrder)
+		v1.GET("/payments/search", s.searchPayments)
+		v1.GET("/payments/:id", s.getPayment)
+		v1.POST("/payments/:id/refunds", s.refundPayment)
+	}
+
+	// Rotas de controle do simulador, usadas pelo cmd/mpsim.
+	sim := r.Group("/_sim")
+	{
+		sim.POST("/scripts", s.handleScript)
+		sim.POST("/failures", s.handleFailures)
+		sim.POST("/orders/:id/settle", s.handleSettle)
+		sim.POST("/orders/:id/expire", s.handleClose(s.Expire))
+		sim.POST("/orders/:id/cancel", s.handleClose(s.CancelAtPOS))
+		sim.POST("/payments/:id/notify", s.handleNotify)
+	}
+	return r
+}
+
+// Script roteiriza as próximas cobranças da external_reference.
+func (s *Server) Script(externalReference string, script Script) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[externalReference] = script
+}
+
+// FailNext faz as próximas count chamadas à API responderem com status, como
+// uma indisponibilidade do Mercado Pago.
+func (s *Server) FailNext(count, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = count
+	s.failureStatus = status
+}
+
+// Settle liquida a cobrança com o resultado roteirizado para a referência e
+// envia o webhook do pagamento criado.
+func (s *Server) Settle(ctx context.Context, orderID string) (*mercadopago.PaymentResponse, error) {
+	s.mu.Lock()
+	o, ok := s.orders[orderID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrOrderNotFound
+	}
+	if o.Status != "created" {
+		s.mu.Unlock()
+		return nil, ErrOrderNotOpen
+	}
+
+	var status string
+	switch s.scriptFor(o.ExternalReference).Outcome {
+	case OutcomeApprove:
+		status = "approved"
+	case OutcomeReject:
+		status = "rejected"
+	case OutcomePending:
+		status = "in_process"
+	default:
+		s.mu.Unlock()
+		return nil, ErrInvalidOutcome
+	}
+
+	amount, err := domain.ParseMoney(o.TotalAmount, "BRL")
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	s.nextPayment++
+	p := &payment{
+		PaymentResponse: mercadopago.PaymentResponse{
+			ID:                s.nextPayment,
+			Status:            status,
+			ExternalReference: o.ExternalReference,
+		},
+		Amount:   amount,
+		Refunded: domain.NewMoney(0, amount.Currency),
+	}
+	s.payments[p.ID] = p
+	o.PaymentID = p.ID
+	o.Status = "processed"
+	if status == "rejected" {
+		o.Status = "failed"
+	}
+	resp := p.PaymentResponse
+	s.mu.Unlock()
+
+	if err := s.Notify(ctx, resp.ID); err != nil {
+		return &resp, err
+	}
+	return &resp, nil
+}
+
+// Notify envia para WebhookURL a notificação assinada do pagamento, como o
+// Mercado Pago faz a cada mudança de status.
+func (s *Server) Notify(ctx context.Context, paymentID int64) error {
+	return s.sendWebhook(ctx, "payment", "payment.updated", strconv.FormatInt(paymentID, 10))
+}
+
+// NotifyOrder envia a notificação do tópico order com o status atual da
+// ordem.
+func (s *Server) NotifyOrder(ctx context.Context, orderID string) error {
+	s.mu.Lock()
+	o, ok := s.orders[orderID]
+	var status string
+	if ok {
+		status = o.Status
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrOrderNotFound
+	}
+	return s.sendWebhook(ctx, "order", "order."+status, orderID)
+}
+
+// Expire expira uma ordem aberta e notifica o tópico order, como o Mercado
+// Pago faz quando o QR vence no ponto de venda.
+func (s *Server) Expire(ctx context.Context, orderID string) error {
+	return s.close(ctx, orderID, "expired")
+}
+
+// CancelAtPOS cancela uma ordem aberta pelo ponto de venda, sem passar pela
+// API, e notifica o tópico order.
+func (s *Server) CancelAtPOS(ctx context.Context, orderID string) error {
+	return s.close(ctx, orderID, "canceled")
+}
+
+func (s *Server) close(ctx context.Context, orderID, status string) error {
+	s.mu.Lock()
+	o, ok := s.orders[orderID]
+	if !ok {
+		s.mu.Unlock()
+		return ErrOrderNotFound
+	}
+	if o.Status != "created" {
+		s.mu.Unlock()
+		return ErrOrderNotOpen
+	}
+	o.Status = status
+	s.mu.Unlock()
+
+	return s.NotifyOrder(ctx, orderID)
+}
+
+func (s *Server) sendWebhook(ctx context.Context, topic, action, dataID string) error {
+	if s.cfg.WebhookURL == "" {
+		return nil
+	}
+
+	var notification mercadopago.WebhookNotification
+	notification.ID = time.Now().UnixNano()
+	notification.Type = topic
+	notification.Action = action
+	notification.APIVersion = "v1"
+	notification.DateCreated = time.Now().UTC().Format(time.RFC3339)
+	notification.Data.ID = dataID
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.WebhookURL+"?data.id="+dataID+"&type="+topic, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	requestID := uuid.NewString()
+	req.Header.Set("x-request-id", requestID)
+	req.Header.Set("x-signature", mercadopago.SignWebhook(s.cfg.WebhookSecret, dataID, requestID, time.Now().Unix()))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: status %d", ErrWebhookRejected, resp.StatusCode)
+	}
+	return nil
+}
+
+// scriptFor deve ser chamado com s.mu travado.
+func (s *Server) scriptFor(externalReference string) Script {
+	script, ok := s.scripts[externalReference]
+	if !ok || script.Outcome == "" {
+		script.Outcome = s.cfg.DefaultOutcome
+	}
+	return script
+}
+
+func (s *Server) authenticate(c *gin.Context) {
+	if s.cfg.AccessToken != "" && c.GetHeader("Authorization") != "Bearer "+s.cfg.AccessToken {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, apiError(http.StatusUnauthorized, "invalid access token"))
+	}
+}
+
+func (s *Server) injectFailures(c *gin.Context) {
+	s.mu.Lock()
+	fail := s.failures > 0
+	status := s.failureStatus
+	if fail {
+		s.failures--
+	}
+	s.mu.Unlock()
+
+	if fail {
+		c.AbortWithStatusJSON(status, apiError(status, "simulated failure"))
+	}
+}
+
+func (s *Server) createOrder(c *gin.Context) {
+	var req mercadopago.OrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apiError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	script := s.scriptFor(req.ExternalReference)
+	s.mu.Unlock()
+	if !wait(c, script.Latency) {
+		return
+	}
+	if script.Outcome == OutcomeError {
+		c.JSON(http.StatusInternalServerError, apiError(http.StatusInternalServerError, "simulated order failure"))
+		return
+	}
+
+	s.mu.Lock()
+	key := c.GetHeader("X-Idempotency-Key")
+	if id, ok := s.byIdempotency[key]; ok && key != "" {
+		o := s.orders[id]
+		s.mu.Unlock()
+		c.JSON(http.StatusCreated, orderResponse(o))
+		return
+	}
+	s.nextOrder++
+	o := &order{
+		ID:                fmt.Sprintf("ORD%010d", s.nextOrder),
+		ExternalReference: req.ExternalReference,
+		TotalAmount:       req.TotalAmount,
+		Status:            "created",
+		IdempotencyKey:    key,
+	}
+	s.orders[o.ID] = o
+	if key != "" {
+		s.byIdempotency[key] = o.ID
+	}
+	s.mu.Unlock()
+
+	if s.cfg.SettleAfter > 0 {
+		time.AfterFunc(s.cfg.SettleAfter, func() {
+			if _, err := s.Settle(context.Background(), o.ID); err != nil && !errors.Is(err, ErrOrderNotOpen) {
+				logger.Warn("mpsim: failed to settle order", zap.String("order_id", o.ID), zap.Error(err))
+			}
+		})
+	}
+
+	c.JSON(http.StatusCreated, orderResponse(o))
+}
+
+func (s *Server) getOrder(c *gin.Context) {
+	s.mu.Lock()
+	o, ok := s.orders[c.Param("id")]
+	var resp gin.H
+	if ok {
+		resp = orderResponse(o)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, apiError(http.StatusNotFound, ErrOrderNotFound.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) cancelOrder(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, apiError(http.StatusNotFound, ErrOrderNotFound.Error()))
+		return
+	}
+	switch o.Status {
+	case "created":
+		o.Status = "canceled"
+	case "canceled":
+	default:
+		c.JSON(http.StatusConflict, apiError(http.StatusConflict, ErrOrderNotOpen.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, orderResponse(o))
+}
+
+func (s *Server) getPayment(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	s.mu.Lock()
+	p, ok := s.payments[id]
+	var resp mercadopago.PaymentResponse
+	var latency time.Duration
+	if ok {
+		resp = p.PaymentResponse
+		latency = s.scriptFor(p.ExternalReference).Latency
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, apiError(http.StatusNotFound, "payment not found"))
+		return
+	}
+	if !wait(c, latency) {
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// searchPayments devolve os pagamentos da referência do mais recente para o
+// mais antigo, como a busca com sort=date_created&criteria=desc.
+func (s *Server) searchPayments(c *gin.Context) {
+	ref := c.Query("external_reference")
+
+	s.mu.Lock()
+	results := []mercadopago.PaymentResponse{}
+	for _, p := range s.payments {
+		if ref == "" || p.ExternalReference == ref {
+			results = append(results, p.PaymentResponse)
+		}
+	}
+	s.mu.Unlock()
+
+	// IDs crescem com o tempo, então a ordem dos IDs é a ordem de criação.
+	sort.Slice(results, func(i, j int) bool { return results[i].ID > results[j].ID })
+	c.JSON(http.StatusOK, mercadopago.PaymentSearchResponse{Results: results})
+}
+
+func (s *Server) refundPayment(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var req mercadopago.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apiError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Como no Mercado Pago, a mesma chave devolve o estorno já feito.
+	key := c.GetHeader("X-Idempotency-Key")
+	if refund, ok := s.refundsByKey[key]; ok && key != "" {
+		c.JSON(http.StatusCreated, refund)
+		return
+	}
+
+	p, ok := s.payments[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, apiError(http.StatusNotFound, "payment not found"))
+		return
+	}
+	if p.Status != "approved" {
+		c.JSON(http.StatusBadRequest, apiError(http.StatusBadRequest, "payment cannot be refunded in status "+p.Status))
+		return
+	}
+
+	remaining := p.Amount.Sub(p.Refunded)
+	amount := remaining
+	if req.Amount != nil {
+		parsed, err := domain.ParseMoney(req.Amount.String(), p.Amount.Currency)
+		if err != nil || parsed.Units <= 0 || parsed.Units > remaining.Units {
+			c.JSON(http.StatusBadRequest, apiError(http.StatusBadRequest, "invalid refund amount"))
+			return
+		}
+		amount = parsed
+	}
+
+	p.Refunded = p.Refunded.Add(amount)
+	if p.Refunded.Units == p.Amount.Units {
+		p.Status = "refunded"
+	}
+	s.nextRefund++
+	value, _ := strconv.ParseFloat(amount.Decimal(), 64)
+	refund := mercadopago.RefundResponse{
+		ID:        s.nextRefund,
+		PaymentID: p.ID,
+		Amount:    value,
+		Status:    "approved",
+	}
+	p.Refunds = append(p.Refunds, refund)
+	if key != "" {
+		s.refundsByKey[key] = refund
+	}
+	c.JSON(http.StatusCreated, refund)
+}
+
+type scriptRequest struct {
+	ExternalReference string  `json:"external_reference" binding:"required"`
+	Outcome           Outcome `json:"outcome"`
+	Latency           string  `json:"latency"`
+}
+
+func (s *Server) handleScript(c *gin.Context) {
+	var req scriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	script := Script{Outcome: req.Outcome}
+	if req.Latency != "" {
+		latency, err := time.ParseDuration(req.Latency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		script.Latency = latency
+	}
+	switch script.Outcome {
+	case "", OutcomeApprove, OutcomeReject, OutcomePending, OutcomeError:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidOutcome.Error()})
+		return
+	}
+	s.Script(req.ExternalReference, script)
+	c.Status(http.StatusNoContent)
+}
+
+type failuresRequest struct {
+	Count  int `json:"count" binding:"min=0"`
+	Status int `json:"status"`
+}
+
+func (s *Server) handleFailures(c *gin.Context) {
+	var req failuresRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == 0 {
+		req.Status = http.StatusServiceUnavailable
+	}
+	s.FailNext(req.Count, req.Status)
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleSettle(c *gin.Context) {
+	p, err := s.Settle(c.Request.Context(), c.Param("id"))
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrOrderNotOpen), errors.Is(err, ErrInvalidOutcome):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case p == nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case err != nil:
+		// O pagamento foi criado, mas o webhook falhou.
+		c.JSON(http.StatusAccepted, gin.H{"payment": p, "webhook_error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"payment": p})
+	}
+}
+
+func (s *Server) handleClose(close func(ctx context.Context, orderID string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := close(c.Request.Context(), c.Param("id"))
+		switch {
+		case errors.Is(err, ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrOrderNotOpen):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			// A ordem foi fechada, mas o webhook falhou.
+			c.JSON(http.StatusAccepted, gin.H{"webhook_error": err.Error()})
+		default:
+			c.Status(http.StatusNoContent)
+		}
+	}
+}
+
+func (s *Server) handleNotify(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	s.mu.Lock()
+	_, ok := s.payments[id]
+	s.mu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return
+	}
+	if err := s.Notify(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// orderResponse deve ser chamado com s.mu travado.
+func orderResponse(o *order) gin.H {
+	payments := []gin.H{}
+	if o.PaymentID != 0 {
+		referenceID := strconv.FormatInt(o.PaymentID, 10)
+		payments = append(payments, gin.H{"id": "PAY" + referenceID, "reference_id": referenceID})
+	}
+	return gin.H{
+		"id":                 o.ID,
+		"type":               "qr",
+		"external_reference": o.ExternalReference,
+		"total_amount":       o.TotalAmount,
+		"status":             o.Status,
+		"type_response":      gin.H{"qr_data": "00020101021243650016COM.MERCADOLIBRE0201306" + o.ID},
+		"transactions":       gin.H{"payments": payments},
+	}
+}
+
+func apiError(status int, message string) gin.H {
+	return gin.H{"status": status, "message": message}
+}
+
+// wait atrasa a resposta e retorna false se o cliente desistiu antes.
+func wait(c *gin.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.Request.Context().Done():
+		c.Abort()
+		return false
+	}
+}
@@ -0,0 +1,240 @@
+package mpsim_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/integration/mercadopago"
+	"github.com/alexssanderFonseca/pagamento/internal/integration/mercadopago/mpsim"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+)
+
+const webhookSecret = "sim-secret"
+
+// setup sobe o simulador e um receptor de webhooks que valida as
+// notificações com o próprio cliente, como o serviço faz.
+func setup(t *testing.T, cfg mpsim.Config) (*mpsim.Server, *mercadopago.Client, <-chan *domain.WebhookEvent) {
+	t.Helper()
+
+	events := make(chan *domain.WebhookEvent, 10)
+	var client *mercadopago.Client
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		event, err := client.ParseWebhook(r.Context(), domain.WebhookRequest{Headers: r.Header, Query: r.URL.Query(), Body: body})
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		events <- event
+	}))
+	t.Cleanup(receiver.Close)
+
+	cfg.WebhookURL = receiver.URL
+	cfg.WebhookSecret = webhookSecret
+	sim := mpsim.NewServer(cfg)
+	server := httptest.NewServer(sim)
+	t.Cleanup(server.Close)
+
+	client = mercadopago.NewClient(config.Default().MercadoPago,
+		mercadopago.WithBaseURL(server.URL),
+		mercadopago.WithAccessToken(cfg.AccessToken),
+		mercadopago.WithWebhookSecret(webhookSecret),
+		mercadopago.WithRetry(2, resilience.Backoff{Base: time.Millisecond, Max: 5 * time.Millisecond}),
+	)
+	return sim, client, events
+}
+
+func chargeRequest(ref string) domain.CreatePaymentRequest {
+	return domain.CreatePaymentRequest{ExternalReference: ref, Amount: domain.NewMoney(1050, "BRL"), Description: "Troca de óleo"}
+}
+
+func TestSimulator_ApproveSendsSignedWebhook(t *testing.T) {
+	sim, client, events := setup(t, mpsim.Config{AccessToken: "token"})
+	ctx := context.Background()
+
+	charge, err := client.CreateCharge(ctx, chargeRequest("OS-1"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if charge.ID == "" || charge.QRData == "" {
+		t.Fatalf("expected order with QR data, got %+v", charge)
+	}
+
+	if _, err := sim.Settle(ctx, charge.ID); err != nil {
+		t.Fatalf("expected settle to notify the receiver, got %v", err)
+	}
+	event := <-events
+	if event.Type != "payment" || event.PaymentID == "" {
+		t.Fatalf("unexpected webhook event: %+v", event)
+	}
+
+	payment, err := client.GetPayment(ctx, event.PaymentID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payment.Status != domain.StatusApproved || payment.ExternalReference != "OS-1" {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+
+	// Ordem já paga não pode ser cancelada.
+	if err := client.CancelCharge(ctx, charge.ID, "cancel-1"); err == nil {
+		t.Error("expected error cancelling a processed order")
+	}
+}
+
+func TestSimulator_ScriptedOutcomes(t *testing.T) {
+	sim, client, events := setup(t, mpsim.Config{})
+	ctx := context.Background()
+	sim.Script("OS-REJ", mpsim.Script{Outcome: mpsim.OutcomeReject})
+	sim.Script("OS-ERR", mpsim.Script{Outcome: mpsim.OutcomeError})
+
+	if _, err := client.CreateCharge(ctx, chargeRequest("OS-ERR")); err == nil {
+		t.Error("expected scripted error outcome to fail the order")
+	}
+
+	charge, err := client.CreateCharge(ctx, chargeRequest("OS-REJ"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := sim.Settle(ctx, charge.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	payment, err := client.GetPayment(ctx, (<-events).PaymentID)
+	if err != nil || payment.Status != domain.StatusRejected {
+		t.Fatalf("expected rejected payment, got %+v (%v)", payment, err)
+	}
+
+	results, err := client.SearchPayments(ctx, "OS-REJ")
+	if err != nil || len(results) != 1 || results[0].ID != payment.ID {
+		t.Errorf("expected search to find the payment, got %+v (%v)", results, err)
+	}
+}
+
+func TestSimulator_FailuresAndLatency(t *testing.T) {
+	sim, client, _ := setup(t, mpsim.Config{})
+	ctx := context.Background()
+
+	// O cliente repete 503 duas vezes antes de desistir.
+	sim.FailNext(2, http.StatusServiceUnavailable)
+	if _, err := client.CreateCharge(ctx, chargeRequest("OS-1")); err != nil {
+		t.Errorf("expected the retries to absorb the failures, got %v", err)
+	}
+	sim.FailNext(3, http.StatusServiceUnavailable)
+	if _, err := client.CreateCharge(ctx, chargeRequest("OS-1")); !errors.Is(err, domain.ErrProviderUnavailable) {
+		t.Errorf("expected simulated 503 to exhaust the retries, got %v", err)
+	}
+
+	sim.Script("OS-SLOW", mpsim.Script{Latency: time.Second})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.CreateCharge(timeoutCtx, chargeRequest("OS-SLOW")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestSimulator_RefundAndCancel(t *testing.T) {
+	sim, client, events := setup(t, mpsim.Config{})
+	ctx := context.Background()
+
+	charge, _ := client.CreateCharge(ctx, chargeRequest("OS-1"))
+	if _, err := sim.Settle(ctx, charge.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	paymentID := (<-events).PaymentID
+
+	partial := domain.NewMoney(500, "BRL")
+	first, err := client.RefundPayment(ctx, paymentID, &partial, "r-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if repeated, err := client.RefundPayment(ctx, paymentID, &partial, "r-1"); err != nil || repeated.ID != first.ID {
+		t.Errorf("expected the same refund for the same key, got %+v (%v)", repeated, err)
+	}
+	tooMuch := domain.NewMoney(1000, "BRL")
+	if _, err := client.RefundPayment(ctx, paymentID, &tooMuch, "r-2"); err == nil {
+		t.Error("expected refund above the remaining amount to fail")
+	}
+	refund, err := client.RefundPayment(ctx, paymentID, nil, "r-3")
+	if err != nil || refund.ID == "" {
+		t.Fatalf("expected full refund of the remaining amount, got %+v (%v)", refund, err)
+	}
+	payment, _ := client.GetPayment(ctx, paymentID)
+	if payment.Status != domain.StatusRefunded {
+		t.Errorf("expected refunded payment, got %s", payment.Status)
+	}
+	if len(payment.Refunds) != 2 || payment.Refunds[0].ID != first.ID || payment.Refunds[0].Amount != partial {
+		t.Errorf("expected both refunds in the payment, got %+v", payment.Refunds)
+	}
+
+	open, _ := client.CreateCharge(ctx, chargeRequest("OS-2"))
+	if err := client.CancelCharge(ctx, open.ID, "cancel-2"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := sim.Settle(ctx, open.ID); !errors.Is(err, mpsim.ErrOrderNotOpen) {
+		t.Errorf("expected cancelled order not to be paid, got %v", err)
+	}
+}
+
+func TestSimulator_OrderExpirationAndPOSCancellation(t *testing.T) {
+	sim, client, events := setup(t, mpsim.Config{})
+	ctx := context.Background()
+
+	expiring, _ := client.CreateCharge(ctx, chargeRequest("OS-1"))
+	if err := sim.Expire(ctx, expiring.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	event := <-events
+	if event.Type != "order" || event.ChargeID != expiring.ID || event.PaymentID != "" {
+		t.Fatalf("unexpected webhook event: %+v", event)
+	}
+	charge, err := client.GetCharge(ctx, event.ChargeID)
+	if err != nil || charge.Status != domain.StatusExpired || charge.ExternalReference != "OS-1" {
+		t.Fatalf("expected expired order, got %+v (%v)", charge, err)
+	}
+
+	cancelled, _ := client.CreateCharge(ctx, chargeRequest("OS-2"))
+	if err := sim.CancelAtPOS(ctx, cancelled.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	charge, err = client.GetCharge(ctx, (<-events).ChargeID)
+	if err != nil || charge.Status != domain.StatusCancelled {
+		t.Fatalf("expected cancelled order, got %+v (%v)", charge, err)
+	}
+	if err := sim.Expire(ctx, cancelled.ID); !errors.Is(err, mpsim.ErrOrderNotOpen) {
+		t.Errorf("expected closed order not to expire, got %v", err)
+	}
+}
+
+func TestSimulator_AutoSettle(t *testing.T) {
+	_, client, events := setup(t, mpsim.Config{SettleAfter: 10 * time.Millisecond})
+
+	if _, err := client.CreateCharge(context.Background(), chargeRequest("OS-1")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	select {
+	case event := <-events:
+		if event.PaymentID == "" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected webhook after SettleAfter")
+	}
+}
+
+func TestSimulator_RejectsInvalidToken(t *testing.T) {
+	sim := mpsim.NewServer(mpsim.Config{AccessToken: "token"})
+	server := httptest.NewServer(sim)
+	defer server.Close()
+
+	client := mercadopago.NewClient(config.Default().MercadoPago, mercadopago.WithBaseURL(server.URL), mercadopago.WithAccessToken("wrong"))
+	if _, err := client.CreateCharge(context.Background(), chargeRequest("OS-1")); err == nil {
+		t.Error("expected 401 for a wrong access token")
+	}
+}
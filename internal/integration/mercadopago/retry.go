@@ -0,0 +1,161 @@
+package mercadopago
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultMaxRetries  = 3
+	DefaultBackoffBase = 200 * time.Millisecond
+	DefaultBackoffMax  = 5 * time.Second
+)
+
+// Operações da API, usadas em WithOperationTimeout e nas métricas.
+const (
+	OperationCreateCharge   = "create_charge"
+	OperationGetPayment     = "get_payment"
+	OperationSearchPayments = "search_payments"
+	OperationGetCharge      = "get_charge"
+	OperationRefundPayment  = "refund_payment"
+	OperationCancelCharge   = "cancel_charge"
+)
+
+// do executa a chamada com timeout por tentativa, passando pelo disjuntor, e
+// repete com backoff quando o Mercado Pago responde 429 ou 5xx. send recebe
+// uma requisição nova a cada tentativa; como a chave X-Idempotency-Key é
+// calculada fora dele, toda repetição reenvia a mesma chave e não duplica
+// ordens nem estornos. Erros de rede não são repetidos. Um 429 não conta como
+// falha no disjuntor: o gateway está respondendo, só limitando a taxa. A
+// operação inteira fica no span mercadopago.<operation>, com um evento por
+// nova tentativa.
+func (c *Client) do(ctx context.Context, operation string, send func(req *resty.Request) (*resty.Response, error)) (resp *resty.Response, err error) {
+	ctx, span := c.tracer.Start(ctx, "mercadopago."+operation,
+		trace.WithAttributes(attribute.String("mercadopago.operation", operation)))
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode()))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for attempt := 0; ; attempt++ {
+		if err := c.breaker.Allow(); err != nil {
+			c.metrics.recordRejected(ctx, operation)
+			return nil, fmt.Errorf("%w: %w", domain.ErrProviderUnavailable, err)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, c.timeoutFor(operation))
+		start := time.Now()
+		resp, err := send(c.httpClient.R().
+			SetContext(callCtx).
+			SetHeader("Authorization", "Bearer "+c.accessToken))
+		cancel()
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode()
+		}
+		c.metrics.recordCall(ctx, operation, time.Since(start), statusCode, err)
+
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// O chamador desistiu; não diz nada sobre a saúde do Mercado Pago.
+			c.breaker.Abandon()
+			return nil, err
+		case err != nil:
+			c.breaker.Failure()
+			return nil, err
+		case !retryable(resp.StatusCode()):
+			c.breaker.Success()
+			return resp, nil
+		}
+
+		if resp.StatusCode() == http.StatusTooManyRequests {
+			c.breaker.Abandon()
+		} else {
+			c.breaker.Failure()
+		}
+		if attempt >= c.maxRetries {
+			return resp, nil
+		}
+
+		wait := c.backoff.Delay(attempt)
+		if retryAfter := retryAfterDelay(resp); retryAfter > wait && retryAfter <= c.backoff.Max {
+			wait = retryAfter
+		}
+		c.metrics.recordRetry(ctx, operation)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.Int("http.response.status_code", resp.StatusCode()),
+			attribute.String("wait", wait.String()),
+		))
+		logger.FromContext(ctx).Warn("retrying mercadopago request",
+			zap.String("operation", operation),
+			zap.Int("attempt", attempt+1),
+			zap.Int("status", resp.StatusCode()),
+			zap.Duration("wait", wait),
+		)
+		if err := resilience.Sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) timeoutFor(operation string) time.Duration {
+	if timeout, ok := c.operationTimeouts[operation]; ok {
+		return timeout
+	}
+	return c.timeout
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryAfterDelay lê o header Retry-After em segundos, quando presente.
+func retryAfterDelay(resp *resty.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header().Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// apiError descreve uma resposta de erro da API. 429 e 5xx, que esgotaram as
+// novas tentativas, são tratados como indisponibilidade do gateway. O corpo da
+// resposta só vai para o log: o erro pode chegar ao cliente da API.
+func apiError(ctx context.Context, operation string, resp *resty.Response) error {
+	logger.FromContext(ctx).Warn("mercadopago api error",
+		zap.String("operation", operation),
+		zap.Int("status", resp.StatusCode()),
+		zap.String("body", resp.String()),
+	)
+	if retryable(resp.StatusCode()) {
+		return fmt.Errorf("%w: mercadopago %s failed with status %d", domain.ErrProviderUnavailable, operation, resp.StatusCode())
+	}
+	return fmt.Errorf("mercadopago %s failed with status %d", operation, resp.StatusCode())
+}
+
+func positiveDuration(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
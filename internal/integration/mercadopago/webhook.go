@@ -0,0 +1,149 @@
+package mercadopago
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+type WebhookNotification struct {
+	ID          interface{} `json:"id"`
+	LiveMode    bool        `json:"live_mode"`
+	Type        string      `json:"type"`
+	DateCreated string      `json:"date_created"`
+	UserID      string      `json:"user_id"`
+	APIVersion  string      `json:"api_version"`
+	Action      string      `json:"action"`
+	Data        struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// DefaultWebhookTolerance é a diferença máxima aceita entre o ts assinado e o
+// relógio local.
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// ParseWebhook valida o header x-signature e extrai o recurso notificado: o
+// pagamento no tópico payment e a ordem nos tópicos order e merchant_order.
+// Notificações de outros tópicos retornam um evento sem PaymentID e ChargeID.
+func (c *Client) ParseWebhook(ctx context.Context, req domain.WebhookRequest) (*domain.WebhookEvent, error) {
+	decoder := json.NewDecoder(bytes.NewReader(req.Body))
+	decoder.UseNumber()
+	var notification WebhookNotification
+	if err := decoder.Decode(&notification); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidWebhookPayload, err)
+	}
+
+	requestID := req.Headers.Get("x-request-id")
+	if !c.validateSignature(req.Headers.Get("x-signature"), requestID, notification) {
+		return nil, domain.ErrInvalidWebhookSignature
+	}
+
+	event := &domain.WebhookEvent{ID: notificationID(notification, requestID), Type: notification.Type}
+	switch notification.Type {
+	case "payment":
+		event.PaymentID = notification.Data.ID
+	case "order", "merchant_order", "topic_merchant_order_wh":
+		event.ChargeID = notification.Data.ID
+	}
+	return event, nil
+}
+
+// notificationID identifica a notificação para deduplicação só com valores
+// assinados: o data.id e o x-request-id. O id do corpo fica de fora, porque
+// não entra na assinatura e poderia ser trocado para escapar da deduplicação
+// ou para descartar outra notificação. Sem x-request-id a notificação não é
+// deduplicada.
+func notificationID(notification WebhookNotification, requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	return notification.Data.ID + ":" + requestID
+}
+
+// validateSignature confere o x-signature com a chave do webhook. Sem chave
+// configurada nenhuma notificação é aceita.
+func (c *Client) validateSignature(signatureHeader, requestID string, notification WebhookNotification) bool {
+	if c.webhookSecret == "" || signatureHeader == "" {
+		return false
+	}
+
+	parts := strings.Split(signatureHeader, ",")
+	var ts, hash string
+	for _, part := range parts {
+		kv := strings.Split(part, "=")
+		if len(kv) != 2 {
+			continue
+		}
+		if kv[0] == "ts" {
+			ts = kv[1]
+		} else if kv[0] == "v1" {
+			hash = kv[1]
+		}
+	}
+
+	if ts == "" || hash == "" {
+		return false
+	}
+
+	if !c.withinTolerance(ts) {
+		return false
+	}
+
+	expectedHash := signatureHash(c.webhookSecret, notification.Data.ID, requestID, ts)
+	return hmac.Equal([]byte(hash), []byte(expectedHash))
+}
+
+// withinTolerance recusa assinaturas antigas ou do futuro, que indicam uma
+// notificação capturada e reenviada. O ts pode vir em segundos ou em
+// milissegundos. Tolerância zero desliga a verificação.
+func (c *Client) withinTolerance(ts string) bool {
+	if c.webhookTolerance <= 0 {
+		return true
+	}
+	value, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	signedAt := time.Unix(value, 0)
+	if value > 1e12 {
+		signedAt = time.UnixMilli(value)
+	}
+	age := time.Since(signedAt)
+	return age <= c.webhookTolerance && age >= -c.webhookTolerance
+}
+
+// SignWebhook monta o header x-signature que o Mercado Pago envia para a
+// notificação do recurso dataID com o x-request-id requestID. É usado pelo
+// simulador (cmd/mpsim).
+func SignWebhook(secret, dataID, requestID string, ts int64) string {
+	timestamp := strconv.FormatInt(ts, 10)
+	return fmt.Sprintf("ts=%s,v1=%s", timestamp, signatureHash(secret, dataID, requestID, timestamp))
+}
+
+// signatureHash assina o manifesto id:<data.id>;request-id:<x-request-id>;ts:<ts>;
+// omitindo, como o Mercado Pago, as partes sem valor. IDs alfanuméricos
+// entram em minúsculas.
+func signatureHash(secret, dataID, requestID, ts string) string {
+	var manifest strings.Builder
+	if dataID != "" {
+		fmt.Fprintf(&manifest, "id:%s;", strings.ToLower(dataID))
+	}
+	if requestID != "" {
+		fmt.Fprintf(&manifest, "request-id:%s;", requestID)
+	}
+	fmt.Fprintf(&manifest, "ts:%s;", ts)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(manifest.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,220 @@
+package mercadopago
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+func sign(secret, manifest string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(manifest))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedHeaders assina a notificação de dataID como o Mercado Pago, com a
+// chave "secret".
+func signedHeaders(dataID, requestID string) http.Header {
+	headers := http.Header{}
+	headers.Set("x-signature", SignWebhook("secret", dataID, requestID, time.Now().Unix()))
+	if requestID != "" {
+		headers.Set("x-request-id", requestID)
+	}
+	return headers
+}
+
+func TestParseWebhook(t *testing.T) {
+	client := &Client{webhookSecret: "secret"}
+	body := []byte(`{"type":"payment","data":{"id":"123"}}`)
+
+	cases := map[string]struct {
+		body      []byte
+		signature string
+		wantErr   error
+		wantID    string
+	}{
+		"valid signature":   {body, "ts=1700000000,v1=" + sign("secret", "id:123;ts:1700000000;"), nil, "123"},
+		"wrong signature":   {body, "ts=1700000000,v1=" + sign("other", "id:123;ts:1700000000;"), domain.ErrInvalidWebhookSignature, ""},
+		"missing signature": {body, "", domain.ErrInvalidWebhookSignature, ""},
+		"invalid payload":   {[]byte("{invalid}"), "", domain.ErrInvalidWebhookPayload, ""},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			headers := http.Header{}
+			if tc.signature != "" {
+				headers.Set("x-signature", tc.signature)
+			}
+			event, err := client.ParseWebhook(context.Background(), domain.WebhookRequest{Headers: headers, Body: tc.body})
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if err == nil && event.PaymentID != tc.wantID {
+				t.Errorf("expected payment id %q, got %q", tc.wantID, event.PaymentID)
+			}
+		})
+	}
+}
+
+func TestParseWebhook_ReplayProtection(t *testing.T) {
+	client := &Client{webhookSecret: "secret", webhookTolerance: 5 * time.Minute}
+	body := []byte(`{"id":12345678901,"type":"payment","data":{"id":"123"}}`)
+	now := time.Now()
+
+	cases := map[string]struct {
+		signature string
+		requestID string
+		wantErr   error
+	}{
+		"fresh timestamp":        {SignWebhook("secret", "123", "req-1", now.Unix()), "req-1", nil},
+		"timestamp in ms":        {SignWebhook("secret", "123", "req-1", now.UnixMilli()), "req-1", nil},
+		"expired timestamp":      {SignWebhook("secret", "123", "req-1", now.Add(-10*time.Minute).Unix()), "req-1", domain.ErrInvalidWebhookSignature},
+		"future timestamp":       {SignWebhook("secret", "123", "req-1", now.Add(10*time.Minute).Unix()), "req-1", domain.ErrInvalidWebhookSignature},
+		"request id swapped":     {SignWebhook("secret", "123", "req-1", now.Unix()), "req-2", domain.ErrInvalidWebhookSignature},
+		"request id in manifest": {"ts=" + strconv.FormatInt(now.Unix(), 10) + ",v1=" + sign("secret", "id:123;request-id:req-1;ts:"+strconv.FormatInt(now.Unix(), 10)+";"), "req-1", nil},
+		"non numeric timestamp":  {"ts=abc,v1=" + sign("secret", "id:123;request-id:req-1;ts:abc;"), "req-1", domain.ErrInvalidWebhookSignature},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			headers := http.Header{}
+			headers.Set("x-signature", tc.signature)
+			headers.Set("x-request-id", tc.requestID)
+			event, err := client.ParseWebhook(context.Background(), domain.WebhookRequest{Headers: headers, Body: body})
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if err == nil && event.ID != "123:req-1" {
+				t.Errorf("expected notification id from the signed data.id and x-request-id, got %q", event.ID)
+			}
+		})
+	}
+}
+
+func TestParseWebhook_RequiresSecret(t *testing.T) {
+	client := &Client{}
+	_, err := client.ParseWebhook(context.Background(), domain.WebhookRequest{
+		Headers: signedHeaders("123", "req-1"),
+		Body:    []byte(`{"type":"payment","data":{"id":"123"}}`),
+	})
+	if !errors.Is(err, domain.ErrInvalidWebhookSignature) {
+		t.Fatalf("expected ErrInvalidWebhookSignature without a secret, got %v", err)
+	}
+}
+
+func TestParseWebhook_NotificationIDUsesOnlySignedValues(t *testing.T) {
+	client := &Client{webhookSecret: "secret"}
+	cases := map[string]struct {
+		requestID string
+		body      string
+		wantID    string
+	}{
+		"without body id":      {"req-1", `{"type":"payment","data":{"id":"123"}}`, "123:req-1"},
+		"body id is ignored":   {"req-1", `{"id":999,"type":"payment","data":{"id":"123"}}`, "123:req-1"},
+		"without x-request-id": {"", `{"id":999,"type":"payment","data":{"id":"123"}}`, ""},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			event, err := client.ParseWebhook(context.Background(), domain.WebhookRequest{
+				Headers: signedHeaders("123", tc.requestID),
+				Body:    []byte(tc.body),
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if event.ID != tc.wantID {
+				t.Errorf("expected notification id %q, got %q", tc.wantID, event.ID)
+			}
+		})
+	}
+}
+
+func TestParseWebhook_OtherTopic(t *testing.T) {
+	client := &Client{webhookSecret: "secret"}
+	event, err := client.ParseWebhook(context.Background(), domain.WebhookRequest{
+		Headers: signedHeaders("9", ""),
+		Body:    []byte(`{"type":"plan","data":{"id":"9"}}`),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if event.PaymentID != "" {
+		t.Errorf("expected no payment for topic plan, got %q", event.PaymentID)
+	}
+}
+
+func TestParseWebhook_OrderTopics(t *testing.T) {
+	client := &Client{webhookSecret: "secret"}
+	for _, topic := range []string{"order", "merchant_order"} {
+		event, err := client.ParseWebhook(context.Background(), domain.WebhookRequest{
+			Headers: signedHeaders("ORD1", ""),
+			Body:    []byte(`{"type":"` + topic + `","data":{"id":"ORD1"}}`),
+		})
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", topic, err)
+		}
+		if event.ChargeID != "ORD1" || event.PaymentID != "" {
+			t.Errorf("%s: expected charge ORD1, got %+v", topic, event)
+		}
+	}
+}
+
+func TestMapOrderStatus(t *testing.T) {
+	cases := map[string]domain.PaymentStatus{
+		"created":         domain.StatusPending,
+		"action_required": domain.StatusPending,
+		"processed":       domain.StatusApproved,
+		"failed":          domain.StatusRejected,
+		"canceled":        domain.StatusCancelled,
+		"expired":         domain.StatusExpired,
+		"refunded":        domain.StatusRefunded,
+	}
+	for raw, want := range cases {
+		if got := mapOrderStatus(raw); got != want {
+			t.Errorf("%s: expected %s, got %s", raw, want, got)
+		}
+	}
+}
+
+func TestMapMerchantOrderStatus(t *testing.T) {
+	cases := []struct {
+		status, orderStatus string
+		want                domain.PaymentStatus
+	}{
+		{"opened", "payment_required", domain.StatusPending},
+		{"opened", "partially_paid", domain.StatusPending},
+		{"closed", "paid", domain.StatusApproved},
+		{"expired", "payment_required", domain.StatusExpired},
+		{"closed", "payment_required", domain.StatusCancelled},
+		{"closed", "reverted", domain.StatusRefunded},
+	}
+	for _, tc := range cases {
+		if got := mapMerchantOrderStatus(tc.status, tc.orderStatus); got != tc.want {
+			t.Errorf("%s/%s: expected %s, got %s", tc.status, tc.orderStatus, tc.want, got)
+		}
+	}
+}
+
+func TestMapStatus(t *testing.T) {
+	cases := map[string]domain.PaymentStatus{
+		"approved":     domain.StatusApproved,
+		"authorized":   domain.StatusAuthorized,
+		"rejected":     domain.StatusRejected,
+		"cancelled":    domain.StatusCancelled,
+		"refunded":     domain.StatusRefunded,
+		"charged_back": domain.StatusChargedBack,
+		"in_process":   domain.StatusPending,
+		"in_mediation": domain.StatusPending,
+	}
+	for raw, want := range cases {
+		if got := mapStatus(raw); got != want {
+			t.Errorf("%s: expected %s, got %s", raw, want, got)
+		}
+	}
+}
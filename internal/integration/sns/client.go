@@ -2,43 +2,107 @@ package sns
 
 import (
 	"context"
-	"encoding/json"
-	"os"
 
-	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
 )
 
+const meterName = "github.com/alexssanderFonseca/pagamento/internal/integration/sns"
+
 type Client struct {
 	snsClient *sns.Client
 	topicARN  string
+
+	meterProvider   metric.MeterProvider
+	publishFailures metric.Int64Counter
 }
 
-func NewClient(cfg aws.Config) *Client {
-	return &Client{
-		snsClient: sns.NewFromConfig(cfg),
-		topicARN:  os.Getenv("AWS_SNS_TOPIC_ARN"),
+type Option func(*Client)
+
+// WithMeterProvider troca o MeterProvider global das métricas do cliente.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *Client) {
+		c.meterProvider = provider
 	}
 }
 
-func (c *Client) PublishPaymentProcessed(ctx context.Context, event domain.PaymentProcessedEvent) error {
-	payload, err := json.Marshal(event)
-	if err != nil {
-		return err
+func NewClient(cfg aws.Config, topicARN string, opts ...Option) *Client {
+	c := &Client{
+		snsClient:     sns.NewFromConfig(cfg),
+		topicARN:      topicARN,
+		meterProvider: otel.GetMeterProvider(),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 
-	_, err = c.snsClient.Publish(ctx, &sns.PublishInput{
-		Message:  aws.String(string(payload)),
-		TopicArn: aws.String(c.topicARN),
-		MessageAttributes: map[string]types.MessageAttributeValue{
-			"event_type": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String("payment_processed"),
-			},
+	var err error
+	if c.publishFailures, err = c.meterProvider.Meter(meterName).Int64Counter("sns.publish.failures",
+		metric.WithDescription("Publicações no SNS que falharam")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	return c
+}
+
+// Publish envia o payload já serializado com o tipo do evento no atributo
+// event_type, usado pelos consumidores para filtrar as mensagens. O contexto
+// do trace de ctx vai nos atributos traceparent e tracestate, para que os
+// consumidores continuem o trace.
+func (c *Client) Publish(ctx context.Context, eventType string, payload []byte) error {
+	attributes := map[string]types.MessageAttributeValue{
+		"event_type": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(eventType),
 		},
+	}
+	otel.GetTextMapPropagator().Inject(ctx, messageAttributeCarrier(attributes))
+
+	_, err := c.snsClient.Publish(ctx, &sns.PublishInput{
+		Message:           aws.String(string(payload)),
+		TopicArn:          aws.String(c.topicARN),
+		MessageAttributes: attributes,
 	})
+	if err != nil {
+		c.publishFailures.Add(ctx, 1, metric.WithAttributes(attribute.String("event_type", eventType)))
+	}
 
 	return err
 }
+
+// Ping confere, com GetTopicAttributes, que o tópico existe e está acessível.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.snsClient.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(c.topicARN)})
+	return err
+}
+
+// messageAttributeCarrier grava e lê o contexto do trace nos atributos da
+// mensagem, como atributos String.
+type messageAttributeCarrier map[string]types.MessageAttributeValue
+
+var _ propagation.TextMapCarrier = messageAttributeCarrier{}
+
+func (c messageAttributeCarrier) Get(key string) string {
+	if value, ok := c[key]; ok && value.StringValue != nil {
+		return *value.StringValue
+	}
+	return ""
+}
+
+func (c messageAttributeCarrier) Set(key, value string) {
+	c[key] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+}
+
+func (c messageAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
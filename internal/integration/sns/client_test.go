@@ -0,0 +1,81 @@
+package sns
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/telemetry/metrictest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestConfig(url string) aws.Config {
+	return aws.Config{
+		Region:       "us-east-1",
+		Credentials:  aws.AnonymousCredentials{},
+		BaseEndpoint: aws.String(url),
+		Retryer:      func() aws.Retryer { return aws.NopRetryer{} },
+	}
+}
+
+func TestClient_Publish_CountsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	reader := metrictest.NewReader()
+	client := NewClient(newTestConfig(server.URL), "arn:aws:sns:us-east-1:000000000000:payments", WithMeterProvider(reader.Provider))
+
+	if err := client.Publish(context.Background(), "payment_processed", []byte(`{}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got := reader.Int64Sum(t, "sns.publish.failures", attribute.String("event_type", "payment_processed")); got != 1 {
+		t.Errorf("expected one failure, got %d", got)
+	}
+}
+
+func TestClient_Publish_InjectsTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := NewClient(newTestConfig(server.URL), "arn:aws:sns:us-east-1:000000000000:payments")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	_ = client.Publish(ctx, "payment_processed", []byte(`{}`))
+
+	attributes := map[string]string{}
+	for i := 1; form.Get("MessageAttributes.entry."+strconv.Itoa(i)+".Name") != ""; i++ {
+		prefix := "MessageAttributes.entry." + strconv.Itoa(i)
+		attributes[form.Get(prefix+".Name")] = form.Get(prefix + ".Value.StringValue")
+	}
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if attributes["traceparent"] != expected {
+		t.Errorf("expected traceparent %s, got %v", expected, attributes)
+	}
+	if attributes["event_type"] != "payment_processed" {
+		t.Errorf("expected the event_type attribute, got %v", attributes)
+	}
+}
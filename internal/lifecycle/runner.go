@@ -0,0 +1,145 @@
+// Package lifecycle inicia os componentes do serviço e os encerra em ordem
+// quando o processo recebe um sinal ou um deles falha.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultShutdownTimeout limita o encerramento de todos os componentes.
+const DefaultShutdownTimeout = 25 * time.Second
+
+// component é uma parte registrada no Runner. run, quando informado, bloqueia
+// enquanto o componente está ativo; stop o encerra.
+type component struct {
+	name string
+	run  func(ctx context.Context) error
+	stop func(ctx context.Context) error
+	done chan struct{}
+}
+
+// Runner inicia os componentes na ordem de registro e os para na ordem
+// inversa: o que é registrado primeiro (ex.: telemetria) é o último a parar,
+// e o servidor HTTP, registrado por último, é o primeiro.
+type Runner struct {
+	components      []*component
+	shutdownTimeout time.Duration
+}
+
+func NewRunner(shutdownTimeout time.Duration) *Runner {
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+	return &Runner{shutdownTimeout: shutdownTimeout}
+}
+
+// Add registra um componente cujo run bloqueia até stop ser chamado, como
+// http.Server.ListenAndServe e Shutdown. run retornar erro encerra o Runner.
+func (r *Runner) Add(name string, run, stop func(ctx context.Context) error) {
+	r.components = append(r.components, &component{name: name, run: run, stop: stop})
+}
+
+// Go registra um worker que roda até o contexto recebido ser cancelado. Na
+// sua vez de parar, o contexto é cancelado e o Runner espera o retorno.
+func (r *Runner) Go(name string, run func(ctx context.Context)) {
+	quit := make(chan struct{})
+	r.Add(name, func(ctx context.Context) error {
+		workerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-quit:
+				cancel()
+			case <-workerCtx.Done():
+			}
+		}()
+		run(workerCtx)
+		return nil
+	}, func(context.Context) error {
+		close(quit)
+		return nil
+	})
+}
+
+// AddServer registra um http.Server: na parada ele deixa de aceitar conexões
+// e espera as requisições em andamento terminarem.
+func (r *Runner) AddServer(name string, srv *http.Server) {
+	r.Add(name, func(context.Context) error {
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, srv.Shutdown)
+}
+
+// OnStop registra uma finalização sem parte ativa, como o flush da
+// telemetria ou o fechamento de uma conexão.
+func (r *Runner) OnStop(name string, stop func(ctx context.Context) error) {
+	r.Add(name, nil, stop)
+}
+
+// Run inicia os componentes e bloqueia até ctx ser cancelado ou um deles
+// falhar; então para todos dentro do prazo de encerramento. Retorna a falha
+// que interrompeu a execução junto com os erros de encerramento.
+func (r *Runner) Run(ctx context.Context) error {
+	// Os componentes não param com ctx, e sim na sua vez, em Stop.
+	runCtx := context.WithoutCancel(ctx)
+	failures := make(chan error, len(r.components))
+	for _, c := range r.components {
+		if c.run == nil {
+			continue
+		}
+		c.done = make(chan struct{})
+		go func(c *component) {
+			defer close(c.done)
+			if err := c.run(runCtx); err != nil {
+				failures <- fmt.Errorf("%s: %w", c.name, err)
+			}
+		}(c)
+		logger.Info("component started", zap.String("component", c.name))
+	}
+
+	var failure error
+	select {
+	case <-ctx.Done():
+		logger.Info("shutdown requested")
+	case failure = <-failures:
+		logger.Error("component failed, shutting down", zap.Error(failure))
+	}
+	return errors.Join(failure, r.Shutdown(runCtx))
+}
+
+// Shutdown para os componentes na ordem inversa do registro, dentro do prazo
+// de encerramento. Run já o chama; use-o direto só quando Run não for
+// executado, como em um subcomando que só precisa das finalizações.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(r.components) - 1; i >= 0; i-- {
+		c := r.components[i]
+		start := time.Now()
+		if c.stop != nil {
+			if err := c.stop(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("stop %s: %w", c.name, err))
+			}
+		}
+		if c.done != nil {
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				errs = append(errs, fmt.Errorf("stop %s: %w", c.name, ctx.Err()))
+			}
+		}
+		logger.Info("component stopped", zap.String("component", c.name), zap.Duration("duration", time.Since(start)))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,143 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder guarda a ordem em que os componentes pararam.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+func TestRunner_StopsInReverseOrder(t *testing.T) {
+	events := &recorder{}
+	runner := NewRunner(time.Second)
+	runner.OnStop("telemetry", func(context.Context) error {
+		events.add("telemetry")
+		return nil
+	})
+	for _, name := range []string{"relay", "sweeper"} {
+		runner.Go(name, func(ctx context.Context) {
+			<-ctx.Done()
+			events.add(name)
+		})
+	}
+	release := make(chan struct{})
+	runner.Add("http", func(context.Context) error {
+		<-release
+		events.add("http")
+		return nil
+	}, func(context.Context) error {
+		close(release)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := runner.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := events.String(); got != "http,sweeper,relay,telemetry" {
+		t.Errorf("unexpected stop order: %s", got)
+	}
+}
+
+func TestRunner_ComponentFailureStopsTheRest(t *testing.T) {
+	stopped := false
+	runner := NewRunner(time.Second)
+	runner.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		stopped = true
+	})
+	runner.Add("http", func(context.Context) error {
+		return errors.New("address already in use")
+	}, nil)
+
+	err := runner.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "http: address already in use") {
+		t.Errorf("expected the failure to be returned, got %v", err)
+	}
+	if !stopped {
+		t.Error("expected the worker to be stopped")
+	}
+}
+
+func TestRunner_ShutdownTimeout(t *testing.T) {
+	runner := NewRunner(20 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	runner.Go("stuck", func(context.Context) {
+		<-block
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := runner.Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stop stuck") {
+		t.Errorf("expected the stuck worker to be reported, got %v", err)
+	}
+}
+
+func TestRunner_ServerDrainsInFlightRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	runner := NewRunner(time.Second)
+	runner.Add("http", func(context.Context) error {
+		if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, srv.Shutdown)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- runner.Run(ctx) }()
+
+	response := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			response <- 0
+			return
+		}
+		resp.Body.Close()
+		response <- resp.StatusCode
+	}()
+	<-started
+	cancel()
+
+	if status := <-response; status != http.StatusNoContent {
+		t.Errorf("expected the in-flight request to finish, got status %d", status)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
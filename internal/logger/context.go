@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	fieldsKey
+)
+
+// WithRequestID guarda no contexto o ID da requisição (header X-Request-ID).
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID retorna o ID guardado por WithRequestID, ou vazio.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithFields guarda campos que FromContext inclui em todas as entradas, como
+// o ID do pagamento em processamento. Um campo com a mesma chave de um já
+// guardado o substitui.
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	current, _ := ctx.Value(fieldsKey).([]zap.Field)
+	merged := make([]zap.Field, 0, len(current)+len(fields))
+	for _, field := range current {
+		if !hasKey(fields, field.Key) {
+			merged = append(merged, field)
+		}
+	}
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey, merged)
+}
+
+// WithPaymentID guarda o ID do pagamento, incluído como payment_id.
+func WithPaymentID(ctx context.Context, paymentID string) context.Context {
+	return WithFields(ctx, zap.String("payment_id", paymentID))
+}
+
+// FromContext retorna o log com os campos do contexto: trace_id e span_id do
+// span corrente, request_id e os guardados por WithFields.
+func FromContext(ctx context.Context) *zap.Logger {
+	var fields []zap.Field
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", spanContext.TraceID().String()),
+			zap.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	stored, _ := ctx.Value(fieldsKey).([]zap.Field)
+	fields = append(fields, stored...)
+	if len(fields) == 0 {
+		return ctxLog
+	}
+	return ctxLog.With(fields...)
+}
+
+func hasKey(fields []zap.Field, key string) bool {
+	for _, field := range fields {
+		if field.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,21 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-var log *zap.Logger
+var (
+	log *zap.Logger
+	// ctxLog é o log sem o AddCallerSkip das funções do pacote, usado por
+	// FromContext, cujo retorno é chamado direto.
+	ctxLog *zap.Logger
+	// level pode ser alterado em execução por SetLevel.
+	level zap.AtomicLevel
+)
 
 func init() {
 	config := zap.NewProductionConfig()
@@ -15,12 +23,18 @@ func init() {
 		config = zap.NewDevelopmentConfig()
 		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	}
+	level = config.Level
 
-	var err error
-	log, err = config.Build(zap.AddCallerSkip(1))
+	base, err := config.Build()
 	if err != nil {
 		panic(err)
 	}
+	setLogger(base)
+}
+
+func setLogger(base *zap.Logger) {
+	ctxLog = base
+	log = base.WithOptions(zap.AddCallerSkip(1))
 }
 
 func Info(msg string, fields ...zap.Field) {
@@ -42,3 +56,19 @@ func Warn(msg string, fields ...zap.Field) {
 func Get() *zap.Logger {
 	return log
 }
+
+// Level retorna o nível mínimo atual dos logs.
+func Level() zapcore.Level {
+	return level.Level()
+}
+
+// SetLevel altera o nível mínimo dos logs em execução; aceita debug, info,
+// warn e error.
+func SetLevel(name string) error {
+	parsed, err := zapcore.ParseLevel(name)
+	if err != nil || parsed > zapcore.ErrorLevel {
+		return fmt.Errorf("unsupported log level %q", name)
+	}
+	level.SetLevel(parsed)
+	return nil
+}
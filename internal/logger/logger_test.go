@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observe troca o log do pacote por um que guarda as entradas em memória.
+func observe(t *testing.T) *observer.ObservedLogs {
+	t.Helper()
+	previous := ctxLog
+	core, logs := observer.New(level)
+	setLogger(zap.New(core))
+	t.Cleanup(func() { setLogger(previous) })
+	return logs
+}
+
+func TestFromContext_AddsCorrelationFields(t *testing.T) {
+	logs := observe(t)
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	ctx = WithRequestID(ctx, "req-1")
+	ctx = WithPaymentID(ctx, "payment-1")
+	ctx = WithPaymentID(ctx, "payment-2")
+
+	FromContext(ctx).Info("payment status updated")
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	expected := map[string]string{
+		"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":    "00f067aa0ba902b7",
+		"request_id": "req-1",
+		"payment_id": "payment-2",
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("expected %s=%s, got %v", key, value, fields[key])
+		}
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestFromContext_EmptyContext(t *testing.T) {
+	logs := observe(t)
+
+	FromContext(context.Background()).Info("no correlation")
+
+	if fields := logs.All()[0].ContextMap(); len(fields) != 0 {
+		t.Errorf("expected no fields, got %v", fields)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	logs := observe(t)
+	previous := Level()
+	t.Cleanup(func() { level.SetLevel(previous) })
+
+	if err := SetLevel("warn"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	Info("filtered")
+	Warn("kept")
+	if logs.Len() != 1 || logs.All()[0].Message != "kept" {
+		t.Errorf("expected only the warning, got %v", logs.All())
+	}
+	if Level() != zapcore.WarnLevel {
+		t.Errorf("expected warn level, got %s", Level())
+	}
+
+	for _, name := range []string{"verbose", "fatal"} {
+		if err := SetLevel(name); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+}
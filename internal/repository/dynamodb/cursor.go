@@ -0,0 +1,83 @@
+package dynamodb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// encodeCursor transforma o LastEvaluatedKey do DynamoDB em um token opaco.
+// Todas as chaves da tabela e dos índices são strings, então basta serializar
+// os valores S.
+func encodeCursor(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	raw := make(map[string]string, len(key))
+	for name, value := range key {
+		s, ok := value.(*types.AttributeValueMemberS)
+		if !ok {
+			return "", domain.ErrInvalidCursor
+		}
+		raw[name] = s.Value
+	}
+
+	payload, err := json.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal(payload, &raw); err != nil || len(raw) == 0 {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	key := make(map[string]types.AttributeValue, len(raw))
+	for name, value := range raw {
+		key[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	return key, nil
+}
+
+// listStartKey decodifica o cursor de List e confere se ele é do mesmo caminho
+// de leitura do filtro. A chave do Scan só tem id; a do ExternalReferenceIndex
+// tem também a external_reference, que precisa ser a do filtro. O DynamoDB
+// recusa uma chave de outro caminho com erro de validação.
+func listStartKey(cursor string, filter domain.PaymentFilter) (map[string]types.AttributeValue, error) {
+	key, err := decodeCursor(cursor)
+	if err != nil || key == nil {
+		return key, err
+	}
+
+	names := []string{"id"}
+	if filter.ExternalReference != "" {
+		names = append(names, "external_reference")
+	}
+	if len(key) != len(names) {
+		return nil, domain.ErrInvalidCursor
+	}
+	for _, name := range names {
+		if _, ok := key[name]; !ok {
+			return nil, domain.ErrInvalidCursor
+		}
+	}
+	if filter.ExternalReference != "" && key["external_reference"].(*types.AttributeValueMemberS).Value != filter.ExternalReference {
+		return nil, domain.ErrInvalidCursor
+	}
+	return key, nil
+}
@@ -0,0 +1,89 @@
+package dynamodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	key := map[string]types.AttributeValue{
+		"id":                 &types.AttributeValueMemberS{Value: "pay-1"},
+		"external_reference": &types.AttributeValueMemberS{Value: "ORDER-1"},
+	}
+
+	cursor, err := encodeCursor(key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cursor == "" {
+		t.Fatal("expected non empty cursor")
+	}
+
+	decoded, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for name, value := range key {
+		got, ok := decoded[name].(*types.AttributeValueMemberS)
+		if !ok || got.Value != value.(*types.AttributeValueMemberS).Value {
+			t.Errorf("expected %s to round trip, got %v", name, decoded[name])
+		}
+	}
+}
+
+func TestCursor_Empty(t *testing.T) {
+	cursor, err := encodeCursor(nil)
+	if err != nil || cursor != "" {
+		t.Fatalf("expected empty cursor, got %q (%v)", cursor, err)
+	}
+
+	key, err := decodeCursor("")
+	if err != nil || key != nil {
+		t.Fatalf("expected nil key, got %v (%v)", key, err)
+	}
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"!!!", "bm90LWpzb24", "e30"} {
+		if _, err := decodeCursor(cursor); !errors.Is(err, domain.ErrInvalidCursor) {
+			t.Errorf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestListStartKey_MatchesFilter(t *testing.T) {
+	scanCursor, _ := encodeCursor(map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: "pay-1"},
+	})
+	indexCursor, _ := encodeCursor(map[string]types.AttributeValue{
+		"id":                 &types.AttributeValueMemberS{Value: "pay-1"},
+		"external_reference": &types.AttributeValueMemberS{Value: "ORDER-1"},
+	})
+
+	cases := []struct {
+		name   string
+		cursor string
+		filter domain.PaymentFilter
+		valid  bool
+	}{
+		{"scan cursor on scan", scanCursor, domain.PaymentFilter{Status: domain.StatusPending}, true},
+		{"index cursor on same reference", indexCursor, domain.PaymentFilter{ExternalReference: "ORDER-1"}, true},
+		{"index cursor on scan", indexCursor, domain.PaymentFilter{}, false},
+		{"scan cursor on index", scanCursor, domain.PaymentFilter{ExternalReference: "ORDER-1"}, false},
+		{"index cursor on other reference", indexCursor, domain.PaymentFilter{ExternalReference: "ORDER-2"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := listStartKey(tc.cursor, tc.filter)
+			if tc.valid && (err != nil || key == nil) {
+				t.Errorf("expected a start key, got %v (%v)", key, err)
+			}
+			if !tc.valid && !errors.Is(err, domain.ErrInvalidCursor) {
+				t.Errorf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
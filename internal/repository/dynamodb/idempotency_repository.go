@@ -0,0 +1,150 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// IdempotencyRepository persiste as chaves de idempotência em uma tabela
+// própria, com TTL no atributo expires_at.
+type IdempotencyRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewIdempotencyRepository(client *dynamodb.Client, tables config.DynamoDB) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		client:    client,
+		tableName: tables.Idempotency,
+	}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, record domain.IdempotencyRecord) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	// Um registro expirado que o TTL ainda não removeu pode ser sobrescrito,
+	// assim como a reserva vencida de uma requisição que não concluiu.
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+		ConditionExpression: aws.String("attribute_not_exists(idempotency_key) OR expires_at < :now OR " +
+			"(attribute_not_exists(payment) AND fingerprint = :fingerprint AND " +
+			"(attribute_not_exists(locked_until) OR locked_until <= :now))"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":         &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+			":fingerprint": &types.AttributeValueMemberS{Value: record.Fingerprint},
+		},
+	})
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return domain.ErrIdempotencyKeyExists
+	}
+	return err
+}
+
+func (r *IdempotencyRepository) Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	// Respostas gravadas antes do Money guardam o amount do pagamento como
+	// número.
+	if payment, ok := result.Item["payment"].(*types.AttributeValueMemberM); ok {
+		upgraded, err := upgradeLegacyAmount(payment.Value)
+		if err != nil {
+			return nil, err
+		}
+		result.Item["payment"] = &types.AttributeValueMemberM{Value: upgraded}
+	}
+
+	var record domain.IdempotencyRecord
+	err = attributevalue.UnmarshalMap(result.Item, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+
+	return &record, nil
+}
+
+// Complete grava o pagamento condicionado ao token da reserva, para que uma
+// requisição lenta não sobrescreva a repetição que assumiu a chave.
+func (r *IdempotencyRepository) Complete(ctx context.Context, key, token string, payment domain.Payment) error {
+	item, err := attributevalue.Marshal(payment)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+		UpdateExpression:    aws.String("SET payment = :payment"),
+		ConditionExpression: aws.String("#token = :token AND attribute_not_exists(payment)"),
+		ExpressionAttributeNames: map[string]string{
+			"#token": "token",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":payment": item,
+			":token":   &types.AttributeValueMemberS{Value: token},
+		},
+	})
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return domain.ErrIdempotencyReservationLost
+	}
+	return err
+}
+
+// Release apaga a reserva. Um registro já concluído, ou assumido por uma
+// repetição, não é apagado.
+func (r *IdempotencyRepository) Release(ctx context.Context, key, token string) error {
+	_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConditionExpression: aws.String("#token = :token AND attribute_not_exists(payment)"),
+		ExpressionAttributeNames: map[string]string{
+			"#token": "token",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":token": &types.AttributeValueMemberS{Value: token},
+		},
+	})
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return nil
+	}
+	return err
+}
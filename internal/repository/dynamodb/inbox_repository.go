@@ -0,0 +1,247 @@
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// InboxRepository guarda as notificações de webhook recebidas até serem
+// processadas. Como no outbox, o índice StatusIndex (status, created_at)
+// devolve as pendentes em ordem de chegada, e os horários são gravados com
+// timeLayout. O índice OrderingKeyIndex (ordering_key, created_at) devolve as
+// notificações de um mesmo pagamento, também em ordem de chegada. As
+// notificações processadas ou mortas ganham expires_at e são apagadas pelo TTL
+// da tabela.
+type InboxRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// inboxProcessedRetention é quanto uma notificação processada fica na tabela,
+// para consulta, antes de o TTL apagá-la. As mortas ficam mais tempo, para
+// dar tempo de reprocessá-las pela API administrativa.
+const (
+	inboxProcessedRetention = 7 * 24 * time.Hour
+	inboxDeadRetention      = 30 * 24 * time.Hour
+)
+
+func NewInboxRepository(client *dynamodb.Client, tables config.DynamoDB) *InboxRepository {
+	return &InboxRepository{
+		client:    client,
+		tableName: tables.Inbox,
+	}
+}
+
+func (r *InboxRepository) Save(ctx context.Context, notification domain.InboxNotification) error {
+	item, err := marshalInboxItem(notification)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	return err
+}
+
+func (r *InboxRepository) Get(ctx context.Context, id string) (*domain.InboxNotification, error) {
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var notification domain.InboxNotification
+	if err := attributevalue.UnmarshalMap(result.Item, &notification); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+func (r *InboxRepository) ListPending(ctx context.Context, now time.Time, limit int) ([]domain.InboxNotification, error) {
+	return r.queryByStatus(ctx, domain.InboxPending, &dynamodb.QueryInput{
+		FilterExpression: aws.String("next_attempt_at <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: formatTime(now)},
+		},
+	}, limit)
+}
+
+// Claim grava a reserva com uma escrita condicional; só um worker consegue
+// reservar a notificação enquanto a reserva estiver vigente.
+func (r *InboxRepository) Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.InboxNotification, error) {
+	result, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression: aws.String("SET claimed_by = :owner, claim_expires_at = :expires_at, updated_at = :now"),
+		ConditionExpression: aws.String("#status = :pending AND next_attempt_at <= :now AND " +
+			"(attribute_not_exists(claim_expires_at) OR claim_expires_at <= :now)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner":      &types.AttributeValueMemberS{Value: owner},
+			":expires_at": &types.AttributeValueMemberS{Value: formatTime(expiresAt)},
+			":now":        &types.AttributeValueMemberS{Value: formatTime(now)},
+			":pending":    &types.AttributeValueMemberS{Value: string(domain.InboxPending)},
+		},
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return domain.InboxNotification{}, claimFailure(err, domain.ErrInboxNotificationNotFound, domain.ErrInboxNotificationClaimed)
+	}
+
+	var notification domain.InboxNotification
+	if err := attributevalue.UnmarshalMap(result.Attributes, &notification); err != nil {
+		return domain.InboxNotification{}, err
+	}
+	return notification, nil
+}
+
+// OldestPending percorre o OrderingKeyIndex em ordem de chegada até a
+// primeira notificação pendente da chave.
+func (r *InboxRepository) OldestPending(ctx context.Context, orderingKey string) (*domain.InboxNotification, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(r.tableName),
+		IndexName:                aws.String("OrderingKeyIndex"),
+		KeyConditionExpression:   aws.String("ordering_key = :ordering_key"),
+		FilterExpression:         aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ordering_key": &types.AttributeValueMemberS{Value: orderingKey},
+			":pending":      &types.AttributeValueMemberS{Value: string(domain.InboxPending)},
+		},
+		ScanIndexForward: aws.Bool(true),
+	}
+	for {
+		result, err := r.client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Items) > 0 {
+			var notification domain.InboxNotification
+			if err := attributevalue.UnmarshalMap(result.Items[0], &notification); err != nil {
+				return nil, err
+			}
+			return &notification, nil
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+func (r *InboxRepository) ListDead(ctx context.Context, limit int) ([]domain.InboxNotification, error) {
+	return r.queryByStatus(ctx, domain.InboxDead, &dynamodb.QueryInput{}, limit)
+}
+
+// Update grava a notificação sem a reserva, o que a libera.
+func (r *InboxRepository) Update(ctx context.Context, notification domain.InboxNotification) error {
+	owner := notification.ClaimedBy
+	notification.ClaimedBy, notification.ClaimExpiresAt = "", nil
+	notification.UpdatedAt = time.Now()
+	item, err := marshalInboxItem(notification)
+	if err != nil {
+		return err
+	}
+	if expiresAt, ok := inboxExpiresAt(notification); ok {
+		item["expires_at"] = expiresAt
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:                           aws.String(r.tableName),
+		Item:                                item,
+		ConditionExpression:                 aws.String("attribute_exists(id)"),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if owner != "" {
+		input.ConditionExpression = aws.String("attribute_exists(id) AND claimed_by = :owner")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		}
+	}
+	_, err = r.client.PutItem(ctx, input)
+	return claimFailure(err, domain.ErrInboxNotificationNotFound, domain.ErrInboxNotificationClaimed)
+}
+
+// marshalInboxItem grava junto a chave de ordenação, usada pelo
+// OrderingKeyIndex.
+func marshalInboxItem(notification domain.InboxNotification) (map[string]types.AttributeValue, error) {
+	item, err := marshalItem(notification)
+	if err != nil {
+		return nil, err
+	}
+	item["ordering_key"] = &types.AttributeValueMemberS{Value: notification.OrderingKey()}
+	return item, nil
+}
+
+// inboxExpiresAt calcula o expires_at (epoch, como o TTL exige) de uma
+// notificação processada ou morta; as pendentes não expiram.
+func inboxExpiresAt(notification domain.InboxNotification) (types.AttributeValue, bool) {
+	var retention time.Duration
+	switch notification.Status {
+	case domain.InboxProcessed:
+		retention = inboxProcessedRetention
+	case domain.InboxDead:
+		retention = inboxDeadRetention
+	default:
+		return nil, false
+	}
+	expiresAt := notification.UpdatedAt.Add(retention).Unix()
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)}, true
+}
+
+// queryByStatus completa o input com a partição do status e pagina até obter
+// limit itens, já que o FilterExpression é aplicado depois do Limit.
+func (r *InboxRepository) queryByStatus(ctx context.Context, status domain.InboxStatus, input *dynamodb.QueryInput, limit int) ([]domain.InboxNotification, error) {
+	input.TableName = aws.String(r.tableName)
+	input.IndexName = aws.String("StatusIndex")
+	input.KeyConditionExpression = aws.String("#status = :status")
+	input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+	if input.ExpressionAttributeValues == nil {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{}
+	}
+	input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: string(status)}
+
+	notifications := []domain.InboxNotification{}
+	for {
+		input.Limit = aws.Int32(int32(limit - len(notifications)))
+		result, err := r.client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			var notification domain.InboxNotification
+			if err := attributevalue.UnmarshalMap(item, &notification); err != nil {
+				return nil, err
+			}
+			notifications = append(notifications, notification)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 || len(notifications) >= limit {
+			return notifications, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
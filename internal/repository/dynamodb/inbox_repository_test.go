@@ -0,0 +1,38 @@
+package dynamodb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestInboxExpiresAt(t *testing.T) {
+	updatedAt := time.Date(2026, 3, 10, 14, 30, 5, 0, time.UTC)
+	tests := []struct {
+		status    domain.InboxStatus
+		retention time.Duration
+		expires   bool
+	}{
+		{status: domain.InboxPending},
+		{status: domain.InboxProcessed, retention: inboxProcessedRetention, expires: true},
+		{status: domain.InboxDead, retention: inboxDeadRetention, expires: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			value, ok := inboxExpiresAt(domain.InboxNotification{Status: tt.status, UpdatedAt: updatedAt})
+			if ok != tt.expires {
+				t.Fatalf("expected expires=%v, got %v", tt.expires, ok)
+			}
+			if !ok {
+				return
+			}
+			want := strconv.FormatInt(updatedAt.Add(tt.retention).Unix(), 10)
+			if n, isN := value.(*types.AttributeValueMemberN); !isN || n.Value != want {
+				t.Errorf("expected expires_at %s, got %#v", want, value)
+			}
+		})
+	}
+}
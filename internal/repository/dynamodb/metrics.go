@@ -0,0 +1,65 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const meterName = "github.com/alexssanderFonseca/pagamento/internal/repository/dynamodb"
+
+// WithMetrics mede cada operação do cliente DynamoDB no histograma
+// dynamodb.operation.duration, com as novas tentativas do SDK incluídas.
+// Uso: dynamodb.NewFromConfig(cfg, WithMetrics(provider)).
+func WithMetrics(provider metric.MeterProvider) func(*dynamodb.Options) {
+	duration, err := provider.Meter(meterName).Float64Histogram("dynamodb.operation.duration",
+		metric.WithDescription("Duração das operações do DynamoDB"),
+		metric.WithUnit("s"))
+	if err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+
+	measure := middleware.InitializeMiddlewareFunc("OperationMetrics", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		start := time.Now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		attrs := []attribute.KeyValue{
+			attribute.String("operation", awsmiddleware.GetOperationName(ctx)),
+			attribute.String("outcome", operationOutcome(err)),
+		}
+		duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		return out, metadata, err
+	})
+
+	return func(o *dynamodb.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			// After: o nome da operação é registrado pelo próprio SDK no
+			// início do passo Initialize.
+			return stack.Initialize.Add(measure, middleware.After)
+		})
+	}
+}
+
+// operationOutcome é success, o código de erro do DynamoDB (ex.:
+// ConditionalCheckFailedException) ou error para falhas sem código, como as
+// de rede.
+func operationOutcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return "error"
+}
@@ -0,0 +1,43 @@
+package dynamodb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/telemetry/metrictest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestWithMetrics_RecordsOperationDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"table not found"}`))
+	}))
+	defer server.Close()
+
+	reader := metrictest.NewReader()
+	client := dynamodb.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		Retryer:     func() aws.Retryer { return aws.NopRetryer{} },
+	}, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(server.URL)
+	}, WithMetrics(reader.Provider))
+
+	if _, err := client.DescribeTable(context.Background(), &dynamodb.DescribeTableInput{TableName: aws.String("Payments")}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	count := reader.HistogramCount(t, "dynamodb.operation.duration",
+		attribute.String("operation", "DescribeTable"),
+		attribute.String("outcome", "ResourceNotFoundException"),
+	)
+	if count != 1 {
+		t.Errorf("expected one measurement, got %d", count)
+	}
+}
@@ -0,0 +1,643 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Migration é uma alteração de dados versionada, como o preenchimento de um
+// atributo novo nos itens antigos. Apply pode ser interrompido e executado de
+// novo, então deve ser idempotente.
+type Migration struct {
+	Version     string
+	Description string
+	Apply       func(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error
+}
+
+// Migrations lista as migrações de dados em ordem de aplicação.
+func Migrations() []Migration {
+	return []Migration{
+		{
+			Version:     "0001_backfill_payment_attributes",
+			Description: "grava version e provider nos pagamentos anteriores a esses atributos",
+			Apply:       backfillPaymentAttributes,
+		},
+		{
+			Version:     "0002_backfill_reference_guards",
+			Description: "cria a guarda de referência externa dos pagamentos anteriores a ela",
+			Apply:       backfillReferenceGuards,
+		},
+		{
+			Version:     "0003_fixed_width_outbox_timestamps",
+			Description: "regrava created_at e next_attempt_at dos eventos do outbox com largura fixa",
+			Apply:       rewriteOutboxTimestamps,
+		},
+		{
+			Version:     "0004_fixed_width_inbox_timestamps",
+			Description: "regrava created_at e next_attempt_at das notificações de webhook com largura fixa",
+			Apply:       rewriteInboxTimestamps,
+		},
+		{
+			Version:     "0005_fixed_width_payment_timestamps",
+			Description: "regrava created_at, updated_at e expires_at dos pagamentos em UTC com largura fixa",
+			Apply:       rewritePaymentTimestamps,
+		},
+		{
+			Version:     "0006_expire_sent_outbox_events",
+			Description: "grava expires_at nos eventos do outbox já publicados, para o TTL apagá-los",
+			Apply:       expireSentOutboxEvents,
+		},
+		{
+			Version:     "0007_expire_finished_inbox_notifications",
+			Description: "grava expires_at nas notificações de webhook já processadas ou mortas, para o TTL apagá-las",
+			Apply:       expireFinishedInboxNotifications,
+		},
+		{
+			Version:     "0008_backfill_inbox_ordering_keys",
+			Description: "grava ordering_key nas notificações de webhook pendentes anteriores ao OrderingKeyIndex",
+			Apply:       backfillInboxOrderingKeys,
+		},
+		{
+			Version:     "0009_move_api_actor_to_declared_actor",
+			Description: "move o autor informado pelo header X-Actor de actor para declared_actor no histórico de status",
+			Apply:       moveAPIActorToDeclaredActor,
+		},
+	}
+}
+
+// migrationLockVersion é o item da tabela de migrações que funciona como
+// trava, impedindo duas execuções simultâneas.
+const migrationLockVersion = "lock"
+
+// migrationLockTTL libera a trava de uma execução que morreu sem soltá-la.
+// Enquanto a execução está viva, a trava é renovada a cada
+// migrationLockRenewal.
+const (
+	migrationLockTTL     = 15 * time.Minute
+	migrationLockRenewal = migrationLockTTL / 3
+)
+
+// ErrMigrationLocked indica que outra instância está aplicando as migrações.
+var ErrMigrationLocked = errors.New("dynamodb migrations are locked by another process")
+
+// ErrMigrationLockLost indica que a trava expirou ou foi tomada por outra
+// instância durante a execução. As migrações em andamento são interrompidas.
+var ErrMigrationLockLost = errors.New("dynamodb migration lock was lost")
+
+type migrationRecord struct {
+	Version     string    `dynamodbav:"version"`
+	Description string    `dynamodbav:"description,omitempty"`
+	AppliedAt   time.Time `dynamodbav:"applied_at"`
+	// Owner identifica a execução dona da trava; vazio nos registros de
+	// migração.
+	Owner string `dynamodbav:"owner,omitempty"`
+}
+
+// ApplyMigrations aplica as migrações ainda não registradas na tabela de
+// migrações e retorna as versões aplicadas.
+func (m *SchemaManager) ApplyMigrations(ctx context.Context, migrations []Migration) ([]string, error) {
+	tableName := m.tables.Migrations
+	owner := uuid.NewString()
+	if err := m.lock(ctx, tableName, owner); err != nil {
+		return nil, err
+	}
+	defer m.unlock(context.WithoutCancel(ctx), tableName, owner)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := m.keepLock(ctx, tableName, owner, cancel)
+	defer stop()
+
+	applied, err := m.appliedMigrations(ctx, tableName)
+	if err != nil {
+		return nil, lockCause(ctx, err)
+	}
+
+	var newlyApplied []string
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		if err := migration.Apply(ctx, m.client, m.tables); err != nil {
+			return newlyApplied, fmt.Errorf("migration %s: %w", migration.Version, lockCause(ctx, err))
+		}
+		if err := m.record(ctx, tableName, owner, migration); err != nil {
+			return newlyApplied, fmt.Errorf("migration %s: %w", migration.Version, lockCause(ctx, err))
+		}
+		newlyApplied = append(newlyApplied, migration.Version)
+	}
+	return newlyApplied, nil
+}
+
+// lockCause troca o erro de contexto cancelado pela perda da trava, quando
+// foi ela que interrompeu a execução.
+func lockCause(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMigrationLockLost) {
+		return cause
+	}
+	return err
+}
+
+// record registra a migração como aplicada na mesma transação que confere
+// que a trava ainda pertence a esta execução.
+func (m *SchemaManager) record(ctx context.Context, tableName, owner string, migration Migration) error {
+	item, err := marshalItem(migrationRecord{
+		Version:     migration.Version,
+		Description: migration.Description,
+		AppliedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				ConditionCheck: &types.ConditionCheck{
+					TableName:                 aws.String(tableName),
+					Key:                       migrationLockKey(),
+					ConditionExpression:       aws.String("#owner = :owner"),
+					ExpressionAttributeNames:  map[string]string{"#owner": "owner"},
+					ExpressionAttributeValues: map[string]types.AttributeValue{":owner": &types.AttributeValueMemberS{Value: owner}},
+				},
+			},
+			{Put: &types.Put{TableName: aws.String(tableName), Item: item}},
+		},
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		return ErrMigrationLockLost
+	}
+	return err
+}
+
+// PendingMigrations retorna as versões ainda não aplicadas.
+func (m *SchemaManager) PendingMigrations(ctx context.Context, migrations []Migration) ([]string, error) {
+	applied, err := m.appliedMigrations(ctx, m.tables.Migrations)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration.Version)
+		}
+	}
+	return pending, nil
+}
+
+func (m *SchemaManager) appliedMigrations(ctx context.Context, tableName string) (map[string]bool, error) {
+	applied := map[string]bool{}
+	err := scanAll(ctx, m.client, &dynamodb.ScanInput{
+		TableName:                aws.String(tableName),
+		ProjectionExpression:     aws.String("#version"),
+		ExpressionAttributeNames: map[string]string{"#version": "version"},
+	}, func(item map[string]types.AttributeValue) error {
+		var record migrationRecord
+		if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+			return err
+		}
+		if record.Version != migrationLockVersion {
+			applied[record.Version] = true
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func migrationLockKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"version": &types.AttributeValueMemberS{Value: migrationLockVersion},
+	}
+}
+
+func (m *SchemaManager) lock(ctx context.Context, tableName, owner string) error {
+	now := time.Now().UTC()
+	item, err := marshalItem(migrationRecord{Version: migrationLockVersion, AppliedAt: now, Owner: owner})
+	if err != nil {
+		return err
+	}
+	_, err = m.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#version) OR applied_at < :stale"),
+		ExpressionAttributeNames: map[string]string{
+			"#version": "version",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":stale": &types.AttributeValueMemberS{Value: formatTime(now.Add(-migrationLockTTL))},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return ErrMigrationLocked
+	}
+	return err
+}
+
+// keepLock renova a trava em segundo plano até stop ser chamado. Se outra
+// execução tomou a trava, ou se ela não pôde ser renovada antes de expirar,
+// cancela ctx com ErrMigrationLockLost.
+func (m *SchemaManager) keepLock(ctx context.Context, tableName, owner string, cancel context.CancelCauseFunc) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(migrationLockRenewal)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := m.renewLock(ctx, tableName, owner)
+			var conditionErr *types.ConditionalCheckFailedException
+			switch {
+			case err == nil:
+				renewed = time.Now()
+			case errors.As(err, &conditionErr):
+				cancel(ErrMigrationLockLost)
+				return
+			case time.Since(renewed) >= migrationLockTTL:
+				cancel(fmt.Errorf("%w: %v", ErrMigrationLockLost, err))
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func (m *SchemaManager) renewLock(ctx context.Context, tableName, owner string) error {
+	_, err := m.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(tableName),
+		Key:                      migrationLockKey(),
+		UpdateExpression:         aws.String("SET applied_at = :now"),
+		ConditionExpression:      aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{"#owner": "owner"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":   &types.AttributeValueMemberS{Value: formatTime(time.Now())},
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	return err
+}
+
+// unlock solta a trava apenas se ela ainda pertence a esta execução.
+func (m *SchemaManager) unlock(ctx context.Context, tableName, owner string) {
+	_, _ = m.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       migrationLockKey(),
+		ConditionExpression:       aws.String("#owner = :owner"),
+		ExpressionAttributeNames:  map[string]string{"#owner": "owner"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":owner": &types.AttributeValueMemberS{Value: owner}},
+	})
+}
+
+// backfillPaymentAttributes grava version 0 e o gateway legado nos pagamentos
+// sem esses atributos, sem tocar nos que já os têm.
+func backfillPaymentAttributes(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	tableName := tables.Payments
+	return scanAll(ctx, client, &dynamodb.ScanInput{
+		TableName:                aws.String(tableName),
+		FilterExpression:         aws.String("attribute_not_exists(#version) OR attribute_not_exists(provider)"),
+		ProjectionExpression:     aws.String("id"),
+		ExpressionAttributeNames: map[string]string{"#version": "version"},
+	}, func(item map[string]types.AttributeValue) error {
+		_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(tableName),
+			Key:                 map[string]types.AttributeValue{"id": item["id"]},
+			UpdateExpression:    aws.String("SET #version = if_not_exists(#version, :zero), provider = if_not_exists(provider, :provider)"),
+			ConditionExpression: aws.String("attribute_exists(id)"),
+			ExpressionAttributeNames: map[string]string{
+				"#version": "version",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":zero":     &types.AttributeValueMemberN{Value: "0"},
+				":provider": &types.AttributeValueMemberS{Value: domain.LegacyProvider},
+			},
+		})
+		return err
+	})
+}
+
+// backfillReferenceGuards aponta cada referência externa sem guarda para o
+// pagamento criado por último, a mesma escolha de GetByExternalReference.
+func backfillReferenceGuards(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	latest := map[string]domain.Payment{}
+	err := scanAll(ctx, client, &dynamodb.ScanInput{
+		TableName:            aws.String(tables.Payments),
+		ProjectionExpression: aws.String("id, external_reference, created_at"),
+	}, func(item map[string]types.AttributeValue) error {
+		var payment domain.Payment
+		if err := attributevalue.UnmarshalMap(item, &payment); err != nil {
+			return err
+		}
+		if current, ok := latest[payment.ExternalReference]; !ok || newerAttempt(payment, current) {
+			latest[payment.ExternalReference] = payment
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for ref, payment := range latest {
+		item, err := marshalItem(referenceGuard{ExternalReference: ref, PaymentID: payment.ID, UpdatedAt: now})
+		if err != nil {
+			return err
+		}
+		_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(tables.Reference),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(external_reference)"),
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteOutboxTimestamps regrava com timeLayout os horários comparados como
+// strings pelo OutboxRepository.
+func rewriteOutboxTimestamps(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	return rewriteTimestamps(ctx, client, tables.Outbox, "created_at", "next_attempt_at")
+}
+
+// rewriteInboxTimestamps faz o mesmo com as notificações do InboxRepository.
+func rewriteInboxTimestamps(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	return rewriteTimestamps(ctx, client, tables.Inbox, "created_at", "next_attempt_at")
+}
+
+// rewritePaymentTimestamps regrava os horários comparados pelo
+// StatusExpiresAtIndex e pelos filtros da listagem de pagamentos. Pagamentos
+// antigos foram gravados com o fuso local do servidor.
+func rewritePaymentTimestamps(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	return rewriteTimestamps(ctx, client, tables.Payments, "created_at", "updated_at", "expires_at")
+}
+
+// expireSentOutboxEvents grava nos eventos publicados antes do TTL do outbox
+// o mesmo expires_at que OutboxRepository.UpdateDelivery grava hoje.
+func expireSentOutboxEvents(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	return scanAll(ctx, client, &dynamodb.ScanInput{
+		TableName:                aws.String(tables.Outbox),
+		FilterExpression:         aws.String("#status = :sent AND attribute_not_exists(expires_at)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sent": &types.AttributeValueMemberS{Value: string(domain.OutboxSent)},
+		},
+	}, func(item map[string]types.AttributeValue) error {
+		var event domain.OutboxEvent
+		if err := attributevalue.UnmarshalMap(item, &event); err != nil {
+			return err
+		}
+		_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                aws.String(tables.Outbox),
+			Key:                      map[string]types.AttributeValue{"id": item["id"]},
+			UpdateExpression:         aws.String("SET expires_at = if_not_exists(expires_at, :expires_at)"),
+			ConditionExpression:      aws.String("#status = :sent"),
+			ExpressionAttributeNames: map[string]string{"#status": "status"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":expires_at": outboxExpiresAt(event),
+				":sent":       &types.AttributeValueMemberS{Value: string(domain.OutboxSent)},
+			},
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			return err
+		}
+		return nil
+	})
+}
+
+// expireFinishedInboxNotifications grava nas notificações processadas ou
+// mortas antes do TTL do inbox o mesmo expires_at que InboxRepository.Update
+// grava hoje.
+func expireFinishedInboxNotifications(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	return scanAll(ctx, client, &dynamodb.ScanInput{
+		TableName:                aws.String(tables.Inbox),
+		FilterExpression:         aws.String("#status IN (:processed, :dead) AND attribute_not_exists(expires_at)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":processed": &types.AttributeValueMemberS{Value: string(domain.InboxProcessed)},
+			":dead":      &types.AttributeValueMemberS{Value: string(domain.InboxDead)},
+		},
+	}, func(item map[string]types.AttributeValue) error {
+		var notification domain.InboxNotification
+		if err := attributevalue.UnmarshalMap(item, &notification); err != nil {
+			return err
+		}
+		expiresAt, ok := inboxExpiresAt(notification)
+		if !ok {
+			return nil
+		}
+		_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                aws.String(tables.Inbox),
+			Key:                      map[string]types.AttributeValue{"id": item["id"]},
+			UpdateExpression:         aws.String("SET expires_at = if_not_exists(expires_at, :expires_at)"),
+			ConditionExpression:      aws.String("#status = :status"),
+			ExpressionAttributeNames: map[string]string{"#status": "status"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":expires_at": expiresAt,
+				":status":     item["status"],
+			},
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			return err
+		}
+		return nil
+	})
+}
+
+// backfillInboxOrderingKeys grava nas notificações pendentes gravadas antes do
+// OrderingKeyIndex a chave de ordenação que InboxRepository grava hoje. As
+// processadas e mortas não seguram ninguém; uma morta reprocessada ganha a
+// chave ao voltar para a fila.
+func backfillInboxOrderingKeys(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	return scanAll(ctx, client, &dynamodb.ScanInput{
+		TableName:                aws.String(tables.Inbox),
+		FilterExpression:         aws.String("#status = :pending AND attribute_not_exists(ordering_key)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: string(domain.InboxPending)},
+		},
+	}, func(item map[string]types.AttributeValue) error {
+		var notification domain.InboxNotification
+		if err := attributevalue.UnmarshalMap(item, &notification); err != nil {
+			return err
+		}
+		_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(tables.Inbox),
+			Key:                 map[string]types.AttributeValue{"id": item["id"]},
+			UpdateExpression:    aws.String("SET ordering_key = if_not_exists(ordering_key, :ordering_key)"),
+			ConditionExpression: aws.String("attribute_exists(id)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":ordering_key": &types.AttributeValueMemberS{Value: notification.OrderingKey()},
+			},
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			return err
+		}
+		return nil
+	})
+}
+
+// moveAPIActorToDeclaredActor corrige os registros de histórico das mudanças
+// pela API gravados quando o header X-Actor, que não é autenticado, ia para
+// actor.
+func moveAPIActorToDeclaredActor(ctx context.Context, client *dynamodb.Client, tables config.DynamoDB) error {
+	return scanAll(ctx, client, &dynamodb.ScanInput{
+		TableName:                aws.String(tables.History),
+		FilterExpression:         aws.String("#source = :api AND attribute_exists(actor)"),
+		ExpressionAttributeNames: map[string]string{"#source": "source"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":api": &types.AttributeValueMemberS{Value: string(domain.SourceAPI)},
+		},
+	}, func(item map[string]types.AttributeValue) error {
+		_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(tables.History),
+			Key: map[string]types.AttributeValue{
+				"payment_id": item["payment_id"],
+				"entry_id":   item["entry_id"],
+			},
+			UpdateExpression:         aws.String("SET declared_actor = actor REMOVE actor"),
+			ConditionExpression:      aws.String("#source = :api AND attribute_exists(actor)"),
+			ExpressionAttributeNames: map[string]string{"#source": "source"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":api": &types.AttributeValueMemberS{Value: string(domain.SourceAPI)},
+			},
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			return err
+		}
+		return nil
+	})
+}
+
+// rewriteTimestampAttempts limita quantas vezes o mesmo atributo é relido
+// quando a aplicação o altera no meio da regravação.
+const rewriteTimestampAttempts = 5
+
+// rewriteTimestamps regrava com timeLayout os atributos de horário dos itens
+// da tabela, um por vez: a aplicação regrava só alguns deles (UpdateStatus
+// troca apenas updated_at), então um item alterado no meio ainda pode ter os
+// outros no formato antigo.
+func rewriteTimestamps(ctx context.Context, client *dynamodb.Client, tableName string, attributes ...string) error {
+	names := map[string]string{"#id": "id"}
+	projection := "#id"
+	for i, attribute := range attributes {
+		name := "#a" + strconv.Itoa(i)
+		names[name] = attribute
+		projection += ", " + name
+	}
+
+	return scanAll(ctx, client, &dynamodb.ScanInput{
+		TableName:                aws.String(tableName),
+		ProjectionExpression:     aws.String(projection),
+		ExpressionAttributeNames: names,
+	}, func(item map[string]types.AttributeValue) error {
+		key := map[string]types.AttributeValue{"id": item["id"]}
+		for _, attribute := range attributes {
+			old, ok := item[attribute].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			if err := rewriteTimestamp(ctx, client, tableName, key, attribute, old.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// rewriteTimestamp regrava um atributo condicionado ao valor lido. Se a
+// condição falha, relê o item e tenta de novo com o valor atual.
+func rewriteTimestamp(ctx context.Context, client *dynamodb.Client, tableName string, key map[string]types.AttributeValue, attribute, old string) error {
+	names := map[string]string{"#a": attribute}
+	for attempt := 1; ; attempt++ {
+		t, err := time.Parse(time.RFC3339, old)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", attribute, old, err)
+		}
+		if formatTime(t) == old {
+			return nil
+		}
+
+		_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                aws.String(tableName),
+			Key:                      key,
+			UpdateExpression:         aws.String("SET #a = :new"),
+			ConditionExpression:      aws.String("#a = :old"),
+			ExpressionAttributeNames: names,
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":new": &types.AttributeValueMemberS{Value: formatTime(t)},
+				":old": &types.AttributeValueMemberS{Value: old},
+			},
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionErr) {
+			return err
+		}
+		if attempt == rewriteTimestampAttempts {
+			return fmt.Errorf("%s of %v changed %d times while being rewritten", attribute, key["id"], attempt)
+		}
+
+		current, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:                aws.String(tableName),
+			Key:                      key,
+			ConsistentRead:           aws.Bool(true),
+			ProjectionExpression:     aws.String("#a"),
+			ExpressionAttributeNames: names,
+		})
+		if err != nil {
+			return err
+		}
+		value, ok := current.Item[attribute].(*types.AttributeValueMemberS)
+		if !ok {
+			// O item foi apagado ou perdeu o atributo.
+			return nil
+		}
+		old = value.Value
+	}
+}
+
+// scanAll percorre todas as páginas do Scan chamando fn para cada item.
+func scanAll(ctx context.Context, client *dynamodb.Client, input *dynamodb.ScanInput, fn func(map[string]types.AttributeValue) error) error {
+	for {
+		result, err := client.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, item := range result.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,41 @@
+package dynamodb
+
+import (
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// unmarshalPayment converte o item em pagamento. Itens gravados antes do
+// Money guardavam amount como número em reais.
+func unmarshalPayment(item map[string]types.AttributeValue, payment *domain.Payment) error {
+	item, err := upgradeLegacyAmount(item)
+	if err != nil {
+		return err
+	}
+	return attributevalue.UnmarshalMap(item, payment)
+}
+
+// upgradeLegacyAmount devolve uma cópia do item com o amount numérico trocado
+// pelo mapa com units e currency; itens no formato atual voltam como estão.
+func upgradeLegacyAmount(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	legacy, ok := item["amount"].(*types.AttributeValueMemberN)
+	if !ok {
+		return item, nil
+	}
+
+	// Os valores antigos vinham de float64; arredonda para o centavo.
+	amount, err := domain.RoundMoney(legacy.Value, domain.DefaultCurrency)
+	if err != nil {
+		return nil, err
+	}
+	upgraded := make(map[string]types.AttributeValue, len(item))
+	for name, value := range item {
+		upgraded[name] = value
+	}
+	upgraded["amount"], err = attributevalue.Marshal(amount)
+	if err != nil {
+		return nil, err
+	}
+	return upgraded, nil
+}
@@ -0,0 +1,59 @@
+package dynamodb
+
+import (
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestUnmarshalPayment_LegacyAmount(t *testing.T) {
+	// Itens gravados antes do Money guardavam o valor como número em reais.
+	item := map[string]types.AttributeValue{
+		"id":     &types.AttributeValueMemberS{Value: "pay-1"},
+		"amount": &types.AttributeValueMemberN{Value: "100.5"},
+	}
+	var legacy domain.Payment
+	if err := unmarshalPayment(item, &legacy); err != nil {
+		t.Fatalf("expected legacy item to be read, got %v", err)
+	}
+	if legacy.Amount != domain.NewMoney(10050, "BRL") {
+		t.Errorf("unexpected legacy amount: %+v", legacy.Amount)
+	}
+	if _, ok := item["amount"].(*types.AttributeValueMemberN); !ok {
+		t.Errorf("expected the original item to be left untouched, got %T", item["amount"])
+	}
+
+	item, err := marshalItem(domain.Payment{ID: "pay-2", Amount: domain.NewMoney(1500, "CLP")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := item["amount"].(*types.AttributeValueMemberM); !ok {
+		t.Fatalf("expected amount to be stored as a map, got %T", item["amount"])
+	}
+
+	var roundTrip domain.Payment
+	if err := unmarshalPayment(item, &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+	if roundTrip.Amount != domain.NewMoney(1500, "CLP") {
+		t.Errorf("unexpected amount after round trip: %+v", roundTrip.Amount)
+	}
+}
+
+func TestUpgradeLegacyAmount_CurrentFormat(t *testing.T) {
+	amount, err := attributevalue.Marshal(domain.NewMoney(1050, "BRL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := map[string]types.AttributeValue{"amount": amount}
+
+	upgraded, err := upgradeLegacyAmount(item)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if upgraded["amount"] != amount {
+		t.Errorf("expected the current format to be kept, got %#v", upgraded["amount"])
+	}
+}
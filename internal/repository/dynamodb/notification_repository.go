@@ -0,0 +1,62 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// NotificationRepository guarda as notificações de webhook já recebidas em
+// uma tabela própria, com TTL no atributo expires_at.
+type NotificationRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewNotificationRepository(client *dynamodb.Client, tables config.DynamoDB) *NotificationRepository {
+	return &NotificationRepository{
+		client:    client,
+		tableName: tables.Notification,
+	}
+}
+
+func (r *NotificationRepository) Reserve(ctx context.Context, notification domain.ProcessedNotification) error {
+	item, err := attributevalue.MarshalMap(notification)
+	if err != nil {
+		return err
+	}
+
+	// Um registro expirado que o TTL ainda não removeu pode ser sobrescrito.
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(notification_key) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return domain.ErrNotificationProcessed
+	}
+	return err
+}
+
+func (r *NotificationRepository) Release(ctx context.Context, key string) error {
+	_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"notification_key": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	return err
+}
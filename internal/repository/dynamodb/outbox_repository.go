@@ -0,0 +1,195 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// OutboxRepository lê e atualiza os eventos gravados pelo PaymentRepository.
+// O índice StatusIndex (status, created_at) permite buscar os pendentes sem
+// varrer a tabela.
+//
+// Os horários são gravados com timeLayout, de largura fixa, porque o índice
+// ordena created_at e os filtros comparam next_attempt_at como strings.
+//
+// Eventos publicados recebem expires_at e são apagados pelo TTL da tabela
+// depois de outboxSentRetention.
+type OutboxRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// outboxSentRetention é quanto um evento publicado fica na tabela, para
+// consulta, antes de o TTL apagá-lo.
+const outboxSentRetention = 7 * 24 * time.Hour
+
+func NewOutboxRepository(client *dynamodb.Client, tables config.DynamoDB) *OutboxRepository {
+	return &OutboxRepository{
+		client:    client,
+		tableName: tables.Outbox,
+	}
+}
+
+func (r *OutboxRepository) ListPending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxEvent, error) {
+	return r.queryByStatus(ctx, domain.OutboxPending, &dynamodb.QueryInput{
+		FilterExpression: aws.String("next_attempt_at <= :now AND " +
+			"(attribute_not_exists(claim_expires_at) OR claim_expires_at <= :now)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: formatTime(now)},
+		},
+	}, limit)
+}
+
+// Claim grava a reserva com uma escrita condicional; só um relay consegue
+// reservar o evento enquanto a reserva estiver vigente.
+func (r *OutboxRepository) Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.OutboxEvent, error) {
+	result, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression: aws.String("SET claimed_by = :owner, claim_expires_at = :expires_at, updated_at = :now"),
+		ConditionExpression: aws.String("#status = :pending AND next_attempt_at <= :now AND " +
+			"(attribute_not_exists(claim_expires_at) OR claim_expires_at <= :now)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner":      &types.AttributeValueMemberS{Value: owner},
+			":expires_at": &types.AttributeValueMemberS{Value: formatTime(expiresAt)},
+			":now":        &types.AttributeValueMemberS{Value: formatTime(now)},
+			":pending":    &types.AttributeValueMemberS{Value: string(domain.OutboxPending)},
+		},
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return domain.OutboxEvent{}, claimFailure(err, domain.ErrOutboxEventNotFound, domain.ErrOutboxEventClaimed)
+	}
+
+	var event domain.OutboxEvent
+	if err := attributevalue.UnmarshalMap(result.Attributes, &event); err != nil {
+		return domain.OutboxEvent{}, err
+	}
+	return event, nil
+}
+
+func (r *OutboxRepository) ListStuck(ctx context.Context, olderThan time.Time, limit int) ([]domain.OutboxEvent, error) {
+	failed, err := r.queryByStatus(ctx, domain.OutboxFailed, &dynamodb.QueryInput{}, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(failed) >= limit {
+		return failed, nil
+	}
+
+	pending, err := r.queryByStatus(ctx, domain.OutboxPending, &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("#status = :status AND created_at < :older_than"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":older_than": &types.AttributeValueMemberS{Value: formatTime(olderThan)},
+		},
+	}, limit-len(failed))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(failed, pending...), nil
+}
+
+// UpdateDelivery grava o evento sem a reserva, o que a libera. Um evento
+// publicado passa a expirar pelo TTL.
+func (r *OutboxRepository) UpdateDelivery(ctx context.Context, event domain.OutboxEvent) error {
+	owner := event.ClaimedBy
+	event.ClaimedBy, event.ClaimExpiresAt = "", nil
+	event.UpdatedAt = time.Now()
+	item, err := marshalItem(event)
+	if err != nil {
+		return err
+	}
+	if event.Status == domain.OutboxSent {
+		item["expires_at"] = outboxExpiresAt(event)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:                           aws.String(r.tableName),
+		Item:                                item,
+		ConditionExpression:                 aws.String("attribute_exists(id)"),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if owner != "" {
+		input.ConditionExpression = aws.String("attribute_exists(id) AND claimed_by = :owner")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		}
+	}
+	_, err = r.client.PutItem(ctx, input)
+	return claimFailure(err, domain.ErrOutboxEventNotFound, domain.ErrOutboxEventClaimed)
+}
+
+// outboxExpiresAt é o horário, em epoch, em que o TTL apaga o evento
+// publicado.
+func outboxExpiresAt(event domain.OutboxEvent) types.AttributeValue {
+	sentAt := event.UpdatedAt
+	if event.SentAt != nil {
+		sentAt = *event.SentAt
+	}
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(sentAt.Add(outboxSentRetention).Unix(), 10)}
+}
+
+// claimFailure traduz a falha da condição de uma escrita numa fila reservada
+// por workers, como o outbox e o inbox: sem o item anterior, ele não existe;
+// com ele, está reservado por outro worker ou não está mais pendente.
+func claimFailure(err, notFound, claimed error) error {
+	var conditionErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionErr) {
+		return err
+	}
+	if len(conditionErr.Item) == 0 {
+		return notFound
+	}
+	return claimed
+}
+
+// queryByStatus completa o input com a partição do status e pagina até obter
+// limit itens, já que o FilterExpression é aplicado depois do Limit.
+func (r *OutboxRepository) queryByStatus(ctx context.Context, status domain.OutboxStatus, input *dynamodb.QueryInput, limit int) ([]domain.OutboxEvent, error) {
+	input.TableName = aws.String(r.tableName)
+	input.IndexName = aws.String("StatusIndex")
+	if input.KeyConditionExpression == nil {
+		input.KeyConditionExpression = aws.String("#status = :status")
+	}
+	input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+	if input.ExpressionAttributeValues == nil {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{}
+	}
+	input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: string(status)}
+
+	events := []domain.OutboxEvent{}
+	for {
+		input.Limit = aws.Int32(int32(limit - len(events)))
+		result, err := r.client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			var event domain.OutboxEvent
+			if err := attributevalue.UnmarshalMap(item, &event); err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 || len(events) >= limit {
+			return events, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -2,45 +2,167 @@ package dynamodb
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alexssanderFonseca/pagamento/internal/config"
 	"github.com/alexssanderFonseca/pagamento/internal/domain"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
 )
 
+// PaymentRepository grava os pagamentos e, na mesma transação, o histórico de
+// status (tabela PaymentStatusHistory, chave payment_id + entry_id) e os
+// eventos de outbox. A tabela PaymentExternalReferences guarda, por
+// external_reference, a tentativa de pagamento vigente. Os horários são
+// gravados com timeLayout, porque o StatusExpiresAtIndex e os filtros da
+// listagem os comparam como strings.
 type PaymentRepository struct {
-	client    *dynamodb.Client
-	tableName string
+	client             *dynamodb.Client
+	tableName          string
+	outboxTableName    string
+	historyTableName   string
+	referenceTableName string
 }
 
-func NewPaymentRepository(client *dynamodb.Client) *PaymentRepository {
-	tableName := os.Getenv("DYNAMODB_TABLE_NAME")
-	if tableName == "" {
-		tableName = "Payments"
-	}
+func NewPaymentRepository(client *dynamodb.Client, tables config.DynamoDB) *PaymentRepository {
 	return &PaymentRepository{
-		client:    client,
-		tableName: tableName,
+		client:             client,
+		tableName:          tables.Payments,
+		outboxTableName:    tables.Outbox,
+		historyTableName:   tables.History,
+		referenceTableName: tables.Reference,
 	}
 }
 
+// referenceGuard aponta a tentativa de pagamento vigente da referência
+// externa. Ela só é trocada na criação de um pagamento que declara substituir
+// a anterior.
+type referenceGuard struct {
+	ExternalReference string    `dynamodbav:"external_reference"`
+	PaymentID         string    `dynamodbav:"payment_id"`
+	UpdatedAt         time.Time `dynamodbav:"updated_at"`
+}
+
 func (r *PaymentRepository) Save(ctx context.Context, payment domain.Payment) error {
-	item, err := attributevalue.MarshalMap(payment)
+	item, err := marshalItem(payment)
 	if err != nil {
 		return err
 	}
 
-	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(r.tableName),
-		Item:      item,
+	history, err := r.historyPut(domain.NewStatusHistoryEntry(payment.ID, payment.Status, domain.StatusAudit{
+		Source:        domain.SourceAPI,
+		DeclaredActor: domain.DeclaredActorFromContext(ctx),
+	}, payment.CreatedAt))
+	if err != nil {
+		return err
+	}
+
+	guard, err := marshalItem(referenceGuard{
+		ExternalReference: payment.ExternalReference,
+		PaymentID:         payment.ID,
+		UpdatedAt:         payment.CreatedAt,
 	})
+	if err != nil {
+		return err
+	}
+	guardCondition := "attribute_not_exists(external_reference)"
+	var guardValues map[string]types.AttributeValue
+	if payment.PreviousAttemptID != "" {
+		guardCondition += " OR payment_id = :previous"
+		guardValues = map[string]types.AttributeValue{
+			":previous": &types.AttributeValueMemberS{Value: payment.PreviousAttemptID},
+		}
+	}
+
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(r.tableName),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:                 aws.String(r.referenceTableName),
+					Item:                      guard,
+					ConditionExpression:       aws.String(guardCondition),
+					ExpressionAttributeValues: guardValues,
+				},
+			},
+			{Put: history},
+		},
+	})
+	switch {
+	case conditionFailed(err, 0):
+		return domain.ErrPaymentAlreadyExists
+	case conditionFailed(err, 1), cancellationCode(err, 1) == "TransactionConflict":
+		// Um conflito na guarda é outra criação em andamento para a mesma
+		// referência.
+		return domain.ErrDuplicateExternalReference
+	}
 	return err
 }
 
+// History consulta todos os registros do pagamento em ordem de entry_id.
+func (r *PaymentRepository) History(ctx context.Context, paymentID string) ([]domain.StatusHistoryEntry, error) {
+	entries := []domain.StatusHistoryEntry{}
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(r.historyTableName),
+			KeyConditionExpression: aws.String("payment_id = :payment_id"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":payment_id": &types.AttributeValueMemberS{Value: paymentID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			var entry domain.StatusHistoryEntry
+			if err := attributevalue.UnmarshalMap(item, &entry); err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+
+		startKey = result.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return entries, nil
+		}
+	}
+}
+
+// historyPut monta a gravação do registro de histórico. O entry_id começa pela
+// data com precisão fixa, para ordenar lexicograficamente, seguida de um
+// sufixo aleatório que evita colisões.
+func (r *PaymentRepository) historyPut(entry domain.StatusHistoryEntry) (*types.Put, error) {
+	entry.ChangedAt = entry.ChangedAt.UTC()
+	entry.EntryID = entry.ChangedAt.Format(historyTimeLayout) + "#" + uuid.NewString()[:8]
+	item, err := marshalItem(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Put{
+		TableName:           aws.String(r.historyTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(entry_id)"),
+	}, nil
+}
+
+const historyTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
 func (r *PaymentRepository) GetByID(ctx context.Context, id string) (*domain.Payment, error) {
 	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(r.tableName),
@@ -57,7 +179,7 @@ func (r *PaymentRepository) GetByID(ctx context.Context, id string) (*domain.Pay
 	}
 
 	var payment domain.Payment
-	err = attributevalue.UnmarshalMap(result.Item, &payment)
+	err = unmarshalPayment(result.Item, &payment)
 	if err != nil {
 		return nil, err
 	}
@@ -65,46 +187,348 @@ func (r *PaymentRepository) GetByID(ctx context.Context, id string) (*domain.Pay
 	return &payment, nil
 }
 
+// GetByExternalReference segue a guarda da referência até a tentativa
+// vigente. Referências gravadas antes da guarda são buscadas no
+// ExternalReferenceIndex, escolhendo o pagamento criado por último.
 func (r *PaymentRepository) GetByExternalReference(ctx context.Context, ref string) (*domain.Payment, error) {
-	input := &dynamodb.QueryInput{
-		TableName:              aws.String(r.tableName),
-		IndexName:              aws.String("ExternalReferenceIndex"),
-		KeyConditionExpression: aws.String("external_reference = :ref"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":ref": &types.AttributeValueMemberS{Value: ref},
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.referenceTableName),
+		Key: map[string]types.AttributeValue{
+			"external_reference": &types.AttributeValueMemberS{Value: ref},
 		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item != nil {
+		var guard referenceGuard
+		if err := attributevalue.UnmarshalMap(result.Item, &guard); err != nil {
+			return nil, err
+		}
+		return r.GetByID(ctx, guard.PaymentID)
 	}
 
-	result, err := r.client.Query(ctx, input)
+	var latest *domain.Payment
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(r.tableName),
+			IndexName:              aws.String("ExternalReferenceIndex"),
+			KeyConditionExpression: aws.String("external_reference = :ref"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":ref": &types.AttributeValueMemberS{Value: ref},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			var payment domain.Payment
+			if err := unmarshalPayment(item, &payment); err != nil {
+				return nil, err
+			}
+			if latest == nil || newerAttempt(payment, *latest) {
+				latest = &payment
+			}
+		}
+
+		startKey = result.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return latest, nil
+		}
+	}
+}
+
+// newerAttempt ordena as tentativas da mesma referência pela criação,
+// desempatando pelo ID para que a escolha não dependa da ordem do índice.
+func newerAttempt(a, b domain.Payment) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+// List pagina os pagamentos usando o LastEvaluatedKey do DynamoDB como cursor.
+// Com external_reference a busca usa o ExternalReferenceIndex; caso contrário
+// faz um Scan filtrado.
+func (r *PaymentRepository) List(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+	startKey, err := listStartKey(filter.Cursor, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(result.Items) == 0 {
-		return nil, nil
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = domain.DefaultPageLimit
+	}
+	if limit > domain.MaxPageLimit {
+		limit = domain.MaxPageLimit
 	}
 
-	var payment domain.Payment
-	err = attributevalue.UnmarshalMap(result.Items[0], &payment)
+	var conditions []string
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	if filter.Status != "" {
+		conditions = append(conditions, "#status = :status")
+		names["#status"] = "status"
+		values[":status"] = &types.AttributeValueMemberS{Value: string(filter.Status)}
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= :created_from")
+		values[":created_from"] = &types.AttributeValueMemberS{Value: formatTime(*filter.CreatedFrom)}
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, "created_at <= :created_to")
+		values[":created_to"] = &types.AttributeValueMemberS{Value: formatTime(*filter.CreatedTo)}
+	}
+	if filter.UpdatedFrom != nil {
+		conditions = append(conditions, "updated_at >= :updated_from")
+		values[":updated_from"] = &types.AttributeValueMemberS{Value: formatTime(*filter.UpdatedFrom)}
+	}
+
+	var filterExpression *string
+	if len(conditions) > 0 {
+		filterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+	if len(names) == 0 {
+		names = nil
+	}
+
+	page := &domain.PaymentPage{Items: []domain.Payment{}}
+	for {
+		remaining := int32(limit - len(page.Items))
+
+		var items []map[string]types.AttributeValue
+		if filter.ExternalReference != "" {
+			values[":ref"] = &types.AttributeValueMemberS{Value: filter.ExternalReference}
+			result, err := r.client.Query(ctx, &dynamodb.QueryInput{
+				TableName:                 aws.String(r.tableName),
+				IndexName:                 aws.String("ExternalReferenceIndex"),
+				KeyConditionExpression:    aws.String("external_reference = :ref"),
+				FilterExpression:          filterExpression,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+				ExclusiveStartKey:         startKey,
+				Limit:                     aws.Int32(remaining),
+			})
+			if err != nil {
+				return nil, err
+			}
+			items, startKey = result.Items, result.LastEvaluatedKey
+		} else {
+			var scanValues map[string]types.AttributeValue
+			if len(values) > 0 {
+				scanValues = values
+			}
+			result, err := r.client.Scan(ctx, &dynamodb.ScanInput{
+				TableName:                 aws.String(r.tableName),
+				FilterExpression:          filterExpression,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: scanValues,
+				ExclusiveStartKey:         startKey,
+				Limit:                     aws.Int32(remaining),
+			})
+			if err != nil {
+				return nil, err
+			}
+			items, startKey = result.Items, result.LastEvaluatedKey
+		}
+
+		for _, item := range items {
+			var payment domain.Payment
+			if err := unmarshalPayment(item, &payment); err != nil {
+				return nil, err
+			}
+			page.Items = append(page.Items, payment)
+		}
+
+		if len(startKey) == 0 || len(page.Items) >= limit {
+			break
+		}
+	}
+
+	page.NextCursor, err = encodeCursor(startKey)
 	if err != nil {
 		return nil, err
 	}
 
-	return &payment, nil
+	return page, nil
 }
 
-func (r *PaymentRepository) UpdateStatus(ctx context.Context, id string, status domain.PaymentStatus) error {
-	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName: aws.String(r.tableName),
-		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{Value: id},
+// ListExpired consulta o StatusExpiresAtIndex (status, expires_at). Pagamentos
+// sem expires_at não entram no índice.
+func (r *PaymentRepository) ListExpired(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String("StatusExpiresAtIndex"),
+		KeyConditionExpression: aws.String("#status = :status AND expires_at <= :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
 		},
-		UpdateExpression:         aws.String("SET #status = :status, updated_at = :updated_at"),
-		ExpressionAttributeNames: map[string]string{"#status": "status"},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":status":     &types.AttributeValueMemberS{Value: string(status)},
-			":updated_at": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+			":status": &types.AttributeValueMemberS{Value: string(domain.StatusPending)},
+			":now":    &types.AttributeValueMemberS{Value: formatTime(now)},
+		},
+		Limit: aws.Int32(int32(limit)),
+	}
+
+	result, err := r.client.Query(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := make([]domain.Payment, 0, len(result.Items))
+	for _, item := range result.Items {
+		var payment domain.Payment
+		if err := unmarshalPayment(item, &payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, nil
+}
+
+// UpdateStatus só grava o novo status se o pagamento ainda estiver na versão
+// lida e o estado atual permitir a transição, evitando que escritas
+// concorrentes se sobrescrevam e que notificações fora de ordem regridam o
+// pagamento. O registro de histórico e os eventos do outbox entram na mesma
+// TransactWriteItems.
+func (r *PaymentRepository) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+	status := change.Status
+	sources := domain.SourceStatuses(status)
+	if len(sources) == 0 {
+		return &domain.TransitionError{To: status}
+	}
+
+	now := time.Now().UTC()
+	sets := []string{"#status = :status", "updated_at = :updated_at", "version = :next_version"}
+	values := map[string]types.AttributeValue{
+		":status":       &types.AttributeValueMemberS{Value: string(status)},
+		":updated_at":   &types.AttributeValueMemberS{Value: formatTime(now)},
+		":next_version": &types.AttributeValueMemberN{Value: strconv.FormatInt(change.Version+1, 10)},
+	}
+	placeholders := make([]string, len(sources))
+	for i, source := range sources {
+		placeholder := fmt.Sprintf(":from%d", i)
+		placeholders[i] = placeholder
+		values[placeholder] = &types.AttributeValueMemberS{Value: string(source)}
+	}
+
+	if change.ProviderPaymentID != "" {
+		sets = append(sets, "mp_payment_id = :provider_payment_id")
+		values[":provider_payment_id"] = &types.AttributeValueMemberS{Value: change.ProviderPaymentID}
+	}
+	conditions := []string{"attribute_exists(id)", fmt.Sprintf("#status IN (%s)", strings.Join(placeholders, ", "))}
+	values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(change.Version, 10)}
+	if change.Version == 0 {
+		// Itens gravados antes do controle de versão não têm o atributo.
+		conditions = append(conditions, "(attribute_not_exists(version) OR version = :version)")
+	} else {
+		conditions = append(conditions, "version = :version")
+	}
+	if change.Refund != nil {
+		refund, err := attributevalue.Marshal(*change.Refund)
+		if err != nil {
+			return err
+		}
+		refundedAmount, err := attributevalue.Marshal(change.RefundedAmount)
+		if err != nil {
+			return err
+		}
+		sets = append(sets,
+			"refunds = list_append(if_not_exists(refunds, :empty_list), :refund)",
+			"refunded_amount = :refunded_amount",
+		)
+		values[":refund"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{refund}}
+		values[":empty_list"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{}}
+		// O total é calculado pelo serviço a partir da versão lida.
+		values[":refunded_amount"] = refundedAmount
+	}
+
+	key := map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: id},
+	}
+	updateExpression := aws.String("SET " + strings.Join(sets, ", "))
+	conditionExpression := aws.String(strings.Join(conditions, " AND "))
+	names := map[string]string{"#status": "status"}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:                           aws.String(r.tableName),
+				Key:                                 key,
+				UpdateExpression:                    updateExpression,
+				ConditionExpression:                 conditionExpression,
+				ExpressionAttributeNames:            names,
+				ExpressionAttributeValues:           values,
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			},
 		},
+	}
+	history, err := r.historyPut(domain.NewStatusHistoryEntry(id, status, change.Audit, now))
+	if err != nil {
+		return err
+	}
+	items = append(items, types.TransactWriteItem{Put: history})
+	for _, event := range events {
+		item, err := marshalItem(event)
+		if err != nil {
+			return err
+		}
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(r.outboxTableName),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		})
+	}
+
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
 	})
+
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) && len(canceledErr.CancellationReasons) > 0 {
+		reason := canceledErr.CancellationReasons[0]
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return transitionFailure(id, reason.Item, change)
+		}
+	}
 	return err
 }
+
+// conditionFailed informa se a transação foi cancelada pela condição do item
+// de índice i.
+func conditionFailed(err error, i int) bool {
+	return cancellationCode(err, i) == "ConditionalCheckFailed"
+}
+
+// cancellationCode retorna o motivo do cancelamento da transação no item de
+// índice i, ou vazio.
+func cancellationCode(err error, i int) string {
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) || len(canceledErr.CancellationReasons) <= i {
+		return ""
+	}
+	return aws.ToString(canceledErr.CancellationReasons[i].Code)
+}
+
+// transitionFailure converte a falha de condição no erro de domínio adequado
+// a partir do item antigo devolvido pelo DynamoDB.
+func transitionFailure(id string, old map[string]types.AttributeValue, change domain.StatusChange) error {
+	if len(old) == 0 {
+		return domain.ErrPaymentNotFound
+	}
+	var current domain.Payment
+	if err := unmarshalPayment(old, &current); err != nil {
+		return err
+	}
+	if current.Version != change.Version {
+		return &domain.ConcurrentModificationError{PaymentID: id, Expected: change.Version, Current: current.Version}
+	}
+	return &domain.TransitionError{From: current.Status, To: change.Status}
+}
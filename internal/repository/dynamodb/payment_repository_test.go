@@ -2,18 +2,23 @@ package dynamodb
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
 
+	appconfig "github.com/alexssanderFonseca/pagamento/internal/config"
 	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/repository/repotest"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
-func setupTestDB(t *testing.T) (*dynamodb.Client, string) {
+// setupTestDB cria no LocalStack as tabelas de pagamento e retorna os nomes
+// delas para os repositórios.
+func setupTestDB(t *testing.T) (*dynamodb.Client, appconfig.DynamoDB) {
 	ctx := context.Background()
 	tableName := "PaymentsTest"
 
@@ -35,6 +40,8 @@ func setupTestDB(t *testing.T) (*dynamodb.Client, string) {
 		AttributeDefinitions: []types.AttributeDefinition{
 			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
 			{AttributeName: aws.String("external_reference"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("expires_at"), AttributeType: types.ScalarAttributeTypeS},
 		},
 		KeySchema: []types.KeySchemaElement{
 			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
@@ -51,6 +58,18 @@ func setupTestDB(t *testing.T) (*dynamodb.Client, string) {
 					WriteCapacityUnits: aws.Int64(5),
 				},
 			},
+			{
+				IndexName: aws.String("StatusExpiresAtIndex"),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("status"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("expires_at"), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+				ProvisionedThroughput: &types.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			},
 		},
 		ProvisionedThroughput: &types.ProvisionedThroughput{
 			ReadCapacityUnits:  aws.Int64(5),
@@ -62,7 +81,81 @@ func setupTestDB(t *testing.T) (*dynamodb.Client, string) {
 		t.Logf("Aviso ao criar tabela (pode já existir): %v", err)
 	}
 
-	return client, tableName
+	_, err = client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName + "History"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("payment_id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("entry_id"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("payment_id"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("entry_id"), KeyType: types.KeyTypeRange},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	})
+	if err != nil {
+		t.Logf("Aviso ao criar tabela de histórico (pode já existir): %v", err)
+	}
+
+	_, err = client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName + "References"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("external_reference"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("external_reference"), KeyType: types.KeyTypeHash},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	})
+	if err != nil {
+		t.Logf("Aviso ao criar tabela de referências (pode já existir): %v", err)
+	}
+
+	_, err = client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName + "Outbox"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("created_at"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String("StatusIndex"),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("status"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("created_at"), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+				ProvisionedThroughput: &types.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	})
+	if err != nil {
+		t.Logf("Aviso ao criar tabela de outbox (pode já existir): %v", err)
+	}
+
+	tables := appconfig.Default().DynamoDB
+	tables.Payments = tableName
+	tables.History = tableName + "History"
+	tables.Reference = tableName + "References"
+	tables.Outbox = tableName + "Outbox"
+	return client, tables
 }
 
 func TestPaymentRepository_Integration(t *testing.T) {
@@ -71,18 +164,20 @@ func TestPaymentRepository_Integration(t *testing.T) {
 		t.Skip("Pulando teste de integração (ambiente CI ou flag -short)")
 	}
 
-	client, tableName := setupTestDB(t)
-	os.Setenv("DYNAMODB_TABLE_NAME", tableName)
-	repo := NewPaymentRepository(client)
+	client, tables := setupTestDB(t)
+	repo := NewPaymentRepository(client, tables)
 
 	ctx := context.Background()
+	expiresAt := time.Now().UTC().Add(-time.Minute)
 	payment := domain.Payment{
 		ID:                "test-id-1",
 		ExternalReference: "REF-INTEGRATION-1",
-		Amount:            100.50,
+		Amount:            domain.NewMoney(10050, "BRL"),
 		Status:            domain.StatusPending,
+		ExpiresAt:         &expiresAt,
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
+		Version:           1,
 	}
 
 	// 1. Teste Save
@@ -91,6 +186,18 @@ func TestPaymentRepository_Integration(t *testing.T) {
 		if err != nil {
 			t.Fatalf("falha ao salvar: %v", err)
 		}
+
+		err = repo.Save(ctx, payment)
+		if !errors.Is(err, domain.ErrPaymentAlreadyExists) {
+			t.Fatalf("esperava ErrPaymentAlreadyExists, obteve %v", err)
+		}
+
+		duplicate := payment
+		duplicate.ID = "test-id-2"
+		err = repo.Save(ctx, duplicate)
+		if !errors.Is(err, domain.ErrDuplicateExternalReference) {
+			t.Fatalf("esperava ErrDuplicateExternalReference, obteve %v", err)
+		}
 	})
 
 	// 2. Teste GetByID
@@ -115,9 +222,45 @@ func TestPaymentRepository_Integration(t *testing.T) {
 		}
 	})
 
-	// 4. Teste UpdateStatus
+	// 4. Teste List (paginação e filtros)
+	t.Run("List Payments", func(t *testing.T) {
+		page, err := repo.List(ctx, domain.PaymentFilter{ExternalReference: payment.ExternalReference, Limit: 10})
+		if err != nil {
+			t.Fatalf("falha ao listar: %v", err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != payment.ID {
+			t.Errorf("esperava o pagamento %s, obteve %+v", payment.ID, page.Items)
+		}
+
+		page, err = repo.List(ctx, domain.PaymentFilter{Status: domain.StatusPending, Limit: 1})
+		if err != nil {
+			t.Fatalf("falha ao listar por status: %v", err)
+		}
+		for _, p := range page.Items {
+			if p.Status != domain.StatusPending {
+				t.Errorf("esperava apenas pending, obteve %s", p.Status)
+			}
+		}
+	})
+
+	// 5. Teste ListExpired (GSI status + expires_at)
+	t.Run("List Expired Payments", func(t *testing.T) {
+		payments, err := repo.ListExpired(ctx, time.Now(), 10)
+		if err != nil {
+			t.Fatalf("falha ao listar expirados: %v", err)
+		}
+		found := false
+		for _, p := range payments {
+			found = found || p.ID == payment.ID
+		}
+		if !found {
+			t.Errorf("esperava o pagamento %s entre os expirados, obteve %+v", payment.ID, payments)
+		}
+	})
+
+	// 6. Teste UpdateStatus
 	t.Run("Update Status", func(t *testing.T) {
-		err := repo.UpdateStatus(ctx, payment.ID, domain.StatusApproved)
+		err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: domain.StatusApproved, ProviderPaymentID: "mp-1", Version: 1})
 		if err != nil {
 			t.Fatalf("falha ao atualizar status: %v", err)
 		}
@@ -126,5 +269,70 @@ func TestPaymentRepository_Integration(t *testing.T) {
 		if p.Status != domain.StatusApproved {
 			t.Errorf("esperava status approved, obteve %s", p.Status)
 		}
+		if p.ProviderPaymentID != "mp-1" {
+			t.Errorf("esperava mp_payment_id mp-1, obteve %s", p.ProviderPaymentID)
+		}
+		if p.Version != 2 {
+			t.Errorf("esperava versão 2, obteve %d", p.Version)
+		}
+	})
+
+	// 7. Teste de versão desatualizada
+	t.Run("Reject Stale Version", func(t *testing.T) {
+		refund := domain.Refund{ID: "refund-0", Amount: domain.NewMoney(1000, "BRL"), Status: "approved", CreatedAt: time.Now()}
+		err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: domain.StatusPartiallyRefunded, Refund: &refund, RefundedAmount: refund.Amount, Version: 1})
+		if !errors.Is(err, domain.ErrConcurrentModification) {
+			t.Fatalf("esperava ErrConcurrentModification, obteve %v", err)
+		}
+	})
+
+	// 8. Teste de transição inválida
+	t.Run("Reject Invalid Transition", func(t *testing.T) {
+		err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: domain.StatusCancelled, Version: 2})
+		if !errors.Is(err, domain.ErrInvalidTransition) {
+			t.Fatalf("esperava ErrInvalidTransition, obteve %v", err)
+		}
+	})
+
+	// 9. Teste de estorno parcial
+	t.Run("Record Refund", func(t *testing.T) {
+		refund := domain.Refund{ID: "refund-1", Amount: domain.NewMoney(3000, "BRL"), Status: "approved", CreatedAt: time.Now()}
+		err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: domain.StatusPartiallyRefunded, Refund: &refund, RefundedAmount: refund.Amount, Version: 2})
+		if err != nil {
+			t.Fatalf("falha ao registrar estorno: %v", err)
+		}
+
+		p, _ := repo.GetByID(ctx, payment.ID)
+		if len(p.Refunds) != 1 || p.RefundedAmount != domain.NewMoney(3000, "BRL") {
+			t.Errorf("esperava um estorno de 30, obteve %+v (total %v)", p.Refunds, p.RefundedAmount)
+		}
+	})
+
+	// 10. Teste do histórico de status
+	t.Run("Status History", func(t *testing.T) {
+		history, err := repo.History(ctx, payment.ID)
+		if err != nil {
+			t.Fatalf("falha ao consultar histórico: %v", err)
+		}
+		expected := []domain.PaymentStatus{domain.StatusPending, domain.StatusApproved, domain.StatusPartiallyRefunded}
+		if len(history) != len(expected) {
+			t.Fatalf("esperava %d registros, obteve %+v", len(expected), history)
+		}
+		for i, entry := range history {
+			if entry.NewStatus != expected[i] {
+				t.Errorf("registro %d: esperava %s, obteve %s", i, expected[i], entry.NewStatus)
+			}
+		}
+	})
+}
+
+func TestPaymentRepository_Conformance(t *testing.T) {
+	if os.Getenv("CI") != "" || testing.Short() {
+		t.Skip("Pulando teste de integração (ambiente CI ou flag -short)")
+	}
+
+	client, tables := setupTestDB(t)
+	repotest.RunPaymentRepositorySuite(t, func(t *testing.T) repotest.Fixture {
+		return repotest.Fixture{Payments: NewPaymentRepository(client, tables), Outbox: NewOutboxRepository(client, tables)}
 	})
 }
@@ -0,0 +1,436 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableSpec descreve uma tabela usada pelo serviço: chave primária, índices
+// globais e atributo de TTL. Os nomes vêm da mesma config.DynamoDB dos
+// repositórios.
+type TableSpec struct {
+	Name string
+	// Attributes declara o tipo dos atributos usados nas chaves da tabela e
+	// dos índices.
+	Attributes []types.AttributeDefinition
+	KeySchema  []types.KeySchemaElement
+	Indexes    []IndexSpec
+	// TTLAttribute, quando informado, é o atributo em epoch usado pelo TTL.
+	TTLAttribute string
+}
+
+// IndexSpec descreve um índice global, sempre com projeção de todos os
+// atributos.
+type IndexSpec struct {
+	Name      string
+	KeySchema []types.KeySchemaElement
+}
+
+func key(hash string, sort ...string) []types.KeySchemaElement {
+	elements := []types.KeySchemaElement{{AttributeName: aws.String(hash), KeyType: types.KeyTypeHash}}
+	for _, name := range sort {
+		elements = append(elements, types.KeySchemaElement{AttributeName: aws.String(name), KeyType: types.KeyTypeRange})
+	}
+	return elements
+}
+
+func stringAttributes(names ...string) []types.AttributeDefinition {
+	attributes := make([]types.AttributeDefinition, len(names))
+	for i, name := range names {
+		attributes[i] = types.AttributeDefinition{AttributeName: aws.String(name), AttributeType: types.ScalarAttributeTypeS}
+	}
+	return attributes
+}
+
+// statusIndex é o índice (status, created_at) das filas de outbox e inbox.
+var statusIndex = IndexSpec{Name: "StatusIndex", KeySchema: key("status", "created_at")}
+
+// PaymentTables são as tabelas gravadas pelo PaymentRepository: pagamentos,
+// outbox, histórico de status e referências externas.
+func PaymentTables(tables config.DynamoDB) []TableSpec {
+	return []TableSpec{
+		{
+			Name:       tables.Payments,
+			Attributes: stringAttributes("id", "external_reference", "status", "expires_at"),
+			KeySchema:  key("id"),
+			Indexes: []IndexSpec{
+				{Name: "ExternalReferenceIndex", KeySchema: key("external_reference")},
+				{Name: "StatusExpiresAtIndex", KeySchema: key("status", "expires_at")},
+			},
+		},
+		{
+			Name:         tables.Outbox,
+			Attributes:   stringAttributes("id", "status", "created_at"),
+			KeySchema:    key("id"),
+			Indexes:      []IndexSpec{statusIndex},
+			TTLAttribute: "expires_at",
+		},
+		{
+			Name:       tables.History,
+			Attributes: stringAttributes("payment_id", "entry_id"),
+			KeySchema:  key("payment_id", "entry_id"),
+		},
+		{
+			Name:       tables.Reference,
+			Attributes: stringAttributes("external_reference"),
+			KeySchema:  key("external_reference"),
+		},
+	}
+}
+
+func IdempotencyTable(tables config.DynamoDB) TableSpec {
+	return TableSpec{
+		Name:         tables.Idempotency,
+		Attributes:   stringAttributes("idempotency_key"),
+		KeySchema:    key("idempotency_key"),
+		TTLAttribute: "expires_at",
+	}
+}
+
+func NotificationTable(tables config.DynamoDB) TableSpec {
+	return TableSpec{
+		Name:         tables.Notification,
+		Attributes:   stringAttributes("notification_key"),
+		KeySchema:    key("notification_key"),
+		TTLAttribute: "expires_at",
+	}
+}
+
+func InboxTable(tables config.DynamoDB) TableSpec {
+	return TableSpec{
+		Name:       tables.Inbox,
+		Attributes: stringAttributes("id", "status", "created_at", "ordering_key"),
+		KeySchema:  key("id"),
+		Indexes: []IndexSpec{
+			statusIndex,
+			{Name: "OrderingKeyIndex", KeySchema: key("ordering_key", "created_at")},
+		},
+		TTLAttribute: "expires_at",
+	}
+}
+
+// MigrationsTable registra as migrações de dados já aplicadas.
+func MigrationsTable(tables config.DynamoDB) TableSpec {
+	return TableSpec{
+		Name:       tables.Migrations,
+		Attributes: stringAttributes("version"),
+		KeySchema:  key("version"),
+	}
+}
+
+// Tables lista todas as tabelas do serviço.
+func Tables(tables config.DynamoDB) []TableSpec {
+	return append(PaymentTables(tables), IdempotencyTable(tables), NotificationTable(tables), InboxTable(tables), MigrationsTable(tables))
+}
+
+// SchemaError lista as diferenças entre as tabelas esperadas e as existentes.
+type SchemaError struct {
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return "dynamodb schema mismatch: " + strings.Join(e.Problems, "; ")
+}
+
+// SchemaManager cria e confere as tabelas descritas pelos TableSpec e aplica
+// as migrações de dados (ver Migrations).
+type SchemaManager struct {
+	client *dynamodb.Client
+	// tables dá os nomes da tabela de migrações e das tabelas migradas.
+	tables config.DynamoDB
+	// pollInterval é o intervalo entre consultas enquanto um índice é criado.
+	pollInterval time.Duration
+	// waitTimeout limita a espera pela criação de uma tabela ou índice.
+	waitTimeout time.Duration
+}
+
+func NewSchemaManager(client *dynamodb.Client, tables config.DynamoDB) *SchemaManager {
+	return &SchemaManager{
+		client:       client,
+		tables:       tables,
+		pollInterval: 5 * time.Second,
+		waitTimeout:  30 * time.Minute,
+	}
+}
+
+// Verify confere que as tabelas existem com a chave, os índices ativos e o TTL
+// esperados, retornando um *SchemaError com tudo o que falta.
+func (m *SchemaManager) Verify(ctx context.Context, tables []TableSpec) error {
+	var problems []string
+	for _, spec := range tables {
+		table, err := m.describe(ctx, spec.Name)
+		if err != nil {
+			return err
+		}
+		if table == nil {
+			problems = append(problems, fmt.Sprintf("table %s not found", spec.Name))
+			continue
+		}
+		ttlEnabled, err := m.ttlEnabled(ctx, spec)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, schemaProblems(spec, table, ttlEnabled)...)
+	}
+	if len(problems) > 0 {
+		return &SchemaError{Problems: problems}
+	}
+	return nil
+}
+
+// EnsureTables cria as tabelas ausentes, os índices que faltam e ativa o TTL,
+// retornando a descrição de cada alteração feita. Chaves primárias diferentes
+// das esperadas não podem ser alteradas e resultam em erro.
+func (m *SchemaManager) EnsureTables(ctx context.Context, tables []TableSpec) ([]string, error) {
+	var changes []string
+	for _, spec := range tables {
+		table, err := m.describe(ctx, spec.Name)
+		if err != nil {
+			return changes, err
+		}
+		if table == nil {
+			if err := m.createTable(ctx, spec); err != nil {
+				return changes, fmt.Errorf("create table %s: %w", spec.Name, err)
+			}
+			changes = append(changes, fmt.Sprintf("created table %s", spec.Name))
+		} else {
+			if !sameKeySchema(spec.KeySchema, table.KeySchema) {
+				return changes, fmt.Errorf("table %s has a different primary key and must be migrated manually", spec.Name)
+			}
+			for _, index := range missingIndexes(spec, table) {
+				if err := m.createIndex(ctx, spec, table, index); err != nil {
+					return changes, fmt.Errorf("create index %s on %s: %w", index.Name, spec.Name, err)
+				}
+				changes = append(changes, fmt.Sprintf("created index %s on %s", index.Name, spec.Name))
+			}
+		}
+
+		ttlEnabled, err := m.ttlEnabled(ctx, spec)
+		if err != nil {
+			return changes, err
+		}
+		if !ttlEnabled {
+			_, err := m.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+				TableName: aws.String(spec.Name),
+				TimeToLiveSpecification: &types.TimeToLiveSpecification{
+					AttributeName: aws.String(spec.TTLAttribute),
+					Enabled:       aws.Bool(true),
+				},
+			})
+			if err != nil {
+				return changes, fmt.Errorf("enable ttl on %s: %w", spec.Name, err)
+			}
+			changes = append(changes, fmt.Sprintf("enabled ttl on %s.%s", spec.Name, spec.TTLAttribute))
+		}
+	}
+	return changes, nil
+}
+
+// describe retorna nil quando a tabela não existe.
+func (m *SchemaManager) describe(ctx context.Context, name string) (*types.TableDescription, error) {
+	result, err := m.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.Table, nil
+}
+
+// Ping confere, com um DescribeTable por tabela, que as tabelas existem e
+// estão ACTIVE. É a verificação leve da readiness; Verify confere o esquema.
+func (m *SchemaManager) Ping(ctx context.Context, tables []TableSpec) error {
+	for _, spec := range tables {
+		table, err := m.describe(ctx, spec.Name)
+		if err != nil {
+			return err
+		}
+		if table == nil {
+			return fmt.Errorf("table %s not found", spec.Name)
+		}
+		if table.TableStatus != types.TableStatusActive {
+			return fmt.Errorf("table %s is %s", spec.Name, table.TableStatus)
+		}
+	}
+	return nil
+}
+
+// ttlEnabled informa se o TTL está ativo (ou sendo ativado) no atributo
+// esperado; tabelas sem TTLAttribute são sempre consideradas em dia.
+func (m *SchemaManager) ttlEnabled(ctx context.Context, spec TableSpec) (bool, error) {
+	if spec.TTLAttribute == "" {
+		return true, nil
+	}
+	result, err := m.client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(spec.Name)})
+	if err != nil {
+		return false, err
+	}
+	ttl := result.TimeToLiveDescription
+	return ttl != nil && aws.ToString(ttl.AttributeName) == spec.TTLAttribute &&
+		(ttl.TimeToLiveStatus == types.TimeToLiveStatusEnabled || ttl.TimeToLiveStatus == types.TimeToLiveStatusEnabling), nil
+}
+
+// createTable cria a tabela sob demanda, sem capacidade provisionada, e
+// espera ela ficar ativa.
+func (m *SchemaManager) createTable(ctx context.Context, spec TableSpec) error {
+	input := &dynamodb.CreateTableInput{
+		TableName:            aws.String(spec.Name),
+		AttributeDefinitions: spec.Attributes,
+		KeySchema:            spec.KeySchema,
+		BillingMode:          types.BillingModePayPerRequest,
+	}
+	for _, index := range spec.Indexes {
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+			IndexName:  aws.String(index.Name),
+			KeySchema:  index.KeySchema,
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		})
+	}
+	if _, err := m.client.CreateTable(ctx, input); err != nil {
+		return err
+	}
+	return dynamodb.NewTableExistsWaiter(m.client).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(spec.Name)}, m.waitTimeout)
+}
+
+// createIndex adiciona um índice global e espera o backfill terminar. Em
+// tabelas provisionadas o índice recebe a mesma capacidade da tabela.
+func (m *SchemaManager) createIndex(ctx context.Context, spec TableSpec, table *types.TableDescription, index IndexSpec) error {
+	create := &types.CreateGlobalSecondaryIndexAction{
+		IndexName:  aws.String(index.Name),
+		KeySchema:  index.KeySchema,
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+	if provisioned := table.ProvisionedThroughput; !isOnDemand(table) && provisioned != nil {
+		create.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits:  provisioned.ReadCapacityUnits,
+			WriteCapacityUnits: provisioned.WriteCapacityUnits,
+		}
+	}
+	_, err := m.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:                   aws.String(spec.Name),
+		AttributeDefinitions:        spec.Attributes,
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{Create: create}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.waitTimeout)
+	defer cancel()
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for {
+		table, err := m.describe(ctx, spec.Name)
+		if err != nil {
+			return err
+		}
+		if table != nil && indexStatus(table, index.Name) == types.IndexStatusActive {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func isOnDemand(table *types.TableDescription) bool {
+	return table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode == types.BillingModePayPerRequest
+}
+
+// schemaProblems compara a tabela descrita pelo DynamoDB com a esperada.
+func schemaProblems(spec TableSpec, table *types.TableDescription, ttlEnabled bool) []string {
+	var problems []string
+	if !sameKeySchema(spec.KeySchema, table.KeySchema) {
+		problems = append(problems, fmt.Sprintf("table %s has an unexpected primary key", spec.Name))
+	}
+	for _, index := range spec.Indexes {
+		switch status := indexStatus(table, index.Name); status {
+		case "":
+			problems = append(problems, fmt.Sprintf("index %s not found on %s", index.Name, spec.Name))
+		case types.IndexStatusActive:
+			if !sameKeySchema(index.KeySchema, indexKeySchema(table, index.Name)) {
+				problems = append(problems, fmt.Sprintf("index %s on %s has an unexpected key", index.Name, spec.Name))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("index %s on %s is %s", index.Name, spec.Name, status))
+		}
+	}
+	if !ttlEnabled {
+		problems = append(problems, fmt.Sprintf("ttl on %s.%s is disabled", spec.Name, spec.TTLAttribute))
+	}
+	return problems
+}
+
+func missingIndexes(spec TableSpec, table *types.TableDescription) []IndexSpec {
+	var missing []IndexSpec
+	for _, index := range spec.Indexes {
+		if indexStatus(table, index.Name) == "" {
+			missing = append(missing, index)
+		}
+	}
+	return missing
+}
+
+// indexStatus retorna vazio quando o índice não existe.
+func indexStatus(table *types.TableDescription, name string) types.IndexStatus {
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == name {
+			return index.IndexStatus
+		}
+	}
+	return ""
+}
+
+func indexKeySchema(table *types.TableDescription, name string) []types.KeySchemaElement {
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == name {
+			return index.KeySchema
+		}
+	}
+	return nil
+}
+
+func sameKeySchema(a, b []types.KeySchemaElement) bool {
+	return slices.EqualFunc(a, b, func(x, y types.KeySchemaElement) bool {
+		return aws.ToString(x.AttributeName) == aws.ToString(y.AttributeName) && x.KeyType == y.KeyType
+	})
+}
+
+// MigrationReport resume uma execução de Migrate.
+type MigrationReport struct {
+	// Changes descreve as tabelas, índices e TTLs criados.
+	Changes []string
+	// Applied são as versões das migrações de dados aplicadas.
+	Applied []string
+}
+
+// Migrate cria ou atualiza as tabelas, incluindo a de migrações, e aplica as
+// migrações de dados pendentes.
+func (m *SchemaManager) Migrate(ctx context.Context, tables []TableSpec, migrations []Migration) (*MigrationReport, error) {
+	migrationsTable := MigrationsTable(m.tables)
+	if !slices.ContainsFunc(tables, func(spec TableSpec) bool { return spec.Name == migrationsTable.Name }) {
+		tables = append(slices.Clone(tables), migrationsTable)
+	}
+
+	report := &MigrationReport{}
+	changes, err := m.EnsureTables(ctx, tables)
+	report.Changes = changes
+	if err != nil || len(migrations) == 0 {
+		return report, err
+	}
+	report.Applied, err = m.ApplyMigrations(ctx, migrations)
+	return report, err
+}
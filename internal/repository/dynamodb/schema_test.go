@@ -0,0 +1,154 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+func describedTable(spec TableSpec, indexStatus map[string]types.IndexStatus) *types.TableDescription {
+	table := &types.TableDescription{TableName: aws.String(spec.Name), KeySchema: spec.KeySchema}
+	for _, index := range spec.Indexes {
+		status, ok := indexStatus[index.Name]
+		if !ok {
+			status = types.IndexStatusActive
+		}
+		if status == "" {
+			continue
+		}
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:   aws.String(index.Name),
+			KeySchema:   index.KeySchema,
+			IndexStatus: status,
+		})
+	}
+	return table
+}
+
+func TestSchemaProblems(t *testing.T) {
+	tables := config.Default().DynamoDB
+	payments := PaymentTables(tables)[0]
+
+	tests := []struct {
+		name       string
+		spec       TableSpec
+		table      *types.TableDescription
+		ttlEnabled bool
+		expected   []string
+	}{
+		{
+			name:       "up to date",
+			spec:       payments,
+			table:      describedTable(payments, nil),
+			ttlEnabled: true,
+		},
+		{
+			name:       "missing index",
+			spec:       payments,
+			table:      describedTable(payments, map[string]types.IndexStatus{"ExternalReferenceIndex": ""}),
+			ttlEnabled: true,
+			expected:   []string{"index ExternalReferenceIndex not found"},
+		},
+		{
+			name:       "index being created",
+			spec:       payments,
+			table:      describedTable(payments, map[string]types.IndexStatus{"StatusExpiresAtIndex": types.IndexStatusCreating}),
+			ttlEnabled: true,
+			expected:   []string{"StatusExpiresAtIndex on Payments is CREATING"},
+		},
+		{
+			name:       "different primary key",
+			spec:       payments,
+			table:      &types.TableDescription{KeySchema: key("payment_id"), GlobalSecondaryIndexes: describedTable(payments, nil).GlobalSecondaryIndexes},
+			ttlEnabled: true,
+			expected:   []string{"unexpected primary key"},
+		},
+		{
+			name:     "ttl disabled",
+			spec:     IdempotencyTable(tables),
+			table:    describedTable(IdempotencyTable(tables), nil),
+			expected: []string{"ttl on PaymentIdempotency.expires_at is disabled"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := schemaProblems(tt.spec, tt.table, tt.ttlEnabled)
+			if len(problems) != len(tt.expected) {
+				t.Fatalf("expected %d problems, got %v", len(tt.expected), problems)
+			}
+			for i, expected := range tt.expected {
+				if !strings.Contains(problems[i], expected) {
+					t.Errorf("expected %q to mention %q", problems[i], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestMissingIndexes(t *testing.T) {
+	payments := PaymentTables(config.Default().DynamoDB)[0]
+	table := describedTable(payments, map[string]types.IndexStatus{"StatusExpiresAtIndex": ""})
+
+	missing := missingIndexes(payments, table)
+	if len(missing) != 1 || missing[0].Name != "StatusExpiresAtIndex" {
+		t.Errorf("expected StatusExpiresAtIndex to be missing, got %+v", missing)
+	}
+}
+
+func TestMigrations_AreOrderedAndUnique(t *testing.T) {
+	migrations := Migrations()
+	for i, migration := range migrations {
+		if migration.Version == migrationLockVersion || migration.Apply == nil {
+			t.Errorf("invalid migration %+v", migration)
+		}
+		if i > 0 && migrations[i-1].Version >= migration.Version {
+			t.Errorf("migrations out of order: %s before %s", migrations[i-1].Version, migration.Version)
+		}
+	}
+}
+
+func TestSchemaManager_Integration(t *testing.T) {
+	if os.Getenv("CI") != "" || testing.Short() {
+		t.Skip("Pulando teste de integração (ambiente CI ou flag -short)")
+	}
+
+	client, names := setupTestDB(t)
+	suffix := uuid.NewString()[:8]
+	names.Idempotency = "IdempotencyTest" + suffix
+	names.Migrations = "MigrationsTest" + suffix
+	ctx := context.Background()
+	schema := NewSchemaManager(client, names)
+	tables := []TableSpec{IdempotencyTable(names)}
+
+	var schemaErr *SchemaError
+	if err := schema.Verify(ctx, tables); !errors.As(err, &schemaErr) {
+		t.Fatalf("expected missing table to be reported, got %v", err)
+	}
+
+	report, err := schema.Migrate(ctx, tables, Migrations())
+	if err != nil {
+		t.Fatalf("falha ao migrar: %v", err)
+	}
+	if len(report.Changes) == 0 || len(report.Applied) != len(Migrations()) {
+		t.Errorf("expected tables and migrations to be applied, got %+v", report)
+	}
+	if err := schema.Verify(ctx, tables); err != nil {
+		t.Errorf("expected schema to be up to date, got %v", err)
+	}
+
+	report, err = schema.Migrate(ctx, tables, Migrations())
+	if err != nil || len(report.Changes) != 0 || len(report.Applied) != 0 {
+		t.Errorf("expected a second run to change nothing, got %+v (%v)", report, err)
+	}
+	if pending, err := schema.PendingMigrations(ctx, Migrations()); err != nil || len(pending) != 0 {
+		t.Errorf("expected no pending migrations, got %v (%v)", pending, err)
+	}
+}
@@ -0,0 +1,28 @@
+package dynamodb
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// timeLayout é o RFC3339 em UTC com os nove dígitos da fração sempre
+// presentes. Os índices ordenam e os filtros comparam os horários como
+// strings, e o RFC3339Nano, que corta os zeros da fração, poria
+// "10:00:05.5Z" antes de "10:00:05Z".
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// marshalItem converte v gravando os horários com timeLayout. A leitura não
+// precisa de opção: o RFC3339 aceita a fração com qualquer número de dígitos.
+func marshalItem(v any) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMapWithOptions(v, func(options *attributevalue.EncoderOptions) {
+		options.EncodeTime = func(t time.Time) (types.AttributeValue, error) {
+			return &types.AttributeValueMemberS{Value: formatTime(t)}, nil
+		}
+	})
+}
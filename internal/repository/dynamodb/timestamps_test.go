@@ -0,0 +1,99 @@
+package dynamodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestFormatTime_SortsAsTime(t *testing.T) {
+	second := time.Date(2026, 3, 10, 14, 30, 5, 0, time.UTC)
+	times := []time.Time{
+		second,
+		second.Add(time.Nanosecond),
+		second.Add(500 * time.Millisecond),
+		second.Add(time.Second),
+	}
+	for i := 1; i < len(times); i++ {
+		if formatTime(times[i-1]) >= formatTime(times[i]) {
+			t.Errorf("expected %s before %s", formatTime(times[i-1]), formatTime(times[i]))
+		}
+	}
+
+	local := second.In(time.FixedZone("BRT", -3*60*60))
+	if formatTime(local) != "2026-03-10T14:30:05.000000000Z" {
+		t.Errorf("expected the time in UTC, got %s", formatTime(local))
+	}
+}
+
+func TestMarshalItem_FixedWidthOutboxTimes(t *testing.T) {
+	at := time.Date(2026, 3, 10, 14, 30, 5, 500_000_000, time.UTC)
+	event, err := domain.NewOutboxEvent("evt-1", domain.EventTypePaymentProcessed, "pay-1", map[string]string{}, at)
+	if err != nil {
+		t.Fatalf("failed to build event: %v", err)
+	}
+
+	item, err := marshalItem(event)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, name := range []string{"created_at", "next_attempt_at"} {
+		value, ok := item[name].(*types.AttributeValueMemberS)
+		if !ok || value.Value != "2026-03-10T14:30:05.500000000Z" {
+			t.Errorf("expected %s in the fixed-width layout, got %#v", name, item[name])
+		}
+	}
+}
+
+func TestMarshalItem_FixedWidthInboxTimes(t *testing.T) {
+	at := time.Date(2026, 3, 10, 14, 30, 5, 0, time.FixedZone("BRT", -3*60*60))
+	claimExpiresAt := at.Add(500 * time.Millisecond)
+	notification := domain.InboxNotification{
+		ID:             "ntf-1",
+		Status:         domain.InboxPending,
+		NextAttemptAt:  at,
+		CreatedAt:      at,
+		ClaimedBy:      "worker-1",
+		ClaimExpiresAt: &claimExpiresAt,
+	}
+
+	item, err := marshalItem(notification)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := map[string]string{
+		"created_at":       "2026-03-10T17:30:05.000000000Z",
+		"next_attempt_at":  "2026-03-10T17:30:05.000000000Z",
+		"claim_expires_at": "2026-03-10T17:30:05.500000000Z",
+	}
+	for name, want := range expected {
+		value, ok := item[name].(*types.AttributeValueMemberS)
+		if !ok || value.Value != want {
+			t.Errorf("expected %s = %s, got %#v", name, want, item[name])
+		}
+	}
+}
+
+func TestMarshalItem_FixedWidthPaymentTimes(t *testing.T) {
+	at := time.Date(2026, 3, 10, 11, 30, 5, 500_000_000, time.FixedZone("BRT", -3*60*60))
+	expiresAt := at.Add(30 * time.Minute)
+	payment := domain.Payment{ID: "pay-1", CreatedAt: at, UpdatedAt: at, ExpiresAt: &expiresAt}
+
+	item, err := marshalItem(payment)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := map[string]string{
+		"created_at": "2026-03-10T14:30:05.500000000Z",
+		"updated_at": "2026-03-10T14:30:05.500000000Z",
+		"expires_at": "2026-03-10T15:00:05.500000000Z",
+	}
+	for name, want := range expected {
+		value, ok := item[name].(*types.AttributeValueMemberS)
+		if !ok || value.Value != want {
+			t.Errorf("expected %s = %s, got %#v", name, want, item[name])
+		}
+	}
+}
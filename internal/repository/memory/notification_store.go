@@ -0,0 +1,56 @@
+// Package memory implementa repositórios em memória, para desenvolvimento
+// local e instâncias únicas. O conteúdo se perde ao reiniciar o processo.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+// NotificationStore deduplica webhooks em memória. Só protege uma réplica:
+// com várias, use o repositório do DynamoDB.
+type NotificationStore struct {
+	mu            sync.Mutex
+	notifications map[string]domain.ProcessedNotification
+	now           func() time.Time
+}
+
+func NewNotificationStore() *NotificationStore {
+	return &NotificationStore{
+		notifications: map[string]domain.ProcessedNotification{},
+		now:           time.Now,
+	}
+}
+
+func (s *NotificationStore) Reserve(ctx context.Context, notification domain.ProcessedNotification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if existing, ok := s.notifications[notification.Key]; ok && !existing.ExpiresAt.Before(now) {
+		return domain.ErrNotificationProcessed
+	}
+	s.notifications[notification.Key] = notification
+	s.evictExpired(now)
+	return nil
+}
+
+func (s *NotificationStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notifications, key)
+	return nil
+}
+
+// evictExpired faz o papel do TTL do DynamoDB. Deve ser chamado com s.mu
+// travado.
+func (s *NotificationStore) evictExpired(now time.Time) {
+	for key, notification := range s.notifications {
+		if notification.ExpiresAt.Before(now) {
+			delete(s.notifications, key)
+		}
+	}
+}
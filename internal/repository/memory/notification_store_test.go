@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+func TestNotificationStore(t *testing.T) {
+	store := NewNotificationStore()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	notification := domain.ProcessedNotification{Key: "mercadopago:1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	if err := store.Reserve(ctx, notification); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.Reserve(ctx, notification); !errors.Is(err, domain.ErrNotificationProcessed) {
+		t.Fatalf("expected ErrNotificationProcessed, got %v", err)
+	}
+
+	if err := store.Release(ctx, notification.Key); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.Reserve(ctx, notification); err != nil {
+		t.Fatalf("expected released notification to be reserved again, got %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := store.Reserve(ctx, domain.ProcessedNotification{Key: "mercadopago:1", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Errorf("expected expired notification to be reserved again, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+// OutboxRepository guarda em memória os eventos gravados pelo
+// PaymentRepository deste pacote.
+type OutboxRepository struct {
+	mu     sync.Mutex
+	events map[string]domain.OutboxEvent
+}
+
+func NewOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{events: map[string]domain.OutboxEvent{}}
+}
+
+func (r *OutboxRepository) add(events ...domain.OutboxEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, event := range events {
+		r.events[event.ID] = event
+	}
+}
+
+func (r *OutboxRepository) ListPending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxEvent, error) {
+	return r.list(limit, func(event domain.OutboxEvent) bool {
+		return claimable(event, now)
+	}), nil
+}
+
+func (r *OutboxRepository) Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event, ok := r.events[id]
+	if !ok {
+		return domain.OutboxEvent{}, domain.ErrOutboxEventNotFound
+	}
+	if !claimable(event, now) {
+		return domain.OutboxEvent{}, domain.ErrOutboxEventClaimed
+	}
+	event.ClaimedBy = owner
+	event.ClaimExpiresAt = &expiresAt
+	event.UpdatedAt = now
+	r.events[id] = event
+	return event, nil
+}
+
+func (r *OutboxRepository) ListStuck(ctx context.Context, olderThan time.Time, limit int) ([]domain.OutboxEvent, error) {
+	failed := r.list(limit, func(event domain.OutboxEvent) bool {
+		return event.Status == domain.OutboxFailed
+	})
+	pending := r.list(limit-len(failed), func(event domain.OutboxEvent) bool {
+		return event.Status == domain.OutboxPending && event.CreatedAt.Before(olderThan)
+	})
+	return append(failed, pending...), nil
+}
+
+func (r *OutboxRepository) UpdateDelivery(ctx context.Context, event domain.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.events[event.ID]
+	if !ok {
+		return domain.ErrOutboxEventNotFound
+	}
+	if event.ClaimedBy != "" && current.ClaimedBy != event.ClaimedBy {
+		return domain.ErrOutboxEventClaimed
+	}
+	event.ClaimedBy = ""
+	event.ClaimExpiresAt = nil
+	event.UpdatedAt = time.Now()
+	r.events[event.ID] = event
+	return nil
+}
+
+// claimable diz se o evento pode ser publicado em now: pendente, com a
+// próxima tentativa vencida e sem reserva vigente.
+func claimable(event domain.OutboxEvent, now time.Time) bool {
+	return event.Status == domain.OutboxPending && !event.NextAttemptAt.After(now) &&
+		(event.ClaimExpiresAt == nil || !event.ClaimExpiresAt.After(now))
+}
+
+// list devolve até limit eventos que satisfazem match, dos mais antigos aos
+// mais novos, como o StatusIndex (status, created_at).
+func (r *OutboxRepository) list(limit int, match func(domain.OutboxEvent) bool) []domain.OutboxEvent {
+	r.mu.Lock()
+	var events []domain.OutboxEvent
+	for _, event := range r.events {
+		if match(event) {
+			events = append(events, event)
+		}
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(events, func(a, b domain.OutboxEvent) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if limit <= 0 {
+		return []domain.OutboxEvent{}
+	}
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	if events == nil {
+		events = []domain.OutboxEvent{}
+	}
+	return events
+}
@@ -0,0 +1,222 @@
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+// PaymentRepository guarda pagamentos, histórico, referências externas e
+// outbox em memória, com as mesmas regras do repositório do DynamoDB:
+// criação sem sobrescrita, uma tentativa vigente por referência externa,
+// transições validadas e controle de versão. Os eventos gravados em
+// UpdateStatus ficam disponíveis em Outbox.
+type PaymentRepository struct {
+	mu         sync.Mutex
+	payments   map[string]domain.Payment
+	history    map[string][]domain.StatusHistoryEntry
+	references map[string]string
+	outbox     *OutboxRepository
+	now        func() time.Time
+}
+
+func NewPaymentRepository() *PaymentRepository {
+	return &PaymentRepository{
+		payments:   map[string]domain.Payment{},
+		history:    map[string][]domain.StatusHistoryEntry{},
+		references: map[string]string{},
+		outbox:     NewOutboxRepository(),
+		now:        time.Now,
+	}
+}
+
+// Outbox retorna o outbox que recebe os eventos das mudanças de status.
+func (r *PaymentRepository) Outbox() *OutboxRepository {
+	return r.outbox
+}
+
+func (r *PaymentRepository) Save(ctx context.Context, payment domain.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.payments[payment.ID]; ok {
+		return domain.ErrPaymentAlreadyExists
+	}
+	if current, ok := r.references[payment.ExternalReference]; ok && current != payment.PreviousAttemptID {
+		return domain.ErrDuplicateExternalReference
+	}
+
+	r.payments[payment.ID] = clonePayment(payment)
+	r.references[payment.ExternalReference] = payment.ID
+	r.appendHistory(domain.NewStatusHistoryEntry(payment.ID, payment.Status, domain.StatusAudit{
+		Source:        domain.SourceAPI,
+		DeclaredActor: domain.DeclaredActorFromContext(ctx),
+	}, payment.CreatedAt))
+	return nil
+}
+
+func (r *PaymentRepository) GetByID(ctx context.Context, id string) (*domain.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment, ok := r.payments[id]
+	if !ok {
+		return nil, nil
+	}
+	payment = clonePayment(payment)
+	return &payment, nil
+}
+
+func (r *PaymentRepository) GetByExternalReference(ctx context.Context, ref string) (*domain.Payment, error) {
+	r.mu.Lock()
+	id, ok := r.references[ref]
+	r.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	return r.GetByID(ctx, id)
+}
+
+// List ordena os pagamentos por criação e ID; o cursor é a posição do último
+// item devolvido.
+func (r *PaymentRepository) List(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+	offset := 0
+	if filter.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+		if err != nil {
+			return nil, domain.ErrInvalidCursor
+		}
+		offset, err = strconv.Atoi(string(raw))
+		if err != nil || offset < 0 {
+			return nil, domain.ErrInvalidCursor
+		}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = domain.DefaultPageLimit
+	}
+	if limit > domain.MaxPageLimit {
+		limit = domain.MaxPageLimit
+	}
+
+	r.mu.Lock()
+	var matches []domain.Payment
+	for _, payment := range r.payments {
+		if matchesFilter(payment, filter) {
+			matches = append(matches, clonePayment(payment))
+		}
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(matches, func(a, b domain.Payment) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	page := &domain.PaymentPage{Items: []domain.Payment{}}
+	if offset < len(matches) {
+		end := min(offset+limit, len(matches))
+		page.Items = append(page.Items, matches[offset:end]...)
+		if end < len(matches) {
+			page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+		}
+	}
+	return page, nil
+}
+
+func matchesFilter(payment domain.Payment, filter domain.PaymentFilter) bool {
+	switch {
+	case filter.ExternalReference != "" && payment.ExternalReference != filter.ExternalReference,
+		filter.Status != "" && payment.Status != filter.Status,
+		filter.CreatedFrom != nil && payment.CreatedAt.Before(*filter.CreatedFrom),
+		filter.CreatedTo != nil && payment.CreatedAt.After(*filter.CreatedTo),
+		filter.UpdatedFrom != nil && payment.UpdatedAt.Before(*filter.UpdatedFrom):
+		return false
+	}
+	return true
+}
+
+func (r *PaymentRepository) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment, ok := r.payments[id]
+	if !ok {
+		return domain.ErrPaymentNotFound
+	}
+	if payment.Version != change.Version {
+		return &domain.ConcurrentModificationError{PaymentID: id, Expected: change.Version, Current: payment.Version}
+	}
+	if !payment.Status.CanTransitionTo(change.Status) {
+		return &domain.TransitionError{From: payment.Status, To: change.Status}
+	}
+
+	now := r.now().UTC()
+	payment.Status = change.Status
+	payment.UpdatedAt = now
+	payment.Version++
+	if change.ProviderPaymentID != "" {
+		payment.ProviderPaymentID = change.ProviderPaymentID
+	}
+	if change.Refund != nil {
+		payment.Refunds = append(slices.Clone(payment.Refunds), *change.Refund)
+		payment.RefundedAmount = change.RefundedAmount
+	}
+
+	r.payments[id] = payment
+	r.appendHistory(domain.NewStatusHistoryEntry(id, change.Status, change.Audit, now))
+	r.outbox.add(events...)
+	return nil
+}
+
+func (r *PaymentRepository) ListExpired(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+	r.mu.Lock()
+	var expired []domain.Payment
+	for _, payment := range r.payments {
+		if payment.Status == domain.StatusPending && payment.ExpiresAt != nil && !payment.ExpiresAt.After(now) {
+			expired = append(expired, clonePayment(payment))
+		}
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(expired, func(a, b domain.Payment) int {
+		return a.ExpiresAt.Compare(*b.ExpiresAt)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	return expired, nil
+}
+
+func (r *PaymentRepository) History(ctx context.Context, paymentID string) ([]domain.StatusHistoryEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]domain.StatusHistoryEntry{}, r.history[paymentID]...), nil
+}
+
+// appendHistory numera os registros na ordem de gravação. Deve ser chamado
+// com r.mu travado.
+func (r *PaymentRepository) appendHistory(entry domain.StatusHistoryEntry) {
+	entry.ChangedAt = entry.ChangedAt.UTC()
+	entry.EntryID = strconv.Itoa(len(r.history[entry.PaymentID]) + 1)
+	r.history[entry.PaymentID] = append(r.history[entry.PaymentID], entry)
+}
+
+// clonePayment evita que quem lê o pagamento altere o que está guardado.
+func clonePayment(payment domain.Payment) domain.Payment {
+	payment.Refunds = slices.Clone(payment.Refunds)
+	if payment.ExpiresAt != nil {
+		expiresAt := *payment.ExpiresAt
+		payment.ExpiresAt = &expiresAt
+	}
+	return payment
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/repository/repotest"
+)
+
+func TestPaymentRepository_Conformance(t *testing.T) {
+	repotest.RunPaymentRepositorySuite(t, func(t *testing.T) repotest.Fixture {
+		repo := NewPaymentRepository()
+		return repotest.Fixture{Payments: repo, Outbox: repo.Outbox()}
+	})
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID identifica o advisory lock que impede duas instâncias de
+// aplicarem as migrações ao mesmo tempo.
+const migrationLockID = 7_212_001
+
+// Migration é um arquivo de migrations/, identificado pelo nome sem a
+// extensão (ex.: "0001_create_payments").
+type Migration struct {
+	Version string
+	SQL     string
+}
+
+// Migrations lista as migrações embutidas em ordem de aplicação.
+func Migrations() ([]Migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		content, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		migrations = append(migrations, Migration{Version: version, SQL: string(content)})
+	}
+	return migrations, nil
+}
+
+// Migrate aplica, cada uma em sua transação, as migrações ainda não
+// registradas em schema_migrations e retorna as versões aplicadas.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// O advisory lock é da sessão, por isso tudo roda na mesma conexão.
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}()
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var newlyApplied []string
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, migration.SQL); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", migration.Version)
+			return err
+		})
+		if err != nil {
+			return newlyApplied, fmt.Errorf("migration %s: %w", migration.Version, err)
+		}
+		newlyApplied = append(newlyApplied, migration.Version)
+	}
+	return newlyApplied, nil
+}
+
+// PendingMigrations retorna as versões ainda não aplicadas, sem alterar o
+// banco.
+func PendingMigrations(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := map[string]bool{}
+	if exists {
+		if applied, err = appliedVersions(ctx, pool); err != nil {
+			return nil, err
+		}
+	}
+
+	var pending []string
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration.Version)
+		}
+	}
+	return pending, nil
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, db querier) (map[string]bool, error) {
+	rows, err := db.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations_AreOrderedAndNotEmpty(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i, migration := range migrations {
+		if strings.TrimSpace(migration.SQL) == "" {
+			t.Errorf("migration %s is empty", migration.Version)
+		}
+		if i > 0 && migrations[i-1].Version >= migration.Version {
+			t.Errorf("migrations out of order: %s before %s", migrations[i-1].Version, migration.Version)
+		}
+	}
+	if migrations[0].Version != "0001_create_payments" {
+		t.Errorf("unexpected first migration %s", migrations[0].Version)
+	}
+}
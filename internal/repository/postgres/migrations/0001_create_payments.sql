@@ -0,0 +1,62 @@
+-- Pagamentos, com as mesmas colunas do item do DynamoDB. Valores monetários
+-- ficam em unidades menores da moeda.
+CREATE TABLE payments (
+    id                  TEXT PRIMARY KEY,
+    external_reference  TEXT NOT NULL,
+    amount_units        BIGINT NOT NULL,
+    amount_currency     TEXT NOT NULL,
+    status              TEXT NOT NULL,
+    qr_code             TEXT NOT NULL DEFAULT '',
+    provider            TEXT NOT NULL DEFAULT '',
+    provider_charge_id  TEXT NOT NULL DEFAULT '',
+    provider_payment_id TEXT NOT NULL DEFAULT '',
+    refunded_units      BIGINT NOT NULL DEFAULT 0,
+    refunded_currency   TEXT NOT NULL DEFAULT '',
+    refunds             JSONB NOT NULL DEFAULT '[]',
+    expires_at          TIMESTAMPTZ,
+    created_at          TIMESTAMPTZ NOT NULL,
+    updated_at          TIMESTAMPTZ NOT NULL,
+    previous_attempt_id TEXT NOT NULL DEFAULT '',
+    version             BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX payments_created_at_idx ON payments (created_at, id);
+CREATE INDEX payments_external_reference_idx ON payments (external_reference, created_at, id);
+CREATE INDEX payments_pending_expires_at_idx ON payments (expires_at) WHERE status = 'pending';
+
+-- Tentativa vigente de cada referência externa (ordem de serviço).
+CREATE TABLE payment_external_references (
+    external_reference TEXT PRIMARY KEY,
+    payment_id         TEXT NOT NULL REFERENCES payments (id),
+    updated_at         TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE payment_status_history (
+    id              BIGSERIAL PRIMARY KEY,
+    payment_id      TEXT NOT NULL REFERENCES payments (id),
+    previous_status TEXT NOT NULL DEFAULT '',
+    new_status      TEXT NOT NULL,
+    source          TEXT NOT NULL,
+    provider_status TEXT NOT NULL DEFAULT '',
+    notification_id TEXT NOT NULL DEFAULT '',
+    actor           TEXT NOT NULL DEFAULT '',
+    changed_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX payment_status_history_payment_idx ON payment_status_history (payment_id, id);
+
+CREATE TABLE payment_outbox (
+    id              TEXT PRIMARY KEY,
+    event_type      TEXT NOT NULL,
+    payment_id      TEXT NOT NULL,
+    payload         JSONB NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX payment_outbox_status_idx ON payment_outbox (status, created_at);
@@ -0,0 +1,3 @@
+-- Contexto do trace em que o evento foi gerado (traceparent), usado pelo
+-- relay para continuar o trace ao publicar no SNS.
+ALTER TABLE payment_outbox ADD COLUMN trace_context JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+-- Reserva do evento pelo relay que vai publicá-lo, para que réplicas
+-- diferentes não publiquem o mesmo evento pendente.
+ALTER TABLE payment_outbox ADD COLUMN claimed_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE payment_outbox ADD COLUMN claim_expires_at TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- O header X-Actor não é autenticado: o valor informado pelo cliente da API
+-- sai de actor e passa para declared_actor.
+ALTER TABLE payment_status_history ADD COLUMN declared_actor TEXT NOT NULL DEFAULT '';
+UPDATE payment_status_history SET declared_actor = actor, actor = '' WHERE source = 'api';
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const outboxColumns = `id, event_type, payment_id, payload, status, attempts, last_error,
+	next_attempt_at, created_at, updated_at, sent_at, trace_context, claimed_by, claim_expires_at`
+
+// OutboxRepository lê e atualiza os eventos gravados pelo PaymentRepository.
+// O índice (status, created_at) permite buscar os pendentes sem varrer a
+// tabela.
+type OutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewOutboxRepository(pool *pgxpool.Pool) *OutboxRepository {
+	return &OutboxRepository{pool: pool}
+}
+
+func (r *OutboxRepository) ListPending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxEvent, error) {
+	return r.query(ctx, `SELECT `+outboxColumns+` FROM payment_outbox
+		WHERE status = $1 AND next_attempt_at <= $2 AND (claim_expires_at IS NULL OR claim_expires_at <= $2)
+		ORDER BY created_at LIMIT $3`, domain.OutboxPending, now, limit)
+}
+
+func (r *OutboxRepository) Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.OutboxEvent, error) {
+	events, err := r.query(ctx, `UPDATE payment_outbox
+		SET claimed_by = $2, claim_expires_at = $3, updated_at = $4
+		WHERE id = $1 AND status = $5 AND next_attempt_at <= $4 AND (claim_expires_at IS NULL OR claim_expires_at <= $4)
+		RETURNING `+outboxColumns, id, owner, expiresAt, now, domain.OutboxPending)
+	if err != nil {
+		return domain.OutboxEvent{}, err
+	}
+	if len(events) == 0 {
+		return domain.OutboxEvent{}, r.unavailable(ctx, id)
+	}
+	return events[0], nil
+}
+
+// ListStuck devolve primeiro os eventos que falharam definitivamente.
+func (r *OutboxRepository) ListStuck(ctx context.Context, olderThan time.Time, limit int) ([]domain.OutboxEvent, error) {
+	return r.query(ctx, `SELECT `+outboxColumns+` FROM payment_outbox
+		WHERE status = $1 OR (status = $2 AND created_at < $3)
+		ORDER BY status = $1 DESC, created_at LIMIT $4`,
+		domain.OutboxFailed, domain.OutboxPending, olderThan, limit)
+}
+
+func (r *OutboxRepository) UpdateDelivery(ctx context.Context, event domain.OutboxEvent) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE payment_outbox
+		SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5, updated_at = $6, sent_at = $7,
+			claimed_by = '', claim_expires_at = NULL
+		WHERE id = $1 AND ($8 = '' OR claimed_by = $8)`,
+		event.ID, event.Status, event.Attempts, event.LastError, event.NextAttemptAt, time.Now(), event.SentAt, event.ClaimedBy,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return r.unavailable(ctx, event.ID)
+	}
+	return nil
+}
+
+// unavailable explica por que um evento não foi alterado: ele não existe ou
+// está reservado por outro relay.
+func (r *OutboxRepository) unavailable(ctx context.Context, id string) error {
+	var exists bool
+	if err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM payment_outbox WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return domain.ErrOutboxEventNotFound
+	}
+	return domain.ErrOutboxEventClaimed
+}
+
+func (r *OutboxRepository) query(ctx context.Context, query string, args ...any) ([]domain.OutboxEvent, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	events, err := pgx.CollectRows(rows, scanOutboxEvent)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []domain.OutboxEvent{}
+	}
+	return events, nil
+}
+
+func scanOutboxEvent(row pgx.CollectableRow) (domain.OutboxEvent, error) {
+	var event domain.OutboxEvent
+	var payload, traceContext []byte
+	err := row.Scan(&event.ID, &event.EventType, &event.PaymentID, &payload, &event.Status,
+		&event.Attempts, &event.LastError, &event.NextAttemptAt, &event.CreatedAt, &event.UpdatedAt, &event.SentAt,
+		&traceContext, &event.ClaimedBy, &event.ClaimExpiresAt)
+	if err != nil {
+		return domain.OutboxEvent{}, err
+	}
+	event.Payload = payload
+	if err := json.Unmarshal(traceContext, &event.TraceContext); err != nil {
+		return domain.OutboxEvent{}, err
+	}
+	if len(event.TraceContext) == 0 {
+		event.TraceContext = nil
+	}
+	event.NextAttemptAt = event.NextAttemptAt.UTC()
+	event.CreatedAt = event.CreatedAt.UTC()
+	event.UpdatedAt = event.UpdatedAt.UTC()
+	if event.SentAt != nil {
+		sentAt := event.SentAt.UTC()
+		event.SentAt = &sentAt
+	}
+	if event.ClaimExpiresAt != nil {
+		claimExpiresAt := event.ClaimExpiresAt.UTC()
+		event.ClaimExpiresAt = &claimExpiresAt
+	}
+	return event, nil
+}
+
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, event domain.OutboxEvent) error {
+	traceContext := event.TraceContext
+	if traceContext == nil {
+		traceContext = map[string]string{}
+	}
+	traceJSON, err := json.Marshal(traceContext)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO payment_outbox (`+outboxColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		event.ID, event.EventType, event.PaymentID, string(event.Payload), event.Status, event.Attempts,
+		event.LastError, event.NextAttemptAt, event.CreatedAt, event.UpdatedAt, event.SentAt, string(traceJSON),
+		event.ClaimedBy, event.ClaimExpiresAt,
+	)
+	return err
+}
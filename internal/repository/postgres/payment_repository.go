@@ -0,0 +1,341 @@
+// Package postgres implementa os repositórios de pagamento e de outbox sobre
+// PostgreSQL, para quem hospeda o serviço fora da AWS. O esquema é criado
+// pelas migrações de migrations/ (ver Migrate).
+package postgres
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// uniqueViolation é o SQLSTATE de violação de chave única.
+const uniqueViolation = "23505"
+
+const paymentColumns = `id, external_reference, amount_units, amount_currency, status, qr_code, provider,
+	provider_charge_id, provider_payment_id, refunded_units, refunded_currency, refunds, expires_at,
+	created_at, updated_at, previous_attempt_id, version`
+
+// PaymentRepository grava os pagamentos e, na mesma transação, o histórico de
+// status (payment_status_history) e os eventos de outbox (payment_outbox). A
+// tabela payment_external_references guarda, por external_reference, a
+// tentativa de pagamento vigente.
+type PaymentRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPaymentRepository(pool *pgxpool.Pool) *PaymentRepository {
+	return &PaymentRepository{pool: pool}
+}
+
+func (r *PaymentRepository) Save(ctx context.Context, payment domain.Payment) error {
+	refunds, err := marshalRefunds(payment.Refunds)
+	if err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO payments (`+paymentColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+			payment.ID, payment.ExternalReference, payment.Amount.Units, payment.Amount.Currency,
+			payment.Status, payment.QRCode, payment.Provider, payment.ProviderChargeID,
+			payment.ProviderPaymentID, payment.RefundedAmount.Units, payment.RefundedAmount.Currency,
+			refunds, payment.ExpiresAt, payment.CreatedAt, payment.UpdatedAt,
+			payment.PreviousAttemptID, payment.Version,
+		)
+		if isUniqueViolation(err) {
+			return domain.ErrPaymentAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		// A guarda só troca de pagamento quando a tentativa nova declara
+		// substituir a vigente; o lock da linha serializa criações
+		// concorrentes para a mesma referência.
+		tag, err := tx.Exec(ctx, `INSERT INTO payment_external_references (external_reference, payment_id, updated_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (external_reference) DO UPDATE
+				SET payment_id = EXCLUDED.payment_id, updated_at = EXCLUDED.updated_at
+				WHERE payment_external_references.payment_id = $4`,
+			payment.ExternalReference, payment.ID, payment.CreatedAt, payment.PreviousAttemptID,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return domain.ErrDuplicateExternalReference
+		}
+
+		return insertHistory(ctx, tx, domain.NewStatusHistoryEntry(payment.ID, payment.Status, domain.StatusAudit{
+			Source:        domain.SourceAPI,
+			DeclaredActor: domain.DeclaredActorFromContext(ctx),
+		}, payment.CreatedAt))
+	})
+}
+
+func (r *PaymentRepository) GetByID(ctx context.Context, id string) (*domain.Payment, error) {
+	row := r.pool.QueryRow(ctx, `SELECT `+paymentColumns+` FROM payments WHERE id = $1`, id)
+	return scanOptionalPayment(row)
+}
+
+// GetByExternalReference segue a guarda da referência até a tentativa
+// vigente.
+func (r *PaymentRepository) GetByExternalReference(ctx context.Context, ref string) (*domain.Payment, error) {
+	row := r.pool.QueryRow(ctx, `SELECT `+paymentColumns+` FROM payments
+		WHERE id = (SELECT payment_id FROM payment_external_references WHERE external_reference = $1)`, ref)
+	return scanOptionalPayment(row)
+}
+
+// listCursor é a posição (created_at, id) do último item da página, usada na
+// paginação por keyset.
+type listCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+}
+
+// List ordena os pagamentos por criação e ID e pagina a partir do último item
+// devolvido.
+func (r *PaymentRepository) List(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Cursor != "" {
+		payload, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+		if err != nil {
+			return nil, domain.ErrInvalidCursor
+		}
+		var cursor listCursor
+		if err := json.Unmarshal(payload, &cursor); err != nil || cursor.ID == "" {
+			return nil, domain.ErrInvalidCursor
+		}
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+	if filter.ExternalReference != "" {
+		where("external_reference = $%d", filter.ExternalReference)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.CreatedFrom != nil {
+		where("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		where("created_at <= $%d", *filter.CreatedTo)
+	}
+	if filter.UpdatedFrom != nil {
+		where("updated_at >= $%d", *filter.UpdatedFrom)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = domain.DefaultPageLimit
+	}
+	if limit > domain.MaxPageLimit {
+		limit = domain.MaxPageLimit
+	}
+
+	query := `SELECT ` + paymentColumns + ` FROM payments`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Um item a mais indica se há próxima página.
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY created_at, id LIMIT $%d", len(args))
+
+	payments, err := r.queryPayments(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.PaymentPage{Items: payments}
+	if len(payments) > limit {
+		page.Items = payments[:limit]
+		last := page.Items[limit-1]
+		payload, err := json.Marshal(listCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(payload)
+	}
+	return page, nil
+}
+
+// ListExpired usa o índice parcial dos pagamentos pendentes por expires_at.
+func (r *PaymentRepository) ListExpired(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+	return r.queryPayments(ctx, `SELECT `+paymentColumns+` FROM payments
+		WHERE status = $1 AND expires_at <= $2
+		ORDER BY expires_at LIMIT $3`, domain.StatusPending, now, limit)
+}
+
+// UpdateStatus trava a linha do pagamento e só grava o novo status se ele
+// ainda estiver na versão lida e o estado atual permitir a transição. O
+// registro de histórico e os eventos do outbox entram na mesma transação.
+func (r *PaymentRepository) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var current domain.Payment
+		err := tx.QueryRow(ctx, `SELECT status, version FROM payments WHERE id = $1 FOR UPDATE`, id).
+			Scan(&current.Status, &current.Version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrPaymentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if current.Version != change.Version {
+			return &domain.ConcurrentModificationError{PaymentID: id, Expected: change.Version, Current: current.Version}
+		}
+		if !current.Status.CanTransitionTo(change.Status) {
+			return &domain.TransitionError{From: current.Status, To: change.Status}
+		}
+
+		now := time.Now().UTC()
+		args := []any{id, change.Status, now, change.Version + 1}
+		sets := []string{"status = $2", "updated_at = $3", "version = $4"}
+		if change.ProviderPaymentID != "" {
+			args = append(args, change.ProviderPaymentID)
+			sets = append(sets, fmt.Sprintf("provider_payment_id = $%d", len(args)))
+		}
+		if change.Refund != nil {
+			refund, err := marshalRefunds([]domain.Refund{*change.Refund})
+			if err != nil {
+				return err
+			}
+			// O total é calculado pelo serviço a partir da versão lida.
+			args = append(args, refund, change.RefundedAmount.Units, change.RefundedAmount.Currency)
+			sets = append(sets,
+				fmt.Sprintf("refunds = refunds || $%d::jsonb", len(args)-2),
+				fmt.Sprintf("refunded_units = $%d", len(args)-1),
+				fmt.Sprintf("refunded_currency = $%d", len(args)),
+			)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE payments SET `+strings.Join(sets, ", ")+` WHERE id = $1`, args...); err != nil {
+			return err
+		}
+
+		if err := insertHistory(ctx, tx, domain.NewStatusHistoryEntry(id, change.Status, change.Audit, now)); err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := insertOutboxEvent(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// History retorna os registros do pagamento na ordem de gravação; o EntryID é
+// o ID sequencial da linha.
+func (r *PaymentRepository) History(ctx context.Context, paymentID string) ([]domain.StatusHistoryEntry, error) {
+	rows, err := r.pool.Query(ctx, `SELECT id, payment_id, previous_status, new_status, source,
+			provider_status, notification_id, actor, declared_actor, changed_at
+		FROM payment_status_history WHERE payment_id = $1 ORDER BY id`, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.StatusHistoryEntry, error) {
+		var entry domain.StatusHistoryEntry
+		var id int64
+		err := row.Scan(&id, &entry.PaymentID, &entry.PreviousStatus, &entry.NewStatus, &entry.Source,
+			&entry.ProviderStatus, &entry.NotificationID, &entry.Actor, &entry.DeclaredActor, &entry.ChangedAt)
+		entry.EntryID = strconv.FormatInt(id, 10)
+		entry.ChangedAt = entry.ChangedAt.UTC()
+		return entry, err
+	})
+}
+
+func insertHistory(ctx context.Context, tx pgx.Tx, entry domain.StatusHistoryEntry) error {
+	_, err := tx.Exec(ctx, `INSERT INTO payment_status_history
+			(payment_id, previous_status, new_status, source, provider_status, notification_id, actor, declared_actor, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		entry.PaymentID, entry.PreviousStatus, entry.NewStatus, entry.Source,
+		entry.ProviderStatus, entry.NotificationID, entry.Actor, entry.DeclaredActor, entry.ChangedAt,
+	)
+	return err
+}
+
+func (r *PaymentRepository) queryPayments(ctx context.Context, query string, args ...any) ([]domain.Payment, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.Payment, error) {
+		return scanPayment(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if payments == nil {
+		payments = []domain.Payment{}
+	}
+	return payments, nil
+}
+
+func scanOptionalPayment(row pgx.Row) (*domain.Payment, error) {
+	payment, err := scanPayment(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// scanPayment lê as colunas de paymentColumns, devolvendo as datas em UTC.
+func scanPayment(row pgx.Row) (domain.Payment, error) {
+	var payment domain.Payment
+	var refunds []byte
+	err := row.Scan(
+		&payment.ID, &payment.ExternalReference, &payment.Amount.Units, &payment.Amount.Currency,
+		&payment.Status, &payment.QRCode, &payment.Provider, &payment.ProviderChargeID,
+		&payment.ProviderPaymentID, &payment.RefundedAmount.Units, &payment.RefundedAmount.Currency,
+		&refunds, &payment.ExpiresAt, &payment.CreatedAt, &payment.UpdatedAt,
+		&payment.PreviousAttemptID, &payment.Version,
+	)
+	if err != nil {
+		return domain.Payment{}, err
+	}
+	if err := json.Unmarshal(refunds, &payment.Refunds); err != nil {
+		return domain.Payment{}, err
+	}
+	if len(payment.Refunds) == 0 {
+		payment.Refunds = nil
+	}
+	if payment.ExpiresAt != nil {
+		expiresAt := payment.ExpiresAt.UTC()
+		payment.ExpiresAt = &expiresAt
+	}
+	payment.CreatedAt = payment.CreatedAt.UTC()
+	payment.UpdatedAt = payment.UpdatedAt.UTC()
+	return payment, nil
+}
+
+func marshalRefunds(refunds []domain.Refund) (string, error) {
+	if refunds == nil {
+		refunds = []domain.Refund{}
+	}
+	payload, err := json.Marshal(refunds)
+	return string(payload), err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
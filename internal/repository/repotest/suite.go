@@ -0,0 +1,591 @@
+// Package repotest reúne a suíte de conformidade que toda implementação de
+// domain.PaymentRepository deve passar. Os testes criam IDs e referências
+// únicos, então podem rodar contra um banco compartilhado e já populado.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/google/uuid"
+)
+
+// Fixture é o par de repositórios sob teste: o outbox deve enxergar os eventos
+// gravados por Payments.UpdateStatus.
+type Fixture struct {
+	Payments domain.PaymentRepository
+	Outbox   domain.OutboxRepository
+}
+
+// now tem precisão de milissegundos, suportada por todos os bancos.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func newPayment(ref string) domain.Payment {
+	createdAt := now()
+	expiresAt := createdAt.Add(30 * time.Minute)
+	return domain.Payment{
+		ID:                uuid.NewString(),
+		ExternalReference: ref,
+		Amount:            domain.NewMoney(10050, "BRL"),
+		Status:            domain.StatusPending,
+		QRCode:            "qr-data",
+		Provider:          "mercadopago",
+		ProviderChargeID:  "charge-" + ref,
+		ExpiresAt:         &expiresAt,
+		CreatedAt:         createdAt,
+		UpdatedAt:         createdAt,
+		Version:           1,
+	}
+}
+
+func newReference() string {
+	return "OS-" + uuid.NewString()
+}
+
+// RunPaymentRepositorySuite executa a suíte contra o repositório devolvido por
+// newFixture, chamado uma vez por subteste.
+func RunPaymentRepositorySuite(t *testing.T, newFixture func(t *testing.T) Fixture) {
+	ctx := context.Background()
+
+	t.Run("SaveAndGet", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		payment := newPayment(newReference())
+		if err := repo.Save(ctx, payment); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		got, err := repo.GetByID(ctx, payment.ID)
+		if err != nil || got == nil {
+			t.Fatalf("expected payment, got %v (%v)", got, err)
+		}
+		assertSamePayment(t, payment, *got)
+
+		got, err = repo.GetByExternalReference(ctx, payment.ExternalReference)
+		if err != nil || got == nil || got.ID != payment.ID {
+			t.Fatalf("expected payment by reference, got %+v (%v)", got, err)
+		}
+	})
+
+	t.Run("GetMissing", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		if got, err := repo.GetByID(ctx, uuid.NewString()); got != nil || err != nil {
+			t.Errorf("expected nil payment and no error, got %+v (%v)", got, err)
+		}
+		if got, err := repo.GetByExternalReference(ctx, newReference()); got != nil || err != nil {
+			t.Errorf("expected nil payment and no error, got %+v (%v)", got, err)
+		}
+	})
+
+	t.Run("SaveRejectsDuplicateID", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		payment := newPayment(newReference())
+		if err := repo.Save(ctx, payment); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		duplicate := payment
+		duplicate.ExternalReference = newReference()
+		if err := repo.Save(ctx, duplicate); !errors.Is(err, domain.ErrPaymentAlreadyExists) {
+			t.Fatalf("expected ErrPaymentAlreadyExists, got %v", err)
+		}
+	})
+
+	t.Run("SaveRejectsDuplicateReference", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		first := newPayment(newReference())
+		if err := repo.Save(ctx, first); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		second := newPayment(first.ExternalReference)
+		if err := repo.Save(ctx, second); !errors.Is(err, domain.ErrDuplicateExternalReference) {
+			t.Fatalf("expected ErrDuplicateExternalReference, got %v", err)
+		}
+		if got, _ := repo.GetByID(ctx, second.ID); got != nil {
+			t.Errorf("expected the rejected payment not to be stored, got %+v", got)
+		}
+	})
+
+	t.Run("SaveSupersedesPreviousAttempt", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		first := newPayment(newReference())
+		if err := repo.Save(ctx, first); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		retry := newPayment(first.ExternalReference)
+		retry.PreviousAttemptID = first.ID
+		if err := repo.Save(ctx, retry); err != nil {
+			t.Fatalf("expected retry to replace the previous attempt, got %v", err)
+		}
+		got, err := repo.GetByExternalReference(ctx, first.ExternalReference)
+		if err != nil || got == nil || got.ID != retry.ID || got.PreviousAttemptID != first.ID {
+			t.Fatalf("expected the retry as current attempt, got %+v (%v)", got, err)
+		}
+
+		stale := newPayment(first.ExternalReference)
+		stale.PreviousAttemptID = first.ID
+		if err := repo.Save(ctx, stale); !errors.Is(err, domain.ErrDuplicateExternalReference) {
+			t.Fatalf("expected a retry of a replaced attempt to fail, got %v", err)
+		}
+	})
+
+	t.Run("ConcurrentSavesForSameReference", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		ref := newReference()
+
+		const writers = 5
+		errs := make([]error, writers)
+		var wg sync.WaitGroup
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = repo.Save(ctx, newPayment(ref))
+			}()
+		}
+		wg.Wait()
+
+		saved := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				saved++
+			case !errors.Is(err, domain.ErrDuplicateExternalReference):
+				t.Errorf("expected ErrDuplicateExternalReference, got %v", err)
+			}
+		}
+		if saved != 1 {
+			t.Errorf("expected exactly one payment for the reference, got %d", saved)
+		}
+	})
+
+	t.Run("UpdateStatus", func(t *testing.T) {
+		fixture := newFixture(t)
+		repo := fixture.Payments
+		payment := newPayment(newReference())
+		if err := repo.Save(ctx, payment); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		event, err := domain.NewOutboxEvent(uuid.NewString(), domain.EventTypePaymentProcessed, payment.ID,
+			domain.PaymentProcessedEvent{PaymentID: payment.ID, Status: domain.StatusApproved}, now())
+		if err != nil {
+			t.Fatalf("failed to build event: %v", err)
+		}
+		traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		event.TraceContext = map[string]string{"traceparent": traceparent}
+		err = repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{
+			Status:            domain.StatusApproved,
+			ProviderPaymentID: "provider-payment-1",
+			Version:           payment.Version,
+			Audit: domain.StatusAudit{
+				PreviousStatus: domain.StatusPending,
+				Source:         domain.SourceWebhook,
+				ProviderStatus: "approved",
+				NotificationID: "notification-1",
+				Actor:          "mercadopago",
+			},
+		}, event)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		got, _ := repo.GetByID(ctx, payment.ID)
+		if got.Status != domain.StatusApproved || got.ProviderPaymentID != "provider-payment-1" || got.Version != payment.Version+1 {
+			t.Errorf("expected approved payment at version %d, got %+v", payment.Version+1, got)
+		}
+		if got.UpdatedAt.Before(payment.UpdatedAt) {
+			t.Errorf("expected updated_at to move forward, got %s", got.UpdatedAt)
+		}
+
+		history, err := repo.History(ctx, payment.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(history) != 2 {
+			t.Fatalf("expected 2 history entries, got %+v", history)
+		}
+		entry := history[1]
+		if entry.EntryID == "" || entry.PaymentID != payment.ID || entry.NewStatus != domain.StatusApproved ||
+			entry.PreviousStatus != domain.StatusPending || entry.Source != domain.SourceWebhook ||
+			entry.ProviderStatus != "approved" || entry.NotificationID != "notification-1" || entry.Actor != "mercadopago" {
+			t.Errorf("unexpected history entry: %+v", entry)
+		}
+
+		pending, err := fixture.Outbox.ListPending(ctx, now().Add(time.Second), 1000)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		found := false
+		for _, pendingEvent := range pending {
+			if pendingEvent.ID == event.ID {
+				found = true
+				if pendingEvent.TraceContext["traceparent"] != traceparent {
+					t.Errorf("expected the trace context to be stored, got %v", pendingEvent.TraceContext)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected event %s in the outbox", event.ID)
+		}
+
+		sentAt := now()
+		event.Status, event.Attempts, event.SentAt = domain.OutboxSent, 1, &sentAt
+		if err := fixture.Outbox.UpdateDelivery(ctx, event); err != nil {
+			t.Errorf("expected delivery update, got %v", err)
+		}
+	})
+
+	t.Run("UpdateStatusRejectsStaleVersion", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		payment := newPayment(newReference())
+		if err := repo.Save(ctx, payment); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: domain.StatusAuthorized, Version: payment.Version}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: domain.StatusApproved, Version: payment.Version})
+		var concurrentErr *domain.ConcurrentModificationError
+		if !errors.As(err, &concurrentErr) || concurrentErr.Current != payment.Version+1 {
+			t.Fatalf("expected ConcurrentModificationError at version %d, got %v", payment.Version+1, err)
+		}
+	})
+
+	t.Run("UpdateStatusRejectsInvalidTransition", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		payment := newPayment(newReference())
+		if err := repo.Save(ctx, payment); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: domain.StatusRefunded, Version: payment.Version})
+		var transitionErr *domain.TransitionError
+		if !errors.As(err, &transitionErr) || transitionErr.From != domain.StatusPending {
+			t.Fatalf("expected TransitionError from pending, got %v", err)
+		}
+		if history, _ := repo.History(ctx, payment.ID); len(history) != 1 {
+			t.Errorf("expected no history for a rejected transition, got %+v", history)
+		}
+	})
+
+	t.Run("UpdateStatusMissingPayment", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		err := repo.UpdateStatus(ctx, uuid.NewString(), domain.StatusChange{Status: domain.StatusApproved, Version: 1})
+		if !errors.Is(err, domain.ErrPaymentNotFound) {
+			t.Fatalf("expected ErrPaymentNotFound, got %v", err)
+		}
+	})
+
+	t.Run("RecordRefunds", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		payment := newPayment(newReference())
+		payment.Status = domain.StatusApproved
+		if err := repo.Save(ctx, payment); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		version := payment.Version
+		total := domain.NewMoney(0, "BRL")
+		for i, units := range []int64{3000, 2000} {
+			refund := domain.Refund{ID: uuid.NewString(), ProviderRefundID: "refund", Amount: domain.NewMoney(units, "BRL"), Status: "approved", CreatedAt: now()}
+			total = total.Add(refund.Amount)
+			err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{
+				Status:         domain.StatusPartiallyRefunded,
+				Refund:         &refund,
+				RefundedAmount: total,
+				Version:        version,
+			})
+			if err != nil {
+				t.Fatalf("refund %d: expected no error, got %v", i, err)
+			}
+			version++
+		}
+
+		got, _ := repo.GetByID(ctx, payment.ID)
+		if len(got.Refunds) != 2 || got.RefundedAmount != domain.NewMoney(5000, "BRL") {
+			t.Fatalf("expected two refunds totalling 50.00, got %+v (total %v)", got.Refunds, got.RefundedAmount)
+		}
+		if got.Refunds[0].Amount != domain.NewMoney(3000, "BRL") || got.Refunds[1].Amount != domain.NewMoney(2000, "BRL") {
+			t.Errorf("expected refunds in order, got %+v", got.Refunds)
+		}
+	})
+
+	t.Run("ListExpired", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		expired := newPayment(newReference())
+		expiresAt := now().Add(-time.Hour)
+		expired.ExpiresAt = &expiresAt
+		valid := newPayment(newReference())
+		for _, payment := range []domain.Payment{expired, valid} {
+			if err := repo.Save(ctx, payment); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+
+		payments, err := repo.ListExpired(ctx, now(), 1000)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		ids := paymentIDs(payments)
+		if !ids[expired.ID] || ids[valid.ID] {
+			t.Errorf("expected only the expired payment, got %v", ids)
+		}
+
+		// Expira o pagamento para não acumular pendentes em bancos reaproveitados.
+		if err := repo.UpdateStatus(ctx, expired.ID, domain.StatusChange{Status: domain.StatusExpired, Version: expired.Version}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		payments, _ = repo.ListExpired(ctx, now(), 1000)
+		if paymentIDs(payments)[expired.ID] {
+			t.Errorf("expected expired payment to leave the pending list")
+		}
+	})
+
+	t.Run("ListFiltersAndPaginates", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		ref := newReference()
+		saved := map[string]bool{}
+		previous := ""
+		for range 3 {
+			payment := newPayment(ref)
+			payment.PreviousAttemptID = previous
+			if err := repo.Save(ctx, payment); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			saved[payment.ID] = true
+			previous = payment.ID
+		}
+		if err := repo.UpdateStatus(ctx, previous, domain.StatusChange{Status: domain.StatusApproved, Version: 1}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		listed := map[string]bool{}
+		filter := domain.PaymentFilter{ExternalReference: ref, Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > len(saved) {
+				t.Fatalf("pagination did not finish")
+			}
+			page, err := repo.List(ctx, filter)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(page.Items) > filter.Limit {
+				t.Fatalf("expected at most %d items, got %d", filter.Limit, len(page.Items))
+			}
+			for _, payment := range page.Items {
+				if listed[payment.ID] {
+					t.Errorf("payment %s listed twice", payment.ID)
+				}
+				listed[payment.ID] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+		if len(listed) != len(saved) {
+			t.Errorf("expected %v, got %v", saved, listed)
+		}
+
+		page, err := repo.List(ctx, domain.PaymentFilter{ExternalReference: ref, Status: domain.StatusApproved})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != previous {
+			t.Errorf("expected only the approved payment, got %+v", page.Items)
+		}
+
+		future := now().Add(time.Hour)
+		page, err = repo.List(ctx, domain.PaymentFilter{ExternalReference: ref, CreatedFrom: &future})
+		if err != nil || len(page.Items) != 0 {
+			t.Errorf("expected no payments created in the future, got %+v (%v)", page, err)
+		}
+
+		if _, err := repo.List(ctx, domain.PaymentFilter{Cursor: "not-a-cursor"}); !errors.Is(err, domain.ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+
+	t.Run("HistoryOrder", func(t *testing.T) {
+		repo := newFixture(t).Payments
+		payment := newPayment(newReference())
+		if err := repo.Save(domain.ContextWithDeclaredActor(ctx, "operator@oficina"), payment); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		statuses := []domain.PaymentStatus{domain.StatusAuthorized, domain.StatusRejected, domain.StatusApproved}
+		for i, status := range statuses {
+			// Garante datas distintas mesmo em relógios de baixa resolução.
+			time.Sleep(2 * time.Millisecond)
+			if err := repo.UpdateStatus(ctx, payment.ID, domain.StatusChange{Status: status, Version: payment.Version + int64(i)}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+
+		history, err := repo.History(ctx, payment.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := append([]domain.PaymentStatus{domain.StatusPending}, statuses...)
+		if len(history) != len(expected) {
+			t.Fatalf("expected %d entries, got %+v", len(expected), history)
+		}
+		for i, entry := range history {
+			if entry.NewStatus != expected[i] {
+				t.Errorf("entry %d: expected %s, got %s", i, expected[i], entry.NewStatus)
+			}
+		}
+		if history[0].Source != domain.SourceAPI || history[0].Actor != "" || history[0].DeclaredActor != "operator@oficina" || !history[0].ChangedAt.Equal(payment.CreatedAt) {
+			t.Errorf("unexpected creation entry: %+v", history[0])
+		}
+
+		empty, err := repo.History(ctx, uuid.NewString())
+		if err != nil || empty == nil || len(empty) != 0 {
+			t.Errorf("expected empty history, got %+v (%v)", empty, err)
+		}
+	})
+
+	t.Run("OutboxUpdateMissingEvent", func(t *testing.T) {
+		outbox := newFixture(t).Outbox
+		err := outbox.UpdateDelivery(ctx, domain.OutboxEvent{ID: uuid.NewString(), Status: domain.OutboxSent})
+		if !errors.Is(err, domain.ErrOutboxEventNotFound) {
+			t.Fatalf("expected ErrOutboxEventNotFound, got %v", err)
+		}
+		at := now()
+		if _, err := outbox.Claim(ctx, uuid.NewString(), "relay-a", at, at.Add(time.Minute)); !errors.Is(err, domain.ErrOutboxEventNotFound) {
+			t.Fatalf("expected ErrOutboxEventNotFound, got %v", err)
+		}
+	})
+
+	t.Run("OutboxClaim", func(t *testing.T) {
+		fixture := newFixture(t)
+		at := now()
+		event := saveOutboxEvent(t, fixture, at)
+		outbox := fixture.Outbox
+
+		claimed, err := outbox.Claim(ctx, event.ID, "relay-a", at, at.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("expected claim, got %v", err)
+		}
+		if claimed.ID != event.ID || claimed.ClaimedBy != "relay-a" || claimed.ClaimExpiresAt == nil ||
+			!claimed.ClaimExpiresAt.Equal(at.Add(time.Minute)) || string(claimed.Payload) != string(event.Payload) {
+			t.Errorf("unexpected claimed event: %+v", claimed)
+		}
+		if _, err := outbox.Claim(ctx, event.ID, "relay-b", at.Add(time.Second), at.Add(time.Minute)); !errors.Is(err, domain.ErrOutboxEventClaimed) {
+			t.Fatalf("expected ErrOutboxEventClaimed while the claim is active, got %v", err)
+		}
+		if pendingIDs(t, outbox, at.Add(time.Second))[event.ID] {
+			t.Errorf("expected claimed event %s not to be listed as pending", event.ID)
+		}
+
+		// Com a reserva vencida, outro relay assume o evento e o primeiro não
+		// consegue mais gravar a entrega.
+		expired := at.Add(2 * time.Minute)
+		if !pendingIDs(t, outbox, expired)[event.ID] {
+			t.Errorf("expected event %s to be pending after the claim expired", event.ID)
+		}
+		if claimed, err = outbox.Claim(ctx, event.ID, "relay-b", expired, expired.Add(time.Minute)); err != nil {
+			t.Fatalf("expected claim after expiry, got %v", err)
+		}
+		stale := claimed
+		stale.ClaimedBy = "relay-a"
+		stale.Status = domain.OutboxSent
+		if err := outbox.UpdateDelivery(ctx, stale); !errors.Is(err, domain.ErrOutboxEventClaimed) {
+			t.Fatalf("expected ErrOutboxEventClaimed for a lost claim, got %v", err)
+		}
+
+		sentAt := expired
+		claimed.Status, claimed.Attempts, claimed.SentAt = domain.OutboxSent, 1, &sentAt
+		if err := outbox.UpdateDelivery(ctx, claimed); err != nil {
+			t.Fatalf("expected delivery update, got %v", err)
+		}
+		if _, err := outbox.Claim(ctx, event.ID, "relay-c", expired.Add(time.Hour), expired.Add(2*time.Hour)); !errors.Is(err, domain.ErrOutboxEventClaimed) {
+			t.Fatalf("expected ErrOutboxEventClaimed for a sent event, got %v", err)
+		}
+	})
+
+	t.Run("OutboxPendingComparesFractionalSeconds", func(t *testing.T) {
+		fixture := newFixture(t)
+		second := now().Truncate(time.Second)
+		event := saveOutboxEvent(t, fixture, second.Add(500*time.Millisecond))
+
+		if pendingIDs(t, fixture.Outbox, second)[event.ID] {
+			t.Errorf("expected event %s not to be due before its next attempt", event.ID)
+		}
+		if _, err := fixture.Outbox.Claim(ctx, event.ID, "relay-a", second, second.Add(time.Minute)); !errors.Is(err, domain.ErrOutboxEventClaimed) {
+			t.Errorf("expected ErrOutboxEventClaimed before the next attempt, got %v", err)
+		}
+		if !pendingIDs(t, fixture.Outbox, second.Add(time.Second))[event.ID] {
+			t.Errorf("expected event %s to be due after its next attempt", event.ID)
+		}
+	})
+}
+
+// saveOutboxEvent grava, pela mudança de status de um pagamento novo, um
+// evento pendente cuja próxima tentativa é nextAttemptAt.
+func saveOutboxEvent(t *testing.T, fixture Fixture, nextAttemptAt time.Time) domain.OutboxEvent {
+	t.Helper()
+	ctx := context.Background()
+	payment := newPayment(newReference())
+	if err := fixture.Payments.Save(ctx, payment); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	event, err := domain.NewOutboxEvent(uuid.NewString(), domain.EventTypePaymentProcessed, payment.ID,
+		domain.PaymentProcessedEvent{PaymentID: payment.ID, Status: domain.StatusApproved}, nextAttemptAt)
+	if err != nil {
+		t.Fatalf("failed to build event: %v", err)
+	}
+	err = fixture.Payments.UpdateStatus(ctx, payment.ID, domain.StatusChange{
+		Status:  domain.StatusApproved,
+		Version: payment.Version,
+		Audit:   domain.StatusAudit{PreviousStatus: domain.StatusPending, Source: domain.SourceWebhook},
+	}, event)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return event
+}
+
+// pendingIDs lista os IDs dos eventos pendentes em at.
+func pendingIDs(t *testing.T, outbox domain.OutboxRepository, at time.Time) map[string]bool {
+	t.Helper()
+	pending, err := outbox.ListPending(context.Background(), at, 1000)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ids := map[string]bool{}
+	for _, event := range pending {
+		ids[event.ID] = true
+	}
+	return ids
+}
+
+func assertSamePayment(t *testing.T, want, got domain.Payment) {
+	t.Helper()
+	if got.ID != want.ID || got.ExternalReference != want.ExternalReference || got.Amount != want.Amount ||
+		got.Status != want.Status || got.QRCode != want.QRCode || got.Provider != want.Provider ||
+		got.ProviderChargeID != want.ProviderChargeID || got.PreviousAttemptID != want.PreviousAttemptID ||
+		got.Version != want.Version || len(got.Refunds) != 0 {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(*want.ExpiresAt) ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("expected dates %v/%v/%v, got %v/%v/%v", want.ExpiresAt, want.CreatedAt, want.UpdatedAt, got.ExpiresAt, got.CreatedAt, got.UpdatedAt)
+	}
+}
+
+func paymentIDs(payments []domain.Payment) map[string]bool {
+	ids := make(map[string]bool, len(payments))
+	for _, payment := range payments {
+		ids[payment.ID] = true
+	}
+	return ids
+}
@@ -0,0 +1,46 @@
+package resilience
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff calcula a espera entre tentativas: exponencial a partir de Base,
+// limitada a Max, com jitter completo para que clientes não repitam em
+// sincronia.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay retorna a espera antes da tentativa seguinte à attempt (0 é a
+// primeira tentativa).
+func (b Backoff) Delay(attempt int) time.Duration {
+	ceiling := b.Base
+	for i := 0; i < attempt && ceiling < b.Max; i++ {
+		ceiling *= 2
+	}
+	if ceiling > b.Max {
+		ceiling = b.Max
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// Sleep espera d ou até o contexto ser cancelado.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
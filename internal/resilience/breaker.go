@@ -0,0 +1,150 @@
+// Package resilience reúne as proteções usadas nas chamadas a serviços
+// externos: disjuntor (circuit breaker) e backoff exponencial com jitter.
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen é retornado sem chamar a dependência enquanto o disjuntor
+// está aberto.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// BreakerConfig configura o disjuntor. Valores zerados usam os padrões.
+type BreakerConfig struct {
+	// FailureThreshold é o número de falhas consecutivas que abre o disjuntor.
+	FailureThreshold int
+	// OpenTimeout é quanto tempo o disjuntor fica aberto antes de deixar
+	// passar uma chamada de teste.
+	OpenTimeout time.Duration
+	// OnStateChange é chamado fora da trava a cada mudança de estado.
+	OnStateChange func(from, to State)
+}
+
+// CircuitBreaker abre após FailureThreshold falhas consecutivas e rejeita as
+// chamadas por OpenTimeout. Depois disso uma única chamada de teste (estado
+// half_open) decide se ele fecha ou volta a abrir.
+type CircuitBreaker struct {
+	name string
+	cfg  BreakerConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(name string, cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultOpenTimeout
+	}
+	return &CircuitBreaker{
+		name:  name,
+		cfg:   cfg,
+		now:   time.Now,
+		state: StateClosed,
+	}
+}
+
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+// State retorna o estado atual, considerando o fim do tempo de abertura.
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow informa se a chamada pode seguir. Toda chamada permitida deve ser
+// seguida de Success, Failure ou Abandon.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			b.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+	case StateHalfOpen:
+		if b.probing {
+			b.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return nil
+}
+
+// Success registra uma chamada bem-sucedida e fecha o disjuntor.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	from := b.state
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+	b.mu.Unlock()
+
+	b.notify(from, StateClosed)
+}
+
+// Failure registra uma falha da dependência.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	from := b.state
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = StateOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// Abandon libera uma chamada permitida sem contá-la como sucesso nem como
+// falha, como uma interrompida pelo chamador ou recusada por limite de taxa.
+func (b *CircuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) notify(from, to State) {
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
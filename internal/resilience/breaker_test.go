@@ -0,0 +1,92 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	var transitions []State
+	b := NewCircuitBreaker("mp", BreakerConfig{
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+		OnStateChange:    func(from, to State) { transitions = append(transitions, to) },
+	})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("expected call %d to be allowed, got %v", i, err)
+		}
+		b.Failure()
+	}
+	// Um sucesso zera a contagem de falhas consecutivas.
+	_ = b.Allow()
+	b.Success()
+	for i := 0; i < 3; i++ {
+		_ = b.Allow()
+		b.Failure()
+	}
+
+	if b.State() != StateOpen {
+		t.Fatalf("expected open breaker, got %s", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("expected half-open after the timeout, got %s", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected only one probe while half-open, got %v", err)
+	}
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("expected failed probe to reopen, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	_ = b.Allow()
+	b.Success()
+	if b.State() != StateClosed {
+		t.Fatalf("expected successful probe to close, got %s", b.State())
+	}
+
+	expected := []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}
+	if len(transitions) != len(expected) {
+		t.Fatalf("expected transitions %v, got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("transition %d: expected %s, got %s", i, expected[i], transitions[i])
+		}
+	}
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Base: 100 * time.Millisecond, Max: time.Second}
+	ceilings := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for attempt, ceiling := range ceilings {
+		for i := 0; i < 50; i++ {
+			if d := b.Delay(attempt); d < 0 || d > ceiling {
+				t.Fatalf("attempt %d: delay %s outside [0, %s]", attempt, d, ceiling)
+			}
+		}
+	}
+}
+
+func TestSleep_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+// Com a política retry_after_failure uma referência pode ter várias
+// tentativas, e o gateway devolve os pagamentos de todas elas. As funções
+// abaixo identificam a tentativa dona de um pagamento do gateway pela
+// cobrança em que ele foi feito.
+
+// attemptForPayment percorre as tentativas da referência, da mais recente para
+// a mais antiga, e retorna a que recebeu o pagamento do gateway. Com uma única
+// tentativa, ela é a dona; sem nenhuma dona, retorna nil.
+func (s *PaymentService) attemptForPayment(ctx context.Context, provider domain.PaymentProvider, latest *domain.Payment, providerPaymentID string) (*domain.Payment, error) {
+	if latest.PreviousAttemptID == "" {
+		return latest, nil
+	}
+
+	attempt := latest
+	for {
+		owns, err := ownsPayment(ctx, provider, attempt, providerPaymentID)
+		if err != nil {
+			return nil, err
+		}
+		if owns {
+			return attempt, nil
+		}
+		if attempt.PreviousAttemptID == "" {
+			return nil, nil
+		}
+		if attempt, err = s.repo.GetByID(ctx, attempt.PreviousAttemptID); err != nil || attempt == nil {
+			return nil, err
+		}
+	}
+}
+
+// attemptPayments filtra, entre os pagamentos do gateway da referência, os da
+// tentativa. Referências com uma única tentativa não são filtradas.
+func (s *PaymentService) attemptPayments(ctx context.Context, provider domain.PaymentProvider, payment *domain.Payment, results []domain.ProviderPayment) ([]domain.ProviderPayment, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+	if payment.PreviousAttemptID == "" {
+		latest, err := s.repo.GetByExternalReference(ctx, payment.ExternalReference)
+		if err != nil {
+			return nil, err
+		}
+		if latest == nil || latest.ID == payment.ID {
+			return results, nil
+		}
+	}
+
+	paymentIDs, err := chargePayments(ctx, provider, payment)
+	if err != nil {
+		return nil, err
+	}
+	var owned []domain.ProviderPayment
+	for _, result := range results {
+		if result.ID == payment.ProviderPaymentID || slices.Contains(paymentIDs, result.ID) {
+			owned = append(owned, result)
+		}
+	}
+	return owned, nil
+}
+
+// ownsPayment diz se o pagamento do gateway foi feito na cobrança da tentativa.
+func ownsPayment(ctx context.Context, provider domain.PaymentProvider, attempt *domain.Payment, providerPaymentID string) (bool, error) {
+	if attempt.ProviderName() != provider.Name() {
+		return false, nil
+	}
+	if attempt.ProviderPaymentID == providerPaymentID {
+		return true, nil
+	}
+	paymentIDs, err := chargePayments(ctx, provider, attempt)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(paymentIDs, providerPaymentID), nil
+}
+
+// chargePayments consulta os pagamentos feitos na cobrança da tentativa.
+func chargePayments(ctx context.Context, provider domain.PaymentProvider, attempt *domain.Payment) ([]string, error) {
+	if attempt.ProviderChargeID == "" {
+		return nil, nil
+	}
+	charge, err := provider.GetCharge(ctx, attempt.ProviderChargeID)
+	if err != nil {
+		return nil, err
+	}
+	return charge.PaymentIDs, nil
+}
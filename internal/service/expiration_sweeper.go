@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultExpirationInterval = 30 * time.Second
+	expirationBatchSize       = 25
+	// sweeperActor identifica o ExpirationSweeper no histórico de status.
+	sweeperActor = "expiration-sweeper"
+)
+
+var expirationBackoff = resilience.Backoff{Base: time.Minute, Max: time.Hour}
+
+// ExpirationSweeper expira os pagamentos pendentes cujo prazo venceu. A
+// cobrança é cancelada no gateway antes da mudança de status, para que o QR
+// não possa mais ser pago; uma cobrança que o gateway já fechou sem
+// pagamento conta como cancelada. Se o cancelamento falhar, o pagamento
+// continua pendente e é tentado de novo com backoff; enquanto isso as
+// varreduras pedem um lote maior e passam por ele, para que pagamentos com
+// falha permanente não segurem os vencidos depois deles.
+type ExpirationSweeper struct {
+	repo      domain.PaymentRepository
+	providers *Providers
+	interval  time.Duration
+	backoff   resilience.Backoff
+	// retries guarda, por pagamento, as falhas seguidas e a próxima tentativa.
+	// Só é usado pela goroutine de Run.
+	retries map[string]expirationRetry
+}
+
+type expirationRetry struct {
+	attempts int
+	at       time.Time
+}
+
+// NewExpirationSweeper cria o sweeper; interval não positivo usa
+// DefaultExpirationInterval.
+func NewExpirationSweeper(repo domain.PaymentRepository, providers *Providers, interval time.Duration) *ExpirationSweeper {
+	if interval <= 0 {
+		interval = DefaultExpirationInterval
+	}
+	return &ExpirationSweeper{
+		repo:      repo,
+		providers: providers,
+		interval:  interval,
+		backoff:   expirationBackoff,
+		retries:   map[string]expirationRetry{},
+	}
+}
+
+// Run varre os pagamentos vencidos periodicamente até o contexto ser
+// cancelado.
+func (s *ExpirationSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.ExpireOverdue(ctx); err != nil {
+			logger.FromContext(ctx).Error("expiration sweep failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireOverdue expira um lote de pagamentos vencidos e retorna quantos foram
+// expirados. Pagamentos cuja próxima tentativa ainda não chegou são pulados.
+func (s *ExpirationSweeper) ExpireOverdue(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	limit := expirationBatchSize + len(s.retries)
+	payments, err := s.repo.ListExpired(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	listed := make(map[string]bool, len(payments))
+	expired := 0
+	for _, payment := range payments {
+		if ctx.Err() != nil {
+			return expired, ctx.Err()
+		}
+		listed[payment.ID] = true
+		retry, deferred := s.retries[payment.ID]
+		if deferred && now.Before(retry.at) {
+			continue
+		}
+		if s.expire(ctx, payment) {
+			expired++
+			delete(s.retries, payment.ID)
+			continue
+		}
+		retry.attempts++
+		retry.at = now.Add(s.backoff.Delay(retry.attempts))
+		s.retries[payment.ID] = retry
+	}
+
+	// Com a lista completa, os pagamentos que saíram dela foram pagos ou
+	// fechados por outro caminho.
+	if len(payments) < limit {
+		for id := range s.retries {
+			if !listed[id] {
+				delete(s.retries, id)
+			}
+		}
+	}
+	return expired, nil
+}
+
+func (s *ExpirationSweeper) expire(ctx context.Context, payment domain.Payment) bool {
+	ctx = logger.WithPaymentID(ctx, payment.ID)
+	if payment.ProviderChargeID != "" {
+		provider, err := s.providers.For(payment)
+		if err != nil {
+			logger.FromContext(ctx).Error("failed to resolve provider for expired payment",
+				zap.Error(err),
+			)
+			return false
+		}
+		err = provider.CancelCharge(ctx, payment.ProviderChargeID, "expire-"+payment.ID)
+		if err != nil && !chargeClosed(ctx, provider, payment.ProviderChargeID) {
+			logger.FromContext(ctx).Error("failed to cancel expired charge in provider",
+				zap.Error(err),
+				zap.String("provider", provider.Name()),
+				zap.String("provider_charge_id", payment.ProviderChargeID),
+			)
+			return false
+		}
+	}
+
+	err := updateStatus(ctx, s.repo, &payment, func(current *domain.Payment) (domain.StatusChange, []domain.OutboxEvent, error) {
+		if err := domain.ValidateTransition(current.Status, domain.StatusExpired); err != nil {
+			return domain.StatusChange{}, nil, err
+		}
+		event, err := newStatusEvent(*current, domain.StatusExpired)
+		if err != nil {
+			return domain.StatusChange{}, nil, err
+		}
+		return domain.StatusChange{
+			Status: domain.StatusExpired,
+			Audit: domain.StatusAudit{
+				PreviousStatus: current.Status,
+				Source:         domain.SourceSweeper,
+				Actor:          sweeperActor,
+			},
+		}, []domain.OutboxEvent{event}, nil
+	})
+	if errors.Is(err, domain.ErrInvalidTransition) {
+		// O webhook de pagamento chegou durante a varredura.
+		logger.FromContext(ctx).Warn("payment changed status before expiring",
+			zap.Error(err),
+		)
+		return false
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to mark payment as expired",
+			zap.Error(err),
+		)
+		return false
+	}
+
+	logger.FromContext(ctx).Info("payment expired",
+		zap.String("provider_charge_id", payment.ProviderChargeID),
+	)
+	return true
+}
+
+// chargeClosed consulta a cobrança depois de um cancelamento recusado: se o
+// gateway já a cancelou ou expirou, o QR não pode mais ser pago e o pagamento
+// pode expirar.
+func chargeClosed(ctx context.Context, provider domain.PaymentProvider, chargeID string) bool {
+	charge, err := provider.GetCharge(ctx, chargeID)
+	if err != nil {
+		return false
+	}
+	return charge.Status == domain.StatusCancelled || charge.Status == domain.StatusExpired
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+func overduePayment(id string) domain.Payment {
+	expiresAt := time.Now().UTC().Add(-time.Minute)
+	return domain.Payment{
+		ID:                id,
+		ExternalReference: "ext-" + id,
+		Status:            domain.StatusPending,
+		ProviderChargeID:  "order-" + id,
+		ExpiresAt:         &expiresAt,
+	}
+}
+
+func TestExpireOverdue_CancelsOrderAndExpires(t *testing.T) {
+	var changes []domain.StatusChange
+	var written []domain.OutboxEvent
+	repo := &MockRepo{
+		ListExpiredFunc: func(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+			return []domain.Payment{overduePayment("1")}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			changes = append(changes, change)
+			written = append(written, events...)
+			return nil
+		},
+	}
+	var cancelled []string
+	mp := &MockProvider{
+		CancelChargeFunc: func(ctx context.Context, orderID string, idempotencyKey string) error {
+			cancelled = append(cancelled, orderID)
+			return nil
+		},
+	}
+
+	sweeper := NewExpirationSweeper(repo, NewProviders(mp), 0)
+
+	expired, err := sweeper.ExpireOverdue(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expired != 1 {
+		t.Errorf("expected 1 expired payment, got %d", expired)
+	}
+	if len(cancelled) != 1 || cancelled[0] != "order-1" {
+		t.Errorf("expected order-1 to be cancelled, got %v", cancelled)
+	}
+	if len(changes) != 1 || changes[0].Status != domain.StatusExpired {
+		t.Errorf("expected status expired, got %+v", changes)
+	}
+	if len(changes) == 1 && (changes[0].Audit.Source != domain.SourceSweeper || changes[0].Audit.PreviousStatus != domain.StatusPending) {
+		t.Errorf("unexpected audit: %+v", changes[0].Audit)
+	}
+	if len(written) != 1 || written[0].EventType != domain.EventTypePaymentExpired {
+		t.Fatalf("expected a payment_expired outbox event, got %+v", written)
+	}
+
+	var event domain.PaymentExpiredEvent
+	if err := json.Unmarshal(written[0].Payload, &event); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if event.PaymentID != "1" || event.ExternalReference != "ext-1" {
+		t.Errorf("unexpected event payload: %+v", event)
+	}
+}
+
+func TestExpireOverdue_KeepsPendingWhenCancelFails(t *testing.T) {
+	repo := &MockRepo{
+		ListExpiredFunc: func(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+			return []domain.Payment{overduePayment("1"), overduePayment("2")}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			if id == "1" {
+				t.Error("payment 1 should stay pending when the order cancellation fails")
+			}
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		CancelChargeFunc: func(ctx context.Context, orderID string, idempotencyKey string) error {
+			if orderID == "order-1" {
+				return errors.New("mp api error")
+			}
+			return nil
+		},
+		GetChargeFunc: func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: chargeID, Status: domain.StatusPending}, nil
+		},
+	}
+
+	sweeper := NewExpirationSweeper(repo, NewProviders(mp), 0)
+
+	expired, err := sweeper.ExpireOverdue(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expired != 1 {
+		t.Errorf("expected only payment 2 to expire, got %d", expired)
+	}
+}
+
+func TestExpireOverdue_ChargeAlreadyClosedInProvider(t *testing.T) {
+	for _, status := range []domain.PaymentStatus{domain.StatusCancelled, domain.StatusExpired} {
+		t.Run(string(status), func(t *testing.T) {
+			var changes []domain.StatusChange
+			repo := &MockRepo{
+				ListExpiredFunc: func(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+					return []domain.Payment{overduePayment("1")}, nil
+				},
+				UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+					changes = append(changes, change)
+					return nil
+				},
+			}
+			mp := &MockProvider{
+				CancelChargeFunc: func(ctx context.Context, orderID string, idempotencyKey string) error {
+					return errors.New("mercadopago cancel_charge failed with status 409")
+				},
+				GetChargeFunc: func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+					return &domain.ProviderCharge{ID: chargeID, Status: status}, nil
+				},
+			}
+
+			expired, err := NewExpirationSweeper(repo, NewProviders(mp), 0).ExpireOverdue(context.Background())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if expired != 1 || len(changes) != 1 || changes[0].Status != domain.StatusExpired {
+				t.Errorf("expected the payment to expire, got expired=%d changes=%+v", expired, changes)
+			}
+		})
+	}
+}
+
+func TestExpireOverdue_DefersFailedPayments(t *testing.T) {
+	failing := []domain.Payment{overduePayment("1"), overduePayment("2")}
+	var limits []int
+	var listed []domain.Payment
+	repo := &MockRepo{
+		ListExpiredFunc: func(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+			limits = append(limits, limit)
+			return listed, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			return nil
+		},
+	}
+	var cancelled []string
+	mp := &MockProvider{
+		CancelChargeFunc: func(ctx context.Context, orderID string, idempotencyKey string) error {
+			cancelled = append(cancelled, orderID)
+			if orderID == "order-3" {
+				return nil
+			}
+			return errors.New("mp api error")
+		},
+		GetChargeFunc: func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: chargeID, Status: domain.StatusPending}, nil
+		},
+	}
+	sweeper := NewExpirationSweeper(repo, NewProviders(mp), 0)
+
+	listed = failing
+	if expired, _ := sweeper.ExpireOverdue(context.Background()); expired != 0 {
+		t.Fatalf("expected no expired payment, got %d", expired)
+	}
+
+	cancelled = nil
+	listed = append(failing, overduePayment("3"))
+	expired, err := sweeper.ExpireOverdue(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expired != 1 || len(cancelled) != 1 || cancelled[0] != "order-3" {
+		t.Errorf("expected the failed payments to wait for their next attempt, got expired=%d cancelled=%v", expired, cancelled)
+	}
+	if limits[1] != expirationBatchSize+2 {
+		t.Errorf("expected the batch to grow past the deferred payments, got limit %d", limits[1])
+	}
+
+	listed = nil
+	if _, err := sweeper.ExpireOverdue(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(sweeper.retries) != 0 {
+		t.Errorf("expected payments no longer overdue to be forgotten, got %v", sweeper.retries)
+	}
+}
+
+func TestExpireOverdue_PaidDuringSweep(t *testing.T) {
+	repo := &MockRepo{
+		ListExpiredFunc: func(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+			return []domain.Payment{overduePayment("1")}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			return &domain.TransitionError{From: domain.StatusApproved, To: domain.StatusExpired}
+		},
+	}
+	mp := &MockProvider{
+		CancelChargeFunc: func(ctx context.Context, orderID string, idempotencyKey string) error { return nil },
+	}
+
+	sweeper := NewExpirationSweeper(repo, NewProviders(mp), 0)
+
+	expired, err := sweeper.ExpireOverdue(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expired != 0 {
+		t.Errorf("expected no expired payment, got %d", expired)
+	}
+}
+
+func TestExpireOverdue_ListError(t *testing.T) {
+	repo := &MockRepo{
+		ListExpiredFunc: func(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+			return nil, errors.New("dynamodb error")
+		},
+	}
+
+	sweeper := NewExpirationSweeper(repo, NewProviders(&MockProvider{}), 0)
+
+	if _, err := sweeper.ExpireOverdue(context.Background()); err == nil {
+		t.Fatal("expected error from repo")
+	}
+}
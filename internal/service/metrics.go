@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// instrumentationName identifica as métricas e os spans do serviço.
+const instrumentationName = "github.com/alexssanderFonseca/pagamento/internal/service"
+
+// Resultados de webhook do atributo outcome de webhooks.received.
+const (
+	webhookValid            = "valid"
+	webhookInvalidSignature = "invalid_signature"
+	webhookInvalidPayload   = "invalid_payload"
+	webhookUnknownType      = "unknown_type"
+	webhookDuplicate        = "duplicate"
+	webhookError            = "error"
+)
+
+type paymentMetrics struct {
+	created        metric.Int64Counter
+	approved       metric.Int64Counter
+	rejected       metric.Int64Counter
+	approvedAmount metric.Int64Counter
+	timeToApproval metric.Float64Histogram
+	webhooks       metric.Int64Counter
+}
+
+// newPaymentMetrics registra os instrumentos no provider. Falhas de registro
+// só são logadas: os instrumentos retornados continuam utilizáveis.
+func newPaymentMetrics(provider metric.MeterProvider) *paymentMetrics {
+	meter := provider.Meter(instrumentationName)
+	m := &paymentMetrics{}
+	var err error
+	if m.created, err = meter.Int64Counter("payments.created",
+		metric.WithDescription("Pagamentos criados")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.approved, err = meter.Int64Counter("payments.approved",
+		metric.WithDescription("Pagamentos aprovados")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.rejected, err = meter.Int64Counter("payments.rejected",
+		metric.WithDescription("Pagamentos recusados, por motivo informado pelo gateway")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.approvedAmount, err = meter.Int64Counter("payments.approved.amount",
+		metric.WithDescription("Valor aprovado, em unidades mínimas da moeda"),
+		metric.WithUnit("{minor_unit}")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.timeToApproval, err = meter.Float64Histogram("payments.time_to_approval",
+		metric.WithDescription("Tempo entre a criação e a aprovação do pagamento"),
+		metric.WithUnit("s")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	if m.webhooks, err = meter.Int64Counter("webhooks.received",
+		metric.WithDescription("Notificações de webhook recebidas, por resultado")); err != nil {
+		logger.Warn("failed to create metric", zap.Error(err))
+	}
+	return m
+}
+
+func (m *paymentMetrics) recordCreated(ctx context.Context, payment domain.Payment) {
+	m.created.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("provider", payment.Provider),
+		attribute.String("currency", payment.Amount.Currency),
+	))
+}
+
+// recordStatusChange registra aprovações e recusas; os demais status não
+// têm métrica própria.
+func (m *paymentMetrics) recordStatusChange(ctx context.Context, payment domain.Payment, providerPayment domain.ProviderPayment, source domain.StatusSource) {
+	switch providerPayment.Status {
+	case domain.StatusApproved:
+		m.approved.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("provider", payment.Provider),
+			attribute.String("source", string(source)),
+		))
+		m.approvedAmount.Add(ctx, payment.Amount.Units, metric.WithAttributes(
+			attribute.String("currency", payment.Amount.Currency),
+		))
+		if !payment.CreatedAt.IsZero() {
+			m.timeToApproval.Record(ctx, time.Since(payment.CreatedAt).Seconds(), metric.WithAttributes(
+				attribute.String("provider", payment.Provider),
+			))
+		}
+	case domain.StatusRejected:
+		m.rejected.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("provider", payment.Provider),
+			attribute.String("reason", rejectionReason(providerPayment)),
+			attribute.String("source", string(source)),
+		))
+	}
+}
+
+// rejectionReason usa o detalhe do gateway (ex.: cc_rejected_insufficient_amount)
+// e, na falta dele, o status bruto.
+func rejectionReason(providerPayment domain.ProviderPayment) string {
+	switch {
+	case providerPayment.StatusDetail != "":
+		return providerPayment.StatusDetail
+	case providerPayment.RawStatus != "":
+		return providerPayment.RawStatus
+	default:
+		return "unknown"
+	}
+}
+
+func (m *paymentMetrics) recordWebhook(ctx context.Context, provider, outcome string) {
+	m.webhooks.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("provider", provider),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// webhookRejection classifica a falha de validação de uma notificação.
+func webhookRejection(err error) string {
+	if errors.Is(err, domain.ErrInvalidWebhookSignature) {
+		return webhookInvalidSignature
+	}
+	return webhookInvalidPayload
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/telemetry/metrictest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestMetrics_PaymentCreated(t *testing.T) {
+	reader := metrictest.NewReader()
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error { return nil },
+	}
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp), WithMeterProvider(reader.Provider))
+
+	_, err := svc.CreatePayment(context.Background(), domain.CreatePaymentRequest{
+		ExternalReference: "ORDER-1",
+		Amount:            domain.NewMoney(1050, "BRL"),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	got := reader.Int64Sum(t, "payments.created",
+		attribute.String("provider", "mercadopago"),
+		attribute.String("currency", "BRL"),
+	)
+	if got != 1 {
+		t.Errorf("expected one created payment, got %d", got)
+	}
+}
+
+// statusWebhook processa um webhook que leva um pagamento pendente criado há
+// um minuto ao status informado pelo gateway.
+func statusWebhook(t *testing.T, reader *metrictest.Reader, providerPayment domain.ProviderPayment) {
+	t.Helper()
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{
+				ID:                "local-1",
+				ExternalReference: "ext-1",
+				Amount:            domain.NewMoney(1050, "BRL"),
+				Status:            domain.StatusPending,
+				Provider:          "mercadopago",
+				CreatedAt:         time.Now().Add(-time.Minute),
+			}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &providerPayment, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp), WithMeterProvider(reader.Provider))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestMetrics_PaymentApproved(t *testing.T) {
+	reader := metrictest.NewReader()
+	statusWebhook(t, reader, domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"})
+
+	if got := reader.Int64Sum(t, "payments.approved", attribute.String("source", "webhook")); got != 1 {
+		t.Errorf("expected one approval, got %d", got)
+	}
+	if got := reader.Int64Sum(t, "payments.approved.amount", attribute.String("currency", "BRL")); got != 1050 {
+		t.Errorf("expected 1050 approved, got %d", got)
+	}
+	if got := reader.HistogramCount(t, "payments.time_to_approval", attribute.String("provider", "mercadopago")); got != 1 {
+		t.Errorf("expected one time-to-approval measurement, got %d", got)
+	}
+	if got := reader.Int64Sum(t, "webhooks.received", attribute.String("outcome", webhookValid)); got != 1 {
+		t.Errorf("expected one valid webhook, got %d", got)
+	}
+}
+
+func TestMetrics_PaymentRejectedReason(t *testing.T) {
+	tests := []struct {
+		name            string
+		providerPayment domain.ProviderPayment
+		expected        string
+	}{
+		{
+			name:            "status detail",
+			providerPayment: domain.ProviderPayment{Status: domain.StatusRejected, RawStatus: "rejected", StatusDetail: "cc_rejected_insufficient_amount"},
+			expected:        "cc_rejected_insufficient_amount",
+		},
+		{
+			name:            "raw status",
+			providerPayment: domain.ProviderPayment{Status: domain.StatusRejected, RawStatus: "rejected"},
+			expected:        "rejected",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := metrictest.NewReader()
+			tt.providerPayment.ExternalReference = "ext-1"
+			statusWebhook(t, reader, tt.providerPayment)
+
+			if got := reader.Int64Sum(t, "payments.rejected", attribute.String("reason", tt.expected)); got != 1 {
+				t.Errorf("expected one rejection with reason %s, got %d", tt.expected, got)
+			}
+			if got := reader.Int64Sum(t, "payments.approved"); got != 0 {
+				t.Errorf("expected no approvals, got %d", got)
+			}
+		})
+	}
+}
+
+func TestMetrics_WebhookOutcomes(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *MockProvider
+		body     string
+		expected string
+	}{
+		{
+			name: "invalid signature",
+			provider: &MockProvider{
+				ParseWebhookFunc: func(ctx context.Context, req domain.WebhookRequest) (*domain.WebhookEvent, error) {
+					return nil, domain.ErrInvalidWebhookSignature
+				},
+			},
+			expected: webhookInvalidSignature,
+		},
+		{
+			name: "invalid payload",
+			provider: &MockProvider{
+				ParseWebhookFunc: func(ctx context.Context, req domain.WebhookRequest) (*domain.WebhookEvent, error) {
+					return nil, domain.ErrInvalidWebhookPayload
+				},
+			},
+			expected: webhookInvalidPayload,
+		},
+		{
+			name:     "unknown type",
+			provider: &MockProvider{},
+			expected: webhookUnknownType,
+		},
+		{
+			name: "error",
+			provider: &MockProvider{
+				GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+					return nil, errors.New("provider unavailable")
+				},
+			},
+			body:     "mp-123",
+			expected: webhookError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := metrictest.NewReader()
+			svc := NewPaymentService(&MockRepo{}, NewProviders(tt.provider), WithMeterProvider(reader.Provider))
+
+			_ = svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest(tt.body))
+
+			if got := reader.Int64Sum(t, "webhooks.received", attribute.String("outcome", tt.expected)); got != 1 {
+				t.Errorf("expected one %s webhook, got %d", tt.expected, got)
+			}
+			if got := reader.Int64Sum(t, "webhooks.received"); got != 1 {
+				t.Errorf("expected a single outcome per webhook, got %d", got)
+			}
+		})
+	}
+}
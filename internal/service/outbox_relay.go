@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	outboxPollInterval = 2 * time.Second
+	outboxBatchSize    = 25
+	outboxMaxAttempts  = 10
+	outboxBaseBackoff  = 2 * time.Second
+	outboxMaxBackoff   = 5 * time.Minute
+	// outboxClaimTTL é quanto tempo a reserva de um evento impede outros
+	// relays de publicá-lo; precisa cobrir a publicação no SNS.
+	outboxClaimTTL = time.Minute
+)
+
+// OutboxRelay publica no SNS os eventos gravados no outbox. Falhas são
+// reagendadas com backoff exponencial até outboxMaxAttempts; depois disso o
+// evento fica como failed e aparece na listagem de eventos travados.
+// Cada réplica reserva o evento antes de publicá-lo, então um evento pendente
+// é publicado por um relay de cada vez.
+type OutboxRelay struct {
+	outbox    domain.OutboxRepository
+	publisher domain.PaymentEventPublisher
+	owner     string
+	claimTTL  time.Duration
+	interval  time.Duration
+	tracer    trace.Tracer
+}
+
+func NewOutboxRelay(outbox domain.OutboxRepository, publisher domain.PaymentEventPublisher) *OutboxRelay {
+	return &OutboxRelay{
+		outbox:    outbox,
+		publisher: publisher,
+		owner:     uuid.NewString(),
+		claimTTL:  outboxClaimTTL,
+		interval:  outboxPollInterval,
+		tracer:    otel.GetTracerProvider().Tracer(instrumentationName),
+	}
+}
+
+// Run processa o outbox periodicamente até o contexto ser cancelado.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayPending(ctx); err != nil {
+			logger.FromContext(ctx).Error("outbox relay iteration failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publica um lote de eventos pendentes e retorna quantos foram
+// enviados com sucesso.
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	events, err := r.outbox.ListPending(ctx, time.Now().UTC(), outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		if r.deliver(ctx, event) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+func (r *OutboxRelay) deliver(ctx context.Context, event domain.OutboxEvent) bool {
+	now := time.Now().UTC()
+	claimed, err := r.outbox.Claim(ctx, event.ID, r.owner, now, now.Add(r.claimTTL))
+	if errors.Is(err, domain.ErrOutboxEventClaimed) {
+		logger.FromContext(ctx).Debug("outbox event claimed by another relay, skipping",
+			zap.String("event_id", event.ID),
+		)
+		return false
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to claim outbox event",
+			zap.Error(err),
+			zap.String("event_id", event.ID),
+		)
+		return false
+	}
+	// O evento reservado é a versão gravada, que pode ter mudado desde a
+	// listagem.
+	event = claimed
+	event.Attempts++
+
+	// A publicação continua o trace em que o evento foi gerado; o publisher
+	// repassa o contexto aos consumidores.
+	ctx = logger.WithPaymentID(ctx, event.PaymentID)
+	ctx, span := r.tracer.Start(extractTraceContext(ctx, event.TraceContext), "OutboxRelay.publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("outbox.event_id", event.ID),
+			attribute.String("outbox.event_type", event.EventType),
+			attribute.String("payment.id", event.PaymentID),
+			attribute.Int("outbox.attempt", event.Attempts),
+		))
+	err = r.publisher.Publish(ctx, event.EventType, event.Payload)
+	endSpan(span, err)
+	if err == nil {
+		event.Status = domain.OutboxSent
+		event.LastError = ""
+		event.SentAt = &now
+		if err := r.outbox.UpdateDelivery(ctx, event); err != nil {
+			// O evento será publicado de novo; consumidores já precisam tolerar
+			// entrega at-least-once.
+			logger.FromContext(ctx).Error("failed to mark outbox event as sent",
+				zap.Error(err),
+				zap.String("event_id", event.ID),
+			)
+		}
+		logger.FromContext(ctx).Info("outbox event published",
+			zap.String("event_id", event.ID),
+			zap.String("event_type", event.EventType),
+			zap.Int("attempts", event.Attempts),
+		)
+		return true
+	}
+
+	event.LastError = err.Error()
+	if event.Attempts >= outboxMaxAttempts {
+		event.Status = domain.OutboxFailed
+	} else {
+		event.NextAttemptAt = now.Add(outboxBackoff(event.Attempts))
+	}
+
+	logger.FromContext(ctx).Error("failed to publish outbox event",
+		zap.Error(err),
+		zap.String("event_id", event.ID),
+		zap.Int("attempts", event.Attempts),
+		zap.String("outbox_status", string(event.Status)),
+	)
+
+	if err := r.outbox.UpdateDelivery(ctx, event); err != nil {
+		logger.FromContext(ctx).Error("failed to record outbox delivery attempt",
+			zap.Error(err),
+			zap.String("event_id", event.ID),
+		)
+	}
+	return false
+}
+
+// ListStuck retorna os eventos que não foram publicados há mais de olderThan
+// ou que esgotaram as tentativas.
+func (r *OutboxRelay) ListStuck(ctx context.Context, olderThan time.Duration, limit int) ([]domain.OutboxEvent, error) {
+	return r.outbox.ListStuck(ctx, time.Now().UTC().Add(-olderThan), limit)
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff << (attempts - 1)
+	if backoff <= 0 || backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+// Mock do SNS Publisher
+type MockPublisher struct {
+	PublishFunc func(ctx context.Context, eventType string, payload []byte) error
+}
+
+func (m *MockPublisher) Publish(ctx context.Context, eventType string, payload []byte) error {
+	if m.PublishFunc != nil {
+		return m.PublishFunc(ctx, eventType, payload)
+	}
+	return nil
+}
+
+// Mock do Outbox
+type MockOutboxRepo struct {
+	Pending       []domain.OutboxEvent
+	Delivered     []domain.OutboxEvent
+	ListStuckFunc func(ctx context.Context, olderThan time.Time, limit int) ([]domain.OutboxEvent, error)
+	ClaimFunc     func(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.OutboxEvent, error)
+}
+
+func (m *MockOutboxRepo) ListPending(ctx context.Context, now time.Time, limit int) ([]domain.OutboxEvent, error) {
+	return m.Pending, nil
+}
+func (m *MockOutboxRepo) ListStuck(ctx context.Context, olderThan time.Time, limit int) ([]domain.OutboxEvent, error) {
+	if m.ListStuckFunc != nil {
+		return m.ListStuckFunc(ctx, olderThan, limit)
+	}
+	return nil, nil
+}
+func (m *MockOutboxRepo) Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.OutboxEvent, error) {
+	if m.ClaimFunc != nil {
+		return m.ClaimFunc(ctx, id, owner, now, expiresAt)
+	}
+	for _, event := range m.Pending {
+		if event.ID == id {
+			event.ClaimedBy, event.ClaimExpiresAt = owner, &expiresAt
+			return event, nil
+		}
+	}
+	return domain.OutboxEvent{}, domain.ErrOutboxEventNotFound
+}
+func (m *MockOutboxRepo) UpdateDelivery(ctx context.Context, event domain.OutboxEvent) error {
+	m.Delivered = append(m.Delivered, event)
+	return nil
+}
+
+func TestOutboxRelay_PublishesAndMarksSent(t *testing.T) {
+	outbox := &MockOutboxRepo{
+		Pending: []domain.OutboxEvent{
+			{ID: "evt-1", EventType: domain.EventTypePaymentProcessed, PaymentID: "local-1", Status: domain.OutboxPending, Payload: []byte(`{"payment_id":"local-1"}`)},
+		},
+	}
+	var published []string
+	publisher := &MockPublisher{
+		PublishFunc: func(ctx context.Context, eventType string, payload []byte) error {
+			if eventType != domain.EventTypePaymentProcessed {
+				t.Errorf("expected event type %s, got %s", domain.EventTypePaymentProcessed, eventType)
+			}
+			published = append(published, string(payload))
+			return nil
+		},
+	}
+
+	relay := NewOutboxRelay(outbox, publisher)
+
+	sent, err := relay.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if sent != 1 || len(published) != 1 || published[0] != `{"payment_id":"local-1"}` {
+		t.Fatalf("expected one published event, got sent=%d published=%v", sent, published)
+	}
+	if len(outbox.Delivered) != 1 || outbox.Delivered[0].Status != domain.OutboxSent || outbox.Delivered[0].SentAt == nil {
+		t.Errorf("expected event to be marked as sent, got %+v", outbox.Delivered)
+	}
+	if outbox.Delivered[0].ClaimedBy != relay.owner {
+		t.Errorf("expected the delivery to carry the relay claim, got %q", outbox.Delivered[0].ClaimedBy)
+	}
+}
+
+func TestOutboxRelay_SkipsEventClaimedByAnotherRelay(t *testing.T) {
+	outbox := &MockOutboxRepo{
+		Pending: []domain.OutboxEvent{{ID: "evt-1", Status: domain.OutboxPending}},
+		ClaimFunc: func(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.OutboxEvent, error) {
+			if owner == "" || !expiresAt.After(now) {
+				t.Errorf("unexpected claim: owner=%q now=%v expiresAt=%v", owner, now, expiresAt)
+			}
+			return domain.OutboxEvent{}, domain.ErrOutboxEventClaimed
+		},
+	}
+	publisher := &MockPublisher{
+		PublishFunc: func(ctx context.Context, eventType string, payload []byte) error {
+			t.Error("expected an event claimed by another relay not to be published")
+			return nil
+		},
+	}
+
+	relay := NewOutboxRelay(outbox, publisher)
+
+	sent, err := relay.RelayPending(context.Background())
+	if err != nil || sent != 0 {
+		t.Fatalf("expected nothing sent and no error, got %d (%v)", sent, err)
+	}
+	if len(outbox.Delivered) != 0 {
+		t.Errorf("expected no delivery record, got %+v", outbox.Delivered)
+	}
+}
+
+func TestOutboxRelay_PublishesClaimedVersion(t *testing.T) {
+	outbox := &MockOutboxRepo{
+		Pending: []domain.OutboxEvent{{ID: "evt-1", Status: domain.OutboxPending, Attempts: 1}},
+		ClaimFunc: func(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.OutboxEvent, error) {
+			return domain.OutboxEvent{ID: id, Status: domain.OutboxPending, Attempts: 2, ClaimedBy: owner, ClaimExpiresAt: &expiresAt}, nil
+		},
+	}
+
+	relay := NewOutboxRelay(outbox, &MockPublisher{})
+
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(outbox.Delivered) != 1 || outbox.Delivered[0].Attempts != 3 {
+		t.Errorf("expected the attempts of the claimed event to be counted, got %+v", outbox.Delivered)
+	}
+}
+
+func TestOutboxRelay_SNSErrorSchedulesRetry(t *testing.T) {
+	outbox := &MockOutboxRepo{
+		Pending: []domain.OutboxEvent{{ID: "evt-1", Status: domain.OutboxPending, Attempts: 2}},
+	}
+	publisher := &MockPublisher{
+		PublishFunc: func(ctx context.Context, eventType string, payload []byte) error {
+			return errors.New("sns error")
+		},
+	}
+
+	relay := NewOutboxRelay(outbox, publisher)
+
+	sent, err := relay.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("expected publish failures not to abort the batch, got %v", err)
+	}
+	if sent != 0 {
+		t.Errorf("expected nothing sent, got %d", sent)
+	}
+
+	event := outbox.Delivered[0]
+	if event.Status != domain.OutboxPending || event.Attempts != 3 || event.LastError != "sns error" {
+		t.Errorf("unexpected delivery record: %+v", event)
+	}
+	if !event.NextAttemptAt.After(time.Now()) {
+		t.Errorf("expected retry to be scheduled in the future, got %v", event.NextAttemptAt)
+	}
+}
+
+func TestOutboxRelay_GivesUpAfterMaxAttempts(t *testing.T) {
+	outbox := &MockOutboxRepo{
+		Pending: []domain.OutboxEvent{{ID: "evt-1", Status: domain.OutboxPending, Attempts: outboxMaxAttempts - 1}},
+	}
+	publisher := &MockPublisher{
+		PublishFunc: func(ctx context.Context, eventType string, payload []byte) error {
+			return errors.New("sns error")
+		},
+	}
+
+	relay := NewOutboxRelay(outbox, publisher)
+
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if outbox.Delivered[0].Status != domain.OutboxFailed {
+		t.Errorf("expected event to be marked as failed, got %s", outbox.Delivered[0].Status)
+	}
+}
+
+func TestOutboxRelay_ListStuck(t *testing.T) {
+	outbox := &MockOutboxRepo{
+		ListStuckFunc: func(ctx context.Context, olderThan time.Time, limit int) ([]domain.OutboxEvent, error) {
+			if time.Since(olderThan) < 10*time.Minute || limit != 5 {
+				t.Errorf("unexpected arguments: olderThan=%v limit=%d", olderThan, limit)
+			}
+			return []domain.OutboxEvent{{ID: "evt-1"}}, nil
+		},
+	}
+
+	relay := NewOutboxRelay(outbox, &MockPublisher{})
+
+	events, err := relay.ListStuck(context.Background(), 10*time.Minute, 5)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one stuck event, got %v (%v)", events, err)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	if outboxBackoff(1) != outboxBaseBackoff {
+		t.Errorf("expected first retry after %v, got %v", outboxBaseBackoff, outboxBackoff(1))
+	}
+	if outboxBackoff(3) != 4*outboxBaseBackoff {
+		t.Errorf("expected exponential backoff, got %v", outboxBackoff(3))
+	}
+	if outboxBackoff(40) != outboxMaxBackoff {
+		t.Errorf("expected backoff to be capped, got %v", outboxBackoff(40))
+	}
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// RefundPayment estorna total ou parcialmente um pagamento aprovado. Sem
+// valor na requisição, estorna todo o saldo restante. A chave enviada ao
+// gateway vem do Idempotency-Key do cliente, obrigatório; repetir a requisição
+// com a mesma chave não estorna duas vezes, e reusá-la com outro valor retorna
+// ErrIdempotencyConflict.
+func (s *PaymentService) RefundPayment(ctx context.Context, id string, req domain.RefundRequest) (*domain.Payment, error) {
+	ctx = logger.WithPaymentID(ctx, id)
+	if req.IdempotencyKey == "" {
+		return nil, domain.ErrRefundKeyRequired
+	}
+	payment, err := s.GetPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Amount != nil && req.Amount.Currency == "" {
+		// Valor sem moeda é na moeda do pagamento.
+		amount := *req.Amount
+		amount.Currency = payment.Amount.Currency
+		req.Amount = &amount
+	}
+
+	refundID := refundKey(payment, req)
+	if existing := findRefund(payment, refundID, ""); existing != nil {
+		if !sameRefundAmount(*existing, req) {
+			return nil, domain.ErrIdempotencyConflict
+		}
+		return payment, nil
+	}
+
+	remaining := payment.Amount.Sub(payment.RefundedAmount)
+	amount := remaining
+	if req.Amount != nil {
+		amount = *req.Amount
+		if amount.Currency != payment.Amount.Currency {
+			return nil, domain.ErrCurrencyMismatch
+		}
+		if amount.Units <= 0 {
+			return nil, domain.ErrInvalidRefundAmount
+		}
+	}
+	if amount.Units <= 0 {
+		return s.replayRefund(ctx, payment, req, refundID, domain.ErrInvalidRefundAmount)
+	}
+	if amount.Units > remaining.Units {
+		return s.replayRefund(ctx, payment, req, refundID, domain.ErrRefundExceedsAmount)
+	}
+
+	newStatus := domain.StatusPartiallyRefunded
+	if amount.Units == remaining.Units {
+		newStatus = domain.StatusRefunded
+	}
+	if err := domain.ValidateTransition(payment.Status, newStatus); err != nil {
+		logger.FromContext(ctx).Warn("refund rejected for payment status",
+			zap.String("current_status", string(payment.Status)),
+		)
+		return nil, err
+	}
+
+	if payment.ProviderPaymentID == "" {
+		return nil, domain.ErrMissingProviderReference
+	}
+
+	provider, err := s.providers.For(*payment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sem valor o gateway estorna o total, o que só vale se ainda não houve
+	// estorno parcial.
+	var providerAmount *domain.Money
+	if req.Amount != nil || !payment.RefundedAmount.IsZero() {
+		providerAmount = &amount
+	}
+
+	providerRefund, err := provider.RefundPayment(ctx, payment.ProviderPaymentID, providerAmount, refundID)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to refund payment in provider",
+			zap.Error(err),
+			zap.String("provider", provider.Name()),
+			zap.String("provider_payment_id", payment.ProviderPaymentID),
+		)
+		return nil, err
+	}
+
+	refund := domain.Refund{
+		ID:               refundID,
+		ProviderRefundID: providerRefund.ID,
+		Amount:           amount,
+		Reason:           req.Reason,
+		Status:           providerRefund.Status,
+		CreatedAt:        time.Now().UTC(),
+	}
+	err = recordRefund(ctx, s.repo, payment, refund, apiAudit(ctx, payment.Status))
+	if errors.Is(err, errStatusUnchanged) {
+		// A notificação do gateway registrou o estorno antes.
+		return s.GetPayment(ctx, id)
+	}
+	if err != nil {
+		// O estorno já foi feito no gateway. Repetir a requisição reenvia a
+		// mesma chave, e a notificação do gateway também registra o estorno.
+		logger.FromContext(ctx).Error("refund executed in provider but not recorded locally",
+			zap.Error(err),
+			zap.String("refund_id", refund.ID),
+			zap.String("provider_refund_id", refund.ProviderRefundID),
+			zap.Stringer("amount", amount),
+		)
+		return nil, fmt.Errorf("%w: %w", domain.ErrRefundNotRecorded, err)
+	}
+
+	logger.FromContext(ctx).Info("payment refunded",
+		zap.String("refund_id", refund.ID),
+		zap.Stringer("amount", amount),
+		zap.String("new_status", string(payment.Status)),
+	)
+	return payment, nil
+}
+
+// refundKey identifica o estorno no gateway e em Payment.Refunds.
+func refundKey(payment *domain.Payment, req domain.RefundRequest) string {
+	return "refund-" + payment.ID + "-" + req.IdempotencyKey
+}
+
+// replayRefund trata um estorno que o saldo local não comporta mais. Pode ser
+// a repetição de um estorno já registrado por outro caminho, como a
+// notificação do gateway, que não conhece a chave do cliente. O gateway
+// devolve o estorno original para a mesma chave e recusa uma chave nova, já
+// que o saldo dele também acabou; na recusa, vale rejection.
+func (s *PaymentService) replayRefund(ctx context.Context, payment *domain.Payment, req domain.RefundRequest, refundID string, rejection error) (*domain.Payment, error) {
+	if payment.ProviderPaymentID == "" || payment.RefundedAmount.IsZero() {
+		return nil, rejection
+	}
+	provider, err := s.providers.For(*payment)
+	if err != nil {
+		return nil, err
+	}
+
+	providerRefund, err := provider.RefundPayment(ctx, payment.ProviderPaymentID, req.Amount, refundID)
+	if err != nil {
+		logger.FromContext(ctx).Info("refund rejected by the remaining balance",
+			zap.Error(err),
+			zap.String("refund_id", refundID),
+		)
+		return nil, rejection
+	}
+	if !sameRefundAmount(domain.Refund{Amount: providerRefund.Amount}, req) {
+		return nil, domain.ErrIdempotencyConflict
+	}
+	if hasRefund(payment, "", providerRefund.ID) {
+		return payment, nil
+	}
+
+	// O gateway já tinha feito o estorno, mas ele ainda não foi registrado.
+	refund := domain.Refund{
+		ID:               refundID,
+		ProviderRefundID: providerRefund.ID,
+		Amount:           providerRefund.Amount,
+		Reason:           req.Reason,
+		Status:           providerRefund.Status,
+		CreatedAt:        time.Now().UTC(),
+	}
+	err = recordRefund(ctx, s.repo, payment, refund, apiAudit(ctx, payment.Status))
+	if errors.Is(err, errStatusUnchanged) {
+		return s.GetPayment(ctx, payment.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrRefundNotRecorded, err)
+	}
+	return payment, nil
+}
+
+// hasRefund diz se o estorno já foi registrado, pelo ID local ou pelo do
+// gateway.
+func hasRefund(payment *domain.Payment, id, providerRefundID string) bool {
+	return findRefund(payment, id, providerRefundID) != nil
+}
+
+func findRefund(payment *domain.Payment, id, providerRefundID string) *domain.Refund {
+	i := slices.IndexFunc(payment.Refunds, func(refund domain.Refund) bool {
+		return refund.ID == id || (providerRefundID != "" && refund.ProviderRefundID == providerRefundID)
+	})
+	if i < 0 {
+		return nil
+	}
+	return &payment.Refunds[i]
+}
+
+// sameRefundAmount diz se a repetição pede o mesmo valor do estorno já feito.
+// Sem valor, a requisição pedia o saldo restante da época, que não dá para
+// recalcular, e é aceita.
+func sameRefundAmount(refund domain.Refund, req domain.RefundRequest) bool {
+	return req.Amount == nil || *req.Amount == refund.Amount
+}
+
+// recordRefund grava o estorno, o novo total estornado e o evento
+// payment_refunded. Numa escrita concorrente o total e o novo status são
+// recalculados sobre o pagamento relido; um estorno já registrado retorna
+// errStatusUnchanged. Em caso de sucesso payment reflete o estorno gravado.
+func recordRefund(ctx context.Context, repo domain.PaymentRepository, payment *domain.Payment, refund domain.Refund, audit domain.StatusAudit) error {
+	var totalRefunded domain.Money
+	err := updateStatus(ctx, repo, payment, func(current *domain.Payment) (domain.StatusChange, []domain.OutboxEvent, error) {
+		if hasRefund(current, refund.ID, refund.ProviderRefundID) {
+			return domain.StatusChange{}, nil, errStatusUnchanged
+		}
+		totalRefunded = current.RefundedAmount.Add(refund.Amount)
+		newStatus := domain.StatusPartiallyRefunded
+		if totalRefunded.Units >= current.Amount.Units {
+			newStatus = domain.StatusRefunded
+		}
+		if err := domain.ValidateTransition(current.Status, newStatus); err != nil {
+			return domain.StatusChange{}, nil, err
+		}
+
+		event, err := domain.NewOutboxEvent(uuid.New().String(), domain.EventTypePaymentRefunded, current.ID, domain.PaymentRefundedEvent{
+			PaymentID:         current.ID,
+			ExternalReference: current.ExternalReference,
+			RefundID:          refund.ID,
+			Amount:            refund.Amount,
+			TotalRefunded:     totalRefunded,
+			Status:            newStatus,
+			RefundedAt:        refund.CreatedAt,
+		}, refund.CreatedAt)
+		if err != nil {
+			return domain.StatusChange{}, nil, err
+		}
+		audit.PreviousStatus = current.Status
+		return domain.StatusChange{
+			Status:         newStatus,
+			Refund:         &refund,
+			RefundedAmount: totalRefunded,
+			Audit:          audit,
+		}, []domain.OutboxEvent{event}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	payment.RefundedAmount = totalRefunded
+	payment.Refunds = append(payment.Refunds, refund)
+	payment.UpdatedAt = refund.CreatedAt
+	return nil
+}
+
+// recordProviderRefunds registra os estornos informados pelo gateway que
+// ainda não estão no pagamento, como um estorno feito pela API cuja gravação
+// falhou ou um feito direto no painel do gateway. Retorna quantos gravou.
+func (s *PaymentService) recordProviderRefunds(ctx context.Context, payment *domain.Payment, providerPayment domain.ProviderPayment, audit domain.StatusAudit) (int, error) {
+	recorded := 0
+	for _, providerRefund := range providerPayment.Refunds {
+		if hasRefund(payment, "", providerRefund.ID) {
+			continue
+		}
+		if providerRefund.Amount.Units <= 0 || providerRefund.Amount.Currency != payment.Amount.Currency {
+			logger.FromContext(ctx).Warn("provider refund with invalid amount ignored",
+				zap.String("provider_refund_id", providerRefund.ID),
+				zap.Stringer("amount", providerRefund.Amount),
+			)
+			continue
+		}
+
+		refund := domain.Refund{
+			ID:               uuid.New().String(),
+			ProviderRefundID: providerRefund.ID,
+			Amount:           providerRefund.Amount,
+			Status:           providerRefund.Status,
+			CreatedAt:        time.Now().UTC(),
+		}
+		err := recordRefund(ctx, s.repo, payment, refund, audit)
+		if errors.Is(err, errStatusUnchanged) {
+			continue
+		}
+		if err != nil {
+			logger.FromContext(ctx).Error("failed to record provider refund",
+				zap.Error(err),
+				zap.String("provider_refund_id", providerRefund.ID),
+			)
+			return recorded, err
+		}
+		recorded++
+		logger.FromContext(ctx).Info("provider refund recorded",
+			zap.String("refund_id", refund.ID),
+			zap.String("provider_refund_id", refund.ProviderRefundID),
+			zap.Stringer("amount", refund.Amount),
+			zap.String("source", string(audit.Source)),
+		)
+	}
+	return recorded, nil
+}
+
+// CancelPayment cancela no gateway a cobrança de um pagamento ainda não pago e
+// marca o pagamento como cancelado.
+func (s *PaymentService) CancelPayment(ctx context.Context, id string) (*domain.Payment, error) {
+	ctx = logger.WithPaymentID(ctx, id)
+	payment, err := s.GetPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := domain.ValidateTransition(payment.Status, domain.StatusCancelled); err != nil {
+		logger.FromContext(ctx).Warn("cancellation rejected for payment status",
+			zap.String("current_status", string(payment.Status)),
+		)
+		return nil, err
+	}
+
+	if payment.ProviderChargeID == "" {
+		return nil, domain.ErrMissingProviderReference
+	}
+
+	provider, err := s.providers.For(*payment)
+	if err != nil {
+		return nil, err
+	}
+
+	err = provider.CancelCharge(ctx, payment.ProviderChargeID, "cancel-"+payment.ID)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to cancel charge in provider",
+			zap.Error(err),
+			zap.String("provider", provider.Name()),
+			zap.String("provider_charge_id", payment.ProviderChargeID),
+		)
+		return nil, err
+	}
+
+	err = updateStatus(ctx, s.repo, payment, func(current *domain.Payment) (domain.StatusChange, []domain.OutboxEvent, error) {
+		if err := domain.ValidateTransition(current.Status, domain.StatusCancelled); err != nil {
+			return domain.StatusChange{}, nil, err
+		}
+		event, err := newPaymentProcessedEvent(*current, domain.StatusCancelled)
+		if err != nil {
+			return domain.StatusChange{}, nil, err
+		}
+		return domain.StatusChange{
+			Status: domain.StatusCancelled,
+			Audit:  apiAudit(ctx, current.Status),
+		}, []domain.OutboxEvent{event}, nil
+	})
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to mark payment as cancelled",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("payment cancelled",
+		zap.String("provider_charge_id", payment.ProviderChargeID),
+	)
+
+	payment.UpdatedAt = time.Now().UTC()
+	return payment, nil
+}
+
+// apiAudit identifica no histórico as mudanças pedidas pela API.
+func apiAudit(ctx context.Context, previous domain.PaymentStatus) domain.StatusAudit {
+	return domain.StatusAudit{
+		PreviousStatus: previous,
+		Source:         domain.SourceAPI,
+		DeclaredActor:  domain.DeclaredActorFromContext(ctx),
+	}
+}
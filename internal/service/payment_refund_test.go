@@ -0,0 +1,560 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+func approvedPayment() *domain.Payment {
+	return &domain.Payment{
+		ID:                "local-1",
+		ExternalReference: "ext-1",
+		Amount:            domain.NewMoney(10000, "BRL"),
+		RefundedAmount:    domain.NewMoney(0, "BRL"),
+		Status:            domain.StatusApproved,
+		ProviderChargeID:  "order-1",
+		ProviderPaymentID: "mp-123",
+	}
+}
+
+func TestRefundPayment_Partial(t *testing.T) {
+	var change domain.StatusChange
+	var written []domain.OutboxEvent
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return approvedPayment(), nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			change = c
+			written = events
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			if paymentID != "mp-123" || amount == nil || amount.Decimal() != "30.00" {
+				t.Errorf("unexpected refund call: %s %v", paymentID, amount)
+			}
+			if idempotencyKey == "" {
+				t.Error("expected an idempotency key for the refund")
+			}
+			return &domain.ProviderRefund{ID: "987", Status: "approved"}, nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	amount := domain.NewMoney(3000, "BRL")
+	payment, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{Amount: &amount, Reason: "peça devolvida", IdempotencyKey: "key-1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if change.Status != domain.StatusPartiallyRefunded || change.Refund == nil || change.Refund.ProviderRefundID != "987" || change.RefundedAmount.Units != 3000 {
+		t.Errorf("unexpected status change: %+v", change)
+	}
+	if payment.Status != domain.StatusPartiallyRefunded || payment.RefundedAmount.Units != 3000 || len(payment.Refunds) != 1 {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+
+	if len(written) != 1 || written[0].EventType != domain.EventTypePaymentRefunded {
+		t.Fatalf("expected a payment_refunded outbox event, got %+v", written)
+	}
+	var event domain.PaymentRefundedEvent
+	_ = json.Unmarshal(written[0].Payload, &event)
+	if event.Amount.Units != 3000 || event.TotalRefunded.Units != 3000 || event.RefundID != change.Refund.ID {
+		t.Errorf("unexpected event payload: %+v", event)
+	}
+}
+
+func TestRefundPayment_AmountWithoutCurrencyUsesPaymentCurrency(t *testing.T) {
+	var change domain.StatusChange
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return approvedPayment(), nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			change = c
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			if amount == nil || amount.Currency != "BRL" || amount.Units != 3000 {
+				t.Errorf("expected the refund in the payment currency, got %v", amount)
+			}
+			return &domain.ProviderRefund{ID: "987", Status: "approved"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	var req domain.RefundRequest
+	if err := json.Unmarshal([]byte(`{"amount": {"units": 3000}}`), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	req.IdempotencyKey = "key-1"
+	if _, err := svc.RefundPayment(context.Background(), "local-1", req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if change.Refund == nil || change.Refund.Amount != domain.NewMoney(3000, "BRL") {
+		t.Errorf("expected a BRL refund, got %+v", change.Refund)
+	}
+}
+
+func TestRefundPayment_ConcurrentRefundRecalculatesTotal(t *testing.T) {
+	var changes []domain.StatusChange
+	reads := 0
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			reads++
+			if reads == 1 {
+				return approvedPayment(), nil
+			}
+			// Outro estorno de 20 foi gravado depois da leitura.
+			payment := approvedPayment()
+			payment.Status = domain.StatusPartiallyRefunded
+			payment.RefundedAmount = domain.NewMoney(2000, "BRL")
+			payment.Version = 1
+			return payment, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			changes = append(changes, c)
+			if c.Version == 0 {
+				return &domain.ConcurrentModificationError{PaymentID: id, Expected: 0, Current: 1}
+			}
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			return &domain.ProviderRefund{ID: "987", Status: "approved"}, nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	amount := domain.NewMoney(3000, "BRL")
+	payment, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{Amount: &amount, IdempotencyKey: "key-1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(changes) != 2 || changes[1].RefundedAmount.Units != 5000 || changes[1].Audit.PreviousStatus != domain.StatusPartiallyRefunded {
+		t.Fatalf("expected the retry to add the refund to the re-read total, got %+v", changes)
+	}
+	if payment.RefundedAmount.Units != 5000 || payment.Version != 2 {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+}
+
+func TestRefundPayment_FullRemaining(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			p := approvedPayment()
+			p.Status = domain.StatusPartiallyRefunded
+			p.RefundedAmount = domain.NewMoney(3000, "BRL")
+			return p, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			if c.Status != domain.StatusRefunded || c.Refund.Amount.Units != 7000 || c.RefundedAmount.Units != 10000 {
+				t.Errorf("expected full refund of the remaining 70, got %+v", c)
+			}
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			if amount == nil || amount.Units != 7000 {
+				t.Errorf("expected explicit remaining amount after a partial refund, got %v", amount)
+			}
+			return &domain.ProviderRefund{ID: "988", Status: "approved"}, nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	payment, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{IdempotencyKey: "key-1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payment.Status != domain.StatusRefunded || payment.RefundedAmount.Units != 10000 {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+}
+
+func TestRefundPayment_Validation(t *testing.T) {
+	tooMuch := domain.NewMoney(15000, "BRL")
+	negative := domain.NewMoney(-100, "BRL")
+	otherCurrency := domain.NewMoney(1000, "USD")
+	cases := map[string]struct {
+		payment *domain.Payment
+		amount  *domain.Money
+		err     error
+	}{
+		"exceeds amount":    {approvedPayment(), &tooMuch, domain.ErrRefundExceedsAmount},
+		"negative amount":   {approvedPayment(), &negative, domain.ErrInvalidRefundAmount},
+		"currency mismatch": {approvedPayment(), &otherCurrency, domain.ErrCurrencyMismatch},
+		"pending payment":   {&domain.Payment{ID: "local-1", Amount: domain.NewMoney(10000, "BRL"), Status: domain.StatusPending, ProviderPaymentID: "mp-1"}, nil, domain.ErrInvalidTransition},
+		"no mp payment id":  {&domain.Payment{ID: "local-1", Amount: domain.NewMoney(10000, "BRL"), Status: domain.StatusApproved}, nil, domain.ErrMissingProviderReference},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := &MockRepo{
+				GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+					return tc.payment, nil
+				},
+			}
+			svc := NewPaymentService(repo, NewProviders(&MockProvider{}))
+
+			_, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{Amount: tc.amount, IdempotencyKey: "key-1"})
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRefundPayment_MPError(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return approvedPayment(), nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			t.Error("status should not change when mercadopago fails")
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			return nil, errors.New("mp api error")
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	if _, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{IdempotencyKey: "key-1"}); err == nil {
+		t.Fatal("expected error from MP")
+	}
+}
+
+func TestRefundPayment_IdempotencyKey(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			payment := approvedPayment()
+			payment.Status = domain.StatusPartiallyRefunded
+			payment.RefundedAmount = domain.NewMoney(1000, "BRL")
+			payment.Refunds = []domain.Refund{{ID: "refund-local-1-key-0", ProviderRefundID: "900", Amount: domain.NewMoney(1000, "BRL")}}
+			return payment, nil
+		},
+	}
+	var key string
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			key = idempotencyKey
+			return &domain.ProviderRefund{ID: "987", Status: "approved"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	payment, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{IdempotencyKey: "key-1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if key != "refund-local-1-key-1" || payment.Refunds[1].ID != key {
+		t.Errorf("expected key refund-local-1-key-1, got %s (%+v)", key, payment.Refunds)
+	}
+}
+
+func TestRefundPayment_RequiresIdempotencyKey(t *testing.T) {
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			t.Error("expected no refund without an idempotency key")
+			return nil, nil
+		},
+	}
+	svc := NewPaymentService(&MockRepo{}, NewProviders(mp))
+
+	if _, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{}); !errors.Is(err, domain.ErrRefundKeyRequired) {
+		t.Errorf("expected ErrRefundKeyRequired, got %v", err)
+	}
+}
+
+func TestRefundPayment_ReplayReturnsRecordedRefund(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			payment := approvedPayment()
+			payment.Status = domain.StatusRefunded
+			payment.RefundedAmount = payment.Amount
+			payment.Refunds = []domain.Refund{{ID: "refund-local-1-key-1", ProviderRefundID: "987", Amount: payment.Amount}}
+			return payment, nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			t.Error("expected no new refund in the provider")
+			return nil, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	payment, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{IdempotencyKey: "key-1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payment.Status != domain.StatusRefunded || len(payment.Refunds) != 1 {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+}
+
+func TestRefundPayment_ReplayWithDifferentAmount(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			payment := approvedPayment()
+			payment.Status = domain.StatusPartiallyRefunded
+			payment.RefundedAmount = domain.NewMoney(3000, "BRL")
+			payment.Refunds = []domain.Refund{{ID: "refund-local-1-key-1", ProviderRefundID: "987", Amount: domain.NewMoney(3000, "BRL")}}
+			return payment, nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			t.Error("expected no new refund in the provider")
+			return nil, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	different := domain.NewMoney(5000, "BRL")
+	_, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{Amount: &different, IdempotencyKey: "key-1"})
+	if !errors.Is(err, domain.ErrIdempotencyConflict) {
+		t.Errorf("expected ErrIdempotencyConflict, got %v", err)
+	}
+
+	same := domain.NewMoney(3000, "BRL")
+	payment, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{Amount: &same, IdempotencyKey: "key-1"})
+	if err != nil || len(payment.Refunds) != 1 {
+		t.Errorf("expected the recorded refund to be returned, got %+v (%v)", payment, err)
+	}
+}
+
+func TestRefundPayment_ReplayAfterWebhookRecordedRefund(t *testing.T) {
+	// A notificação registrou o estorno com um ID próprio antes da resposta
+	// chegar ao cliente, que repete a requisição com a mesma chave.
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			payment := approvedPayment()
+			payment.Status = domain.StatusRefunded
+			payment.RefundedAmount = payment.Amount
+			payment.Refunds = []domain.Refund{{ID: "webhook-refund", ProviderRefundID: "987", Amount: payment.Amount}}
+			return payment, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			t.Error("expected no new refund to be recorded")
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			if idempotencyKey != "refund-local-1-key-1" {
+				// Uma chave nova é recusada: o pagamento não tem mais saldo.
+				return nil, errors.New("insufficient balance")
+			}
+			return &domain.ProviderRefund{ID: "987", Status: "approved", Amount: domain.NewMoney(10000, "BRL")}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	payment, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{IdempotencyKey: "key-1"})
+	if err != nil {
+		t.Fatalf("expected the recorded payment, got %v", err)
+	}
+	if payment.Status != domain.StatusRefunded || len(payment.Refunds) != 1 {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+
+	if _, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{IdempotencyKey: "key-2"}); !errors.Is(err, domain.ErrInvalidRefundAmount) {
+		t.Errorf("expected a new key to be rejected with ErrInvalidRefundAmount, got %v", err)
+	}
+}
+
+func TestRefundPayment_NotRecordedLocally(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return approvedPayment(), nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			return errors.New("dynamodb unavailable")
+		},
+	}
+	mp := &MockProvider{
+		RefundPaymentFunc: func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+			return &domain.ProviderRefund{ID: "987", Status: "approved"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	if _, err := svc.RefundPayment(context.Background(), "local-1", domain.RefundRequest{IdempotencyKey: "key-1"}); !errors.Is(err, domain.ErrRefundNotRecorded) {
+		t.Errorf("expected ErrRefundNotRecorded, got %v", err)
+	}
+}
+
+func TestProcessWebhook_RecordsProviderRefunds(t *testing.T) {
+	var changes []domain.StatusChange
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			payment := approvedPayment()
+			payment.Refunds = []domain.Refund{}
+			return payment, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			changes = append(changes, c)
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{
+				Status:            domain.StatusApproved,
+				RawStatus:         "approved",
+				ExternalReference: "ext-1",
+				Refunds:           []domain.ProviderRefund{{ID: "987", Status: "approved", Amount: domain.NewMoney(3000, "BRL")}},
+			}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected only the refund to be recorded, got %+v", changes)
+	}
+	change := changes[0]
+	if change.Status != domain.StatusPartiallyRefunded || change.Refund == nil || change.Refund.ProviderRefundID != "987" ||
+		change.RefundedAmount.Units != 3000 || change.Audit.Source != domain.SourceWebhook {
+		t.Errorf("unexpected status change: %+v", change)
+	}
+}
+
+func TestProcessWebhook_PendingPaymentApprovedAndRefundedAtProvider(t *testing.T) {
+	cases := []struct {
+		name           string
+		providerStatus domain.PaymentStatus
+		refunded       int64
+		want           []domain.PaymentStatus
+	}{
+		{"partial refund", domain.StatusApproved, 3000, []domain.PaymentStatus{domain.StatusApproved, domain.StatusPartiallyRefunded}},
+		{"full refund", domain.StatusRefunded, 10000, []domain.PaymentStatus{domain.StatusApproved, domain.StatusRefunded}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var changes []domain.StatusChange
+			repo := &MockRepo{
+				GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+					payment := approvedPayment()
+					payment.Status = domain.StatusPending
+					payment.ProviderPaymentID = ""
+					return payment, nil
+				},
+				UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+					changes = append(changes, c)
+					return nil
+				},
+			}
+			mp := &MockProvider{
+				GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+					return &domain.ProviderPayment{
+						Status:            tc.providerStatus,
+						RawStatus:         string(tc.providerStatus),
+						ExternalReference: "ext-1",
+						Refunds:           []domain.ProviderRefund{{ID: "987", Status: "approved", Amount: domain.NewMoney(tc.refunded, "BRL")}},
+					}, nil
+				},
+			}
+			svc := NewPaymentService(repo, NewProviders(mp))
+
+			if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(changes) != len(tc.want) {
+				t.Fatalf("expected changes to %v, got %+v", tc.want, changes)
+			}
+			for i, status := range tc.want {
+				if changes[i].Status != status {
+					t.Errorf("change %d: expected %s, got %s", i, status, changes[i].Status)
+				}
+			}
+			if changes[0].ProviderPaymentID != "mp-123" {
+				t.Errorf("expected the approval to record the provider payment, got %+v", changes[0])
+			}
+			if refund := changes[1].Refund; refund == nil || refund.ProviderRefundID != "987" || changes[1].RefundedAmount.Units != tc.refunded {
+				t.Errorf("expected the provider refund to be recorded, got %+v", changes[1])
+			}
+		})
+	}
+}
+
+func TestCancelPayment_Success(t *testing.T) {
+	var written []domain.OutboxEvent
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", Status: domain.StatusPending, ProviderChargeID: "order-1"}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			if c.Status != domain.StatusCancelled {
+				t.Errorf("expected cancelled status, got %s", c.Status)
+			}
+			if c.Audit.Source != domain.SourceAPI || c.Audit.PreviousStatus != domain.StatusPending || c.Audit.Actor != "" || c.Audit.DeclaredActor != "atendente-1" {
+				t.Errorf("unexpected audit: %+v", c.Audit)
+			}
+			written = events
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		CancelChargeFunc: func(ctx context.Context, orderID string, idempotencyKey string) error {
+			if orderID != "order-1" {
+				t.Errorf("expected order-1, got %s", orderID)
+			}
+			return nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	payment, err := svc.CancelPayment(domain.ContextWithDeclaredActor(context.Background(), "atendente-1"), "local-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payment.Status != domain.StatusCancelled {
+		t.Errorf("expected cancelled, got %s", payment.Status)
+	}
+	if len(written) != 1 || written[0].EventType != domain.EventTypePaymentProcessed {
+		t.Errorf("expected a payment_processed outbox event, got %+v", written)
+	}
+}
+
+func TestCancelPayment_AlreadyApproved(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return approvedPayment(), nil
+		},
+	}
+	mp := &MockProvider{
+		CancelChargeFunc: func(ctx context.Context, orderID string, idempotencyKey string) error {
+			t.Error("mercadopago should not be called for an approved payment")
+			return nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	_, err := svc.CancelPayment(context.Background(), "local-1")
+	if !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+}
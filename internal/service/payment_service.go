@@ -2,154 +2,894 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/alexssanderFonseca/pagamento/internal/domain"
 	"github.com/alexssanderFonseca/pagamento/internal/logger"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+const (
+	// idempotencyTTL define por quanto tempo uma chave de idempotência é honrada.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL é quanto uma requisição em andamento segura a chave;
+	// precisa cobrir a criação da cobrança no gateway, com as retentativas.
+	idempotencyLockTTL = 2 * time.Minute
+	// DefaultNotificationTTL é por quanto tempo uma notificação de webhook
+	// recebida é lembrada; cobre as reentregas do gateway.
+	DefaultNotificationTTL = 72 * time.Hour
+	// DefaultPaymentTTL é o prazo de pagamento quando a requisição não
+	// informa expires_in.
+	DefaultPaymentTTL = 30 * time.Minute
+)
+
 type PaymentService struct {
-	repo           domain.PaymentRepository
-	mpClient       domain.MercadoPagoClient
-	eventPublisher domain.PaymentEventPublisher
+	repo        domain.PaymentRepository
+	providers   *Providers
+	idempotency domain.IdempotencyStore
+	paymentTTL  time.Duration
+	// referencePolicy decide se uma referência externa com pagamento aceita
+	// uma nova cobrança.
+	referencePolicy domain.ReferencePolicy
+
+	notifications   domain.NotificationStore
+	notificationTTL time.Duration
+	inbox           domain.InboxRepository
+
+	meterProvider  metric.MeterProvider
+	metrics        *paymentMetrics
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+}
+
+type Option func(*PaymentService)
+
+// WithIdempotencyStore habilita o suporte ao header Idempotency-Key.
+func WithIdempotencyStore(store domain.IdempotencyStore) Option {
+	return func(s *PaymentService) {
+		s.idempotency = store
+	}
+}
+
+// WithNotificationStore habilita a deduplicação de webhooks: notificações
+// reentregues dentro de ttl são confirmadas sem reprocessamento. ttl não
+// positivo usa DefaultNotificationTTL.
+func WithNotificationStore(store domain.NotificationStore, ttl time.Duration) Option {
+	return func(s *PaymentService) {
+		s.notifications = store
+		if ttl > 0 {
+			s.notificationTTL = ttl
+		}
+	}
+}
+
+// WithWebhookInbox torna o processamento de webhooks assíncrono: a
+// notificação validada é gravada no inbox e processada pelo WebhookWorker.
+func WithWebhookInbox(inbox domain.InboxRepository) Option {
+	return func(s *PaymentService) {
+		s.inbox = inbox
+	}
+}
+
+// WithReferencePolicy define o tratamento de pagamentos repetidos para a
+// mesma referência externa; o padrão é ReferencePolicyRetryAfterFailure.
+func WithReferencePolicy(policy domain.ReferencePolicy) Option {
+	return func(s *PaymentService) {
+		if policy != "" {
+			s.referencePolicy = policy
+		}
+	}
+}
+
+// WithPaymentTTL altera o prazo de pagamento padrão; valores não positivos
+// são ignorados.
+func WithPaymentTTL(ttl time.Duration) Option {
+	return func(s *PaymentService) {
+		if ttl > 0 {
+			s.paymentTTL = ttl
+		}
+	}
+}
+
+// WithMeterProvider troca o MeterProvider global das métricas de negócio.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(s *PaymentService) {
+		s.meterProvider = provider
+	}
+}
+
+// WithTracerProvider troca o TracerProvider global dos spans do serviço.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *PaymentService) {
+		s.tracerProvider = provider
+	}
 }
 
-func NewPaymentService(repo domain.PaymentRepository, mpClient domain.MercadoPagoClient, eventPublisher domain.PaymentEventPublisher) *PaymentService {
-	return &PaymentService{
-		repo:           repo,
-		mpClient:       mpClient,
-		eventPublisher: eventPublisher,
+func NewPaymentService(repo domain.PaymentRepository, providers *Providers, opts ...Option) *PaymentService {
+	s := &PaymentService{
+		repo:            repo,
+		providers:       providers,
+		paymentTTL:      DefaultPaymentTTL,
+		notificationTTL: DefaultNotificationTTL,
+		referencePolicy: domain.ReferencePolicyRetryAfterFailure,
+		meterProvider:   otel.GetMeterProvider(),
+		tracerProvider:  otel.GetTracerProvider(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	s.metrics = newPaymentMetrics(s.meterProvider)
+	s.tracer = s.tracerProvider.Tracer(instrumentationName)
+	return s
 }
 
+// CreatePayment cria a cobrança. Quando a requisição traz uma chave de
+// idempotência, repetições com o mesmo corpo devolvem o pagamento original e
+// repetições com corpo diferente retornam ErrIdempotencyConflict.
 func (s *PaymentService) CreatePayment(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error) {
-	logger.Info("creating payment order",
+	ctx, span := s.tracer.Start(ctx, "PaymentService.CreatePayment", trace.WithAttributes(
+		attribute.String("payment.external_reference", req.ExternalReference),
+		attribute.Bool("payment.idempotent", req.IdempotencyKey != ""),
+	))
+	payment, err := s.createWithIdempotency(ctx, req)
+	if payment != nil {
+		span.SetAttributes(
+			attribute.String("payment.id", payment.ID),
+			attribute.String("payment.status", string(payment.Status)),
+		)
+	}
+	endSpan(span, err)
+	return payment, err
+}
+
+func (s *PaymentService) createWithIdempotency(ctx context.Context, req domain.CreatePaymentRequest) (*domain.Payment, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	provider, err := s.providers.Get(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("payment.provider", provider.Name()))
+
+	if req.IdempotencyKey == "" || s.idempotency == nil {
+		return s.createPayment(ctx, provider, req)
+	}
+
+	fingerprint := req.Fingerprint()
+	payment, err := s.replayIdempotent(ctx, req.IdempotencyKey, fingerprint)
+	if err != nil || payment != nil {
+		return payment, err
+	}
+
+	now := time.Now()
+	token := uuid.NewString()
+	err = s.idempotency.Reserve(ctx, domain.IdempotencyRecord{
+		Key:         req.IdempotencyKey,
+		Fingerprint: fingerprint,
+		Token:       token,
+		LockedUntil: now.Add(idempotencyLockTTL),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyTTL),
+	})
+	if errors.Is(err, domain.ErrIdempotencyKeyExists) {
+		// Outra requisição com a mesma chave reservou entre a leitura e a escrita.
+		payment, err := s.replayIdempotent(ctx, req.IdempotencyKey, fingerprint)
+		if err != nil || payment != nil {
+			return payment, err
+		}
+		return nil, domain.ErrIdempotencyInProgress
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to reserve idempotency key",
+			zap.Error(err),
+			zap.String("idempotency_key", req.IdempotencyKey),
+		)
+		return nil, err
+	}
+
+	payment, err = s.createPayment(ctx, provider, req)
+	if err != nil {
+		if releaseErr := s.idempotency.Release(ctx, req.IdempotencyKey, token); releaseErr != nil {
+			logger.FromContext(ctx).Error("failed to release idempotency key",
+				zap.Error(releaseErr),
+				zap.String("idempotency_key", req.IdempotencyKey),
+			)
+		}
+		return nil, err
+	}
+
+	err = s.idempotency.Complete(ctx, req.IdempotencyKey, token, *payment)
+	if errors.Is(err, domain.ErrIdempotencyReservationLost) {
+		// Uma repetição assumiu a chave enquanto esta requisição demorava; a
+		// resposta gravada por ela é a que vale para a chave.
+		logger.FromContext(ctx).Warn("idempotency reservation taken over before completion",
+			zap.String("idempotency_key", req.IdempotencyKey),
+			zap.String("payment_id", payment.ID),
+		)
+		if record, getErr := s.idempotency.Get(ctx, req.IdempotencyKey); getErr == nil && record != nil && record.Payment != nil {
+			return record.Payment, nil
+		}
+		return payment, nil
+	}
+	if err != nil {
+		// O pagamento já existe; uma repetição receberá ErrIdempotencyInProgress
+		// até a reserva vencer e depois esbarra na referência externa, sem que
+		// o gateway gere nova cobrança.
+		logger.FromContext(ctx).Error("failed to store idempotent response",
+			zap.Error(err),
+			zap.String("idempotency_key", req.IdempotencyKey),
+			zap.String("payment_id", payment.ID),
+		)
+	}
+
+	return payment, nil
+}
+
+// checkExternalReference aplica a política de referência externa. Retorna o
+// pagamento pendente a devolver (ReferencePolicyReturnPending) ou o ID da
+// tentativa que a nova cobrança substitui (ReferencePolicyRetryAfterFailure).
+func (s *PaymentService) checkExternalReference(ctx context.Context, ref string) (*domain.Payment, string, error) {
+	current, err := s.repo.GetByExternalReference(ctx, ref)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to fetch local payment by external reference",
+			zap.Error(err),
+			zap.String("external_reference", ref),
+		)
+		return nil, "", err
+	}
+	if current == nil {
+		return nil, "", nil
+	}
+
+	switch {
+	case s.referencePolicy == domain.ReferencePolicyReturnPending && current.Status == domain.StatusPending:
+		logger.FromContext(ctx).Info("returning pending payment for external reference",
+			zap.String("external_reference", ref),
+			zap.String("payment_id", current.ID),
+		)
+		return current, "", nil
+	case s.referencePolicy == domain.ReferencePolicyRetryAfterFailure && current.Status.IsFailed():
+		return nil, current.ID, nil
+	}
+
+	logger.FromContext(ctx).Warn("payment rejected for duplicate external reference",
+		zap.String("external_reference", ref),
+		zap.String("existing_payment_id", current.ID),
+		zap.String("existing_status", string(current.Status)),
+		zap.String("policy", string(s.referencePolicy)),
+	)
+	return nil, "", domain.ErrDuplicateExternalReference
+}
+
+func (s *PaymentService) replayIdempotent(ctx context.Context, key, fingerprint string) (*domain.Payment, error) {
+	record, err := s.idempotency.Get(ctx, key)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to fetch idempotency record",
+			zap.Error(err),
+			zap.String("idempotency_key", key),
+		)
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, nil
+	}
+
+	if record.Fingerprint != fingerprint {
+		logger.FromContext(ctx).Warn("idempotency key reused with a different request",
+			zap.String("idempotency_key", key),
+		)
+		return nil, domain.ErrIdempotencyConflict
+	}
+
+	if record.InProgress(time.Now()) {
+		return nil, domain.ErrIdempotencyInProgress
+	}
+	if record.Payment == nil {
+		// A requisição que reservou a chave não concluiu a tempo; esta a assume.
+		logger.FromContext(ctx).Warn("taking over expired idempotency reservation",
+			zap.String("idempotency_key", key),
+		)
+		return nil, nil
+	}
+
+	logger.FromContext(ctx).Info("replaying idempotent payment creation",
+		zap.String("idempotency_key", key),
+		zap.String("payment_id", record.Payment.ID),
+	)
+	return record.Payment, nil
+}
+
+func (s *PaymentService) createPayment(ctx context.Context, provider domain.PaymentProvider, req domain.CreatePaymentRequest) (*domain.Payment, error) {
+	logger.FromContext(ctx).Info("creating payment order",
 		zap.String("external_reference", req.ExternalReference),
-		zap.Float64("amount", req.Amount),
+		zap.Stringer("amount", req.Amount),
+		zap.String("provider", provider.Name()),
 	)
 
-	qrCode, err := s.mpClient.CreateQRCodeOrder(ctx, req)
+	existing, previousAttemptID, err := s.checkExternalReference(ctx, req.ExternalReference)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	charge, err := provider.CreateCharge(ctx, req)
 	if err != nil {
-		logger.Error("failed to create qr code order in mercadopago",
+		logger.FromContext(ctx).Error("failed to create charge in payment provider",
 			zap.Error(err),
 			zap.String("external_reference", req.ExternalReference),
+			zap.String("provider", provider.Name()),
 		)
 		return nil, err
 	}
 
+	now := time.Now().UTC()
+	ttl := s.paymentTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	expiresAt := now.Add(ttl)
+
 	payment := domain.Payment{
 		ID:                uuid.New().String(),
 		ExternalReference: req.ExternalReference,
 		Amount:            req.Amount,
+		RefundedAmount:    domain.NewMoney(0, req.Amount.Currency),
 		Status:            domain.StatusPending,
-		QRCode:            qrCode,
-		CreatedAt:         time.Now(),
-		UpdatedAt:         time.Now(),
+		QRCode:            charge.QRData,
+		Provider:          provider.Name(),
+		ProviderChargeID:  charge.ID,
+		ExpiresAt:         &expiresAt,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+		PreviousAttemptID: previousAttemptID,
+		Version:           1,
 	}
+	ctx = logger.WithPaymentID(ctx, payment.ID)
 
 	err = s.repo.Save(ctx, payment)
+	if errors.Is(err, domain.ErrDuplicateExternalReference) {
+		// Outra criação para a mesma referência venceu a corrida; a cobrança
+		// recém-criada não pode ficar aberta no gateway.
+		logger.FromContext(ctx).Warn("concurrent payment for external reference, cancelling charge",
+			zap.String("external_reference", req.ExternalReference),
+			zap.String("provider_charge_id", charge.ID),
+		)
+		if cancelErr := provider.CancelCharge(ctx, charge.ID, "duplicate-"+payment.ID); cancelErr != nil {
+			logger.FromContext(ctx).Error("failed to cancel duplicate charge in provider",
+				zap.Error(cancelErr),
+				zap.String("provider", provider.Name()),
+				zap.String("provider_charge_id", charge.ID),
+			)
+		}
+		return nil, err
+	}
 	if err != nil {
-		logger.Error("failed to save payment in dynamodb",
+		logger.FromContext(ctx).Error("failed to save payment in dynamodb",
 			zap.Error(err),
-			zap.String("payment_id", payment.ID),
 		)
 		return nil, err
 	}
 
-	logger.Info("payment created successfully",
-		zap.String("payment_id", payment.ID),
+	logger.FromContext(ctx).Info("payment created successfully",
 		zap.String("status", string(payment.Status)),
 	)
+	s.metrics.recordCreated(ctx, payment)
 
 	return &payment, nil
 }
 
-func (s *PaymentService) ProcessWebhook(ctx context.Context, notification domain.MPWebhookNotification) error {
-	logger.Info("received webhook notification",
+func (s *PaymentService) GetPayment(ctx context.Context, id string) (*domain.Payment, error) {
+	ctx = logger.WithPaymentID(ctx, id)
+	payment, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to fetch payment by id",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if payment == nil {
+		return nil, domain.ErrPaymentNotFound
+	}
+
+	return payment, nil
+}
+
+// GetPaymentHistory retorna as mudanças de status do pagamento em ordem
+// cronológica.
+func (s *PaymentService) GetPaymentHistory(ctx context.Context, id string) ([]domain.StatusHistoryEntry, error) {
+	ctx = logger.WithPaymentID(ctx, id)
+	if _, err := s.GetPayment(ctx, id); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.History(ctx, id)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to fetch payment status history",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	return history, nil
+}
+
+func (s *PaymentService) ListPayments(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+	page, err := s.repo.List(ctx, filter)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to list payments",
+			zap.Error(err),
+			zap.String("external_reference", filter.ExternalReference),
+			zap.String("status", string(filter.Status)),
+		)
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// ProcessWebhook valida a notificação com o gateway indicado e aplica ao
+// pagamento local o status consultado no gateway. Com um NotificationStore,
+// notificações repetidas são confirmadas sem reprocessamento. Com um inbox
+// (WithWebhookInbox), a notificação só é gravada e o retorno é imediato.
+func (s *PaymentService) ProcessWebhook(ctx context.Context, providerName string, req domain.WebhookRequest) error {
+	ctx, span := s.tracer.Start(ctx, "PaymentService.ProcessWebhook", trace.WithAttributes(
+		attribute.String("webhook.provider", providerName),
+	))
+	err := s.processWebhook(ctx, providerName, req)
+	endSpan(span, err)
+	return err
+}
+
+func (s *PaymentService) processWebhook(ctx context.Context, providerName string, req domain.WebhookRequest) error {
+	provider, err := s.providers.Get(providerName)
+	if err != nil {
+		return err
+	}
+
+	notification, err := provider.ParseWebhook(ctx, req)
+	if err != nil {
+		logger.FromContext(ctx).Warn("webhook notification rejected",
+			zap.Error(err),
+			zap.String("provider", providerName),
+		)
+		s.metrics.recordWebhook(ctx, provider.Name(), webhookRejection(err))
+		return err
+	}
+
+	logger.FromContext(ctx).Info("received webhook notification",
+		zap.String("provider", provider.Name()),
 		zap.String("type", notification.Type),
-		zap.String("action", notification.Action),
+		zap.String("notification_id", notification.ID),
+	)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("webhook.type", notification.Type),
+		attribute.String("webhook.notification_id", notification.ID),
+		attribute.String("webhook.provider_payment_id", notification.PaymentID),
 	)
 
-	if notification.Type == "payment" {
-		paymentID := notification.Data.ID
-		mpPayment, err := s.mpClient.GetPaymentDetails(ctx, paymentID)
-		if err != nil {
-			logger.Error("failed to get payment details from mercadopago",
-				zap.Error(err),
-				zap.String("mp_payment_id", paymentID),
-			)
-			return err
-		}
+	if s.notifications == nil || notification.ID == "" {
+		err := s.dispatchWebhook(ctx, provider, notification, req.Body)
+		s.metrics.recordWebhook(ctx, provider.Name(), webhookOutcome(notification, err))
+		return err
+	}
 
-		logger.Info("mercadopago payment details fetched",
-			zap.String("mp_payment_id", paymentID),
-			zap.String("mp_status", mpPayment.Status),
-			zap.String("external_reference", mpPayment.ExternalReference),
+	key := notificationKey(provider.Name(), notification.ID)
+	now := time.Now()
+	err = s.notifications.Reserve(ctx, domain.ProcessedNotification{
+		Key:       key,
+		Provider:  provider.Name(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.notificationTTL),
+	})
+	if errors.Is(err, domain.ErrNotificationProcessed) {
+		logger.FromContext(ctx).Info("duplicate webhook notification acknowledged",
+			zap.String("provider", provider.Name()),
+			zap.String("notification_id", notification.ID),
 		)
+		s.metrics.recordWebhook(ctx, provider.Name(), webhookDuplicate)
+		return nil
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to reserve webhook notification",
+			zap.Error(err),
+			zap.String("notification_id", notification.ID),
+		)
+		s.metrics.recordWebhook(ctx, provider.Name(), webhookError)
+		return err
+	}
 
-		payment, err := s.repo.GetByExternalReference(ctx, mpPayment.ExternalReference)
-		if err != nil {
-			logger.Error("failed to fetch local payment by external reference",
-				zap.Error(err),
-				zap.String("external_reference", mpPayment.ExternalReference),
-			)
-			return err
-		}
+	err = s.dispatchWebhook(ctx, provider, notification, req.Body)
+	s.metrics.recordWebhook(ctx, provider.Name(), webhookOutcome(notification, err))
+	if err != nil {
+		// Sem a reserva, a reentrega do gateway é processada de novo.
+		s.releaseNotification(ctx, provider.Name(), notification.ID)
+		return err
+	}
+	return nil
+}
 
-		if payment == nil {
-			logger.Warn("payment not found for received webhook",
-				zap.String("external_reference", mpPayment.ExternalReference),
-			)
-			return nil
-		}
+// notificationKey identifica a notificação no NotificationStore.
+func notificationKey(provider, notificationID string) string {
+	return provider + ":" + notificationID
+}
+
+// releaseNotification apaga a reserva de deduplicação da notificação, para
+// que uma reentrega do gateway seja aceita.
+func (s *PaymentService) releaseNotification(ctx context.Context, provider, notificationID string) {
+	if s.notifications == nil || notificationID == "" {
+		return
+	}
+	if err := s.notifications.Release(ctx, notificationKey(provider, notificationID)); err != nil {
+		logger.FromContext(ctx).Error("failed to release webhook notification",
+			zap.Error(err),
+			zap.String("provider", provider),
+			zap.String("notification_id", notificationID),
+		)
+	}
+}
+
+// dispatchWebhook grava a notificação no inbox, quando configurado, ou a
+// processa na hora.
+func (s *PaymentService) dispatchWebhook(ctx context.Context, provider domain.PaymentProvider, notification *domain.WebhookEvent, body []byte) error {
+	if s.inbox == nil {
+		return s.handleWebhookEvent(ctx, provider, notification)
+	}
+
+	now := time.Now().UTC()
+	entry := domain.InboxNotification{
+		ID:             uuid.NewString(),
+		Provider:       provider.Name(),
+		NotificationID: notification.ID,
+		Type:           notification.Type,
+		PaymentID:      notification.PaymentID,
+		ChargeID:       notification.ChargeID,
+		Body:           inboxBody(body),
+		Status:         domain.InboxPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		TraceContext:   injectTraceContext(ctx),
+	}
+	if err := s.inbox.Save(ctx, entry); err != nil {
+		logger.FromContext(ctx).Error("failed to enqueue webhook notification",
+			zap.Error(err),
+			zap.String("provider", provider.Name()),
+			zap.String("notification_id", notification.ID),
+		)
+		return err
+	}
+
+	logger.FromContext(ctx).Info("webhook notification enqueued",
+		zap.String("inbox_id", entry.ID),
+		zap.String("provider_payment_id", entry.PaymentID),
+	)
+	return nil
+}
+
+// inboxBody guarda o corpo como JSON; corpos que não são JSON (gateways que
+// notificam por formulário) viram uma string JSON.
+func inboxBody(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// webhookOutcome classifica uma notificação válida pelo resultado do envio:
+// error se falhou, unknown_type se ela não se refere a pagamento nem a
+// cobrança e valid nos demais casos.
+func webhookOutcome(notification *domain.WebhookEvent, err error) string {
+	switch {
+	case err != nil:
+		return webhookError
+	case notification.PaymentID == "" && notification.ChargeID == "":
+		return webhookUnknownType
+	default:
+		return webhookValid
+	}
+}
+
+func (s *PaymentService) handleWebhookEvent(ctx context.Context, provider domain.PaymentProvider, notification *domain.WebhookEvent) error {
+	switch {
+	case notification.PaymentID != "":
+		return s.handlePaymentNotification(ctx, provider, notification)
+	case notification.ChargeID != "":
+		return s.handleChargeNotification(ctx, provider, notification)
+	default:
+		logger.FromContext(ctx).Info("webhook topic ignored",
+			zap.String("provider", provider.Name()),
+			zap.String("type", notification.Type),
+		)
+		return nil
+	}
+}
+
+func (s *PaymentService) handlePaymentNotification(ctx context.Context, provider domain.PaymentProvider, notification *domain.WebhookEvent) error {
+	providerPayment, err := provider.GetPayment(ctx, notification.PaymentID)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to get payment details from provider",
+			zap.Error(err),
+			zap.String("provider", provider.Name()),
+			zap.String("provider_payment_id", notification.PaymentID),
+		)
+		return err
+	}
+
+	logger.FromContext(ctx).Info("provider payment details fetched",
+		zap.String("provider_payment_id", notification.PaymentID),
+		zap.String("provider_status", providerPayment.RawStatus),
+		zap.String("external_reference", providerPayment.ExternalReference),
+	)
+
+	payment, err := s.repo.GetByExternalReference(ctx, providerPayment.ExternalReference)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to fetch local payment by external reference",
+			zap.Error(err),
+			zap.String("external_reference", providerPayment.ExternalReference),
+		)
+		return err
+	}
+
+	if payment == nil {
+		logger.FromContext(ctx).Warn("payment not found for received webhook",
+			zap.String("external_reference", providerPayment.ExternalReference),
+		)
+		return nil
+	}
 
-		var newStatus domain.PaymentStatus
-		switch mpPayment.Status {
-		case "approved":
-			newStatus = domain.StatusApproved
-		case "rejected", "cancelled":
-			newStatus = domain.StatusRejected
-		default:
-			newStatus = domain.StatusPending
+	// A referência aponta para a tentativa mais recente; a notificação pode ser
+	// de um pagamento feito numa tentativa anterior.
+	latestID := payment.ID
+	payment, err = s.attemptForPayment(ctx, provider, payment, notification.PaymentID)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to resolve the payment attempt of the provider payment",
+			zap.Error(err),
+			zap.String("provider_payment_id", notification.PaymentID),
+		)
+		return err
+	}
+	if payment == nil {
+		logger.FromContext(ctx).Warn("provider payment does not belong to any attempt of the reference, skipping update",
+			zap.String("provider_payment_id", notification.PaymentID),
+			zap.String("external_reference", providerPayment.ExternalReference),
+			zap.String("latest_payment_id", latestID),
+		)
+		return nil
+	}
+
+	// O ID da notificação é o mesmo pagamento consultado, mas o gateway pode
+	// não devolvê-lo na consulta.
+	providerPayment.ID = notification.PaymentID
+	_, err = s.syncProviderPayment(ctx, payment, *providerPayment, webhookAudit(provider, notification))
+	if errors.Is(err, domain.ErrInvalidTransition) {
+		return nil
+	}
+	return err
+}
+
+// handleChargeNotification aplica o fechamento de uma cobrança sem
+// pagamento, como o cancelamento ou a expiração da ordem no ponto de venda.
+// Aprovações e recusas chegam também no tópico payment, que traz o pagamento
+// do gateway usado nos estornos; por isso aqui elas só são registradas.
+func (s *PaymentService) handleChargeNotification(ctx context.Context, provider domain.PaymentProvider, notification *domain.WebhookEvent) error {
+	charge, err := provider.GetCharge(ctx, notification.ChargeID)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to get charge details from provider",
+			zap.Error(err),
+			zap.String("provider", provider.Name()),
+			zap.String("provider_charge_id", notification.ChargeID),
+		)
+		return err
+	}
+
+	logger.FromContext(ctx).Info("provider charge details fetched",
+		zap.String("provider_charge_id", charge.ID),
+		zap.String("provider_status", charge.RawStatus),
+		zap.String("external_reference", charge.ExternalReference),
+	)
+
+	if charge.Status != domain.StatusCancelled && charge.Status != domain.StatusExpired {
+		return nil
+	}
+
+	payment, err := s.repo.GetByExternalReference(ctx, charge.ExternalReference)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to fetch local payment by external reference",
+			zap.Error(err),
+			zap.String("external_reference", charge.ExternalReference),
+		)
+		return err
+	}
+
+	if payment == nil {
+		logger.FromContext(ctx).Warn("payment not found for received webhook",
+			zap.String("external_reference", charge.ExternalReference),
+		)
+		return nil
+	}
+
+	// Uma nova tentativa da mesma referência não é afetada pelo fechamento da
+	// cobrança anterior.
+	if !chargeBelongsTo(payment, charge) {
+		logger.FromContext(ctx).Info("charge notification does not match the payment charge, skipping update",
+			zap.String("payment_id", payment.ID),
+			zap.String("provider_charge_id", charge.ID),
+			zap.String("payment_charge_id", payment.ProviderChargeID),
+		)
+		return nil
+	}
+
+	err = s.applyProviderStatus(ctx, payment, domain.ProviderPayment{
+		ExternalReference: charge.ExternalReference,
+		Status:            charge.Status,
+		RawStatus:         charge.RawStatus,
+	}, webhookAudit(provider, notification))
+	if errors.Is(err, domain.ErrInvalidTransition) {
+		return nil
+	}
+	return err
+}
+
+// chargeBelongsTo diz se a cobrança consultada é a da tentativa. Cobranças
+// vinculadas (merchant orders) só são atribuídas sem ambiguidade: à única
+// tentativa da referência ou à que tem um pagamento feito nelas.
+func chargeBelongsTo(payment *domain.Payment, charge *domain.ProviderCharge) bool {
+	if charge.Linked {
+		return payment.PreviousAttemptID == "" ||
+			(payment.ProviderPaymentID != "" && slices.Contains(charge.PaymentIDs, payment.ProviderPaymentID))
+	}
+	return payment.ProviderChargeID == "" || payment.ProviderChargeID == charge.ID
+}
+
+// webhookAudit identifica no histórico a notificação e o gateway que a enviou.
+func webhookAudit(provider domain.PaymentProvider, notification *domain.WebhookEvent) domain.StatusAudit {
+	return domain.StatusAudit{
+		Source:         domain.SourceWebhook,
+		NotificationID: notification.ID,
+		Actor:          provider.Name(),
+	}
+}
+
+// applyProviderStatus leva o pagamento local ao status informado pelo
+// gateway, validando a transição e gravando o evento no outbox. É usado pelo
+// webhook e pela reconciliação; transições recusadas retornam
+// ErrInvalidTransition e não alteram o pagamento. O status anterior e o status
+// bruto do gateway são preenchidos em audit.
+func (s *PaymentService) applyProviderStatus(ctx context.Context, payment *domain.Payment, providerPayment domain.ProviderPayment, audit domain.StatusAudit) error {
+	ctx = logger.WithPaymentID(ctx, payment.ID)
+	source := string(audit.Source)
+	newStatus := providerPayment.Status
+
+	// O evento vai para o outbox na mesma transação; o OutboxRelay publica no SNS.
+	var event domain.OutboxEvent
+	err := updateStatus(ctx, s.repo, payment, func(current *domain.Payment) (domain.StatusChange, []domain.OutboxEvent, error) {
+		if current.Status == newStatus {
+			logger.FromContext(ctx).Info("payment already in reported status, skipping update",
+				zap.String("status", string(newStatus)),
+			)
+			return domain.StatusChange{}, nil, errStatusUnchanged
 		}
 
-		err = s.repo.UpdateStatus(ctx, payment.ID, newStatus)
-		if err != nil {
-			logger.Error("failed to update payment status",
-				zap.Error(err),
-				zap.String("payment_id", payment.ID),
+		if err := domain.ValidateTransition(current.Status, newStatus); err != nil {
+			logger.FromContext(ctx).Warn("illegal payment status transition ignored",
+				zap.String("current_status", string(current.Status)),
 				zap.String("new_status", string(newStatus)),
+				zap.String("provider_status", providerPayment.RawStatus),
+				zap.String("source", source),
 			)
-			return err
+			return domain.StatusChange{}, nil, err
 		}
 
-		logger.Info("payment status updated via webhook",
-			zap.String("payment_id", payment.ID),
+		var err error
+		event, err = newStatusEvent(*current, newStatus)
+		if err != nil {
+			return domain.StatusChange{}, nil, err
+		}
+		audit.PreviousStatus = current.Status
+		audit.ProviderStatus = providerPayment.RawStatus
+		return domain.StatusChange{
+			Status:            newStatus,
+			ProviderPaymentID: providerPayment.ID,
+			Audit:             audit,
+		}, []domain.OutboxEvent{event}, nil
+	})
+	switch {
+	case errors.Is(err, errStatusUnchanged):
+		return nil
+	case errors.Is(err, domain.ErrInvalidTransition):
+		return err
+	case err != nil:
+		logger.FromContext(ctx).Error("failed to update payment status",
+			zap.Error(err),
 			zap.String("new_status", string(newStatus)),
 		)
+		return err
+	}
 
-		// Publicar evento no SNS
-		if s.eventPublisher != nil {
-			err = s.eventPublisher.PublishPaymentProcessed(ctx, domain.PaymentProcessedEvent{
-				PaymentID:         payment.ID,
-				ExternalReference: payment.ExternalReference,
-				Status:            newStatus,
-				ProcessedAt:       time.Now(),
-			})
-			if err != nil {
-				logger.Error("failed to publish payment processed event to SNS",
-					zap.Error(err),
-					zap.String("payment_id", payment.ID),
-				)
-				// Não retornamos erro aqui para não causar re-tentativas do webhook MP por falha no SNS
-			} else {
-				logger.Info("payment processed event published to SNS",
-					zap.String("payment_id", payment.ID),
-				)
-			}
-		}
+	logger.FromContext(ctx).Info("payment status updated",
+		zap.String("new_status", string(newStatus)),
+		zap.String("outbox_event_id", event.ID),
+		zap.String("source", source),
+	)
+
+	if providerPayment.ID != "" {
+		payment.ProviderPaymentID = providerPayment.ID
 	}
+	s.metrics.recordStatusChange(ctx, *payment, providerPayment, audit.Source)
 	return nil
 }
+
+// syncProviderPayment aplica ao pagamento o status e os estornos informados
+// pelo gateway e diz se gravou alguma mudança. Estornos só valem sobre um
+// pagamento aprovado, então o status vem primeiro: um pagamento ainda pendente
+// que o gateway informa como estornado é aprovado e chega a refunded pelos
+// estornos registrados.
+func (s *PaymentService) syncProviderPayment(ctx context.Context, payment *domain.Payment, providerPayment domain.ProviderPayment, audit domain.StatusAudit) (bool, error) {
+	version := payment.Version
+	target := providerPayment
+	if target.Status == domain.StatusRefunded && len(target.Refunds) > 0 && !acceptsRefunds(payment.Status) {
+		target.Status = domain.StatusApproved
+	}
+	if !statusMatches(payment.Status, target.Status) {
+		if err := s.applyProviderStatus(ctx, payment, target, audit); err != nil {
+			return payment.Version != version, err
+		}
+	}
+
+	if acceptsRefunds(payment.Status) {
+		if _, err := s.recordProviderRefunds(ctx, payment, providerPayment, audit); err != nil {
+			return payment.Version != version, err
+		}
+	}
+
+	var err error
+	if !statusMatches(payment.Status, providerPayment.Status) {
+		err = s.applyProviderStatus(ctx, payment, providerPayment, audit)
+	}
+	return payment.Version != version, err
+}
+
+// acceptsRefunds diz se um pagamento no status pode receber estornos.
+func acceptsRefunds(status domain.PaymentStatus) bool {
+	return status.CanTransitionTo(domain.StatusPartiallyRefunded) || status.CanTransitionTo(domain.StatusRefunded)
+}
+
+// newStatusEvent monta o evento da mudança de status: payment_expired para
+// expirações, como o ExpirationSweeper, e payment_processed para as demais.
+func newStatusEvent(payment domain.Payment, status domain.PaymentStatus) (domain.OutboxEvent, error) {
+	if status != domain.StatusExpired {
+		return newPaymentProcessedEvent(payment, status)
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now
+	if payment.ExpiresAt != nil {
+		expiresAt = *payment.ExpiresAt
+	}
+	return domain.NewOutboxEvent(uuid.New().String(), domain.EventTypePaymentExpired, payment.ID, domain.PaymentExpiredEvent{
+		PaymentID:         payment.ID,
+		ExternalReference: payment.ExternalReference,
+		ExpiresAt:         expiresAt,
+		ExpiredAt:         now,
+	}, now)
+}
+
+func newPaymentProcessedEvent(payment domain.Payment, status domain.PaymentStatus) (domain.OutboxEvent, error) {
+	now := time.Now().UTC()
+	return domain.NewOutboxEvent(uuid.New().String(), domain.EventTypePaymentProcessed, payment.ID, domain.PaymentProcessedEvent{
+		PaymentID:         payment.ID,
+		ExternalReference: payment.ExternalReference,
+		Status:            status,
+		ProcessedAt:       now,
+	}, now)
+}
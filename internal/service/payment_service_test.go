@@ -2,60 +2,145 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/repository/memory"
 )
 
 // Mock do Repository
 type MockRepo struct {
 	SaveFunc                   func(ctx context.Context, payment domain.Payment) error
+	GetByIDFunc                func(ctx context.Context, id string) (*domain.Payment, error)
 	GetByExternalReferenceFunc func(ctx context.Context, ref string) (*domain.Payment, error)
-	UpdateStatusFunc           func(ctx context.Context, id string, status domain.PaymentStatus) error
+	ListFunc                   func(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error)
+	UpdateStatusFunc           func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error
+	ListExpiredFunc            func(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error)
+	HistoryFunc                func(ctx context.Context, paymentID string) ([]domain.StatusHistoryEntry, error)
 }
 
 func (m *MockRepo) Save(ctx context.Context, payment domain.Payment) error {
 	return m.SaveFunc(ctx, payment)
 }
-func (m *MockRepo) GetByID(ctx context.Context, id string) (*domain.Payment, error) { return nil, nil }
+func (m *MockRepo) GetByID(ctx context.Context, id string) (*domain.Payment, error) {
+	if m.GetByIDFunc != nil {
+		return m.GetByIDFunc(ctx, id)
+	}
+	return nil, nil
+}
 func (m *MockRepo) GetByExternalReference(ctx context.Context, ref string) (*domain.Payment, error) {
 	if m.GetByExternalReferenceFunc != nil {
 		return m.GetByExternalReferenceFunc(ctx, ref)
 	}
 	return nil, nil
 }
-func (m *MockRepo) UpdateStatus(ctx context.Context, id string, status domain.PaymentStatus) error {
+func (m *MockRepo) List(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+	if m.ListFunc != nil {
+		return m.ListFunc(ctx, filter)
+	}
+	return &domain.PaymentPage{}, nil
+}
+func (m *MockRepo) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
 	if m.UpdateStatusFunc != nil {
-		return m.UpdateStatusFunc(ctx, id, status)
+		return m.UpdateStatusFunc(ctx, id, change, events...)
 	}
 	return nil
 }
+func (m *MockRepo) ListExpired(ctx context.Context, now time.Time, limit int) ([]domain.Payment, error) {
+	if m.ListExpiredFunc != nil {
+		return m.ListExpiredFunc(ctx, now, limit)
+	}
+	return nil, nil
+}
+func (m *MockRepo) History(ctx context.Context, paymentID string) ([]domain.StatusHistoryEntry, error) {
+	if m.HistoryFunc != nil {
+		return m.HistoryFunc(ctx, paymentID)
+	}
+	return nil, nil
+}
 
-// Mock do MP Client
-type MockMPClient struct {
-	CreateQRCodeFunc      func(ctx context.Context, req domain.CreatePaymentRequest) (string, error)
-	GetPaymentDetailsFunc func(ctx context.Context, id string) (*domain.MPPaymentResponse, error)
+// Mock do gateway de pagamento
+type MockProvider struct {
+	NameValue          string
+	CreateChargeFunc   func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error)
+	GetPaymentFunc     func(ctx context.Context, id string) (*domain.ProviderPayment, error)
+	SearchPaymentsFunc func(ctx context.Context, externalReference string) ([]domain.ProviderPayment, error)
+	RefundPaymentFunc  func(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error)
+	GetChargeFunc      func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error)
+	CancelChargeFunc   func(ctx context.Context, chargeID string, idempotencyKey string) error
+	ParseWebhookFunc   func(ctx context.Context, req domain.WebhookRequest) (*domain.WebhookEvent, error)
 }
 
-func (m *MockMPClient) CreateQRCodeOrder(ctx context.Context, req domain.CreatePaymentRequest) (string, error) {
-	return m.CreateQRCodeFunc(ctx, req)
+func (m *MockProvider) Name() string {
+	if m.NameValue != "" {
+		return m.NameValue
+	}
+	return "mercadopago"
+}
+func (m *MockProvider) CreateCharge(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+	return m.CreateChargeFunc(ctx, req)
 }
-func (m *MockMPClient) GetPaymentDetails(ctx context.Context, paymentID string) (*domain.MPPaymentResponse, error) {
-	if m.GetPaymentDetailsFunc != nil {
-		return m.GetPaymentDetailsFunc(ctx, paymentID)
+func (m *MockProvider) GetPayment(ctx context.Context, paymentID string) (*domain.ProviderPayment, error) {
+	if m.GetPaymentFunc != nil {
+		return m.GetPaymentFunc(ctx, paymentID)
 	}
 	return nil, nil
 }
+func (m *MockProvider) SearchPayments(ctx context.Context, externalReference string) ([]domain.ProviderPayment, error) {
+	if m.SearchPaymentsFunc != nil {
+		return m.SearchPaymentsFunc(ctx, externalReference)
+	}
+	return nil, nil
+}
+func (m *MockProvider) RefundPayment(ctx context.Context, paymentID string, amount *domain.Money, idempotencyKey string) (*domain.ProviderRefund, error) {
+	return m.RefundPaymentFunc(ctx, paymentID, amount, idempotencyKey)
+}
+func (m *MockProvider) GetCharge(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+	return m.GetChargeFunc(ctx, chargeID)
+}
+func (m *MockProvider) CancelCharge(ctx context.Context, chargeID string, idempotencyKey string) error {
+	return m.CancelChargeFunc(ctx, chargeID, idempotencyKey)
+}
+func (m *MockProvider) ParseWebhook(ctx context.Context, req domain.WebhookRequest) (*domain.WebhookEvent, error) {
+	if m.ParseWebhookFunc != nil {
+		return m.ParseWebhookFunc(ctx, req)
+	}
+	return &domain.WebhookEvent{ID: "notification-" + string(req.Body), Type: "payment", PaymentID: string(req.Body)}, nil
+}
+
+// Mock do IdempotencyStore
+type MockIdempotencyStore struct {
+	records map[string]*domain.IdempotencyRecord
+}
 
-// Mock do SNS Publisher
-type MockPublisher struct {
-	PublishFunc func(ctx context.Context, event domain.PaymentProcessedEvent) error
+func NewMockIdempotencyStore() *MockIdempotencyStore {
+	return &MockIdempotencyStore{records: map[string]*domain.IdempotencyRecord{}}
 }
 
-func (m *MockPublisher) PublishPaymentProcessed(ctx context.Context, event domain.PaymentProcessedEvent) error {
-	if m.PublishFunc != nil {
-		return m.PublishFunc(ctx, event)
+func (m *MockIdempotencyStore) Reserve(ctx context.Context, record domain.IdempotencyRecord) error {
+	if current, ok := m.records[record.Key]; ok && (current.Payment != nil || current.InProgress(time.Now())) {
+		return domain.ErrIdempotencyKeyExists
+	}
+	m.records[record.Key] = &record
+	return nil
+}
+func (m *MockIdempotencyStore) Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	return m.records[key], nil
+}
+func (m *MockIdempotencyStore) Complete(ctx context.Context, key, token string, payment domain.Payment) error {
+	record, ok := m.records[key]
+	if !ok || record.Token != token || record.Payment != nil {
+		return domain.ErrIdempotencyReservationLost
+	}
+	record.Payment = &payment
+	return nil
+}
+func (m *MockIdempotencyStore) Release(ctx context.Context, key, token string) error {
+	if record, ok := m.records[key]; ok && record.Token == token && record.Payment == nil {
+		delete(m.records, key)
 	}
 	return nil
 }
@@ -64,18 +149,16 @@ func TestCreatePayment_Success(t *testing.T) {
 	repo := &MockRepo{
 		SaveFunc: func(ctx context.Context, payment domain.Payment) error { return nil },
 	}
-	mp := &MockMPClient{
-		CreateQRCodeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (string, error) {
-			return "qr_data_mock", nil
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-1", QRData: "qr_data_mock"}, nil
 		},
 	}
-	publisher := &MockPublisher{}
-
-	svc := NewPaymentService(repo, mp, publisher)
+	svc := NewPaymentService(repo, NewProviders(mp))
 
 	req := domain.CreatePaymentRequest{
 		ExternalReference: "ORDER-1",
-		Amount:            10.50,
+		Amount:            domain.NewMoney(1050, "BRL"),
 		Description:       "Test",
 	}
 
@@ -92,22 +175,170 @@ func TestCreatePayment_Success(t *testing.T) {
 	if payment.Status != domain.StatusPending {
 		t.Errorf("expected status pending, got %s", payment.Status)
 	}
+
+	if payment.ProviderChargeID != "order-1" {
+		t.Errorf("expected mercadopago order id order-1, got %s", payment.ProviderChargeID)
+	}
+
+	if payment.CreatedAt.Location() != time.UTC || payment.UpdatedAt.Location() != time.UTC || payment.ExpiresAt.Location() != time.UTC {
+		t.Errorf("expected timestamps in UTC, got created=%v updated=%v expires=%v", payment.CreatedAt, payment.UpdatedAt, payment.ExpiresAt)
+	}
+}
+
+func TestCreatePayment_ExternalReferencePolicy(t *testing.T) {
+	cases := []struct {
+		name       string
+		policy     domain.ReferencePolicy
+		existing   domain.PaymentStatus
+		wantErr    error
+		wantCharge bool
+		wantID     string
+	}{
+		{"reject pending", domain.ReferencePolicyReject, domain.StatusPending, domain.ErrDuplicateExternalReference, false, ""},
+		{"reject expired", domain.ReferencePolicyReject, domain.StatusExpired, domain.ErrDuplicateExternalReference, false, ""},
+		{"return pending", domain.ReferencePolicyReturnPending, domain.StatusPending, nil, false, "existing-1"},
+		{"return pending approved", domain.ReferencePolicyReturnPending, domain.StatusApproved, domain.ErrDuplicateExternalReference, false, ""},
+		{"retry after expiration", domain.ReferencePolicyRetryAfterFailure, domain.StatusExpired, nil, true, ""},
+		{"retry after rejection", domain.ReferencePolicyRetryAfterFailure, domain.StatusRejected, nil, true, ""},
+		{"retry while pending", domain.ReferencePolicyRetryAfterFailure, domain.StatusPending, domain.ErrDuplicateExternalReference, false, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *domain.Payment
+			repo := &MockRepo{
+				GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+					return &domain.Payment{ID: "existing-1", ExternalReference: ref, Status: tc.existing}, nil
+				},
+				SaveFunc: func(ctx context.Context, payment domain.Payment) error {
+					saved = &payment
+					return nil
+				},
+			}
+			charged := false
+			mp := &MockProvider{
+				CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+					charged = true
+					return &domain.ProviderCharge{ID: "order-2", QRData: "qr"}, nil
+				},
+			}
+			svc := NewPaymentService(repo, NewProviders(mp), WithReferencePolicy(tc.policy))
+
+			payment, err := svc.CreatePayment(context.Background(), domain.CreatePaymentRequest{
+				ExternalReference: "ORDER-1",
+				Amount:            domain.NewMoney(1050, "BRL"),
+			})
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if charged != tc.wantCharge {
+				t.Errorf("expected charge created = %v", tc.wantCharge)
+			}
+			if tc.wantID != "" && (payment == nil || payment.ID != tc.wantID) {
+				t.Errorf("expected existing payment %s, got %+v", tc.wantID, payment)
+			}
+			if tc.wantCharge && (saved == nil || saved.PreviousAttemptID != "existing-1") {
+				t.Errorf("expected the new attempt to supersede existing-1, got %+v", saved)
+			}
+		})
+	}
+}
+
+func TestCreatePayment_ConcurrentDuplicateCancelsCharge(t *testing.T) {
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error {
+			return domain.ErrDuplicateExternalReference
+		},
+	}
+	var cancelled string
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-2", QRData: "qr"}, nil
+		},
+		CancelChargeFunc: func(ctx context.Context, chargeID string, idempotencyKey string) error {
+			cancelled = chargeID
+			return nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	_, err := svc.CreatePayment(context.Background(), domain.CreatePaymentRequest{
+		ExternalReference: "ORDER-1",
+		Amount:            domain.NewMoney(1050, "BRL"),
+	})
+	if !errors.Is(err, domain.ErrDuplicateExternalReference) {
+		t.Fatalf("expected ErrDuplicateExternalReference, got %v", err)
+	}
+	if cancelled != "order-2" {
+		t.Errorf("expected the orphan charge to be cancelled, got %q", cancelled)
+	}
+}
+
+func TestCreatePayment_Expiration(t *testing.T) {
+	var saved domain.Payment
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error {
+			saved = payment
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-1", QRData: "qr_data_mock"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp), WithPaymentTTL(10*time.Minute))
+
+	req := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1050, "BRL")}
+	if _, err := svc.CreatePayment(context.Background(), req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if saved.ExpiresAt == nil || saved.ExpiresAt.Sub(saved.CreatedAt).Round(time.Second) != 10*time.Minute {
+		t.Errorf("expected default ttl of 10m, got %v", saved.ExpiresAt)
+	}
+
+	req.ExpiresIn = 120
+	if _, err := svc.CreatePayment(context.Background(), req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if saved.ExpiresAt.Sub(saved.CreatedAt).Round(time.Second) != 2*time.Minute {
+		t.Errorf("expected ttl from the request, got %v", saved.ExpiresAt.Sub(saved.CreatedAt))
+	}
+}
+
+func TestCreatePayment_InvalidAmount(t *testing.T) {
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			t.Error("mercadopago should not be called for an invalid amount")
+			return nil, nil
+		},
+	}
+	svc := NewPaymentService(&MockRepo{}, NewProviders(mp))
+
+	cases := map[domain.Money]error{
+		domain.NewMoney(0, "BRL"):            domain.ErrInvalidAmount,
+		domain.NewMoney(1_000_000_01, "BRL"): domain.ErrAmountTooLarge,
+		domain.NewMoney(1000, "EUR"):         domain.ErrUnsupportedCurrency,
+	}
+	for amount, expected := range cases {
+		_, err := svc.CreatePayment(context.Background(), domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: amount})
+		if !errors.Is(err, expected) {
+			t.Errorf("amount %v: expected %v, got %v", amount, expected, err)
+		}
+	}
 }
 
 func TestCreatePayment_MP_Error(t *testing.T) {
 	repo := &MockRepo{}
-	mp := &MockMPClient{
-		CreateQRCodeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (string, error) {
-			return "", errors.New("mp api error")
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return nil, errors.New("mp api error")
 		},
 	}
-	publisher := &MockPublisher{}
-
-	svc := NewPaymentService(repo, mp, publisher)
+	svc := NewPaymentService(repo, NewProviders(mp))
 
 	req := domain.CreatePaymentRequest{
 		ExternalReference: "ORDER-1",
-		Amount:            10.50,
+		Amount:            domain.NewMoney(1050, "BRL"),
 	}
 
 	_, err := svc.CreatePayment(context.Background(), req)
@@ -121,18 +352,16 @@ func TestCreatePayment_Repo_Error(t *testing.T) {
 	repo := &MockRepo{
 		SaveFunc: func(ctx context.Context, payment domain.Payment) error { return errors.New("db error") },
 	}
-	mp := &MockMPClient{
-		CreateQRCodeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (string, error) {
-			return "qr_data", nil
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-1", QRData: "qr_data"}, nil
 		},
 	}
-	publisher := &MockPublisher{}
-
-	svc := NewPaymentService(repo, mp, publisher)
+	svc := NewPaymentService(repo, NewProviders(mp))
 
 	req := domain.CreatePaymentRequest{
 		ExternalReference: "ORDER-1",
-		Amount:            10.50,
+		Amount:            domain.NewMoney(1050, "BRL"),
 	}
 
 	_, err := svc.CreatePayment(context.Background(), req)
@@ -142,203 +371,900 @@ func TestCreatePayment_Repo_Error(t *testing.T) {
 	}
 }
 
+func TestCreatePayment_IdempotentReplay(t *testing.T) {
+	saves := 0
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error {
+			saves++
+			return nil
+		},
+	}
+	orders := 0
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			orders++
+			if req.IdempotencyKey != "key-1" {
+				t.Errorf("expected idempotency key to reach mercadopago, got %q", req.IdempotencyKey)
+			}
+			return &domain.ProviderCharge{ID: "order-1", QRData: "qr_data"}, nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp), WithIdempotencyStore(NewMockIdempotencyStore()))
+
+	req := domain.CreatePaymentRequest{
+		ExternalReference: "ORDER-1",
+		Amount:            domain.NewMoney(1050, "BRL"),
+		Description:       "Test",
+		IdempotencyKey:    "key-1",
+	}
+
+	first, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	second, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected no error on replay, got %v", err)
+	}
+
+	if first.ID != second.ID {
+		t.Errorf("expected replay to return payment %s, got %s", first.ID, second.ID)
+	}
+	if orders != 1 || saves != 1 {
+		t.Errorf("expected a single order and save, got %d orders and %d saves", orders, saves)
+	}
+}
+
+func TestCreatePayment_IdempotencyConflict(t *testing.T) {
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error { return nil },
+	}
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-1", QRData: "qr_data"}, nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp), WithIdempotencyStore(NewMockIdempotencyStore()))
+
+	req := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1050, "BRL"), IdempotencyKey: "key-1"}
+	if _, err := svc.CreatePayment(context.Background(), req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req.Amount = domain.NewMoney(2000, "BRL")
+	_, err := svc.CreatePayment(context.Background(), req)
+	if !errors.Is(err, domain.ErrIdempotencyConflict) {
+		t.Fatalf("expected ErrIdempotencyConflict, got %v", err)
+	}
+}
+
+func TestCreatePayment_IdempotencyInProgress(t *testing.T) {
+	store := NewMockIdempotencyStore()
+	req := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1050, "BRL"), IdempotencyKey: "key-1"}
+	_ = store.Reserve(context.Background(), domain.IdempotencyRecord{Key: "key-1", Fingerprint: req.Fingerprint(), LockedUntil: time.Now().Add(time.Minute)})
+
+	svc := NewPaymentService(&MockRepo{}, NewProviders(&MockProvider{}), WithIdempotencyStore(store))
+
+	_, err := svc.CreatePayment(context.Background(), req)
+	if !errors.Is(err, domain.ErrIdempotencyInProgress) {
+		t.Fatalf("expected ErrIdempotencyInProgress, got %v", err)
+	}
+}
+
+func TestCreatePayment_IdempotencyTakesOverExpiredReservation(t *testing.T) {
+	store := NewMockIdempotencyStore()
+	req := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1050, "BRL"), IdempotencyKey: "key-1"}
+	// Reserva de uma requisição que morreu antes de concluir.
+	_ = store.Reserve(context.Background(), domain.IdempotencyRecord{Key: "key-1", Fingerprint: req.Fingerprint(), LockedUntil: time.Now().Add(-time.Second)})
+
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error { return nil },
+	}
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-1", QRData: "qr_data"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp), WithIdempotencyStore(store))
+
+	payment, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected the retry to take over the key, got %v", err)
+	}
+	record := store.records["key-1"]
+	if record.Payment == nil || record.Payment.ID != payment.ID {
+		t.Errorf("expected the key to be completed with payment %s, got %+v", payment.ID, record)
+	}
+
+	req.Amount = domain.NewMoney(2000, "BRL")
+	store.records["key-2"] = &domain.IdempotencyRecord{Key: "key-2", Fingerprint: "other", LockedUntil: time.Now().Add(-time.Second)}
+	req.IdempotencyKey = "key-2"
+	if _, err := svc.CreatePayment(context.Background(), req); !errors.Is(err, domain.ErrIdempotencyConflict) {
+		t.Errorf("expected an expired reservation of another request to stay a conflict, got %v", err)
+	}
+}
+
+func TestCreatePayment_IdempotencySlowRequestDoesNotOverwriteTakeover(t *testing.T) {
+	store := NewMockIdempotencyStore()
+	req := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1050, "BRL"), IdempotencyKey: "key-1"}
+	winner := domain.Payment{ID: "winner"}
+
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error { return nil },
+	}
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, r domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			// A reserva venceu durante a chamada e uma repetição a assumiu e
+			// concluiu.
+			store.records["key-1"] = &domain.IdempotencyRecord{Key: "key-1", Fingerprint: req.Fingerprint(), Token: "retry", Payment: &winner}
+			return &domain.ProviderCharge{ID: "order-1", QRData: "qr_data"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp), WithIdempotencyStore(store))
+
+	payment, err := svc.CreatePayment(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payment.ID != "winner" || store.records["key-1"].Payment.ID != "winner" {
+		t.Errorf("expected the takeover's response to be kept, got %s (stored %s)", payment.ID, store.records["key-1"].Payment.ID)
+	}
+}
+
+func TestCreatePayment_IdempotencyReleasedOnFailure(t *testing.T) {
+	store := NewMockIdempotencyStore()
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return nil, errors.New("mp api error")
+		},
+	}
+
+	svc := NewPaymentService(&MockRepo{}, NewProviders(mp), WithIdempotencyStore(store))
+
+	req := domain.CreatePaymentRequest{ExternalReference: "ORDER-1", Amount: domain.NewMoney(1050, "BRL"), IdempotencyKey: "key-1"}
+	if _, err := svc.CreatePayment(context.Background(), req); err == nil {
+		t.Fatal("expected error from MP, got nil")
+	}
+	if _, ok := store.records["key-1"]; ok {
+		t.Error("expected idempotency key to be released after failure")
+	}
+}
+
+func TestGetPayment_Success(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return &domain.Payment{ID: id, Status: domain.StatusApproved}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(&MockProvider{}))
+
+	payment, err := svc.GetPayment(context.Background(), "local-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payment.ID != "local-1" || payment.Status != domain.StatusApproved {
+		t.Errorf("unexpected payment returned: %+v", payment)
+	}
+}
+
+func TestGetPayment_NotFound(t *testing.T) {
+	svc := NewPaymentService(&MockRepo{}, NewProviders(&MockProvider{}))
+
+	_, err := svc.GetPayment(context.Background(), "missing")
+	if !errors.Is(err, domain.ErrPaymentNotFound) {
+		t.Fatalf("expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+func TestListPayments_PassesFilter(t *testing.T) {
+	repo := &MockRepo{
+		ListFunc: func(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+			if filter.Status != domain.StatusPending || filter.Cursor != "abc" {
+				t.Errorf("unexpected filter: %+v", filter)
+			}
+			return &domain.PaymentPage{Items: []domain.Payment{{ID: "local-1"}}, NextCursor: "def"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(&MockProvider{}))
+
+	page, err := svc.ListPayments(context.Background(), domain.PaymentFilter{Status: domain.StatusPending, Cursor: "abc"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(page.Items) != 1 || page.NextCursor != "def" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+}
+
+func TestListPayments_RepoError(t *testing.T) {
+	repo := &MockRepo{
+		ListFunc: func(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+			return nil, errors.New("db error")
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(&MockProvider{}))
+
+	if _, err := svc.ListPayments(context.Background(), domain.PaymentFilter{}); err == nil {
+		t.Fatal("expected error from repo List")
+	}
+}
+
+func TestGetPaymentHistory(t *testing.T) {
+	repo := &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			if id == "missing" {
+				return nil, nil
+			}
+			return &domain.Payment{ID: id, Status: domain.StatusApproved}, nil
+		},
+		HistoryFunc: func(ctx context.Context, paymentID string) ([]domain.StatusHistoryEntry, error) {
+			return []domain.StatusHistoryEntry{
+				{PaymentID: paymentID, NewStatus: domain.StatusPending, Source: domain.SourceAPI},
+				{PaymentID: paymentID, PreviousStatus: domain.StatusPending, NewStatus: domain.StatusApproved, Source: domain.SourceWebhook},
+			}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(&MockProvider{}))
+
+	history, err := svc.GetPaymentHistory(context.Background(), "local-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(history) != 2 || history[1].NewStatus != domain.StatusApproved {
+		t.Errorf("unexpected history: %+v", history)
+	}
+
+	if _, err := svc.GetPaymentHistory(context.Background(), "missing"); !errors.Is(err, domain.ErrPaymentNotFound) {
+		t.Errorf("expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+// webhookRequest monta uma notificação que o MockProvider interpreta como
+// pagamento com o ID informado no corpo.
+func webhookRequest(paymentID string) domain.WebhookRequest {
+	return domain.WebhookRequest{Body: []byte(paymentID)}
+}
+
 func TestProcessWebhook_Approved(t *testing.T) {
 	repo := &MockRepo{
 		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
-			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1"}, nil
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
 		},
-		UpdateStatusFunc: func(ctx context.Context, id string, status domain.PaymentStatus) error {
-			if status != domain.StatusApproved {
-				t.Errorf("expected approved status, got %s", status)
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			if change.Status != domain.StatusApproved {
+				t.Errorf("expected approved status, got %s", change.Status)
+			}
+			expected := domain.StatusAudit{
+				PreviousStatus: domain.StatusPending,
+				Source:         domain.SourceWebhook,
+				ProviderStatus: "approved",
+				NotificationID: "notification-mp-123",
+				Actor:          "mercadopago",
+			}
+			if change.Audit != expected {
+				t.Errorf("unexpected audit: %+v", change.Audit)
 			}
 			return nil
 		},
 	}
-	mp := &MockMPClient{
-		GetPaymentDetailsFunc: func(ctx context.Context, id string) (*domain.MPPaymentResponse, error) {
-			return &domain.MPPaymentResponse{Status: "approved", ExternalReference: "ext-1"}, nil
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
 		},
 	}
-	publisher := &MockPublisher{}
+	svc := NewPaymentService(repo, NewProviders(mp))
 
-	svc := NewPaymentService(repo, mp, publisher)
+	notification := webhookRequest("mp-123")
 
-	notification := domain.MPWebhookNotification{
-		Type: "payment",
-		Data: struct {
-			ID string `json:"id"`
-		}{ID: "mp-123"},
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", notification)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
+}
 
-	err := svc.ProcessWebhook(context.Background(), notification)
+func TestProcessWebhook_Rejected(t *testing.T) {
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			if change.Status != domain.StatusRejected {
+				t.Errorf("expected rejected status, got %s", change.Status)
+			}
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusRejected, RawStatus: "rejected", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	notification := webhookRequest("mp-123")
+
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", notification)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 }
 
-func TestProcessWebhook_Rejected(t *testing.T) {
+func TestProcessWebhook_Cancelled(t *testing.T) {
 	repo := &MockRepo{
 		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
-			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1"}, nil
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
 		},
-		UpdateStatusFunc: func(ctx context.Context, id string, status domain.PaymentStatus) error {
-			if status != domain.StatusRejected {
-				t.Errorf("expected rejected status, got %s", status)
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			if change.Status != domain.StatusCancelled {
+				t.Errorf("expected cancelled status, got %s", change.Status)
 			}
 			return nil
 		},
 	}
-	mp := &MockMPClient{
-		GetPaymentDetailsFunc: func(ctx context.Context, id string) (*domain.MPPaymentResponse, error) {
-			return &domain.MPPaymentResponse{Status: "cancelled", ExternalReference: "ext-1"}, nil
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusCancelled, RawStatus: "cancelled", ExternalReference: "ext-1"}, nil
 		},
 	}
-	publisher := &MockPublisher{}
 
-	svc := NewPaymentService(repo, mp, publisher)
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	notification := webhookRequest("mp-123")
 
-	notification := domain.MPWebhookNotification{
-		Type: "payment",
-		Data: struct {
-			ID string `json:"id"`
-		}{ID: "mp-123"},
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", notification)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
+}
 
-	err := svc.ProcessWebhook(context.Background(), notification)
+func TestProcessWebhook_LatePendingDoesNotRegress(t *testing.T) {
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusApproved}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			t.Errorf("update should not be called, got %s", change.Status)
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusPending, RawStatus: "pending", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	notification := webhookRequest("mp-123")
+
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", notification)
+	if err != nil {
+		t.Fatalf("expected illegal transition to be acknowledged, got %v", err)
+	}
+}
+
+func TestProcessWebhook_RepoRejectsTransition(t *testing.T) {
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			return &domain.TransitionError{From: domain.StatusCancelled, To: change.Status}
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123"))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 }
 
+func TestProcessWebhook_RetriesConcurrentModification(t *testing.T) {
+	var changes []domain.StatusChange
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending, Version: 1}, nil
+		},
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			// Outra notificação autorizou o pagamento depois da leitura.
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusAuthorized, Version: 2}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			changes = append(changes, change)
+			if change.Version == 1 {
+				return &domain.ConcurrentModificationError{PaymentID: id, Expected: 1, Current: 2}
+			}
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected the update to be retried once, got %+v", changes)
+	}
+	if changes[1].Version != 2 || changes[1].Audit.PreviousStatus != domain.StatusAuthorized {
+		t.Errorf("expected the retry to use the re-read payment, got %+v", changes[1])
+	}
+}
+
+func TestProcessWebhook_ConcurrentModificationInvalidatesTransition(t *testing.T) {
+	calls := 0
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending, Version: 1}, nil
+		},
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusCancelled, Version: 2}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			calls++
+			return &domain.ConcurrentModificationError{PaymentID: id, Expected: change.Version, Current: 2}
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+		t.Fatalf("expected the now illegal transition to be acknowledged, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single write attempt, got %d", calls)
+	}
+}
+
 func TestProcessWebhook_NotFoundLocal(t *testing.T) {
 	repo := &MockRepo{
 		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
 			return nil, nil // Not found locally
 		},
 	}
-	mp := &MockMPClient{
-		GetPaymentDetailsFunc: func(ctx context.Context, id string) (*domain.MPPaymentResponse, error) {
-			return &domain.MPPaymentResponse{Status: "approved", ExternalReference: "ext-unknown"}, nil
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-unknown"}, nil
 		},
 	}
 
-	svc := NewPaymentService(repo, mp, nil)
+	svc := NewPaymentService(repo, NewProviders(mp))
 
-	notification := domain.MPWebhookNotification{
-		Type: "payment",
-		Data: struct {
-			ID string `json:"id"`
-		}{ID: "mp-123"},
-	}
+	notification := webhookRequest("mp-123")
 
-	err := svc.ProcessWebhook(context.Background(), notification)
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", notification)
 	if err != nil {
 		t.Fatalf("expected no error (just log warn), got %v", err)
 	}
 }
 
 func TestProcessWebhook_MPError(t *testing.T) {
-	mp := &MockMPClient{
-		GetPaymentDetailsFunc: func(ctx context.Context, id string) (*domain.MPPaymentResponse, error) {
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
 			return nil, errors.New("api error")
 		},
 	}
-	svc := NewPaymentService(nil, mp, nil)
-	err := svc.ProcessWebhook(context.Background(), domain.MPWebhookNotification{Type: "payment"})
+	svc := NewPaymentService(nil, NewProviders(mp))
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123"))
 	if err == nil {
-		t.Fatal("expected error from MP Client")
+		t.Fatal("expected error from provider")
 	}
 }
 
-func TestProcessWebhook_SNSError(t *testing.T) {
+func TestProcessWebhook_WritesOutboxEvent(t *testing.T) {
+	var written []domain.OutboxEvent
 	repo := &MockRepo{
 		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
-			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1"}, nil
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
 		},
-		UpdateStatusFunc: func(ctx context.Context, id string, status domain.PaymentStatus) error {
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			if change.ProviderPaymentID != "mp-123" {
+				t.Errorf("expected mercadopago payment id to be stored, got %q", change.ProviderPaymentID)
+			}
+			written = events
 			return nil
 		},
 	}
-	mp := &MockMPClient{
-		GetPaymentDetailsFunc: func(ctx context.Context, id string) (*domain.MPPaymentResponse, error) {
-			return &domain.MPPaymentResponse{Status: "approved", ExternalReference: "ext-1"}, nil
-		},
-	}
-	publisher := &MockPublisher{
-		PublishFunc: func(ctx context.Context, event domain.PaymentProcessedEvent) error {
-			return errors.New("sns error")
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
 		},
 	}
 
-	svc := NewPaymentService(repo, mp, publisher)
+	svc := NewPaymentService(repo, NewProviders(mp))
 
-	notification := domain.MPWebhookNotification{
-		Type: "payment",
-		Data: struct {
-			ID string `json:"id"`
-		}{ID: "mp-123"},
-	}
+	notification := webhookRequest("mp-123")
 
-	err := svc.ProcessWebhook(context.Background(), notification)
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", notification)
 	if err != nil {
-		t.Fatalf("expected no error from webhook even if SNS fails, got %v", err)
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(written) != 1 {
+		t.Fatalf("expected one outbox event written with the status update, got %d", len(written))
+	}
+	event := written[0]
+	if event.Status != domain.OutboxPending || event.EventType != domain.EventTypePaymentProcessed {
+		t.Errorf("unexpected outbox event: %+v", event)
+	}
+	var payload domain.PaymentProcessedEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		t.Fatalf("expected JSON payload, got %v", err)
+	}
+	if payload.PaymentID != "local-1" || payload.Status != domain.StatusApproved {
+		t.Errorf("unexpected event payload: %+v", payload)
 	}
 }
 
 func TestProcessWebhook_UnknownType(t *testing.T) {
-	svc := NewPaymentService(nil, nil, nil)
-	err := svc.ProcessWebhook(context.Background(), domain.MPWebhookNotification{Type: "unknown"})
+	svc := NewPaymentService(nil, NewProviders(&MockProvider{}))
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest(""))
 	if err != nil {
 		t.Fatal("should ignore unknown notification types")
 	}
 }
 
+func TestProcessWebhook_UnknownProvider(t *testing.T) {
+	svc := NewPaymentService(nil, NewProviders(&MockProvider{}))
+	err := svc.ProcessWebhook(context.Background(), "pix", webhookRequest("mp-123"))
+	if !errors.Is(err, domain.ErrUnknownProvider) {
+		t.Fatalf("expected ErrUnknownProvider, got %v", err)
+	}
+}
+
+func TestProcessWebhook_InvalidSignature(t *testing.T) {
+	mp := &MockProvider{
+		ParseWebhookFunc: func(ctx context.Context, req domain.WebhookRequest) (*domain.WebhookEvent, error) {
+			return nil, domain.ErrInvalidWebhookSignature
+		},
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			t.Error("provider should not be queried for an unsigned notification")
+			return nil, nil
+		},
+	}
+	svc := NewPaymentService(nil, NewProviders(mp))
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123"))
+	if !errors.Is(err, domain.ErrInvalidWebhookSignature) {
+		t.Fatalf("expected ErrInvalidWebhookSignature, got %v", err)
+	}
+}
+
 func TestProcessWebhook_RepoGetError(t *testing.T) {
 	repo := &MockRepo{
 		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
 			return nil, errors.New("db error")
 		},
 	}
-	mp := &MockMPClient{
-		GetPaymentDetailsFunc: func(ctx context.Context, id string) (*domain.MPPaymentResponse, error) {
-			return &domain.MPPaymentResponse{Status: "approved", ExternalReference: "ext-1"}, nil
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
 		},
 	}
-	svc := NewPaymentService(repo, mp, nil)
-	err := svc.ProcessWebhook(context.Background(), domain.MPWebhookNotification{
-		Type: "payment",
-		Data: struct {
-			ID string `json:"id"`
-		}{ID: "mp-123"},
-	})
+	svc := NewPaymentService(repo, NewProviders(mp))
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123"))
 	if err == nil {
 		t.Fatal("expected error from repo Get")
 	}
 }
 
+func TestProcessWebhook_DuplicateNotificationAcknowledged(t *testing.T) {
+	updates := 0
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			updates++
+			return nil
+		},
+	}
+	lookups := 0
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			lookups++
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp), WithNotificationStore(memory.NewNotificationStore(), time.Hour))
+
+	for i := 0; i < 2; i++ {
+		if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if lookups != 1 || updates != 1 {
+		t.Errorf("expected the repeated notification to be skipped, got %d lookups and %d updates", lookups, updates)
+	}
+}
+
+func TestProcessWebhook_FailedNotificationIsReprocessed(t *testing.T) {
+	failures := 1
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			if failures > 0 {
+				failures--
+				return errors.New("update error")
+			}
+			return nil
+		},
+	}
+	lookups := 0
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			lookups++
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp), WithNotificationStore(memory.NewNotificationStore(), time.Hour))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err == nil {
+		t.Fatal("expected error from repo Update")
+	}
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+		t.Fatalf("expected the redelivery to be processed, got %v", err)
+	}
+	if lookups != 2 {
+		t.Errorf("expected 2 lookups, got %d", lookups)
+	}
+}
+
+func chargeWebhook(chargeID string) *MockProvider {
+	return &MockProvider{
+		ParseWebhookFunc: func(ctx context.Context, req domain.WebhookRequest) (*domain.WebhookEvent, error) {
+			return &domain.WebhookEvent{Type: "order", ChargeID: chargeID}, nil
+		},
+	}
+}
+
+func TestProcessWebhook_OrderClosedAtPOS(t *testing.T) {
+	cases := map[string]struct {
+		chargeStatus domain.PaymentStatus
+		wantEvent    string
+	}{
+		"cancelled": {domain.StatusCancelled, domain.EventTypePaymentProcessed},
+		"expired":   {domain.StatusExpired, domain.EventTypePaymentExpired},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var change domain.StatusChange
+			var events []domain.OutboxEvent
+			repo := &MockRepo{
+				GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+					return &domain.Payment{ID: "local-1", ExternalReference: ref, Status: domain.StatusPending, ProviderChargeID: "ORD1"}, nil
+				},
+				UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, e ...domain.OutboxEvent) error {
+					change, events = c, e
+					return nil
+				},
+			}
+			mp := chargeWebhook("ORD1")
+			mp.GetChargeFunc = func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+				return &domain.ProviderCharge{ID: chargeID, ExternalReference: "ext-1", Status: tc.chargeStatus, RawStatus: name}, nil
+			}
+			svc := NewPaymentService(repo, NewProviders(mp))
+
+			if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("")); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if change.Status != tc.chargeStatus || change.ProviderPaymentID != "" {
+				t.Errorf("unexpected status change: %+v", change)
+			}
+			if len(events) != 1 || events[0].EventType != tc.wantEvent {
+				t.Errorf("expected %s event, got %+v", tc.wantEvent, events)
+			}
+		})
+	}
+}
+
+func TestProcessWebhook_OrderNotificationSkipped(t *testing.T) {
+	cases := map[string]domain.ProviderCharge{
+		"open order":           {ID: "ORD1", ExternalReference: "ext-1", Status: domain.StatusPending},
+		"approved order":       {ID: "ORD1", ExternalReference: "ext-1", Status: domain.StatusApproved},
+		"previous order of os": {ID: "ORD0", ExternalReference: "ext-1", Status: domain.StatusExpired},
+	}
+	for name, charge := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := &MockRepo{
+				GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+					return &domain.Payment{ID: "local-1", ExternalReference: ref, Status: domain.StatusPending, ProviderChargeID: "ORD1"}, nil
+				},
+				UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+					t.Errorf("expected no update, got %+v", change)
+					return nil
+				},
+			}
+			mp := chargeWebhook(charge.ID)
+			mp.GetChargeFunc = func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+				return &charge, nil
+			}
+			svc := NewPaymentService(repo, NewProviders(mp))
+
+			if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("")); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessWebhook_MerchantOrderClosed(t *testing.T) {
+	cases := map[string]struct {
+		payment    domain.Payment
+		paymentIDs []string
+		wantUpdate bool
+	}{
+		"only attempt": {
+			payment:    domain.Payment{ID: "local-1", Status: domain.StatusPending, ProviderChargeID: "ORD1"},
+			wantUpdate: true,
+		},
+		"retry without payments": {
+			payment: domain.Payment{ID: "local-2", Status: domain.StatusPending, ProviderChargeID: "ORD2", PreviousAttemptID: "local-1"},
+		},
+		"retry with a payment in the order": {
+			payment:    domain.Payment{ID: "local-2", Status: domain.StatusAuthorized, ProviderChargeID: "ORD2", ProviderPaymentID: "456", PreviousAttemptID: "local-1"},
+			paymentIDs: []string{"456"},
+			wantUpdate: true,
+		},
+		"retry with a payment of another attempt": {
+			payment:    domain.Payment{ID: "local-2", Status: domain.StatusAuthorized, ProviderChargeID: "ORD2", ProviderPaymentID: "789", PreviousAttemptID: "local-1"},
+			paymentIDs: []string{"456"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			updated := false
+			repo := &MockRepo{
+				GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+					payment := tc.payment
+					payment.ExternalReference = ref
+					return &payment, nil
+				},
+				UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+					updated = change.Status == domain.StatusCancelled
+					return nil
+				},
+			}
+			mp := chargeWebhook("123")
+			mp.GetChargeFunc = func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+				return &domain.ProviderCharge{
+					ID:                chargeID,
+					ExternalReference: "ext-1",
+					Status:            domain.StatusCancelled,
+					RawStatus:         "payment_required",
+					PaymentIDs:        tc.paymentIDs,
+					Linked:            true,
+				}, nil
+			}
+			svc := NewPaymentService(repo, NewProviders(mp))
+
+			if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("")); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if updated != tc.wantUpdate {
+				t.Errorf("expected update %v, got %v", tc.wantUpdate, updated)
+			}
+		})
+	}
+}
+
+// retryAttempts monta uma referência com duas tentativas: local-1 recusada na
+// ordem ORD1 pelo pagamento 11 e local-2 pendente na ordem ORD2.
+func retryAttempts(updates map[string]domain.StatusChange) *MockRepo {
+	attempts := map[string]domain.Payment{
+		"local-1": {ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusRejected, ProviderChargeID: "ORD1", ProviderPaymentID: "11"},
+		"local-2": {ID: "local-2", ExternalReference: "ext-1", Status: domain.StatusPending, ProviderChargeID: "ORD2", PreviousAttemptID: "local-1"},
+	}
+	return &MockRepo{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Payment, error) {
+			payment, ok := attempts[id]
+			if !ok {
+				return nil, nil
+			}
+			return &payment, nil
+		},
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			payment := attempts["local-2"]
+			return &payment, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			updates[id] = change
+			return nil
+		},
+	}
+}
+
+func retryProvider(payments map[string]domain.PaymentStatus, chargePayments map[string][]string) *MockProvider {
+	return &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{ID: id, Status: payments[id], RawStatus: string(payments[id]), ExternalReference: "ext-1"}, nil
+		},
+		GetChargeFunc: func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: chargeID, ExternalReference: "ext-1", PaymentIDs: chargePayments[chargeID]}, nil
+		},
+	}
+}
+
+func TestProcessWebhook_RetryAttempts(t *testing.T) {
+	cases := map[string]struct {
+		paymentID      string
+		status         domain.PaymentStatus
+		chargePayments map[string][]string
+		wantUpdates    map[string]domain.PaymentStatus
+	}{
+		"late notification of the previous attempt": {
+			paymentID:      "11",
+			status:         domain.StatusRejected,
+			chargePayments: map[string][]string{"ORD1": {"11"}},
+			wantUpdates:    map[string]domain.PaymentStatus{},
+		},
+		"payment of the current attempt": {
+			paymentID:      "12",
+			status:         domain.StatusApproved,
+			chargePayments: map[string][]string{"ORD1": {"11"}, "ORD2": {"12"}},
+			wantUpdates:    map[string]domain.PaymentStatus{"local-2": domain.StatusApproved},
+		},
+		"payment of no attempt": {
+			paymentID:      "99",
+			status:         domain.StatusApproved,
+			chargePayments: map[string][]string{"ORD1": {"11"}},
+			wantUpdates:    map[string]domain.PaymentStatus{},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			updates := map[string]domain.StatusChange{}
+			mp := retryProvider(map[string]domain.PaymentStatus{tc.paymentID: tc.status}, tc.chargePayments)
+			svc := NewPaymentService(retryAttempts(updates), NewProviders(mp))
+
+			if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest(tc.paymentID)); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(updates) != len(tc.wantUpdates) {
+				t.Fatalf("expected updates %v, got %+v", tc.wantUpdates, updates)
+			}
+			for id, status := range tc.wantUpdates {
+				if updates[id].Status != status {
+					t.Errorf("expected %s to be %s, got %+v", id, status, updates[id])
+				}
+			}
+		})
+	}
+}
+
 func TestProcessWebhook_RepoUpdateError(t *testing.T) {
 	repo := &MockRepo{
 		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
-			return &domain.Payment{ID: "local-1"}, nil
+			return &domain.Payment{ID: "local-1", Status: domain.StatusPending}, nil
 		},
-		UpdateStatusFunc: func(ctx context.Context, id string, status domain.PaymentStatus) error {
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
 			return errors.New("update error")
 		},
 	}
-	mp := &MockMPClient{
-		GetPaymentDetailsFunc: func(ctx context.Context, id string) (*domain.MPPaymentResponse, error) {
-			return &domain.MPPaymentResponse{Status: "approved", ExternalReference: "ext-1"}, nil
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
 		},
 	}
-	svc := NewPaymentService(repo, mp, nil)
-	err := svc.ProcessWebhook(context.Background(), domain.MPWebhookNotification{
-		Type: "payment",
-		Data: struct {
-			ID string `json:"id"`
-		}{ID: "mp-123"},
-	})
+	svc := NewPaymentService(repo, NewProviders(mp))
+	err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123"))
 	if err == nil {
 		t.Fatal("expected error from repo Update")
 	}
 }
-
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+// Providers resolve o gateway de pagamento pelo nome. O primeiro gateway
+// informado é o padrão para requisições que não escolhem um.
+type Providers struct {
+	byName      map[string]domain.PaymentProvider
+	defaultName string
+}
+
+func NewProviders(defaultProvider domain.PaymentProvider, others ...domain.PaymentProvider) *Providers {
+	p := &Providers{
+		byName:      map[string]domain.PaymentProvider{},
+		defaultName: defaultProvider.Name(),
+	}
+	for _, provider := range append([]domain.PaymentProvider{defaultProvider}, others...) {
+		p.byName[provider.Name()] = provider
+	}
+	return p
+}
+
+// SetDefault troca o gateway usado quando a requisição não escolhe um.
+func (p *Providers) SetDefault(name string) error {
+	if _, err := p.Get(name); err != nil {
+		return err
+	}
+	p.defaultName = name
+	return nil
+}
+
+// Get retorna o gateway pelo nome; nome vazio retorna o padrão.
+func (p *Providers) Get(name string) (domain.PaymentProvider, error) {
+	if name == "" {
+		name = p.defaultName
+	}
+	provider, ok := p.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// For retorna o gateway em que o pagamento foi criado.
+func (p *Providers) For(payment domain.Payment) (domain.PaymentProvider, error) {
+	return p.Get(payment.ProviderName())
+}
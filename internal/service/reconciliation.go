@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultReconciliationInterval = 10 * time.Minute
+	// DefaultReconciliationWindow define até quando um pagamento atualizado
+	// recentemente ainda é conferido, além de todos os pendentes.
+	DefaultReconciliationWindow = 24 * time.Hour
+)
+
+// reconcilerActor identifica a reconciliação no histórico de status.
+const reconcilerActor = "reconciler"
+
+// Reconciler confere os pagamentos locais com o gateway para recuperar
+// webhooks perdidos. Divergências são corrigidas pela mesma lógica de
+// transição do webhook e registradas no relatório.
+type Reconciler struct {
+	payments *PaymentService
+	window   time.Duration
+}
+
+func NewReconciler(payments *PaymentService, window time.Duration) *Reconciler {
+	return &Reconciler{
+		payments: payments,
+		window:   window,
+	}
+}
+
+// Run executa a reconciliação a cada interval até o contexto ser cancelado.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := r.Reconcile(ctx)
+		if err != nil {
+			logger.FromContext(ctx).Error("reconciliation failed", zap.Error(err))
+			continue
+		}
+		for _, d := range report.Discrepancies {
+			logger.FromContext(ctx).Warn("reconciliation discrepancy",
+				zap.String("payment_id", d.PaymentID),
+				zap.String("local_status", string(d.LocalStatus)),
+				zap.String("provider_status", string(d.ProviderStatus)),
+				zap.String("action", string(d.Action)),
+				zap.String("error", d.Error),
+			)
+		}
+	}
+}
+
+// Reconcile confere os pagamentos pendentes e os atualizados dentro da janela.
+func (r *Reconciler) Reconcile(ctx context.Context) (*domain.ReconciliationReport, error) {
+	report := &domain.ReconciliationReport{
+		StartedAt:     time.Now().UTC(),
+		Discrepancies: []domain.Discrepancy{},
+	}
+
+	updatedFrom := report.StartedAt.Add(-r.window)
+	candidates, err := r.collect(ctx,
+		domain.PaymentFilter{Status: domain.StatusPending},
+		domain.PaymentFilter{UpdatedFrom: &updatedFrom},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.Checked++
+		if d, found := r.reconcilePayment(ctx, &candidates[i]); found {
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	logger.FromContext(ctx).Info("reconciliation finished",
+		zap.Int("checked", report.Checked),
+		zap.Int("discrepancies", len(report.Discrepancies)),
+		zap.Duration("duration", report.FinishedAt.Sub(report.StartedAt)),
+	)
+	return report, nil
+}
+
+// collect percorre todas as páginas de cada filtro, sem repetir pagamentos.
+func (r *Reconciler) collect(ctx context.Context, filters ...domain.PaymentFilter) ([]domain.Payment, error) {
+	seen := map[string]bool{}
+	var payments []domain.Payment
+	for _, filter := range filters {
+		filter.Limit = domain.MaxPageLimit
+		for {
+			page, err := r.payments.repo.List(ctx, filter)
+			if err != nil {
+				return nil, err
+			}
+			for _, payment := range page.Items {
+				if !seen[payment.ID] {
+					seen[payment.ID] = true
+					payments = append(payments, payment)
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+	}
+	return payments, nil
+}
+
+func (r *Reconciler) reconcilePayment(ctx context.Context, payment *domain.Payment) (domain.Discrepancy, bool) {
+	ctx = logger.WithPaymentID(ctx, payment.ID)
+	d := domain.Discrepancy{
+		PaymentID:         payment.ID,
+		ExternalReference: payment.ExternalReference,
+		Provider:          payment.ProviderName(),
+		LocalStatus:       payment.Status,
+	}
+
+	provider, err := r.payments.providers.For(*payment)
+	if err != nil {
+		d.Action = domain.ReconciliationError
+		d.Error = err.Error()
+		return d, true
+	}
+
+	results, err := provider.SearchPayments(ctx, payment.ExternalReference)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to search payments in provider",
+			zap.Error(err),
+			zap.String("provider", provider.Name()),
+		)
+		d.Action = domain.ReconciliationError
+		d.Error = err.Error()
+		return d, true
+	}
+
+	results, err = r.payments.attemptPayments(ctx, provider, payment, results)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to filter the provider payments of the attempt",
+			zap.Error(err),
+			zap.String("provider", provider.Name()),
+		)
+		d.Action = domain.ReconciliationError
+		d.Error = err.Error()
+		return d, true
+	}
+
+	providerPayment := selectProviderPayment(results)
+	if providerPayment == nil {
+		switch payment.Status {
+		case domain.StatusPending, domain.StatusCancelled, domain.StatusExpired:
+			return d, false
+		}
+		d.Action = domain.ReconciliationNotFound
+		return d, true
+	}
+
+	d.ProviderStatus = providerPayment.Status
+	d.ProviderPaymentID = providerPayment.ID
+	audit := domain.StatusAudit{
+		Source: domain.SourceReconciliation,
+		Actor:  reconcilerActor,
+	}
+	changed, err := r.payments.syncProviderPayment(ctx, payment, *providerPayment, audit)
+	switch {
+	case errors.Is(err, domain.ErrInvalidTransition):
+		d.Action = domain.ReconciliationManualReview
+	case err != nil:
+		d.Action = domain.ReconciliationError
+		d.Error = err.Error()
+	case !changed:
+		return d, false
+	default:
+		d.Action = domain.ReconciliationCorrected
+	}
+	return d, true
+}
+
+// selectProviderPayment escolhe, entre as tentativas de pagamento da mesma
+// referência, a que efetivamente capturou o valor; sem nenhuma, a mais recente.
+func selectProviderPayment(results []domain.ProviderPayment) *domain.ProviderPayment {
+	for i := range results {
+		switch results[i].Status {
+		case domain.StatusAuthorized, domain.StatusApproved, domain.StatusRefunded, domain.StatusChargedBack:
+			return &results[i]
+		}
+	}
+	if len(results) > 0 {
+		return &results[0]
+	}
+	return nil
+}
+
+// statusMatches compara os status considerando que o gateway pode manter
+// approved após um estorno parcial.
+func statusMatches(local, provider domain.PaymentStatus) bool {
+	return local == provider ||
+		(local == domain.StatusPartiallyRefunded && provider == domain.StatusApproved)
+}
+
+const (
+	ReportFormatJSON = "json"
+	ReportFormatCSV  = "csv"
+)
+
+// WriteReconciliationReport grava o relatório em JSON ou CSV. O CSV tem uma
+// linha por divergência.
+func WriteReconciliationReport(w io.Writer, report *domain.ReconciliationReport, format string) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case ReportFormatCSV:
+		writer := csv.NewWriter(w)
+		_ = writer.Write([]string{"payment_id", "external_reference", "local_status", "provider", "provider_status", "provider_payment_id", "action", "error"})
+		for _, d := range report.Discrepancies {
+			_ = writer.Write([]string{
+				d.PaymentID,
+				d.ExternalReference,
+				string(d.LocalStatus),
+				d.Provider,
+				string(d.ProviderStatus),
+				d.ProviderPaymentID,
+				string(d.Action),
+				d.Error,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
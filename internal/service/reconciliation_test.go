@@ -0,0 +1,243 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+)
+
+func reconciliationRepo(pending, recent []domain.Payment, updates map[string]domain.StatusChange) *MockRepo {
+	return &MockRepo{
+		ListFunc: func(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+			if filter.Status == domain.StatusPending {
+				return &domain.PaymentPage{Items: pending}, nil
+			}
+			if filter.UpdatedFrom == nil {
+				return nil, errors.New("unexpected filter")
+			}
+			return &domain.PaymentPage{Items: recent}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			updates[id] = change
+			return nil
+		},
+	}
+}
+
+func TestReconcile_FixesLostWebhook(t *testing.T) {
+	updates := map[string]domain.StatusChange{}
+	pending := []domain.Payment{
+		{ID: "p1", ExternalReference: "ref-1", Status: domain.StatusPending},
+		{ID: "p2", ExternalReference: "ref-2", Status: domain.StatusPending},
+	}
+	// p1 aparece nas duas consultas e deve ser conferido uma única vez.
+	recent := []domain.Payment{
+		{ID: "p1", ExternalReference: "ref-1", Status: domain.StatusPending},
+		{ID: "p3", ExternalReference: "ref-3", Status: domain.StatusApproved},
+	}
+	mp := &MockProvider{
+		SearchPaymentsFunc: func(ctx context.Context, ref string) ([]domain.ProviderPayment, error) {
+			switch ref {
+			case "ref-1":
+				// A tentativa aprovada vence a rejeitada mais recente.
+				return []domain.ProviderPayment{
+					{ID: "11", Status: domain.StatusRejected, RawStatus: "rejected", ExternalReference: ref},
+					{ID: "10", Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: ref},
+				}, nil
+			case "ref-3":
+				return []domain.ProviderPayment{{ID: "30", Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: ref}}, nil
+			}
+			return nil, nil
+		},
+	}
+
+	svc := NewPaymentService(reconciliationRepo(pending, recent, updates), NewProviders(mp))
+	report, err := NewReconciler(svc, time.Hour).Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if report.Checked != 3 {
+		t.Errorf("expected 3 payments checked, got %d", report.Checked)
+	}
+	if len(report.Discrepancies) != 1 {
+		t.Fatalf("expected 1 discrepancy, got %+v", report.Discrepancies)
+	}
+	d := report.Discrepancies[0]
+	if d.PaymentID != "p1" || d.Action != domain.ReconciliationCorrected || d.ProviderStatus != domain.StatusApproved || d.LocalStatus != domain.StatusPending {
+		t.Errorf("unexpected discrepancy: %+v", d)
+	}
+	if change, ok := updates["p1"]; !ok || change.Status != domain.StatusApproved || change.ProviderPaymentID != "10" {
+		t.Errorf("expected p1 to be approved with mp payment 10, got %+v", change)
+	}
+}
+
+func TestReconcile_ReportsUnfixableDiscrepancies(t *testing.T) {
+	updates := map[string]domain.StatusChange{}
+	recent := []domain.Payment{
+		{ID: "p1", ExternalReference: "ref-1", Status: domain.StatusRefunded},
+		{ID: "p2", ExternalReference: "ref-2", Status: domain.StatusApproved},
+		{ID: "p3", ExternalReference: "ref-3", Status: domain.StatusPartiallyRefunded},
+		{ID: "p4", ExternalReference: "ref-4", Status: domain.StatusApproved},
+	}
+	mp := &MockProvider{
+		SearchPaymentsFunc: func(ctx context.Context, ref string) ([]domain.ProviderPayment, error) {
+			switch ref {
+			case "ref-1":
+				return []domain.ProviderPayment{{ID: "10", Status: domain.StatusApproved, RawStatus: "approved"}}, nil
+			case "ref-3":
+				return []domain.ProviderPayment{{ID: "30", Status: domain.StatusApproved, RawStatus: "approved"}}, nil
+			case "ref-4":
+				return nil, errors.New("mp api error")
+			}
+			return nil, nil
+		},
+	}
+
+	svc := NewPaymentService(reconciliationRepo(nil, recent, updates), NewProviders(mp))
+	report, err := NewReconciler(svc, time.Hour).Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	actions := map[string]domain.ReconciliationAction{}
+	for _, d := range report.Discrepancies {
+		actions[d.PaymentID] = d.Action
+	}
+	expected := map[string]domain.ReconciliationAction{
+		"p1": domain.ReconciliationManualReview,
+		"p2": domain.ReconciliationNotFound,
+		"p4": domain.ReconciliationError,
+	}
+	if len(actions) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, actions)
+	}
+	for id, action := range expected {
+		if actions[id] != action {
+			t.Errorf("%s: expected %s, got %s", id, action, actions[id])
+		}
+	}
+	if len(updates) != 0 {
+		t.Errorf("expected no status update, got %+v", updates)
+	}
+}
+
+func TestReconcile_RetryAttemptIgnoresPreviousAttemptPayments(t *testing.T) {
+	cases := map[string]struct {
+		chargePayments map[string][]string
+		results        []domain.ProviderPayment
+		wantStatus     domain.PaymentStatus
+	}{
+		"only the rejected payment of the previous attempt": {
+			chargePayments: map[string][]string{"ORD1": {"11"}},
+			results:        []domain.ProviderPayment{{ID: "11", Status: domain.StatusRejected, RawStatus: "rejected"}},
+		},
+		"approved payment of the current attempt": {
+			chargePayments: map[string][]string{"ORD1": {"11"}, "ORD2": {"12"}},
+			results: []domain.ProviderPayment{
+				{ID: "12", Status: domain.StatusApproved, RawStatus: "approved"},
+				{ID: "11", Status: domain.StatusRejected, RawStatus: "rejected"},
+			},
+			wantStatus: domain.StatusApproved,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			updates := map[string]domain.StatusChange{}
+			repo := retryAttempts(updates)
+			repo.ListFunc = func(ctx context.Context, filter domain.PaymentFilter) (*domain.PaymentPage, error) {
+				if filter.Status != domain.StatusPending {
+					return &domain.PaymentPage{}, nil
+				}
+				current, _ := repo.GetByID(ctx, "local-2")
+				return &domain.PaymentPage{Items: []domain.Payment{*current}}, nil
+			}
+			mp := retryProvider(nil, tc.chargePayments)
+			mp.SearchPaymentsFunc = func(ctx context.Context, ref string) ([]domain.ProviderPayment, error) {
+				return tc.results, nil
+			}
+			svc := NewPaymentService(repo, NewProviders(mp))
+
+			if _, err := NewReconciler(svc, time.Hour).Reconcile(context.Background()); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if change := updates["local-2"]; change.Status != tc.wantStatus {
+				t.Errorf("expected status %q, got %+v", tc.wantStatus, change)
+			}
+		})
+	}
+}
+
+func TestReconcile_PendingPaymentApprovedAndRefundedAtProvider(t *testing.T) {
+	var changes []domain.StatusChange
+	pending := []domain.Payment{
+		{ID: "p1", ExternalReference: "ref-1", Amount: domain.NewMoney(10000, "BRL"), Status: domain.StatusPending},
+	}
+	repo := reconciliationRepo(pending, nil, map[string]domain.StatusChange{})
+	repo.UpdateStatusFunc = func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+		changes = append(changes, change)
+		return nil
+	}
+	mp := &MockProvider{
+		SearchPaymentsFunc: func(ctx context.Context, ref string) ([]domain.ProviderPayment, error) {
+			return []domain.ProviderPayment{{
+				ID:                "10",
+				Status:            domain.StatusApproved,
+				RawStatus:         "approved",
+				ExternalReference: ref,
+				Refunds:           []domain.ProviderRefund{{ID: "987", Status: "approved", Amount: domain.NewMoney(3000, "BRL")}},
+			}}, nil
+		},
+	}
+
+	svc := NewPaymentService(repo, NewProviders(mp))
+	report, err := NewReconciler(svc, time.Hour).Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].Action != domain.ReconciliationCorrected {
+		t.Fatalf("expected the payment to be corrected, got %+v", report.Discrepancies)
+	}
+	if len(changes) != 2 || changes[0].Status != domain.StatusApproved || changes[0].ProviderPaymentID != "10" ||
+		changes[1].Status != domain.StatusPartiallyRefunded || changes[1].RefundedAmount.Units != 3000 {
+		t.Errorf("expected approval followed by the refund, got %+v", changes)
+	}
+}
+
+func TestWriteReconciliationReport(t *testing.T) {
+	report := &domain.ReconciliationReport{
+		Checked: 2,
+		Discrepancies: []domain.Discrepancy{
+			{PaymentID: "p1", ExternalReference: "ref-1", Provider: "mercadopago", LocalStatus: domain.StatusPending, ProviderStatus: domain.StatusApproved, ProviderPaymentID: "10", Action: domain.ReconciliationCorrected},
+		},
+	}
+
+	var jsonOut bytes.Buffer
+	if err := WriteReconciliationReport(&jsonOut, report, ReportFormatJSON); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var decoded domain.ReconciliationReport
+	if err := json.Unmarshal(jsonOut.Bytes(), &decoded); err != nil || decoded.Checked != 2 || len(decoded.Discrepancies) != 1 {
+		t.Errorf("unexpected JSON report: %s", jsonOut.String())
+	}
+
+	var csvOut bytes.Buffer
+	if err := WriteReconciliationReport(&csvOut, report, ReportFormatCSV); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	if err != nil || len(rows) != 2 || rows[1][0] != "p1" || rows[1][6] != "corrected" {
+		t.Errorf("unexpected CSV report: %v (%v)", rows, err)
+	}
+
+	if err := WriteReconciliationReport(&bytes.Buffer{}, report, "xml"); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
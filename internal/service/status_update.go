@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"go.uber.org/zap"
+)
+
+// maxUpdateAttempts limita as releituras de um pagamento alterado por outra
+// escrita durante uma mudança de status.
+const maxUpdateAttempts = 3
+
+// errStatusUnchanged é retornado por um statusBuilder quando o pagamento
+// relido já está no status desejado e não há o que gravar.
+var errStatusUnchanged = errors.New("payment already in target status")
+
+// statusBuilder monta a mudança de status e os eventos do outbox a partir do
+// pagamento lido. Ele é chamado de novo a cada releitura e deve validar a
+// transição sobre o estado recebido.
+type statusBuilder func(payment *domain.Payment) (domain.StatusChange, []domain.OutboxEvent, error)
+
+// updateStatus grava a mudança montada por build com a versão lida do
+// pagamento. Se outra escrita alterou o pagamento nesse meio tempo, o
+// pagamento é relido e a transição reaplicada, até maxUpdateAttempts vezes.
+// Em caso de sucesso payment reflete o status e a versão gravados, os eventos
+// levam o trace de ctx e a mudança vira um evento do span corrente.
+func updateStatus(ctx context.Context, repo domain.PaymentRepository, payment *domain.Payment, build statusBuilder) error {
+	for attempt := 1; ; attempt++ {
+		change, events, err := build(payment)
+		if err != nil {
+			return err
+		}
+		change.Version = payment.Version
+		traceContext := injectTraceContext(ctx)
+		for i := range events {
+			events[i].TraceContext = traceContext
+		}
+
+		err = repo.UpdateStatus(ctx, payment.ID, change, events...)
+		if err == nil {
+			addStatusEvent(ctx, payment.ID, payment.Status, change)
+			payment.Status = change.Status
+			payment.Version = change.Version + 1
+			return nil
+		}
+		if !errors.Is(err, domain.ErrConcurrentModification) || attempt >= maxUpdateAttempts {
+			return err
+		}
+
+		logger.FromContext(ctx).Warn("payment modified concurrently, retrying status update",
+			zap.Error(err),
+			zap.String("new_status", string(change.Status)),
+			zap.Int("attempt", attempt),
+		)
+		current, err := repo.GetByID(ctx, payment.ID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return domain.ErrPaymentNotFound
+		}
+		*payment = *current
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// endSpan registra err no span, quando houver, e o encerra.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTraceContext serializa o trace de ctx para ser gravado junto com
+// eventos e notificações processados depois, fora da requisição. Retorna nil
+// quando ctx não está em um trace.
+func injectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// extractTraceContext devolve ctx no trace gravado por injectTraceContext.
+func extractTraceContext(ctx context.Context, traceContext map[string]string) context.Context {
+	if len(traceContext) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(traceContext))
+}
+
+// addStatusEvent registra a mudança de status como evento do span corrente.
+func addStatusEvent(ctx context.Context, paymentID string, previous domain.PaymentStatus, change domain.StatusChange) {
+	trace.SpanFromContext(ctx).AddEvent("payment.status_changed", trace.WithAttributes(
+		attribute.String("payment.id", paymentID),
+		attribute.String("payment.previous_status", string(previous)),
+		attribute.String("payment.status", string(change.Status)),
+		attribute.String("payment.status_source", string(change.Audit.Source)),
+	))
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useTraceContext instala o propagador W3C enquanto o teste roda.
+func useTraceContext(t *testing.T) {
+	t.Helper()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+}
+
+func endedSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("span %s not found", name)
+	return nil
+}
+
+func TestTracing_CreatePaymentSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	repo := &MockRepo{
+		SaveFunc: func(ctx context.Context, payment domain.Payment) error { return nil },
+	}
+	mp := &MockProvider{
+		CreateChargeFunc: func(ctx context.Context, req domain.CreatePaymentRequest) (*domain.ProviderCharge, error) {
+			return &domain.ProviderCharge{ID: "order-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	payment, err := svc.CreatePayment(context.Background(), domain.CreatePaymentRequest{
+		ExternalReference: "ORDER-1",
+		Amount:            domain.NewMoney(1050, "BRL"),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	span := endedSpan(t, recorder, "PaymentService.CreatePayment")
+	attrs := attribute.NewSet(span.Attributes()...)
+	if value, _ := attrs.Value("payment.id"); value.AsString() != payment.ID {
+		t.Errorf("expected payment.id %s, got %q", payment.ID, value.AsString())
+	}
+	if value, _ := attrs.Value("payment.provider"); value.AsString() != "mercadopago" {
+		t.Errorf("expected payment.provider mercadopago, got %q", value.AsString())
+	}
+}
+
+func TestTracing_ProcessWebhookRecordsStatusTransition(t *testing.T) {
+	useTraceContext(t)
+	recorder := tracetest.NewSpanRecorder()
+	var outboxEvents []domain.OutboxEvent
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: "ext-1", Status: domain.StatusPending}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, change domain.StatusChange, events ...domain.OutboxEvent) error {
+			outboxEvents = events
+			return nil
+		},
+	}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return &domain.ProviderPayment{Status: domain.StatusApproved, RawStatus: "approved", ExternalReference: "ext-1"}, nil
+		},
+	}
+	svc := NewPaymentService(repo, NewProviders(mp),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	span := endedSpan(t, recorder, "PaymentService.ProcessWebhook")
+	var transition *sdktrace.Event
+	for _, event := range span.Events() {
+		if event.Name == "payment.status_changed" {
+			transition = &event
+		}
+	}
+	if transition == nil {
+		t.Fatal("expected a payment.status_changed event")
+	}
+	attrs := attribute.NewSet(transition.Attributes...)
+	previous, _ := attrs.Value("payment.previous_status")
+	status, _ := attrs.Value("payment.status")
+	if previous.AsString() != "pending" || status.AsString() != "approved" {
+		t.Errorf("unexpected transition %s -> %s", previous.AsString(), status.AsString())
+	}
+
+	if len(outboxEvents) != 1 {
+		t.Fatalf("expected one outbox event, got %d", len(outboxEvents))
+	}
+	traceID := span.SpanContext().TraceID().String()
+	if traceparent := outboxEvents[0].TraceContext["traceparent"]; traceparent == "" || traceparent[3:35] != traceID {
+		t.Errorf("expected the outbox event in trace %s, got %q", traceID, traceparent)
+	}
+}
+
+func TestTracing_OutboxRelayContinuesEventTrace(t *testing.T) {
+	useTraceContext(t)
+	recorder := tracetest.NewSpanRecorder()
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	outbox := &MockOutboxRepo{
+		Pending: []domain.OutboxEvent{{
+			ID:           "evt-1",
+			EventType:    domain.EventTypePaymentProcessed,
+			PaymentID:    "local-1",
+			Status:       domain.OutboxPending,
+			Payload:      []byte(`{}`),
+			TraceContext: map[string]string{"traceparent": traceparent},
+		}},
+	}
+	var published trace.SpanContext
+	publisher := &MockPublisher{
+		PublishFunc: func(ctx context.Context, eventType string, payload []byte) error {
+			published = trace.SpanContextFromContext(ctx)
+			return nil
+		},
+	}
+	relay := NewOutboxRelay(outbox, publisher)
+	relay.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(instrumentationName)
+
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if published.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the publish to continue the event trace, got %s", published.TraceID())
+	}
+	span := endedSpan(t, recorder, "OutboxRelay.publish")
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected the span to be a child of the stored context, got parent %s", span.Parent().SpanID())
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/logger"
+	"github.com/alexssanderFonseca/pagamento/internal/resilience"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultWebhookConcurrency = 4
+	webhookPollInterval       = time.Second
+	webhookBatchSize          = 50
+	webhookMaxAttempts        = 8
+	// webhookClaimTTL é quanto tempo a reserva de uma notificação impede outros
+	// workers de processá-la; precisa cobrir as consultas ao gateway.
+	webhookClaimTTL = 2 * time.Minute
+)
+
+var webhookBackoff = resilience.Backoff{Base: 2 * time.Second, Max: 5 * time.Minute}
+
+// WebhookWorker processa as notificações gravadas no inbox. Notificações do
+// mesmo pagamento são processadas uma de cada vez, em ordem de chegada;
+// pagamentos diferentes andam em paralelo, até concurrency de cada vez.
+// Falhas são reagendadas com backoff até webhookMaxAttempts; depois disso a
+// notificação fica como dead até ser reprocessada pelo admin ou reentregue
+// pelo gateway, já que a reserva de deduplicação dela é liberada.
+//
+// Com várias réplicas, cada notificação é reservada antes de ser processada.
+// Se a reserva falha, outro worker está com o pagamento, e as notificações
+// seguintes dele ficam para esse worker.
+type WebhookWorker struct {
+	inbox       domain.InboxRepository
+	payments    *PaymentService
+	owner       string
+	claimTTL    time.Duration
+	concurrency int
+	interval    time.Duration
+	maxAttempts int
+	backoff     resilience.Backoff
+}
+
+// NewWebhookWorker cria o worker; concurrency não positivo usa
+// DefaultWebhookConcurrency.
+func NewWebhookWorker(inbox domain.InboxRepository, payments *PaymentService, concurrency int) *WebhookWorker {
+	if concurrency <= 0 {
+		concurrency = DefaultWebhookConcurrency
+	}
+	return &WebhookWorker{
+		inbox:       inbox,
+		payments:    payments,
+		owner:       uuid.NewString(),
+		claimTTL:    webhookClaimTTL,
+		concurrency: concurrency,
+		interval:    webhookPollInterval,
+		maxAttempts: webhookMaxAttempts,
+		backoff:     webhookBackoff,
+	}
+}
+
+// Run processa o inbox periodicamente até o contexto ser cancelado.
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.ProcessPending(ctx); err != nil {
+			logger.FromContext(ctx).Error("webhook worker iteration failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessPending processa um lote de notificações pendentes e retorna quantas
+// foram processadas com sucesso. O lote termina antes do próximo começar, o
+// que mantém a ordem por pagamento entre lotes.
+func (w *WebhookWorker) ProcessPending(ctx context.Context) (int, error) {
+	notifications, err := w.inbox.ListPending(ctx, time.Now().UTC(), webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	var keys []string
+	groups := map[string][]domain.InboxNotification{}
+	for _, notification := range notifications {
+		key := notification.OrderingKey()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], notification)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		processed int
+		slots     = make(chan struct{}, w.concurrency)
+	)
+	for _, key := range keys {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return processed, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(group []domain.InboxNotification) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			count := w.processGroup(ctx, group)
+			mu.Lock()
+			processed += count
+			mu.Unlock()
+		}(groups[key])
+	}
+	wg.Wait()
+	return processed, nil
+}
+
+// processGroup processa em ordem as notificações de um pagamento. Quando uma
+// delas é reagendada, as seguintes esperam a mesma nova tentativa para não
+// passarem à frente; elas são adiadas antes de a reserva da reagendada ser
+// liberada. O mesmo vale para uma notificação reagendada num lote anterior
+// (ver waitForEarlier).
+func (w *WebhookWorker) processGroup(ctx context.Context, group []domain.InboxNotification) int {
+	if w.waitForEarlier(ctx, group) {
+		return 0
+	}
+
+	processed := 0
+	for i := range group {
+		if ctx.Err() != nil || !w.claim(ctx, &group[i]) {
+			return processed
+		}
+
+		notification := &group[i]
+		if w.process(ctx, notification) {
+			processed++
+			continue
+		}
+		if notification.Status == domain.InboxDead {
+			w.update(ctx, *notification)
+			w.payments.releaseNotification(ctx, notification.Provider, notification.NotificationID)
+			continue
+		}
+
+		for _, next := range group[i+1:] {
+			if !w.claim(ctx, &next) {
+				break
+			}
+			next.NextAttemptAt = notification.NextAttemptAt
+			w.update(ctx, next)
+		}
+		w.update(ctx, *notification)
+		return processed
+	}
+	return processed
+}
+
+// waitForEarlier confere se o pagamento tem uma notificação pendente mais
+// antiga que o lote não trouxe, por ter sido reagendada antes dele. Nesse caso
+// o grupo é adiado para a nova tentativa dela e não é processado agora.
+func (w *WebhookWorker) waitForEarlier(ctx context.Context, group []domain.InboxNotification) bool {
+	first := group[0]
+	if first.OrderingKey() == first.ID {
+		return false
+	}
+
+	oldest, err := w.inbox.OldestPending(ctx, first.OrderingKey())
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to look up earlier webhook notifications",
+			zap.Error(err),
+			zap.String("inbox_id", first.ID),
+		)
+		return true
+	}
+	if oldest == nil || oldest.ID == first.ID || !oldest.CreatedAt.Before(first.CreatedAt) {
+		return false
+	}
+
+	logger.FromContext(ctx).Info("webhook notifications waiting for an earlier retry",
+		zap.String("inbox_id", first.ID),
+		zap.String("earlier_inbox_id", oldest.ID),
+		zap.Time("next_attempt_at", oldest.NextAttemptAt),
+	)
+	if !oldest.NextAttemptAt.After(time.Now().UTC()) {
+		// A anterior já venceu e entra num dos próximos lotes.
+		return true
+	}
+	for i := range group {
+		if !w.claim(ctx, &group[i]) {
+			break
+		}
+		group[i].NextAttemptAt = oldest.NextAttemptAt
+		w.update(ctx, group[i])
+	}
+	return true
+}
+
+// claim reserva a notificação para este worker e a troca pela versão gravada.
+func (w *WebhookWorker) claim(ctx context.Context, notification *domain.InboxNotification) bool {
+	now := time.Now().UTC()
+	claimed, err := w.inbox.Claim(ctx, notification.ID, w.owner, now, now.Add(w.claimTTL))
+	if errors.Is(err, domain.ErrInboxNotificationClaimed) {
+		logger.FromContext(ctx).Debug("webhook notification claimed by another worker, skipping",
+			zap.String("inbox_id", notification.ID),
+		)
+		return false
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to claim webhook notification",
+			zap.Error(err),
+			zap.String("inbox_id", notification.ID),
+		)
+		return false
+	}
+	*notification = claimed
+	return true
+}
+
+// process processa uma notificação reservada. O sucesso é gravado aqui; a
+// falha fica em notification para processGroup gravar.
+func (w *WebhookWorker) process(ctx context.Context, notification *domain.InboxNotification) bool {
+	notification.Attempts++
+	now := time.Now().UTC()
+
+	// O processamento continua o trace da requisição que gravou a notificação.
+	ctx, span := w.payments.tracer.Start(extractTraceContext(ctx, notification.TraceContext), "WebhookWorker.process",
+		trace.WithAttributes(
+			attribute.String("webhook.inbox_id", notification.ID),
+			attribute.String("webhook.provider_payment_id", notification.PaymentID),
+			attribute.Int("webhook.attempt", notification.Attempts),
+		))
+	err := w.payments.handleInboxNotification(ctx, *notification)
+	endSpan(span, err)
+	if err == nil {
+		notification.Status = domain.InboxProcessed
+		notification.LastError = ""
+		notification.ProcessedAt = &now
+		w.update(ctx, *notification)
+		logger.FromContext(ctx).Info("webhook notification processed",
+			zap.String("inbox_id", notification.ID),
+			zap.String("provider_payment_id", notification.PaymentID),
+			zap.Int("attempts", notification.Attempts),
+		)
+		return true
+	}
+
+	notification.LastError = err.Error()
+	if notification.Attempts >= w.maxAttempts || errors.Is(err, domain.ErrUnknownProvider) {
+		notification.Status = domain.InboxDead
+	} else {
+		notification.NextAttemptAt = now.Add(w.backoff.Delay(notification.Attempts - 1))
+	}
+
+	logger.FromContext(ctx).Error("failed to process webhook notification",
+		zap.Error(err),
+		zap.String("inbox_id", notification.ID),
+		zap.String("provider_payment_id", notification.PaymentID),
+		zap.Int("attempts", notification.Attempts),
+		zap.String("inbox_status", string(notification.Status)),
+	)
+	return false
+}
+
+func (w *WebhookWorker) update(ctx context.Context, notification domain.InboxNotification) {
+	if err := w.inbox.Update(ctx, notification); err != nil {
+		// A notificação continua pendente e será processada de novo; aplicar o
+		// mesmo status duas vezes não altera o pagamento.
+		logger.FromContext(ctx).Error("failed to record webhook notification attempt",
+			zap.Error(err),
+			zap.String("inbox_id", notification.ID),
+		)
+	}
+}
+
+// ListDead retorna as notificações que esgotaram as tentativas.
+func (w *WebhookWorker) ListDead(ctx context.Context, limit int) ([]domain.InboxNotification, error) {
+	return w.inbox.ListDead(ctx, limit)
+}
+
+// Replay devolve uma notificação dead para a fila, com as tentativas zeradas.
+func (w *WebhookWorker) Replay(ctx context.Context, id string) (*domain.InboxNotification, error) {
+	notification, err := w.inbox.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if notification == nil {
+		return nil, domain.ErrInboxNotificationNotFound
+	}
+	if notification.Status != domain.InboxDead {
+		return nil, domain.ErrInboxNotificationNotDead
+	}
+
+	notification.Status = domain.InboxPending
+	notification.Attempts = 0
+	notification.NextAttemptAt = time.Now().UTC()
+	if err := w.inbox.Update(ctx, *notification); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("webhook notification replayed", zap.String("inbox_id", notification.ID))
+	return notification, nil
+}
+
+// handleInboxNotification processa uma notificação do inbox com o gateway que
+// a recebeu. A assinatura já foi validada na gravação.
+func (s *PaymentService) handleInboxNotification(ctx context.Context, notification domain.InboxNotification) error {
+	provider, err := s.providers.Get(notification.Provider)
+	if err != nil {
+		return err
+	}
+	event := notification.Event()
+	return s.handleWebhookEvent(ctx, provider, &event)
+}
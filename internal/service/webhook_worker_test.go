@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexssanderFonseca/pagamento/internal/domain"
+	"github.com/alexssanderFonseca/pagamento/internal/repository/memory"
+)
+
+// Mock do Inbox
+type MockInboxRepo struct {
+	mu      sync.Mutex
+	Pending []domain.InboxNotification
+	// Waiting são as pendentes com a próxima tentativa no futuro, que
+	// ListPending não devolve.
+	Waiting   []domain.InboxNotification
+	Saved     []domain.InboxNotification
+	Updated   []domain.InboxNotification
+	GetFunc   func(ctx context.Context, id string) (*domain.InboxNotification, error)
+	ClaimFunc func(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.InboxNotification, error)
+}
+
+func (m *MockInboxRepo) Save(ctx context.Context, notification domain.InboxNotification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Saved = append(m.Saved, notification)
+	return nil
+}
+func (m *MockInboxRepo) Get(ctx context.Context, id string) (*domain.InboxNotification, error) {
+	return m.GetFunc(ctx, id)
+}
+func (m *MockInboxRepo) ListPending(ctx context.Context, now time.Time, limit int) ([]domain.InboxNotification, error) {
+	return m.Pending, nil
+}
+func (m *MockInboxRepo) Claim(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.InboxNotification, error) {
+	if m.ClaimFunc != nil {
+		return m.ClaimFunc(ctx, id, owner, now, expiresAt)
+	}
+	for _, notification := range m.Pending {
+		if notification.ID == id {
+			notification.ClaimedBy, notification.ClaimExpiresAt = owner, &expiresAt
+			return notification, nil
+		}
+	}
+	return domain.InboxNotification{}, domain.ErrInboxNotificationNotFound
+}
+func (m *MockInboxRepo) OldestPending(ctx context.Context, orderingKey string) (*domain.InboxNotification, error) {
+	var oldest *domain.InboxNotification
+	for _, notification := range append(slices.Clone(m.Pending), m.Waiting...) {
+		if notification.OrderingKey() != orderingKey {
+			continue
+		}
+		if oldest == nil || notification.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = &notification
+		}
+	}
+	return oldest, nil
+}
+func (m *MockInboxRepo) ListDead(ctx context.Context, limit int) ([]domain.InboxNotification, error) {
+	return nil, nil
+}
+func (m *MockInboxRepo) Update(ctx context.Context, notification domain.InboxNotification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Updated = append(m.Updated, notification)
+	return nil
+}
+
+// updated retorna a última versão gravada de cada notificação.
+func (m *MockInboxRepo) updated() map[string]domain.InboxNotification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latest := map[string]domain.InboxNotification{}
+	for _, notification := range m.Updated {
+		latest[notification.ID] = notification
+	}
+	return latest
+}
+
+func inboxNotification(id, paymentID string, createdAt time.Time) domain.InboxNotification {
+	return domain.InboxNotification{
+		ID:        id,
+		Provider:  "mercadopago",
+		Type:      "payment",
+		PaymentID: paymentID,
+		Status:    domain.InboxPending,
+		CreatedAt: createdAt,
+	}
+}
+
+func TestWebhookWorker_ProcessesPaymentNotificationsInOrder(t *testing.T) {
+	base := time.Now()
+	inbox := &MockInboxRepo{Pending: []domain.InboxNotification{
+		inboxNotification("in-3", "mp-1", base.Add(2*time.Second)),
+		inboxNotification("in-1", "mp-1", base),
+		inboxNotification("in-2", "mp-2", base.Add(time.Second)),
+	}}
+
+	var mu sync.Mutex
+	lookups := map[string][]time.Time{}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			mu.Lock()
+			lookups[id] = append(lookups[id], time.Now())
+			mu.Unlock()
+			return &domain.ProviderPayment{Status: domain.StatusApproved, ExternalReference: "ext-" + id}, nil
+		},
+	}
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return nil, nil
+		},
+	}
+	worker := NewWebhookWorker(inbox, NewPaymentService(repo, NewProviders(mp)), 2)
+
+	processed, err := worker.ProcessPending(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if processed != 3 {
+		t.Fatalf("expected 3 processed notifications, got %d", processed)
+	}
+	if len(lookups["mp-1"]) != 2 || len(lookups["mp-2"]) != 1 {
+		t.Errorf("unexpected lookups: %v", lookups)
+	}
+
+	var order []string
+	for _, notification := range inbox.Updated {
+		if notification.PaymentID == "mp-1" {
+			order = append(order, notification.ID)
+		}
+		if notification.Status != domain.InboxProcessed || notification.ProcessedAt == nil {
+			t.Errorf("expected %s to be processed, got %+v", notification.ID, notification)
+		}
+	}
+	if len(order) != 2 || order[0] != "in-1" || order[1] != "in-3" {
+		t.Errorf("expected notifications of mp-1 in arrival order, got %v", order)
+	}
+}
+
+func TestWebhookWorker_FailureDefersLaterNotifications(t *testing.T) {
+	base := time.Now()
+	inbox := &MockInboxRepo{Pending: []domain.InboxNotification{
+		inboxNotification("in-1", "mp-1", base),
+		inboxNotification("in-2", "mp-1", base.Add(time.Second)),
+	}}
+	calls := 0
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			calls++
+			return nil, errors.New("mp unavailable")
+		},
+	}
+	worker := NewWebhookWorker(inbox, NewPaymentService(&MockRepo{}, NewProviders(mp)), 1)
+
+	processed, _ := worker.ProcessPending(context.Background())
+	if processed != 0 || calls != 1 {
+		t.Fatalf("expected the second notification to wait, got processed=%d calls=%d", processed, calls)
+	}
+
+	updated := inbox.updated()
+	first, second := updated["in-1"], updated["in-2"]
+	if first.Status != domain.InboxPending || first.Attempts != 1 || first.LastError == "" {
+		t.Errorf("expected first notification to be rescheduled, got %+v", first)
+	}
+	if second.Attempts != 0 || !second.NextAttemptAt.Equal(first.NextAttemptAt) {
+		t.Errorf("expected second notification to wait for the first, got %+v", second)
+	}
+}
+
+func TestWebhookWorker_LaterNotificationWaitsForEarlierRetry(t *testing.T) {
+	base := time.Now()
+	retry := base.Add(time.Minute)
+	earlier := inboxNotification("in-1", "mp-1", base.Add(-time.Minute))
+	earlier.Attempts, earlier.NextAttemptAt = 1, retry
+	inbox := &MockInboxRepo{
+		Pending: []domain.InboxNotification{inboxNotification("in-2", "mp-1", base)},
+		Waiting: []domain.InboxNotification{earlier},
+	}
+	calls := 0
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			calls++
+			return &domain.ProviderPayment{Status: domain.StatusApproved, ExternalReference: "ext-" + id}, nil
+		},
+	}
+	worker := NewWebhookWorker(inbox, NewPaymentService(&MockRepo{}, NewProviders(mp)), 1)
+
+	processed, err := worker.ProcessPending(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if processed != 0 || calls != 0 {
+		t.Fatalf("expected the later notification to wait, got processed=%d calls=%d", processed, calls)
+	}
+	later := inbox.updated()["in-2"]
+	if later.Status != domain.InboxPending || later.Attempts != 0 || !later.NextAttemptAt.Equal(retry) {
+		t.Errorf("expected the later notification to be deferred to the earlier retry, got %+v", later)
+	}
+}
+
+func TestWebhookWorker_SkipsGroupClaimedByAnotherWorker(t *testing.T) {
+	base := time.Now()
+	inbox := &MockInboxRepo{Pending: []domain.InboxNotification{
+		inboxNotification("in-1", "mp-1", base),
+		inboxNotification("in-2", "mp-1", base.Add(time.Second)),
+		inboxNotification("in-3", "mp-2", base.Add(2*time.Second)),
+	}}
+	var claims []string
+	inbox.ClaimFunc = func(ctx context.Context, id, owner string, now, expiresAt time.Time) (domain.InboxNotification, error) {
+		claims = append(claims, id)
+		if id == "in-1" {
+			return domain.InboxNotification{}, domain.ErrInboxNotificationClaimed
+		}
+		notification := inboxNotification(id, "mp-2", base.Add(2*time.Second))
+		notification.ClaimedBy, notification.Attempts = owner, 3
+		return notification, nil
+	}
+	var lookups []string
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			lookups = append(lookups, id)
+			return &domain.ProviderPayment{Status: domain.StatusApproved, ExternalReference: "ext-" + id}, nil
+		},
+	}
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return nil, nil
+		},
+	}
+	worker := NewWebhookWorker(inbox, NewPaymentService(repo, NewProviders(mp)), 1)
+
+	processed, err := worker.ProcessPending(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if processed != 1 || len(lookups) != 1 || lookups[0] != "mp-2" {
+		t.Fatalf("expected only mp-2 to be processed, got processed=%d lookups=%v", processed, lookups)
+	}
+	if len(claims) != 2 || claims[0] != "in-1" || claims[1] != "in-3" {
+		t.Errorf("expected in-2 to wait for the worker holding in-1, got claims %v", claims)
+	}
+	updated := inbox.updated()
+	if _, ok := updated["in-2"]; ok {
+		t.Errorf("expected in-2 to be left untouched, got %+v", updated["in-2"])
+	}
+	if got := updated["in-3"]; got.Attempts != 4 || got.ClaimedBy == "" || got.Status != domain.InboxProcessed {
+		t.Errorf("expected the claimed version of in-3 to be processed, got %+v", got)
+	}
+}
+
+func TestWebhookWorker_DeadAfterMaxAttempts(t *testing.T) {
+	notification := inboxNotification("in-1", "mp-1", time.Now())
+	notification.NotificationID = "n-1"
+	notification.Attempts = webhookMaxAttempts - 1
+	inbox := &MockInboxRepo{Pending: []domain.InboxNotification{notification}}
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			return nil, errors.New("mp unavailable")
+		},
+	}
+	notifications := memory.NewNotificationStore()
+	_ = notifications.Reserve(context.Background(), domain.ProcessedNotification{Key: "mercadopago:n-1", ExpiresAt: time.Now().Add(time.Hour)})
+	svc := NewPaymentService(&MockRepo{}, NewProviders(mp), WithNotificationStore(notifications, time.Hour))
+	worker := NewWebhookWorker(inbox, svc, 1)
+
+	if _, err := worker.ProcessPending(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := inbox.updated()["in-1"]; got.Status != domain.InboxDead || got.Attempts != webhookMaxAttempts {
+		t.Errorf("expected notification to be dead, got %+v", got)
+	}
+	// Uma reentrega do gateway volta a ser aceita.
+	err := notifications.Reserve(context.Background(), domain.ProcessedNotification{Key: "mercadopago:n-1", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Errorf("expected the dead notification to be released for redelivery, got %v", err)
+	}
+}
+
+func TestWebhookWorker_Replay(t *testing.T) {
+	notifications := map[string]*domain.InboxNotification{
+		"in-1": {ID: "in-1", Status: domain.InboxDead, Attempts: webhookMaxAttempts},
+		"in-2": {ID: "in-2", Status: domain.InboxPending},
+	}
+	inbox := &MockInboxRepo{
+		GetFunc: func(ctx context.Context, id string) (*domain.InboxNotification, error) {
+			return notifications[id], nil
+		},
+	}
+	worker := NewWebhookWorker(inbox, NewPaymentService(&MockRepo{}, NewProviders(&MockProvider{})), 1)
+
+	replayed, err := worker.Replay(context.Background(), "in-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if replayed.Status != domain.InboxPending || replayed.Attempts != 0 || len(inbox.Updated) != 1 {
+		t.Errorf("expected notification back in the queue, got %+v", replayed)
+	}
+	if _, err := worker.Replay(context.Background(), "in-2"); !errors.Is(err, domain.ErrInboxNotificationNotDead) {
+		t.Errorf("expected ErrInboxNotificationNotDead, got %v", err)
+	}
+	if _, err := worker.Replay(context.Background(), "in-9"); !errors.Is(err, domain.ErrInboxNotificationNotFound) {
+		t.Errorf("expected ErrInboxNotificationNotFound, got %v", err)
+	}
+}
+
+func TestProcessWebhook_EnqueuesWithInbox(t *testing.T) {
+	mp := &MockProvider{
+		GetPaymentFunc: func(ctx context.Context, id string) (*domain.ProviderPayment, error) {
+			t.Error("expected no provider lookup when enqueuing")
+			return nil, nil
+		},
+	}
+	inbox := &MockInboxRepo{}
+	svc := NewPaymentService(&MockRepo{}, NewProviders(mp), WithWebhookInbox(inbox))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("mp-123")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(inbox.Saved) != 1 {
+		t.Fatalf("expected one enqueued notification, got %d", len(inbox.Saved))
+	}
+	saved := inbox.Saved[0]
+	if saved.PaymentID != "mp-123" || saved.Provider != "mercadopago" || saved.Status != domain.InboxPending || string(saved.Body) != `"mp-123"` {
+		t.Errorf("unexpected inbox notification: %+v", saved)
+	}
+}
+
+func TestWebhookWorker_ProcessesEnqueuedOrderNotification(t *testing.T) {
+	var change domain.StatusChange
+	repo := &MockRepo{
+		GetByExternalReferenceFunc: func(ctx context.Context, ref string) (*domain.Payment, error) {
+			return &domain.Payment{ID: "local-1", ExternalReference: ref, Status: domain.StatusPending, ProviderChargeID: "ORD1"}, nil
+		},
+		UpdateStatusFunc: func(ctx context.Context, id string, c domain.StatusChange, events ...domain.OutboxEvent) error {
+			change = c
+			return nil
+		},
+	}
+	mp := chargeWebhook("ORD1")
+	mp.GetChargeFunc = func(ctx context.Context, chargeID string) (*domain.ProviderCharge, error) {
+		return &domain.ProviderCharge{ID: chargeID, ExternalReference: "ext-1", Status: domain.StatusCancelled, RawStatus: "canceled"}, nil
+	}
+	inbox := &MockInboxRepo{}
+	svc := NewPaymentService(repo, NewProviders(mp), WithWebhookInbox(inbox))
+
+	if err := svc.ProcessWebhook(context.Background(), "mercadopago", webhookRequest("")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(inbox.Saved) != 1 || inbox.Saved[0].ChargeID != "ORD1" {
+		t.Fatalf("expected the order id in the inbox, got %+v", inbox.Saved)
+	}
+
+	inbox.Pending = inbox.Saved
+	if _, err := NewWebhookWorker(inbox, svc, 1).ProcessPending(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if change.Status != domain.StatusCancelled {
+		t.Errorf("expected the payment to be cancelled, got %+v", change)
+	}
+}
@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/alexssanderFonseca/pagamento/internal/telemetry"
+
+// AWSTracing cria um span por operação dos clientes do AWS SDK, como
+// DynamoDB.PutItem ou SNS.Publish, com as novas tentativas do SDK dentro
+// dele. Uso: awsCfg.APIOptions = append(awsCfg.APIOptions, AWSTracing(tp)).
+func AWSTracing(provider trace.TracerProvider) func(*middleware.Stack) error {
+	tracer := provider.Tracer(instrumentationName)
+
+	start := middleware.InitializeMiddlewareFunc("OTelTracing", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		service := awsmiddleware.GetServiceID(ctx)
+		operation := awsmiddleware.GetOperationName(ctx)
+		ctx, span := tracer.Start(ctx, service+"."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "aws-api"),
+				attribute.String("rpc.service", service),
+				attribute.String("rpc.method", operation),
+				attribute.String("cloud.region", awsmiddleware.GetRegion(ctx)),
+			),
+		)
+		defer span.End()
+
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+			span.SetAttributes(attribute.String("aws.request_id", requestID))
+		}
+		if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return out, metadata, err
+	})
+
+	return func(stack *middleware.Stack) error {
+		// After: o serviço e a operação são registrados pelo próprio SDK no
+		// início do passo Initialize.
+		return stack.Initialize.Add(start, middleware.After)
+	}
+}
@@ -0,0 +1,76 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAWSTracing(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected codes.Code
+	}{
+		{name: "success", status: http.StatusOK, body: `{}`, expected: codes.Unset},
+		{
+			name:     "error",
+			status:   http.StatusBadRequest,
+			body:     `{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"table not found"}`,
+			expected: codes.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				w.Header().Set("X-Amzn-Requestid", "req-1")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			recorder := tracetest.NewSpanRecorder()
+			cfg := aws.Config{
+				Region:      "us-east-1",
+				Credentials: aws.AnonymousCredentials{},
+				Retryer:     func() aws.Retryer { return aws.NopRetryer{} },
+			}
+			cfg.APIOptions = append(cfg.APIOptions, AWSTracing(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+			client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+				o.BaseEndpoint = aws.String(server.URL)
+			})
+
+			_, _ = client.DescribeTable(context.Background(), &dynamodb.DescribeTableInput{TableName: aws.String("Payments")})
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("expected one span, got %d", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != "DynamoDB.DescribeTable" {
+				t.Errorf("unexpected span name %s", span.Name())
+			}
+			if span.Status().Code != tt.expected {
+				t.Errorf("expected status %v, got %v", tt.expected, span.Status().Code)
+			}
+			attrs := attribute.NewSet(span.Attributes()...)
+			if value, _ := attrs.Value("aws.request_id"); value.AsString() != "req-1" {
+				t.Errorf("expected the request id attribute, got %q", value.AsString())
+			}
+			if value, _ := attrs.Value("http.response.status_code"); value.AsInt64() != int64(tt.status) {
+				t.Errorf("expected status code %d, got %d", tt.status, value.AsInt64())
+			}
+		})
+	}
+}
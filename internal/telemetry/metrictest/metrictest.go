@@ -0,0 +1,90 @@
+// Package metrictest lê, nos testes, as métricas gravadas em um MeterProvider
+// em memória.
+package metrictest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Reader guarda as métricas do Provider até Collect.
+type Reader struct {
+	reader   *sdkmetric.ManualReader
+	Provider *sdkmetric.MeterProvider
+}
+
+func NewReader() *Reader {
+	reader := sdkmetric.NewManualReader()
+	return &Reader{reader: reader, Provider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))}
+}
+
+// Collect retorna as métricas gravadas, por nome.
+func (r *Reader) Collect(t *testing.T) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := r.reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	metrics := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+// Int64Sum soma os pontos do contador name que têm todos os atributos
+// informados.
+func (r *Reader) Int64Sum(t *testing.T, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	m, ok := r.Collect(t)[name]
+	if !ok {
+		return 0
+	}
+	sum, ok := m.Data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("metric %s is %T, not an int64 sum", name, m.Data)
+	}
+	var total int64
+	for _, point := range sum.DataPoints {
+		if hasAttributes(point.Attributes, attrs) {
+			total += point.Value
+		}
+	}
+	return total
+}
+
+// HistogramCount conta as medições do histograma name que têm todos os
+// atributos informados.
+func (r *Reader) HistogramCount(t *testing.T, name string, attrs ...attribute.KeyValue) uint64 {
+	t.Helper()
+	m, ok := r.Collect(t)[name]
+	if !ok {
+		return 0
+	}
+	histogram, ok := m.Data.(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("metric %s is %T, not a float64 histogram", name, m.Data)
+	}
+	var count uint64
+	for _, point := range histogram.DataPoints {
+		if hasAttributes(point.Attributes, attrs) {
+			count += point.Count
+		}
+	}
+	return count
+}
+
+func hasAttributes(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if value, ok := set.Value(attr.Key); !ok || value != attr.Value {
+			return false
+		}
+	}
+	return true
+}
@@ -3,9 +3,9 @@ package telemetry
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
+	"github.com/alexssanderFonseca/pagamento/internal/config"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
@@ -16,24 +16,21 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 )
 
-func InitProvider() (func(context.Context) error, error) {
+func InitProvider(cfg config.Telemetry) (func(context.Context) error, error) {
 	ctx := context.Background()
 
 	res, err := resource.New(ctx,
 		resource.WithAttributes(
-			semconv.ServiceNameKey.String(getEnv("OTEL_SERVICE_NAME", "pagamento")),
-			semconv.ServiceVersionKey.String(getEnv("OTEL_VERSION", "1.0.0")),
-			semconv.DeploymentEnvironmentKey.String(getEnv("OTEL_ENVIRONMENT", "local")),
+			semconv.ServiceNameKey.String(cfg.ServiceName),
+			semconv.ServiceVersionKey.String(cfg.Version),
+			semconv.DeploymentEnvironmentKey.String(cfg.Environment),
 		),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	otelAgentAddr := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otelAgentAddr == "" {
-		otelAgentAddr = "localhost:4318"
-	}
+	otelAgentAddr := cfg.OTLPEndpoint
 
 	// Trace Exporter
 	traceExporter, err := otlptracehttp.New(ctx,
@@ -82,10 +79,3 @@ func InitProvider() (func(context.Context) error, error) {
 		return nil
 	}, nil
 }
-
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}